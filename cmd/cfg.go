@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/kagof/kagofunge/pkg/analysis"
+	"github.com/spf13/cobra"
+)
+
+var cfgCmd = &cobra.Command{
+	Use:   "cfg <program>",
+	Short: "Output the control-flow graph of a Befunge-93 program",
+	Example: `kagofunge cfg hello-world.bf | dot -Tsvg -o hello-world.svg
+kagofunge cfg '<> #,:# _@#:"Hello, World!"' -I --format=json`,
+	Long: `cfg will statically build the control-flow graph of a Befunge-93 program
+without running it, and write it to the output file. The graph has a node for
+each state of the instruction pointer which is reachable from (0, 0) heading
+right: its position, its direction and whether it is in string mode. Edges
+are labelled with how the instruction pointer moves between states: through
+_ and | popping zero or not, ? picking a direction, # skipping a cell, or /
+and % reflecting when dividing by zero reflects. Edges which wrap around the
+torus are marked too.
+
+The graph is built from the program as it is loaded, so it doesn't include
+states which a self-modifying program can only reach after using p.`,
+	Args:              cobra.ExactArgs(1),
+	DisableAutoGenTag: true,
+	RunE:              cfgRunE,
+}
+
+func cfgRunE(cmd *cobra.Command, args []string) error {
+	flags := *cmd.Flags()
+
+	cfg, err := getConfig(flags)
+	if err != nil {
+		return err
+	}
+	program, err := getProgram(flags, args[0])
+	if err != nil {
+		return err
+	}
+	format, err := flags.GetString("format")
+	if err != nil {
+		return err
+	}
+	if format != "dot" && format != "json" {
+		return errors.New("Unknown format " + format)
+	}
+	cmd.SilenceUsage = true // don't print usage for errors past this point
+	graph, err := analysis.NewGraph(program, cfg.Interpreter)
+	if err != nil {
+		return err
+	}
+	outputFile, err := getOutputFile(flags)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		return graph.WriteJSON(outputFile)
+	}
+	return graph.WriteDot(outputFile)
+}
+
+func init() {
+	rootCmd.AddCommand(cfgCmd)
+	cfgCmd.Flags().String("format",
+		"dot",
+		`The format to output the graph in: dot for Graphviz's 
+DOT language, or json.`)
+}
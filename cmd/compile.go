@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/pkg/compiler"
+	"github.com/spf13/cobra"
+	"io"
+)
+
+var compileCmd = &cobra.Command{
+	Use:   "compile <program>",
+	Short: "Compile a Befunge-93 program to Go, C or WebAssembly",
+	Example: `kagofunge compile hello-world.bf -o main.go
+kagofunge compile '<> #,:# _@#:"Hello, World!"' -I -o main.go
+kagofunge compile hello-world.bf --target=c -o main.c
+kagofunge compile hello-world.bf --target=wasm -o main.wasm`,
+	Long: `compile will compile a Befunge-93 program ahead of time into the source of a
+standalone Go or C99 program, or a WebAssembly module using WASI, which behaves
+the same as running it with the current interpreter config. The compiled program
+is written to the output file, and reads input from stdin and writes output to
+stdout when run.
+
+Programs which don't use p are compiled into a state machine over the
+positions and directions of the instruction pointer, while self-modifying
+programs embed a minimal interpreter along with the initial program.`,
+	Args:              cobra.ExactArgs(1),
+	DisableAutoGenTag: true,
+	RunE:              compileRunE,
+}
+
+func compileRunE(cmd *cobra.Command, args []string) error {
+	flags := *cmd.Flags()
+
+	cfg, err := getConfig(flags)
+	if err != nil {
+		return err
+	}
+	program, err := getProgram(flags, args[0])
+	if err != nil {
+		return err
+	}
+	target, err := flags.GetString("target")
+	if err != nil {
+		return err
+	}
+	var compile func(string, config.InterpreterConfig) (string, error)
+	switch target {
+	case "go":
+		compile = compiler.CompileGo
+	case "c":
+		compile = compiler.CompileC
+	case "wasm":
+		compile = compiler.CompileWasm
+	default:
+		return errors.New("Unknown target " + target)
+	}
+	cmd.SilenceUsage = true // don't print usage for errors past this point
+	source, err := compile(program, cfg.Interpreter)
+	if err != nil {
+		return err
+	}
+	outputFile, err := getOutputFile(flags)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(outputFile, source)
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(compileCmd)
+	compileCmd.Flags().String("target",
+		"go",
+		`The language to compile the program to: go for a Go 
+program, c for a C99 program, or wasm for a binary
+WebAssembly module using WASI.`)
+}
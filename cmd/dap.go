@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/kagof/kagofunge/internal/debug"
+	"github.com/spf13/cobra"
+	"net"
+	"os"
+	"strconv"
+)
+
+var dapCmd = &cobra.Command{
+	Use:   "dap",
+	Short: "Serve the Debug Adapter Protocol, for debugging Befunge-93 programs in an editor",
+	Example: `kagofunge dap
+kagofunge dap --port 4711
+kagofunge dap --dialect=98 -c debugger.history-limit=0`,
+	Long: `dap will serve the Debug Adapter Protocol, so that editors such as VSCode can
+debug Befunge-93 programs. By default, a single session is served over stdin
+and stdout. With --port, sessions are served one after another over a TCP
+port on localhost.
+
+The program to debug is given by the editor's launch configuration:
+
+  program       the path of the program to debug
+  input         the path of a file to read the program's input from
+  stopOnEntry   stop before the first instruction
+
+Each instruction pointer is shown as a thread, whose line and column are its
+y and x coordinates. Breakpoints without a column break anywhere on their
+line, and their conditions and hit counts use the same format as the debug
+command's if and hit clauses. The debug console evaluates top, depth, x, y, z
+and dir, and the debug command's commands, such as peek 3 4 or
+set stack 0 42. The rest of the configuration, such as the dialect, comes
+from the config file and flags.`,
+	Args:              cobra.NoArgs,
+	DisableAutoGenTag: true,
+	RunE:              dapRunE,
+}
+
+func dapRunE(cmd *cobra.Command, _ []string) error {
+	flags := *cmd.Flags()
+
+	config, err := getConfig(flags)
+	if err != nil {
+		return err
+	}
+	port, err := flags.GetInt("port")
+	if err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true // don't print usage for errors past this point
+	if port == 0 {
+		return debug.NewDAPServer(config, os.Stdin, os.Stdout).Serve()
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = listener.Close() }()
+	_, _ = fmt.Fprintf(os.Stderr, "listening on %s\n", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		if err := debug.NewDAPServer(config, conn, conn).Serve(); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+		}
+		_ = conn.Close()
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(dapCmd)
+	dapCmd.Flags().Int("port",
+		0,
+		`If set, serve sessions over this TCP port on
+localhost rather than over stdin and stdout.`)
+}
@@ -1,11 +1,13 @@
 package cmd
 
 import (
-	"github.com/kagof/kagofunge/internal"
+	"errors"
+	"fmt"
 	"github.com/kagof/kagofunge/internal/debug"
 	"github.com/kagof/kagofunge/pkg"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"os"
 	"time"
 )
 
@@ -14,13 +16,62 @@ var debugCmd = &cobra.Command{
 	Short: "Debug a Befunge-93 program",
 	Example: `kagofunge debug hello-world.bf --breakpoint "(0,0)"
 kagofunge debug '<> #,:# _@#:"Hello, World!"' -I -b 0,0 -b 8,0 -I -b 0,0 -b 15,0
-kagofunge debug hello-world.bf -o output.txt -i input.txt -b '[1,1]'`,
+kagofunge debug hello-world.bf -o output.txt -i input.txt -b '[1,1]'
+kagofunge debug hello-world.bf -b '22,0 if top==0' -b '18,0 hit 5'
+kagofunge debug self-modifying.bf --watch 3,0 --watch '0,2..9,2'
+kagofunge debug recursive.bf --watch-stack 'depth>100' --watch-top=-1
+kagofunge debug hello-world.bf --tui -b 8,0
+kagofunge debug random.bf --replay trace.jsonl`,
 	Long: `debug will execute a Befunge-93 program, exiting when either the program 
 terminates or an unhandled error occurs.
 
 Breakpoints can be set using the --breakpoint/-b flag, which will interrupt the 
 program's execution and display information about the current state of the 
-program to the caller.'`,
+program to the caller.'
+
+Breakpoints can be made conditional by following the position with clauses:
+  if <condition>   only interrupt when the condition holds. Conditions compare
+                   top (the value on top of the stack), depth (the size of the
+                   stack), x, y or z to an integer using ==, !=, <, <=, > or >=,
+                   or dir to east, west, north, south, high or low using == or
+                   !=. Conditions can be combined with &&
+  hit <n>          only interrupt every nth time the breakpoint is hit
+
+Watchpoints can be set using the --watch flag, which will interrupt the 
+program after p (or any other instruction that writes to the torus) puts a 
+cell, or one of a range of cells, showing the old and new values and the 
+instruction pointer which put it.
+
+Stack watches can be set using the --watch-stack and --watch-top flags, which 
+will interrupt the program whenever a condition on the stack starts to hold, 
+eg when the stack first grows deeper than 100 values.
+
+While interrupted, the debugger reads commands, such as step 10, break add 3,4, 
+print stack, set stack 0 42 or poke 3 4 'c'. Enter help to list them all. An 
+empty line steps one instruction. In a terminal, previous commands can be 
+recalled with the arrow keys and tab completes command names.
+
+back (or b) steps back one instruction and reverse-continue (or rc) steps 
+back to the previous breakpoint or watched cell being put. The number of steps 
+that can be stepped back through is set by debugger.history-limit.
+
+--tui takes over the terminal with a full-screen debugger, showing the torus, 
+the stack, breakpoints and watches, input and output in separate panes. It is 
+controlled by single keys: s or space steps, c continues, b steps back, r 
+reverse continues, t toggles a breakpoint, the arrow keys move a cursor 
+around the torus, f follows the instruction pointer again, i types input for 
+the program ahead of time, : enters a command, and q quits. While the program 
+runs, p pauses it.
+
+--replay follows a trace written by run --trace, so that a run can be stepped 
+through exactly as it happened: each ? goes the way it went in the trace, even 
+when iterated by k, FIXP's D pushes the same numbers, and & and ~ read the 
+input that was read in the trace. If the program diverges 
+from the trace, such as when the program has changed, the debugger pauses.
+
+When the program uses ?, the debugger prints the seed of its randomness as it 
+exits, and info shows it while interrupted. Rerunning with --seed makes the 
+same choices again.`,
 	Args:              cobra.ExactArgs(1),
 	DisableAutoGenTag: true,
 	RunE:              debugRunE,
@@ -41,6 +92,7 @@ func debugRunE(cmd *cobra.Command, args []string) error {
 			return err
 		}
 	}
+	exitWithCode(befunge)
 
 	return nil
 }
@@ -50,30 +102,131 @@ func getDebugger(flags pflag.FlagSet, args []string) (pkg.Stepper, error) {
 	if err != nil {
 		return nil, err
 	}
-	var breakpoints []pkg.Vector2
+	var breakpoints []*debug.Breakpoint
 	breakpoints, err = getBreakpoints(flags)
 	if err != nil {
 		return nil, err
 	}
+	var watchpoints []*debug.Watchpoint
+	watchpoints, err = getWatchpoints(flags)
+	if err != nil {
+		return nil, err
+	}
+	var stackWatches []*debug.StackWatch
+	stackWatches, err = getStackWatches(flags)
+	if err != nil {
+		return nil, err
+	}
 	var speed time.Duration
 	speed, err = flags.GetDuration("speed")
 	if err != nil {
 		return nil, err
 	}
 
-	befunge := debug.NewDebugger(config, program, outputFile, inputFile, breakpoints, speed)
+	var tui bool
+	tui, err = flags.GetBool("tui")
+	if err != nil {
+		return nil, err
+	}
+	var records []*pkg.TraceRecord
+	records, err = getReplay(flags)
+	if err != nil {
+		return nil, err
+	}
+	if records != nil {
+		inputFile = debug.ReplayInput(records)
+	}
+
+	befunge := debug.NewDebugger(config, program, outputFile, inputFile, breakpoints, watchpoints, stackWatches,
+		speed)
+	if records != nil {
+		befunge.Replay(records)
+	}
+	if tui {
+		if err := befunge.EnableTUI(); err != nil {
+			return nil, err
+		}
+	}
 	return befunge, nil
 }
 
-func getBreakpoints(flags pflag.FlagSet) ([]pkg.Vector2, error) {
+// getReplay reads the trace to replay, if there is one
+func getReplay(flags pflag.FlagSet) ([]*pkg.TraceRecord, error) {
+	path, err := flags.GetString("replay")
+	if err != nil || path == "" {
+		return nil, err
+	}
+	if flags.Changed("input") {
+		return nil, errors.New("--replay can't be used with --input, as the input is read from the trace")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Join(errors.New(fmt.Sprintf("Cannot read trace file %s", path)), err)
+	}
+	defer func() { _ = file.Close() }()
+	records, err := pkg.ReadTrace(file)
+	if err != nil {
+		return nil, err
+	}
+	if records == nil {
+		records = []*pkg.TraceRecord{}
+	}
+	return records, nil
+}
+
+func getBreakpoints(flags pflag.FlagSet) ([]*debug.Breakpoint, error) {
 	breakpointStrings, err := flags.GetStringArray("breakpoint")
 	if err != nil {
 		return nil, err
 	}
-	return internal.MapSlicePE(breakpointStrings, func(str string) (*pkg.Vector2, error) {
-		vec, err := pkg.ParseVector2(str)
-		return vec, err
-	})
+	var breakpoints []*debug.Breakpoint
+	for _, str := range breakpointStrings {
+		breakpoint, err := debug.ParseBreakpoint(str)
+		if err != nil {
+			return nil, err
+		}
+		breakpoints = append(breakpoints, breakpoint)
+	}
+	return breakpoints, nil
+}
+
+func getWatchpoints(flags pflag.FlagSet) ([]*debug.Watchpoint, error) {
+	watchpointStrings, err := flags.GetStringArray("watch")
+	if err != nil {
+		return nil, err
+	}
+	var watchpoints []*debug.Watchpoint
+	for _, str := range watchpointStrings {
+		watchpoint, err := debug.ParseWatchpoint(str)
+		if err != nil {
+			return nil, err
+		}
+		watchpoints = append(watchpoints, watchpoint)
+	}
+	return watchpoints, nil
+}
+
+func getStackWatches(flags pflag.FlagSet) ([]*debug.StackWatch, error) {
+	stackWatchStrings, err := flags.GetStringArray("watch-stack")
+	if err != nil {
+		return nil, err
+	}
+	tops, err := flags.GetStringArray("watch-top")
+	if err != nil {
+		return nil, err
+	}
+	for _, top := range tops {
+		stackWatchStrings = append(stackWatchStrings, "top=="+top)
+	}
+	var stackWatches []*debug.StackWatch
+	for _, str := range stackWatchStrings {
+		stackWatch, err := debug.ParseStackWatch(str)
+		if err != nil {
+			return nil, err
+		}
+		stackWatches = append(stackWatches, stackWatch)
+	}
+	return stackWatches, nil
 }
 
 func init() {
@@ -83,11 +236,41 @@ func init() {
 		nil,
 		`Breakpoints to set in the program while 
 executing. can be in the formats (x,y), (x y), 
-[x,y], [x y], or x,y.`)
+[x,y], [x y], or x,y. Trefunge breakpoints can 
+also have a z coordinate, eg (x,y,z). Can be 
+followed by conditions, eg '3,4 if top==0', 
+'3,4 if depth>10 && dir==west' or '3,4 hit 100'.`)
+	debugCmd.Flags().StringArray("watch",
+		nil,
+		`Cells to watch in the program while executing. 
+interrupts after a cell is put. can be a single 
+position in any of the breakpoint formats, or a 
+range of cells, eg '0,0..9,2'.`)
+	debugCmd.Flags().StringArray("watch-stack",
+		nil,
+		`Conditions to watch while executing. interrupts 
+whenever a condition starts to hold. uses the 
+breakpoint condition format, eg 'depth>10' or 
+'depth>2 && top<0'.`)
+	debugCmd.Flags().StringArray("watch-top",
+		nil,
+		`Values to watch for on top of the stack while 
+executing. interrupts whenever the value comes to the 
+top of the stack. shorthand for 
+--watch-stack 'top==<value>'.`)
 	debugCmd.Flags().DurationP("speed",
 		"s",
 		0,
 		`If set, the program will progress automatically
 at the specified speed. Should be a duration. 
 Eg 100ms, 1s`)
+	debugCmd.Flags().Bool("tui",
+		false,
+		`If set, the debugger takes over the terminal with 
+a full-screen interface, controlled by single keys.`)
+	debugCmd.Flags().String("replay",
+		"",
+		`A trace written by run --trace to follow. each ? 
+goes the way it went in the trace, and the input 
+is the input read in the trace.`)
 }
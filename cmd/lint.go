@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/kagof/kagofunge/pkg/analysis"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint <program>",
+	Short: "Report likely mistakes in a Befunge-93 program",
+	Example: `kagofunge lint hello-world.bf
+kagofunge lint '<> #,:# _@#:"Hello, World!"' -I
+kagofunge lint hello-world.bf --format=sarif -o lint.sarif`,
+	Long: `lint will statically analyse a Befunge-93 program without running it, using
+its control-flow graph, and report likely mistakes:
+
+  unreachable             cells which are never executed
+  unterminated-string     string mode which is never ended, so it wraps
+                          around the whole row or column
+  never-halts             paths which can never reach @
+  get-out-of-bounds       g with constant coordinates outside the torus
+  put-out-of-bounds       p with constant coordinates outside the torus
+  non-ascii-instruction   non-ASCII characters executed outside string mode
+
+Out of bounds g and p are errors if the configured out of bounds behaviour
+halts the program, and everything else is a warning. lint exits with code 1
+if it reports any errors.`,
+	Args:              cobra.ExactArgs(1),
+	DisableAutoGenTag: true,
+	RunE:              lintRunE,
+}
+
+func lintRunE(cmd *cobra.Command, args []string) error {
+	flags := *cmd.Flags()
+
+	cfg, err := getConfig(flags)
+	if err != nil {
+		return err
+	}
+	program, err := getProgram(flags, args[0])
+	if err != nil {
+		return err
+	}
+	inline, err := flags.GetBool("inline")
+	if err != nil {
+		return err
+	}
+	format, err := flags.GetString("format")
+	if err != nil {
+		return err
+	}
+	if format != "text" && format != "json" && format != "sarif" {
+		return errors.New("Unknown format " + format)
+	}
+	cmd.SilenceUsage = true // don't print usage for errors past this point
+	graph, err := analysis.NewGraph(program, cfg.Interpreter)
+	if err != nil {
+		return err
+	}
+	diagnostics := analysis.Lint(graph)
+	outputFile, err := getOutputFile(flags)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		err = analysis.WriteDiagnosticsJSON(outputFile, diagnostics)
+	case "sarif":
+		uri := ""
+		if !inline {
+			uri = filepath.ToSlash(args[0])
+		}
+		err = analysis.WriteSARIF(outputFile, diagnostics, uri)
+	default:
+		err = analysis.WriteDiagnostics(outputFile, diagnostics)
+	}
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(diagnostics, func(d analysis.Diagnostic) bool {
+		return d.Severity == analysis.SeverityError
+	}) {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+	lintCmd.Flags().String("format",
+		"text",
+		`The format to report diagnostics in: text to be read, 
+json, or sarif for code scanning tools.`)
+}
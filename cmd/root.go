@@ -4,16 +4,18 @@ import (
 	"errors"
 	"fmt"
 	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/pkg"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:   "kagofunge <run | debug> <program> [flags]",
+	Use:   "kagofunge <run | debug | compile | cfg | lint | dap> <program> [flags]",
 	Short: "A Befunge-93 interpreter and debugger",
 	Example: `kagofunge run hello-world.bf
 kagofunge run '<> #,:# _@#:"Hello, World!"' -I
@@ -21,9 +23,18 @@ kagofunge run hello-world.bf -o output.txt -i input.txt
 
 kagofunge debug hello-world.bf --breakpoint "(0,0)"
 kagofunge debug '<> #,:# _@#:"Hello, World!"' -I -b 0,0 -b 8,0
-kagofunge debug hello-world.bf -o output.txt -i input.txt -b '[1,1]'`,
-	Version: "0.1.0",
+kagofunge debug hello-world.bf -o output.txt -i input.txt -b '[1,1]'
+
+kagofunge compile hello-world.bf -o main.go
+
+kagofunge cfg hello-world.bf --format=json
+
+kagofunge lint hello-world.bf
+
+kagofunge dap --port 4711`,
+	Version: pkg.Version,
 	Long: `kagofunge is an interpreter and debugger for Befunge-93 written in Go.
+Funge-98 programs can be run using --dialect=98.
 For detailed usage, use kagofunge run --help or kagofunge debug --help.`,
 	DisableAutoGenTag:     true,
 	DisableFlagsInUseLine: true,
@@ -41,7 +52,7 @@ func init() {
 	rootCmd.CompletionOptions.HiddenDefaultCmd = true
 	rootCmd.SetUsageTemplate(strings.Replace(rootCmd.UsageTemplate(),
 		"{{.CommandPath}} [command]",
-		"{{.CommandPath}} <run|debug> <program> [flags]",
+		"{{.CommandPath}} <run|debug|compile|cfg|lint|dap> <program> [flags]",
 		1))
 
 	rootCmd.PersistentFlags().StringP("output", "o", "", "Output file path. Default: stdout")
@@ -54,6 +65,27 @@ func init() {
 Befunge-93 program, otherwise it is interpreted as a 
 path to a Befunge-93 program file.`)
 
+	rootCmd.PersistentFlags().StringP("dialect",
+		"d",
+		"",
+		`The dialect to interpret the program as, either 93 
+or 98. Overrides the interpreter.dialect config value.
+Default: 93`)
+
+	rootCmd.PersistentFlags().Int("dimensions",
+		0,
+		`The number of dimensions of the program: 1 for 
+Unefunge, 2 for Befunge or 3 for Trefunge. Unefunge and 
+Trefunge imply --dialect=98. Overrides the 
+interpreter.dimensions config value. Default: 2`)
+
+	rootCmd.PersistentFlags().String("seed",
+		"",
+		`Seeds the randomness of ?, so that each run of the 
+program makes the same choices. Overrides the 
+interpreter.random-seed config value. Default: a 
+different seed for each run`)
+
 	rootCmd.PersistentFlags().StringP("config-file",
 		"C",
 		"",
@@ -78,6 +110,13 @@ $HOME/.kgf/config.yml`)
 	}
 }
 
+// exitWithCode exits the process if the program requested a non-zero exit code when it terminated
+func exitWithCode(stepper pkg.Stepper) {
+	if e, ok := stepper.(interface{ ExitCode() int }); ok && e.ExitCode() != 0 {
+		os.Exit(e.ExitCode())
+	}
+}
+
 func getConfig(flags pflag.FlagSet) (*config.Config, error) {
 	path, err := flags.GetString("config-file")
 	if err != nil {
@@ -87,6 +126,34 @@ func getConfig(flags pflag.FlagSet) (*config.Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	dialect, err := flags.GetString("dialect")
+	if err != nil {
+		return nil, err
+	}
+	dimensions, err := flags.GetInt("dimensions")
+	if err != nil {
+		return nil, err
+	}
+	seed, err := flags.GetString("seed")
+	if err != nil {
+		return nil, err
+	}
+	if overrides == nil {
+		overrides = make(map[string]string)
+	}
+	if dimensions != 0 {
+		overrides["interpreter.dimensions"] = strconv.Itoa(dimensions)
+		if dimensions != 2 && dialect == "" {
+			// only Funge-98 defines Unefunge and Trefunge
+			dialect = string(config.Dialect98)
+		}
+	}
+	if dialect != "" {
+		overrides["interpreter.dialect"] = dialect
+	}
+	if seed != "" {
+		overrides["interpreter.random-seed"] = seed
+	}
 
 	return config.GetConfig(path, overrides)
 }
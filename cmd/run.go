@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"github.com/kagof/kagofunge/pkg"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"os"
 )
 
 var runCmd = &cobra.Command{
@@ -12,10 +15,19 @@ var runCmd = &cobra.Command{
 	Short:   "Run a Befunge-93 program",
 	Example: `kagofunge run hello-world.bf
 kagofunge run '<> #,:# _@#:"Hello, World!"' -I
-kagofunge run hello-world.bf -o output.txt -i input.txt`,
+kagofunge run hello-world.bf -o output.txt -i input.txt
+kagofunge run hello-world.bf --trace trace.jsonl
+kagofunge run hello-world.bf --trace trace.txt --trace-format=text --trace-depth=8
+kagofunge run random.bf --seed 42`,
 	DisableAutoGenTag: true,
 	Long: `run will execute a Befunge-93 program, exiting when either the program 
-terminates or an unhandled error occurs.`,
+terminates or an unhandled error occurs.
+
+--trace writes a record of each instruction executed to a file: the tick, the 
+instruction pointer, its position and character, its delta afterwards, whether 
+it was in string mode, the values on top of its stack afterwards, and any 
+input read or output written. Traces of the same program can be diffed to see 
+where two versions of the interpreter, or two configurations, diverge.`,
 	Args: cobra.ExactArgs(1),
 	RunE: runRunE,
 }
@@ -35,6 +47,7 @@ func runRunE(cmd *cobra.Command, args []string) error {
 			return err
 		}
 	}
+	exitWithCode(befunge)
 
 	return nil
 }
@@ -45,9 +58,74 @@ func getBefunge(flags pflag.FlagSet, args []string) (pkg.Stepper, error) {
 		return nil, err
 	}
 	befunge := pkg.NewBefunge(config, program, outputFile, inputFile)
-	return befunge, nil
+	engine, err := flags.GetString("engine")
+	if err != nil {
+		return nil, err
+	}
+	tracePath, err := flags.GetString("trace")
+	if err != nil {
+		return nil, err
+	}
+	if tracePath != "" {
+		if engine != "step" {
+			return nil, errors.New("--trace can only be used with the step engine")
+		}
+		return getTraceRecorder(flags, befunge, tracePath)
+	}
+	switch engine {
+	case "step":
+		return befunge, nil
+	case "trace":
+		return pkg.NewTraceEngine(befunge), nil
+	default:
+		return nil, errors.New("Unknown engine " + engine)
+	}
+}
+
+func getTraceRecorder(flags pflag.FlagSet, befunge *pkg.Befunge, path string) (*pkg.TraceRecorder, error) {
+	format, err := flags.GetString("trace-format")
+	if err != nil {
+		return nil, err
+	}
+	depth, err := flags.GetInt("trace-depth")
+	if err != nil {
+		return nil, err
+	}
+	if depth < 0 {
+		return nil, fmt.Errorf("Unknown trace depth %d", depth)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Join(errors.New(fmt.Sprintf("Cannot write trace file %s", path)), err)
+	}
+	writer, err := pkg.NewTraceWriter(file, pkg.TraceFormat(format))
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return pkg.NewTraceRecorder(befunge, writer, depth), nil
 }
 
 func init() {
 	rootCmd.AddCommand(runCmd)
+	runCmd.Flags().String("engine",
+		"step",
+		`The execution engine to run the program with: step
+to execute one instruction at a time, or trace to 
+compile straight-line paths through the program as 
+they are reached, which is faster for CPU heavy 
+programs.`)
+	runCmd.Flags().String("trace",
+		"",
+		`If set, write a record of each instruction executed 
+to this file.`)
+	runCmd.Flags().String("trace-format",
+		string(pkg.TraceFormatJSONL),
+		`The format of the trace: text for a line describing 
+each instruction, jsonl for a JSON object on each 
+line, or binary for a compact binary encoding.`)
+	runCmd.Flags().Int("trace-depth",
+		4,
+		`The number of values on top of the stack to record 
+in the trace after each instruction.`)
 }
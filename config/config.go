@@ -2,10 +2,12 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"github.com/goccy/go-yaml"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
 )
 
 type Config struct {
@@ -36,12 +38,39 @@ func GetConfig(fileOverride string, overrides map[string]string) (*Config, error
 	if err != nil {
 		return nil, err
 	}
+	err = config.Validate()
+	if err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
+// Validate checks the values which can't be checked alone, such as those set in the config file, which aren't mapped
+// like environment variables and overrides are
+func (c *Config) Validate() error {
+	if c.Interpreter.Dialect != Dialect93 && c.Interpreter.Dialect != Dialect98 {
+		return errors.New("Unknown dialect " + string(c.Interpreter.Dialect))
+	}
+	if c.Interpreter.Dialect != Dialect98 && c.Interpreter.Dimensions != 2 {
+		return fmt.Errorf("Unknown number of dimensions %d for dialect %s, as only Funge-98 has Unefunge and Trefunge",
+			c.Interpreter.Dimensions, c.Interpreter.Dialect)
+	}
+	if c.Interpreter.Dimensions < 1 || c.Interpreter.Dimensions > 3 {
+		return fmt.Errorf("Unknown number of dimensions %d", c.Interpreter.Dimensions)
+	}
+	if c.Debugger.HistoryLimit < 0 {
+		return fmt.Errorf("Unknown history limit %d", c.Debugger.HistoryLimit)
+	}
+	return nil
+}
+
 func DefaultConfig() Config {
 	return Config{
 		Interpreter: InterpreterConfig{
+			Dialect:                     Dialect93,
+			Dimensions:                  2,
+			CellWidth:                   CellWidth64,
+			OverflowBehaviour:           OverflowWrap,
 			DivideByZeroBehaviour:       Div0PromptForInput,
 			ModulusByZeroBehaviour:      Div0PromptForInput,
 			PutOutOfBoundsBehaviour:     OobNoOp,
@@ -49,12 +78,20 @@ func DefaultConfig() Config {
 			EnforceTorusSizeRestriction: false,
 			TorusSizeRestrictionWidth:   80,
 			TorusSizeRestrictionHeight:  25,
+			RandomSeed:                  nil,
+			Sandbox: SandboxConfig{
+				AllowedDirectories: nil,
+				AllowExec:          false,
+			},
 		},
 		Debugger: DebuggerConfig{
 			ShowTorus:            true,
 			ShowTorusCoordinates: true,
 			ShowStack:            true,
 			EnableColors:         true,
+			HistoryLimit:         10000,
+			ViewportWidth:        0,
+			ViewportHeight:       0,
 		},
 	}
 }
@@ -102,3 +139,63 @@ func div0Mapper(s string) (DivideByZeroBehaviour, error) {
 	}
 	return behaviour, nil
 }
+
+func dimensionsMapper(s string) (int, error) {
+	dimensions, err := strconv.Atoi(s)
+	if err != nil || dimensions < 1 || dimensions > 3 {
+		return 0, errors.New("Unknown number of dimensions " + s)
+	}
+	return dimensions, nil
+}
+
+func historyLimitMapper(s string) (int, error) {
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 0 {
+		return 0, errors.New("Unknown history limit " + s)
+	}
+	return limit, nil
+}
+
+func viewportMapper(s string) (int, error) {
+	size, err := strconv.Atoi(s)
+	if err != nil || size < 0 {
+		return 0, errors.New("Unknown viewport size " + s)
+	}
+	return size, nil
+}
+
+func randomSeedMapper(s string) (*uint64, error) {
+	seed, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, errors.New("Unknown random seed " + s)
+	}
+	return &seed, nil
+}
+
+func dialectMapper(s string) (Dialect, error) {
+	dialect := dialects[s]
+	if dialect == "" {
+		return "", errors.New("Unknown dialect " + s)
+	}
+	return dialect, nil
+}
+
+func directoriesMapper(s string) ([]string, error) {
+	return filepath.SplitList(s), nil
+}
+
+func cellWidthMapper(s string) (CellWidth, error) {
+	width := cellWidths[s]
+	if width == "" {
+		return "", errors.New("Unknown cell width " + s)
+	}
+	return width, nil
+}
+
+func overflowMapper(s string) (OverflowBehaviour, error) {
+	behaviour := overflowBehaviours[s]
+	if behaviour == "" {
+		return "", errors.New("Unknown overflow behaviour " + s)
+	}
+	return behaviour, nil
+}
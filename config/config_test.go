@@ -0,0 +1,80 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// configFromYaml loads a config file with the given contents
+func configFromYaml(t *testing.T, contents string) (*Config, error) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return GetConfig(path, nil)
+}
+
+func TestGetConfig_dialect(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	tests := []struct {
+		name     string
+		yaml     string
+		expected Dialect
+	}{
+		{"name", "interpreter:\n  dialect: FUNGE_98\n", Dialect98},
+		{"number", "interpreter:\n  dialect: 98\n", Dialect98},
+		{"quoted_number", "interpreter:\n  dialect: \"93\"\n", Dialect93},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			config, err := configFromYaml(t, test.yaml)
+			if asserts.NoError(err) {
+				asserts.Equal(test.expected, config.Interpreter.Dialect)
+			}
+		})
+	}
+}
+
+func TestGetConfig_invalid(t *testing.T) {
+	t.Parallel()
+	_, err := configFromYaml(t, "interpreter:\n  dialect: FUNGE_98\n  dimensions: 5\n")
+	assert.Error(t, err, "Funge-98 only has 1 to 3 dimensions")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		valid  bool
+	}{
+		{"default", func(c *Config) {}, true},
+		{"unknown_dialect", func(c *Config) { c.Interpreter.Dialect = "97" }, false},
+		{"trefunge", func(c *Config) { c.Interpreter.Dialect, c.Interpreter.Dimensions = Dialect98, 3 }, true},
+		{"93_unefunge", func(c *Config) { c.Interpreter.Dimensions = 1 }, false},
+		{"98_too_many_dimensions", func(c *Config) { c.Interpreter.Dialect, c.Interpreter.Dimensions = Dialect98, 5 }, false},
+		{"98_no_dimensions", func(c *Config) { c.Interpreter.Dialect, c.Interpreter.Dimensions = Dialect98, 0 }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			config := DefaultConfig()
+			test.modify(&config)
+			err := config.Validate()
+			if test.valid {
+				asserts.NoError(err)
+			} else {
+				asserts.Error(err)
+			}
+		})
+	}
+}
@@ -5,4 +5,7 @@ type DebuggerConfig struct {
 	ShowTorusCoordinates bool `yaml:"show-torus-coordinates"`
 	ShowStack            bool `yaml:"show-stack"`
 	EnableColors         bool `yaml:"enable-colors"`
+	HistoryLimit         int  `yaml:"history-limit"`
+	ViewportWidth        int  `yaml:"viewport-width"`
+	ViewportHeight       int  `yaml:"viewport-height"`
 }
@@ -6,6 +6,34 @@ import (
 )
 
 func overridePropsFromEnv(p *Config) error {
+	dialect, err := fromEnvOrDefault("KGF_INTERPRETER_DIALECT",
+		dialectMapper,
+		p.Interpreter.Dialect)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.Dialect = dialect
+	dimensions, err := fromEnvOrDefault("KGF_INTERPRETER_DIMENSIONS",
+		dimensionsMapper,
+		p.Interpreter.Dimensions)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.Dimensions = dimensions
+	cellWidth, err := fromEnvOrDefault("KGF_INTERPRETER_CELL_WIDTH",
+		cellWidthMapper,
+		p.Interpreter.CellWidth)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.CellWidth = cellWidth
+	overflow, err := fromEnvOrDefault("KGF_INTERPRETER_OVERFLOW_BEHAVIOUR",
+		overflowMapper,
+		p.Interpreter.OverflowBehaviour)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.OverflowBehaviour = overflow
 	div0, err := fromEnvOrDefault("KGF_INTERPRETER_DIVIDE_BY_ZERO_BEHAVIOUR",
 		div0Mapper,
 		p.Interpreter.DivideByZeroBehaviour)
@@ -41,6 +69,27 @@ func overridePropsFromEnv(p *Config) error {
 		return err
 	}
 	p.Interpreter.EnforceTorusSizeRestriction = tSize
+	seed, err := fromEnvOrDefault("KGF_INTERPRETER_RANDOM_SEED",
+		randomSeedMapper,
+		p.Interpreter.RandomSeed)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.RandomSeed = seed
+	allowedDirs, err := fromEnvOrDefault("KGF_INTERPRETER_SANDBOX_ALLOWED_DIRECTORIES",
+		directoriesMapper,
+		p.Interpreter.Sandbox.AllowedDirectories)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.Sandbox.AllowedDirectories = allowedDirs
+	allowExec, err := fromEnvOrDefault("KGF_INTERPRETER_SANDBOX_ALLOW_EXEC",
+		strconv.ParseBool,
+		p.Interpreter.Sandbox.AllowExec)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.Sandbox.AllowExec = allowExec
 
 	showT, err := fromEnvOrDefault("KGF_DEBUGGER_SHOW_TORUS",
 		strconv.ParseBool,
@@ -63,6 +112,27 @@ func overridePropsFromEnv(p *Config) error {
 		return err
 	}
 	p.Debugger.EnableColors = colors
+	historyLimit, err := fromEnvOrDefault("KGF_DEBUGGER_HISTORY_LIMIT",
+		historyLimitMapper,
+		p.Debugger.HistoryLimit)
+	if err != nil {
+		return err
+	}
+	p.Debugger.HistoryLimit = historyLimit
+	viewportWidth, err := fromEnvOrDefault("KGF_DEBUGGER_VIEWPORT_WIDTH",
+		viewportMapper,
+		p.Debugger.ViewportWidth)
+	if err != nil {
+		return err
+	}
+	p.Debugger.ViewportWidth = viewportWidth
+	viewportHeight, err := fromEnvOrDefault("KGF_DEBUGGER_VIEWPORT_HEIGHT",
+		viewportMapper,
+		p.Debugger.ViewportHeight)
+	if err != nil {
+		return err
+	}
+	p.Debugger.ViewportHeight = viewportHeight
 
 	return nil
 }
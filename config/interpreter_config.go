@@ -1,6 +1,12 @@
 package config
 
+import "fmt"
+
 type InterpreterConfig struct {
+	Dialect                     Dialect               `yaml:"dialect"`
+	Dimensions                  int                   `yaml:"dimensions"`
+	CellWidth                   CellWidth             `yaml:"cell-width"`
+	OverflowBehaviour           OverflowBehaviour     `yaml:"overflow-behaviour"`
 	DivideByZeroBehaviour       DivideByZeroBehaviour `yaml:"divide-by-zero-behaviour"`
 	ModulusByZeroBehaviour      DivideByZeroBehaviour `yaml:"modulus-by-zero-behaviour"`
 	PutOutOfBoundsBehaviour     OutOfBoundsBehaviour  `yaml:"put-out-of-bounds-behaviour"`
@@ -8,6 +14,92 @@ type InterpreterConfig struct {
 	EnforceTorusSizeRestriction bool                  `yaml:"enforce-torus-size-restriction"`
 	TorusSizeRestrictionWidth   int                   `yaml:"torus-size-restriction-width"`
 	TorusSizeRestrictionHeight  int                   `yaml:"torus-size-restriction-height"`
+	RandomSeed                  *uint64               `yaml:"random-seed"` // nil seeds each run differently
+	Sandbox                     SandboxConfig         `yaml:"sandbox"`
+}
+
+// SandboxConfig restricts what Funge-98 programs can do outside of the interpreter. By default, programs can't access
+// files with i and o, or run commands with =
+type SandboxConfig struct {
+	AllowedDirectories []string `yaml:"allowed-directories"`
+	AllowExec          bool     `yaml:"allow-exec"`
+}
+
+type Dialect string
+
+const (
+	Dialect93 Dialect = "BEFUNGE_93"
+	Dialect98 Dialect = "FUNGE_98"
+)
+
+var dialects = map[string]Dialect{
+	"BEFUNGE_93": Dialect93,
+	"FUNGE_98":   Dialect98,
+	"93":         Dialect93,
+	"98":         Dialect98,
+}
+
+// UnmarshalYAML allows the dialect to be written as 93 or 98, as it can be in environment variables and overrides
+func (d *Dialect) UnmarshalYAML(unmarshal func(any) error) error {
+	var v any
+	err := unmarshal(&v)
+	if err != nil {
+		return err
+	}
+	dialect, err := dialectMapper(fmt.Sprint(v))
+	if err != nil {
+		return err
+	}
+	*d = dialect
+	return nil
+}
+
+type CellWidth string
+
+const (
+	CellWidth8      CellWidth = "8"
+	CellWidth16     CellWidth = "16"
+	CellWidth32     CellWidth = "32"
+	CellWidth64     CellWidth = "64"
+	CellWidthBignum CellWidth = "BIGNUM"
+)
+
+var cellWidths = map[string]CellWidth{
+	"8":      CellWidth8,
+	"16":     CellWidth16,
+	"32":     CellWidth32,
+	"64":     CellWidth64,
+	"BIGNUM": CellWidthBignum,
+	"bignum": CellWidthBignum,
+}
+
+// UnmarshalYAML allows the cell width to be written as a number, eg cell-width: 32
+func (c *CellWidth) UnmarshalYAML(unmarshal func(any) error) error {
+	var v any
+	err := unmarshal(&v)
+	if err != nil {
+		return err
+	}
+	width, err := cellWidthMapper(fmt.Sprint(v))
+	if err != nil {
+		return err
+	}
+	*c = width
+	return nil
+}
+
+type OverflowBehaviour string
+
+const (
+	OverflowWrap     OverflowBehaviour = "WRAP"
+	OverflowSaturate OverflowBehaviour = "SATURATE"
+	OverflowPanic    OverflowBehaviour = "PANIC"
+)
+
+var overflowBehaviours = map[string]OverflowBehaviour{
+	"WRAP":     OverflowWrap,
+	"SATURATE": OverflowSaturate,
+	"PANIC":    OverflowPanic,
 }
 
 type DivideByZeroBehaviour string
@@ -3,6 +3,38 @@ package config
 import "strconv"
 
 func overridePropsFromMap(p *Config, overrides map[string]string) error {
+	dialect, err := fromMapOrDefault(overrides,
+		"interpreter.dialect",
+		dialectMapper,
+		p.Interpreter.Dialect)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.Dialect = dialect
+	dimensions, err := fromMapOrDefault(overrides,
+		"interpreter.dimensions",
+		dimensionsMapper,
+		p.Interpreter.Dimensions)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.Dimensions = dimensions
+	cellWidth, err := fromMapOrDefault(overrides,
+		"interpreter.cell-width",
+		cellWidthMapper,
+		p.Interpreter.CellWidth)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.CellWidth = cellWidth
+	overflow, err := fromMapOrDefault(overrides,
+		"interpreter.overflow-behaviour",
+		overflowMapper,
+		p.Interpreter.OverflowBehaviour)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.OverflowBehaviour = overflow
 	div0, err := fromMapOrDefault(overrides,
 		"interpreter.divide-by-zero-behaviour",
 		div0Mapper,
@@ -43,6 +75,30 @@ func overridePropsFromMap(p *Config, overrides map[string]string) error {
 		return err
 	}
 	p.Interpreter.EnforceTorusSizeRestriction = tSize
+	seed, err := fromMapOrDefault(overrides,
+		"interpreter.random-seed",
+		randomSeedMapper,
+		p.Interpreter.RandomSeed)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.RandomSeed = seed
+	allowedDirs, err := fromMapOrDefault(overrides,
+		"interpreter.sandbox.allowed-directories",
+		directoriesMapper,
+		p.Interpreter.Sandbox.AllowedDirectories)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.Sandbox.AllowedDirectories = allowedDirs
+	allowExec, err := fromMapOrDefault(overrides,
+		"interpreter.sandbox.allow-exec",
+		strconv.ParseBool,
+		p.Interpreter.Sandbox.AllowExec)
+	if err != nil {
+		return err
+	}
+	p.Interpreter.Sandbox.AllowExec = allowExec
 
 	showT, err := fromMapOrDefault(overrides,
 		"debugger.show-torus",
@@ -68,6 +124,30 @@ func overridePropsFromMap(p *Config, overrides map[string]string) error {
 		return err
 	}
 	p.Debugger.EnableColors = colors
+	historyLimit, err := fromMapOrDefault(overrides,
+		"debugger.history-limit",
+		historyLimitMapper,
+		p.Debugger.HistoryLimit)
+	if err != nil {
+		return err
+	}
+	p.Debugger.HistoryLimit = historyLimit
+	viewportWidth, err := fromMapOrDefault(overrides,
+		"debugger.viewport-width",
+		viewportMapper,
+		p.Debugger.ViewportWidth)
+	if err != nil {
+		return err
+	}
+	p.Debugger.ViewportWidth = viewportWidth
+	viewportHeight, err := fromMapOrDefault(overrides,
+		"debugger.viewport-height",
+		viewportMapper,
+		p.Debugger.ViewportHeight)
+	if err != nil {
+		return err
+	}
+	p.Debugger.ViewportHeight = viewportHeight
 
 	return nil
 
@@ -8,6 +8,8 @@ require (
 	github.com/spf13/cobra v1.8.1
 	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.10.0
+	github.com/tetratelabs/wazero v1.9.0
+	golang.org/x/term v0.27.0
 )
 
 require (
@@ -0,0 +1,212 @@
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kagof/kagofunge/pkg"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// the first if or hit clause, which separates the position from the rest of the breakpoint
+	regexClause = regexp.MustCompile(`\s+(if|hit)\s`)
+	// a comparison in an if clause, eg top==0 or depth > 10
+	regexComparison = regexp.MustCompile(`^(top|depth|dir|x|y|z)\s*(==|!=|<=|>=|<|>)\s*(-?\w+)`)
+	regexHit        = regexp.MustCompile(`^hit\s+(\d+)`)
+
+	directions = map[string]*pkg.Vector{
+		"east":  pkg.XPos(),
+		"west":  pkg.XNeg(),
+		"south": pkg.YPos(),
+		"north": pkg.YNeg(),
+		"high":  pkg.ZNeg(),
+		"low":   pkg.ZPos(),
+		"right": pkg.XPos(),
+		"left":  pkg.XNeg(),
+		"down":  pkg.YPos(),
+		"up":    pkg.YNeg(),
+	}
+)
+
+// Breakpoint a position which pauses the debugger when an instruction pointer reaches it. Breakpoints can have
+// conditions on the state of the instruction pointer, in which case they only pause when all of them hold, and a hit
+// count, in which case they only pause every time they have been hit that many more times
+type Breakpoint struct {
+	Position    pkg.Vector
+	comparisons []comparison
+	hitCount    int  // 0 if the breakpoint pauses every time it is hit
+	hits        int  // the number of times the conditions held when an instruction pointer reached the position
+	row         bool // whether the breakpoint is on every position in the row of its position, rather than just one
+	source      string
+}
+
+// comparison a condition on a variable of the instruction pointer's state, eg top==0
+type comparison struct {
+	variable string
+	operator string
+	value    int64
+	delta    *pkg.Vector // the direction compared against, for dir
+}
+
+// ParseBreakpoint parses a breakpoint, which is a position in any of the formats of pkg.ParseVector, followed by any
+// number of clauses:
+//   - if <comparison> [&& <comparison>...]: only pause when every comparison holds. A comparison is a variable, one of
+//     ==, !=, <, <=, > or >=, and an integer. The variables are top (the value on top of the stack, or 0 if it's
+//     empty), depth (the number of values on the stack), x, y and z. dir can also be compared to a direction with ==
+//     and !=, which is one of east, west, north, south, high or low, or equivalently right, left, up, down
+//   - hit <n>: only pause every nth time the breakpoint is hit, counting the hits where its conditions hold
+//
+// eg 3,4 if top==0, (3,4) if depth>10 && dir==west, or 3,4 hit 100
+func ParseBreakpoint(str string) (*Breakpoint, error) {
+	str = strings.TrimSpace(str)
+	position, clauses := str, ""
+	if loc := regexClause.FindStringIndex(str); loc != nil {
+		position, clauses = str[:loc[0]], strings.TrimSpace(str[loc[0]:])
+	}
+	vector, err := pkg.ParseVector(position)
+	if err != nil {
+		return nil, err
+	}
+	b := &Breakpoint{Position: *vector, source: str}
+	for clauses != "" {
+		if strings.HasPrefix(clauses, "hit") {
+			match := regexHit.FindStringSubmatch(clauses)
+			if match == nil {
+				return nil, fmt.Errorf("invalid hit count in breakpoint %s", str)
+			}
+			b.hitCount, err = strconv.Atoi(match[1])
+			if err != nil || b.hitCount == 0 {
+				return nil, fmt.Errorf("invalid hit count in breakpoint %s", str)
+			}
+			clauses = strings.TrimSpace(clauses[len(match[0]):])
+			continue
+		}
+		rest, ok := strings.CutPrefix(clauses, "if")
+		if !ok {
+			return nil, fmt.Errorf("expected if or hit in breakpoint %s, but got %s", str, clauses)
+		}
+		comparisons, rest, err := parseConditions(rest)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("invalid condition in breakpoint %s", str), err)
+		}
+		b.comparisons = append(b.comparisons, comparisons...)
+		clauses = rest
+	}
+	return b, nil
+}
+
+// parseConditions parses comparisons joined by &&, returning them and whatever follows the last of them
+func parseConditions(str string) ([]comparison, string, error) {
+	var comparisons []comparison
+	for {
+		str = strings.TrimSpace(str)
+		match := regexComparison.FindStringSubmatch(str)
+		if match == nil {
+			return nil, "", fmt.Errorf("expected a comparison, but got %s", str)
+		}
+		c, err := newComparison(match[1], match[2], match[3])
+		if err != nil {
+			return nil, "", err
+		}
+		comparisons = append(comparisons, *c)
+		str = strings.TrimSpace(str[len(match[0]):])
+		rest, ok := strings.CutPrefix(str, "&&")
+		if !ok {
+			return comparisons, str, nil
+		}
+		str = rest
+	}
+}
+
+func newComparison(variable string, operator string, value string) (*comparison, error) {
+	c := &comparison{variable: variable, operator: operator}
+	if variable == "dir" {
+		if operator != "==" && operator != "!=" {
+			return nil, fmt.Errorf("dir can only be compared with == or !=, not %s", operator)
+		}
+		delta, ok := directions[value]
+		if !ok {
+			return nil, fmt.Errorf("unknown direction %s", value)
+		}
+		c.delta = delta
+		return c, nil
+	}
+	var err error
+	c.value, err = strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be compared to an integer, not %s", variable, value)
+	}
+	return c, nil
+}
+
+// hit records an instruction pointer reaching the breakpoint's position, returning whether the debugger should pause
+func (b *Breakpoint) hit(f *pkg.Befunge, ip *pkg.IP) bool {
+	if !b.holds(f, ip) {
+		return false
+	}
+	b.hits++
+	return b.hitCount == 0 || b.hits%b.hitCount == 0
+}
+
+// at whether the breakpoint is at a position
+func (b *Breakpoint) at(position pkg.Vector) bool {
+	if b.row {
+		return b.Position.Y == position.Y && b.Position.Z == position.Z
+	}
+	return b.Position == position
+}
+
+// holds whether all the breakpoint's conditions hold for the instruction pointer, regardless of its hit count
+func (b *Breakpoint) holds(f *pkg.Befunge, ip *pkg.IP) bool {
+	for _, c := range b.comparisons {
+		if !c.holds(f, ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c comparison) holds(f *pkg.Befunge, ip *pkg.IP) bool {
+	if c.variable == "dir" {
+		return (*ip.Delta() == *c.delta) == (c.operator == "==")
+	}
+	cmp := variableValue(f, ip, c.variable).Cmp(big.NewInt(c.value))
+	switch c.operator {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// variableValue the value of one of the integer variables which conditions can compare: top, depth, x, y or z
+func variableValue(f *pkg.Befunge, ip *pkg.IP, variable string) *big.Int {
+	switch variable {
+	case "top":
+		top, _ := ip.Stack.Peek()
+		return f.CellValue(top)
+	case "depth":
+		return big.NewInt(int64(len(ip.Stack.Values)))
+	case "x":
+		return big.NewInt(int64(ip.InstructionPointer.X))
+	case "y":
+		return big.NewInt(int64(ip.InstructionPointer.Y))
+	default:
+		return big.NewInt(int64(ip.InstructionPointer.Z))
+	}
+}
+
+func (b *Breakpoint) String() string {
+	return b.source
+}
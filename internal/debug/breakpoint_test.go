@@ -0,0 +1,135 @@
+package debug
+
+import (
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/pkg"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestParseBreakpoint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		breakpoint  string
+		position    pkg.Vector
+		comparisons int
+		hitCount    int
+		valid       bool
+	}{
+		{"position", "3,4", *pkg.NewVector2(3, 4), 0, 0, true},
+		{"parenthesised_position", "(3 4)", *pkg.NewVector2(3, 4), 0, 0, true},
+		{"trefunge_position", "(3,4,5) if z==5", *pkg.NewVector3(3, 4, 5), 1, 0, true},
+		{"condition", "3,4 if top==0", *pkg.NewVector2(3, 4), 1, 0, true},
+		{"condition_spaces", "(3, 4) if depth > 10", *pkg.NewVector2(3, 4), 1, 0, true},
+		{"negative", "3,4 if top>=-1", *pkg.NewVector2(3, 4), 1, 0, true},
+		{"direction", "3,4 if dir==west", *pkg.NewVector2(3, 4), 1, 0, true},
+		{"conjunction", "3,4 if top!=0 && dir!=up && x<4", *pkg.NewVector2(3, 4), 3, 0, true},
+		{"hit_count", "3,4 hit 100", *pkg.NewVector2(3, 4), 0, 100, true},
+		{"condition_and_hit_count", "3,4 if top==0 hit 5", *pkg.NewVector2(3, 4), 1, 5, true},
+		{"hit_count_and_condition", "3,4 hit 5 if top==0", *pkg.NewVector2(3, 4), 1, 5, true},
+		{"invalid_position", "a,b if top==0", pkg.Vector{}, 0, 0, false},
+		{"unknown_variable", "3,4 if foo==0", pkg.Vector{}, 0, 0, false},
+		{"unknown_direction", "3,4 if dir==sideways", pkg.Vector{}, 0, 0, false},
+		{"direction_ordering", "3,4 if dir<west", pkg.Vector{}, 0, 0, false},
+		{"not_an_integer", "3,4 if top==west", pkg.Vector{}, 0, 0, false},
+		{"zero_hit_count", "3,4 hit 0", pkg.Vector{}, 0, 0, false},
+		{"missing_hit_count", "3,4 hit x", pkg.Vector{}, 0, 0, false},
+		{"dangling_conjunction", "3,4 if top==0 &&", pkg.Vector{}, 0, 0, false},
+		{"trailing_clause", "3,4 if top==0 unless", pkg.Vector{}, 0, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+
+			b, err := ParseBreakpoint(test.breakpoint)
+			if !test.valid {
+				asserts.Error(err)
+				return
+			}
+			if !asserts.NoError(err) {
+				return
+			}
+			asserts.Equal(test.position, b.Position)
+			asserts.Len(b.comparisons, test.comparisons)
+			asserts.Equal(test.hitCount, b.hitCount)
+			asserts.Equal(test.breakpoint, b.String())
+		})
+	}
+}
+
+func TestBreakpoint_hit(t *testing.T) {
+	t.Parallel()
+
+	// counts down from 3 to 0, reaching the > at (1,0) on steps 1, 10, 19 and 28 with 3, 2, 1 and 0 on top of the stack
+	const countdown = "3>:#v_@\n ^-1<"
+
+	tests := []struct {
+		name       string
+		funge      string
+		breakpoint string
+		// the number of the steps, counting from 0, before which the breakpoint pauses
+		expected []int
+	}{
+		{"unconditional", countdown, "1,0", []int{1, 10, 19, 28}},
+		{"top", countdown, "1,0 if top==1", []int{19}},
+		{"top_empty_stack", "1$@", "2,0 if top==0", []int{2}},
+		{"depth", "123@", "3,0 if depth>2", []int{3}},
+		{"direction", "v\n>v\n^<", "0,1 if dir==north", []int{5, 9, 13, 17, 21, 25, 29, 33, 37}},
+		{"direction_not", "v\n>v\n^<", "0,1 if dir!=north", []int{1}},
+		{"hit_count", countdown, "1,0 hit 2", []int{10, 28}},
+		{"hit_count_counts_when_condition_holds", countdown, "1,0 if top<3 hit 2", []int{19}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+
+			b, err := ParseBreakpoint(test.breakpoint)
+			if !asserts.NoError(err) {
+				return
+			}
+			cfg := config.DefaultConfig()
+			befunge := pkg.NewBefunge(&cfg, test.funge, &strings.Builder{}, strings.NewReader(""))
+			var paused []int
+			for i := range 40 {
+				ip := befunge.IPs[0]
+				if b.Position == *ip.InstructionPointer && b.hit(befunge, ip) {
+					paused = append(paused, i)
+				}
+				hasNext, err := befunge.Step()
+				if !asserts.NoError(err) || !hasNext {
+					break
+				}
+			}
+			asserts.Equal(test.expected, paused)
+		})
+	}
+}
+
+func TestBreakpoint_hitTrefunge(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	// h sends the instruction pointer high, wrapping around to the @ on the last layer
+	b, err := ParseBreakpoint("0,0,1 if dir==high")
+	if !asserts.NoError(err) {
+		return
+	}
+	cfg := config.DefaultConfig()
+	cfg.Interpreter.Dialect = config.Dialect98
+	cfg.Interpreter.Dimensions = 3
+	befunge := pkg.NewBefunge(&cfg, "h\f@", &strings.Builder{}, strings.NewReader(""))
+	_, err = befunge.Step()
+	if !asserts.NoError(err) {
+		return
+	}
+	ip := befunge.IPs[0]
+	asserts.Equal(b.Position, *ip.InstructionPointer)
+	asserts.True(b.hit(befunge, ip), "h should move the instruction pointer high")
+}
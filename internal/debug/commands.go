@@ -0,0 +1,572 @@
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kagof/kagofunge/pkg"
+	"maps"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// command a command which can be entered while the debugger is interrupted
+type command struct {
+	name        string
+	aliases     []string
+	usage       string // the arguments the command takes
+	description string
+	subcommands []string // completed after the command's name
+	moves       bool     // whether the command runs, steps back or stops the program, rather than looking at its state
+	// run performs the command, returning whether the program should carry on running
+	run func(d *Debugger, args []string) (bool, error)
+}
+
+// commands every command, in the order they are listed by help. These are set in init, as help refers to them
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			name:        "step",
+			aliases:     []string{"s"},
+			usage:       "[n]",
+			description: "step forwards n instructions, or 1 if n isn't given. An empty line also steps",
+			moves:       true,
+			run: func(d *Debugger, args []string) (bool, error) {
+				n, err := parseCount(args)
+				if err != nil {
+					return false, err
+				}
+				d.stepMode, d.stepsLeft = true, n
+				return true, nil
+			},
+		},
+		{
+			name:        "back",
+			aliases:     []string{"b"},
+			usage:       "[n]",
+			description: "step back n instructions, or 1 if n isn't given",
+			moves:       true,
+			run: func(d *Debugger, args []string) (bool, error) {
+				n, err := parseCount(args)
+				if err != nil {
+					return false, err
+				}
+				if err := d.canStepBack(); err != nil {
+					return false, err
+				}
+				for range n {
+					if d.stepBack() == nil {
+						break
+					}
+				}
+				return false, nil
+			},
+		},
+		{
+			name:        "continue",
+			aliases:     []string{"c"},
+			description: "continue until a breakpoint or watch interrupts the program",
+			moves:       true,
+			run: func(d *Debugger, args []string) (bool, error) {
+				d.stepMode = false
+				return true, nil
+			},
+		},
+		{
+			name:        "reverse-continue",
+			aliases:     []string{"rc"},
+			description: "step back until a breakpoint is reached, or until just before a watched cell is put",
+			moves:       true,
+			run: func(d *Debugger, args []string) (bool, error) {
+				if err := d.canStepBack(); err != nil {
+					return false, err
+				}
+				d.reverseContinue()
+				return false, nil
+			},
+		},
+		{
+			name:        "jump",
+			aliases:     []string{"j"},
+			description: "with --speed, continue at full speed until a breakpoint or watch interrupts the program",
+			moves:       true,
+			run: func(d *Debugger, args []string) (bool, error) {
+				d.jumping, d.stepMode = true, false
+				return true, nil
+			},
+		},
+		{
+			name:        "break",
+			usage:       "add <breakpoint> | del <n> | list",
+			description: "add, delete or list breakpoints, in the same format as --breakpoint",
+			subcommands: []string{"add", "del", "list"},
+			run: func(d *Debugger, args []string) (bool, error) {
+				subcommand, rest := subcommand(args)
+				switch subcommand {
+				case "add":
+					b, err := ParseBreakpoint(strings.Join(rest, " "))
+					if err != nil {
+						return false, err
+					}
+					d.breakpoints = append(d.breakpoints, b)
+					d.message("breakpoint %d: %s", len(d.breakpoints), b)
+				case "del":
+					i, err := parseIndex(rest, len(d.breakpoints))
+					if err != nil {
+						return false, err
+					}
+					d.message("deleted breakpoint %d: %s", i+1, d.breakpoints[i])
+					d.breakpoints = slices.Delete(d.breakpoints, i, i+1)
+				case "list":
+					if len(d.breakpoints) == 0 {
+						d.message("no breakpoints")
+					}
+					for i, b := range d.breakpoints {
+						d.message("breakpoint %d: %s", i+1, b)
+					}
+				default:
+					return false, errors.New("usage: break add <breakpoint> | del <n> | list")
+				}
+				return false, nil
+			},
+		},
+		{
+			name:        "watch",
+			usage:       "cells <cells> | stack <condition> | top <value> | del <n> | list",
+			description: "add, delete or list watches, in the same formats as --watch, --watch-stack and --watch-top",
+			subcommands: []string{"cells", "stack", "top", "del", "list"},
+			run: func(d *Debugger, args []string) (bool, error) {
+				subcommand, rest := subcommand(args)
+				switch subcommand {
+				case "cells":
+					w, err := ParseWatchpoint(strings.Join(rest, " "))
+					if err != nil {
+						return false, err
+					}
+					d.watchpoints = append(d.watchpoints, w)
+				case "stack", "top":
+					condition := strings.Join(rest, " ")
+					if subcommand == "top" {
+						condition = "top==" + condition
+					}
+					w, err := ParseStackWatch(condition)
+					if err != nil {
+						return false, err
+					}
+					d.stackWatches = append(d.stackWatches, w)
+				case "del":
+					i, err := parseIndex(rest, len(d.watchpoints)+len(d.stackWatches))
+					if err != nil {
+						return false, err
+					}
+					d.message("deleted watch %d: %s", i+1, d.watchString(i))
+					if i < len(d.watchpoints) {
+						d.watchpoints = slices.Delete(d.watchpoints, i, i+1)
+					} else {
+						i -= len(d.watchpoints)
+						d.stackWatches = slices.Delete(d.stackWatches, i, i+1)
+					}
+					return false, nil
+				case "list":
+				default:
+					return false, errors.New("usage: watch cells <cells> | stack <condition> | top <value> | del <n> | list")
+				}
+				if len(d.watchpoints)+len(d.stackWatches) == 0 {
+					d.message("no watches")
+				}
+				for i := range len(d.watchpoints) + len(d.stackWatches) {
+					d.message("watch %d: %s", i+1, d.watchString(i))
+				}
+				return false, nil
+			},
+		},
+		{
+			name:        "print",
+			aliases:     []string{"p"},
+			usage:       "stack | ips | torus | output",
+			description: "print part of the state of the program, even if the debugger config hides it",
+			subcommands: []string{"stack", "ips", "torus", "output"},
+			run: func(d *Debugger, args []string) (bool, error) {
+				subcommand, _ := subcommand(args)
+				switch subcommand {
+				case "stack":
+					d.message("%s", strings.TrimSuffix(d.stacksString(), "\n"))
+				case "ips":
+					for _, ip := range d.befunge.IPs {
+						d.message("%s", d.ipString(ip))
+					}
+				case "torus":
+					d.message("%s", d.torusToString())
+				case "output":
+					d.message("%q", d.output.String())
+				default:
+					return false, errors.New("usage: print stack | ips | torus | output")
+				}
+				return false, nil
+			},
+		},
+		{
+			name:        "set",
+			usage:       "stack <depth> <value>",
+			description: "set the value at a depth of the stack, where 0 is the top. Values can be integers or characters, eg 'a'",
+			subcommands: []string{"stack"},
+			run: func(d *Debugger, args []string) (bool, error) {
+				subcommand, rest := subcommand(args)
+				if subcommand != "stack" || len(rest) != 2 {
+					return false, errors.New("usage: set stack <depth> <value>")
+				}
+				values := d.befunge.Stack.Values
+				if len(values) == 0 {
+					return false, errors.New("the stack is empty")
+				}
+				depth, err := strconv.Atoi(rest[0])
+				if err != nil || depth < 0 || depth >= len(values) {
+					return false, fmt.Errorf("depth must be between 0 and %d, not %s", len(values)-1, rest[0])
+				}
+				v, err := d.parseValue(rest[1])
+				if err != nil {
+					return false, err
+				}
+				values[len(values)-1-depth] = v
+				return false, nil
+			},
+		},
+		{
+			name:        "poke",
+			usage:       "<x> <y> <value>",
+			description: "put a value into a cell. Values can be integers or characters, eg 'a'",
+			run: func(d *Debugger, args []string) (bool, error) {
+				position, rest, err := d.parsePosition(args)
+				if err != nil {
+					return false, err
+				}
+				if len(rest) != 1 {
+					return false, errors.New("usage: poke <x> <y> <value>")
+				}
+				c, err := parseSpaceValue(rest[0])
+				if err != nil {
+					return false, err
+				}
+				d.befunge.Space.Put(position, c)
+				return false, nil
+			},
+		},
+		{
+			name:        "peek",
+			usage:       "<x> <y>",
+			description: "print the value of a cell",
+			run: func(d *Debugger, args []string) (bool, error) {
+				position, rest, err := d.parsePosition(args)
+				if err != nil {
+					return false, err
+				}
+				if len(rest) != 0 {
+					return false, errors.New("usage: peek <x> <y>")
+				}
+				c := d.befunge.Space.Get(position)
+				d.message("%s: %q (%d)", position, c, c)
+				return false, nil
+			},
+		},
+		{
+			name:        "goto",
+			usage:       "<x> <y>",
+			description: "move the instruction pointer to a cell",
+			run: func(d *Debugger, args []string) (bool, error) {
+				position, rest, err := d.parsePosition(args)
+				if err != nil {
+					return false, err
+				}
+				if len(rest) != 0 {
+					return false, errors.New("usage: goto <x> <y>")
+				}
+				d.befunge.InstructionPointer = position
+				return false, nil
+			},
+		},
+		{
+			name:        "dir",
+			usage:       "<direction>",
+			description: "change the direction of the instruction pointer to east, west, north, south, high or low, or to a vector, eg (1,1)",
+			subcommands: slices.Sorted(maps.Keys(directions)),
+			run: func(d *Debugger, args []string) (bool, error) {
+				if len(args) != 1 {
+					return false, errors.New("usage: dir <direction>")
+				}
+				delta, ok := directions[args[0]]
+				if !ok {
+					var err error
+					if delta, err = pkg.ParseVector(args[0]); err != nil {
+						return false, fmt.Errorf("unknown direction %s", args[0])
+					}
+				}
+				if (d.befunge.Dimensions() < 3 && delta.Z != 0) || (d.befunge.Dimensions() < 2 && delta.Y != 0) {
+					return false, fmt.Errorf("%s can't be used with %d dimensions", args[0], d.befunge.Dimensions())
+				}
+				d.befunge.SetDelta(delta)
+				return false, nil
+			},
+		},
+		{
+			name:        "info",
+			description: "print the state of the instruction pointers and the debugger",
+			run: func(d *Debugger, args []string) (bool, error) {
+				for _, ip := range d.befunge.IPs {
+					d.message("%s", d.ipString(ip))
+				}
+				d.message("steps: %d", d.steps)
+				d.message("history: %d of %d steps", len(d.history), d.config.HistoryLimit)
+				d.message("breakpoints: %d, watches: %d", len(d.breakpoints), len(d.watchpoints)+len(d.stackWatches))
+				d.message("random seed: %d", d.random.seed)
+				if d.replay != nil {
+					d.message("replay: %s", d.replay)
+				}
+				return false, nil
+			},
+		},
+		{
+			name:        "help",
+			aliases:     []string{"h", "?"},
+			usage:       "[command]",
+			description: "list the commands, or describe one of them",
+			run: func(d *Debugger, args []string) (bool, error) {
+				if len(args) > 0 {
+					c, ok := findCommand(args[0])
+					if !ok {
+						return false, fmt.Errorf("unknown command %s", args[0])
+					}
+					d.message("%s %s", c.name, c.usage)
+					d.message("  %s", c.description)
+					if len(c.aliases) > 0 {
+						d.message("  aliases: %s", strings.Join(c.aliases, ", "))
+					}
+					return false, nil
+				}
+				for _, c := range commands {
+					d.message("%-36s %s", c.name+" "+c.usage, c.description)
+				}
+				return false, nil
+			},
+		},
+		{
+			name:        "quit",
+			aliases:     []string{"q", "exit"},
+			description: "stop the program and exit the debugger",
+			moves:       true,
+			run: func(d *Debugger, args []string) (bool, error) {
+				d.quitting = true
+				return true, nil
+			},
+		},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name || slices.Contains(c.aliases, name) {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// execute runs a line entered while the debugger is interrupted, returning whether the program should carry on running
+func (d *Debugger) execute(line string) bool {
+	args := splitArgs(line)
+	if len(args) == 0 {
+		d.stepMode, d.stepsLeft = true, 1
+		return true
+	}
+	c, ok := findCommand(strings.ToLower(args[0]))
+	if !ok {
+		d.message("unknown command %s. Enter help to list the commands", args[0])
+		return false
+	}
+	resume, err := c.run(d, args[1:])
+	if err != nil {
+		d.message("%s", d.colorOrNot(red, noColor).Sprint(err))
+	}
+	return resume
+}
+
+// complete completes the command, or its subcommand, being typed when tab is pressed
+func (d *Debugger) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	before := line[:pos]
+	words := strings.Fields(before)
+	if len(words) == 0 || strings.HasSuffix(before, " ") {
+		words = append(words, "")
+	}
+	partial := words[len(words)-1]
+	var candidates []string
+	switch len(words) {
+	case 1:
+		for _, c := range commands {
+			candidates = append(candidates, c.name)
+		}
+	case 2:
+		if c, ok := findCommand(words[0]); ok && c.name == "help" {
+			for _, c := range commands {
+				candidates = append(candidates, c.name)
+			}
+		} else if ok {
+			candidates = c.subcommands
+		}
+	}
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, partial) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	completion := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	if len(matches) == 1 {
+		completion += " "
+	}
+	completed := before[:len(before)-len(partial)] + completion
+	return completed + line[pos:], len(completed), true
+}
+
+// message adds a line to show below the state of the program the next time it is shown
+func (d *Debugger) message(format string, a ...any) {
+	d.messages = append(d.messages, fmt.Sprintf(format, a...))
+}
+
+// watchString describes the watch at the index, counting the watchpoints and then the stack watches
+func (d *Debugger) watchString(i int) string {
+	if i < len(d.watchpoints) {
+		return "cells " + d.watchpoints[i].String()
+	}
+	return "stack " + d.stackWatches[i-len(d.watchpoints)].String()
+}
+
+// splitArgs splits a line into its arguments, which are separated by whitespace. A quoted character, such as ' ', is
+// always a single argument
+func splitArgs(line string) []string {
+	var args []string
+	var arg strings.Builder
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if r == '\'' && arg.Len() == 0 {
+			// a quote followed by any character and another quote
+			if _, n := utf8.DecodeRuneInString(line[i+size:]); i+size+n < len(line) && line[i+size+n] == '\'' {
+				args = append(args, line[i:i+size+n+1])
+				i += size + n + 1
+				continue
+			}
+		}
+		if unicode.IsSpace(r) {
+			if arg.Len() > 0 {
+				args = append(args, arg.String())
+				arg.Reset()
+			}
+		} else {
+			arg.WriteRune(r)
+		}
+		i += size
+	}
+	if arg.Len() > 0 {
+		args = append(args, arg.String())
+	}
+	return args
+}
+
+func subcommand(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	return strings.ToLower(args[0]), args[1:]
+}
+
+// parseCount parses an optional count of at least 1, which defaults to 1
+func parseCount(args []string) (int, error) {
+	if len(args) == 0 {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || len(args) > 1 {
+		return 0, fmt.Errorf("expected a count of at least 1, not %s", strings.Join(args, " "))
+	}
+	return n, nil
+}
+
+// parseIndex parses a 1-based index into a list of the given length, returning it 0-based
+func parseIndex(args []string, length int) (int, error) {
+	if len(args) != 1 {
+		return 0, errors.New("expected the number of the item to delete")
+	}
+	i, err := strconv.Atoi(args[0])
+	if err != nil || i < 1 || i > length {
+		return 0, fmt.Errorf("there is no number %s", args[0])
+	}
+	return i - 1, nil
+}
+
+// parsePosition parses a coordinate for each dimension of funge-space, returning the position and the rest of the
+// arguments
+func (d *Debugger) parsePosition(args []string) (*pkg.Vector, []string, error) {
+	dimensions := d.befunge.Dimensions()
+	if len(args) < dimensions {
+		return nil, nil, fmt.Errorf("expected %d coordinates", dimensions)
+	}
+	var coordinates [3]int
+	for i, arg := range args[:dimensions] {
+		var err error
+		if coordinates[i], err = strconv.Atoi(arg); err != nil {
+			return nil, nil, fmt.Errorf("expected %d coordinates, but %s isn't an integer", dimensions, arg)
+		}
+	}
+	position := pkg.NewVector3(coordinates[0], coordinates[1], coordinates[2])
+	if !d.befunge.Space.Contains(position) {
+		return nil, nil, fmt.Errorf("%s is outside funge-space", position)
+	}
+	return position, args[dimensions:], nil
+}
+
+// parseValue parses a stack cell, which is either an integer or a quoted character
+func (d *Debugger) parseValue(str string) (int, error) {
+	if r, ok := parseChar(str); ok {
+		return int(r), nil
+	}
+	v, ok := new(big.Int).SetString(str, 10)
+	if !ok {
+		return 0, fmt.Errorf("expected an integer or a character, eg 'a', not %s", str)
+	}
+	return d.befunge.Cell(v)
+}
+
+// parseSpaceValue parses a funge-space cell, which is either an integer or a quoted character
+func parseSpaceValue(str string) (rune, error) {
+	if r, ok := parseChar(str); ok {
+		return r, nil
+	}
+	v, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || v < math.MinInt32 || v > math.MaxInt32 {
+		return 0, fmt.Errorf("expected a 32 bit integer or a character, eg 'a', not %s", str)
+	}
+	return rune(v), nil
+}
+
+func parseChar(str string) (rune, bool) {
+	r, size := utf8.DecodeRuneInString(strings.TrimPrefix(str, "'"))
+	if len(str) != size+2 || str[0] != '\'' || str[len(str)-1] != '\'' {
+		return 0, false
+	}
+	return r, true
+}
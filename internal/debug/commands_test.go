@@ -0,0 +1,173 @@
+package debug
+
+import (
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/pkg"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"step", []string{"step"}},
+		{"step 2\n", []string{"step", "2"}},
+		{"  break  add 1,2 ", []string{"break", "add", "1,2"}},
+		{"poke 1 2 ' '", []string{"poke", "1", "2", "' '"}},
+		{"poke 1 2 'ü'", []string{"poke", "1", "2", "'ü'"}},
+		{"poke 1 2 '", []string{"poke", "1", "2", "'"}},
+		{"break\tadd 1,2 if top=='a'", []string{"break", "add", "1,2", "if", "top=='a'"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.expected, splitArgs(test.line))
+		})
+	}
+}
+
+func TestDebugger_execute(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		lines  []string
+		resume bool // whether the last line resumes the program
+		// check asserts the state of the debugger after the lines have been executed
+		check func(asserts *assert.Assertions, d *Debugger)
+	}{
+		{"empty line steps", []string{""}, true, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.True(d.stepMode)
+			asserts.Equal(1, d.stepsLeft)
+		}},
+		{"step n", []string{"step 5"}, true, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.True(d.stepMode)
+			asserts.Equal(5, d.stepsLeft)
+		}},
+		{"step invalid", []string{"s 0"}, false, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.Equal([]string{"expected a count of at least 1, not 0"}, d.messages)
+		}},
+		{"continue", []string{"c"}, true, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.False(d.stepMode)
+		}},
+		{"unknown command", []string{"frobnicate"}, false, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.Equal([]string{"unknown command frobnicate. Enter help to list the commands"}, d.messages)
+		}},
+		{"break add, del and list", []string{"break add 1,0", "break add 2,0 if top==1", "break del 1", "break list"},
+			false, func(asserts *assert.Assertions, d *Debugger) {
+				asserts.Len(d.breakpoints, 1)
+				asserts.Equal([]string{"breakpoint 1: 1,0", "breakpoint 2: 2,0 if top==1",
+					"deleted breakpoint 1: 1,0", "breakpoint 1: 2,0 if top==1"}, d.messages)
+			}},
+		{"break del missing", []string{"break del 1"}, false, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.Equal([]string{"there is no number 1"}, d.messages)
+		}},
+		{"watch cells, top and del", []string{"watch cells 0,0..1,1", "watch top 97", "watch del 1"}, false,
+			func(asserts *assert.Assertions, d *Debugger) {
+				asserts.Empty(d.watchpoints)
+				asserts.Len(d.stackWatches, 1)
+				asserts.Equal("deleted watch 1: cells 0,0..1,1", d.messages[len(d.messages)-1])
+			}},
+		{"set stack", []string{"set stack 1 42", "set stack 0 'a'"}, false,
+			func(asserts *assert.Assertions, d *Debugger) {
+				asserts.Equal([]int{42, 'a'}, d.befunge.Stack.Values)
+			}},
+		{"set stack too deep", []string{"set stack 2 42"}, false, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.Equal([]int{1, 2}, d.befunge.Stack.Values)
+			asserts.Equal([]string{"depth must be between 0 and 1, not 2"}, d.messages)
+		}},
+		{"poke and peek", []string{"poke 3 0 'x'", "peek 3 0", "poke 3 0 65", "peek 3 0"}, false,
+			func(asserts *assert.Assertions, d *Debugger) {
+				asserts.Equal([]string{"(3,0): 'x' (120)", "(3,0): 'A' (65)"}, d.messages)
+			}},
+		{"peek outside", []string{"peek 100 0"}, false, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.Equal([]string{"(100,0) is outside funge-space"}, d.messages)
+		}},
+		{"goto", []string{"goto 4 0"}, false, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.Equal(*pkg.NewVector2(4, 0), *d.befunge.InstructionPointer)
+		}},
+		{"dir", []string{"dir west"}, false, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.Equal(*pkg.NewVector2(-1, 0), *d.befunge.Delta())
+		}},
+		{"dir vector", []string{"dir (1,1)"}, false, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.Equal(*pkg.NewVector2(1, 1), *d.befunge.Delta())
+		}},
+		{"dir high in 2 dimensions", []string{"dir high"}, false, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.Equal([]string{"high can't be used with 2 dimensions"}, d.messages)
+		}},
+		{"help command", []string{"help s"}, false, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.Equal("step [n]", d.messages[0])
+		}},
+		{"help", []string{"?"}, false, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.Len(d.messages, len(commands))
+		}},
+		{"quit", []string{"q"}, true, func(asserts *assert.Assertions, d *Debugger) {
+			asserts.True(d.quitting)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+
+			cfg := config.DefaultConfig()
+			cfg.Debugger.EnableColors = false
+			d := NewDebugger(&cfg, "12..@", &strings.Builder{}, strings.NewReader(""), nil, nil, nil, 0)
+			for range 2 {
+				_, err := d.step()
+				asserts.NoError(err)
+			}
+			var resume bool
+			for _, line := range test.lines {
+				resume = d.execute(line)
+			}
+			asserts.Equal(test.resume, resume)
+			test.check(asserts, d)
+		})
+	}
+}
+
+func TestDebugger_complete(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		line     string
+		expected string
+		ok       bool
+	}{
+		{"", "", true}, // the common prefix of every command is empty
+		{"ste", "step ", true},
+		{"re", "reverse-continue ", true},
+		{"p", "p", true}, // print, poke and peek
+		{"pe", "peek ", true},
+		{"break ", "break ", true},
+		{"break a", "break add ", true},
+		{"watch s", "watch stack ", true},
+		{"dir e", "dir east ", true},
+		{"help wa", "help watch ", true},
+		{"xyz", "", false},
+		{"break add 1", "", false},
+	}
+
+	cfg := config.DefaultConfig()
+	d := NewDebugger(&cfg, "@", &strings.Builder{}, strings.NewReader(""), nil, nil, nil, 0)
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+			line, pos, ok := d.complete(test.line, len(test.line), '\t')
+			asserts.Equal(test.ok, ok)
+			asserts.Equal(test.expected, line)
+			asserts.Equal(len(test.expected), pos)
+		})
+	}
+}
@@ -0,0 +1,657 @@
+package debug
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/internal"
+	"github.com/kagof/kagofunge/pkg"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DAPServer serves a debugging session over the Debug Adapter Protocol, so that editors can debug a program with the
+// same breakpoints, stepping and commands as the terminal debugger. Each instruction pointer is a thread, whose only
+// stack frame is at its position, with the line and column of the frame being its y and x coordinates
+type DAPServer struct {
+	config  *config.Config
+	reader  *bufio.Reader
+	writer  io.Writer
+	writing sync.Mutex // guards writer and seq, as events are sent while the program runs in the background
+	seq     int
+
+	lineBase   int  // 1 if lines start at 1, as they do unless the client says otherwise
+	columnBase int  // 1 if columns start at 1, as they do unless the client says otherwise
+	invalidate bool // whether the client supports invalidated events
+
+	// the rest is guarded by state, as the program is stepped in the background until it stops
+	state         sync.Mutex
+	debugger      *Debugger     // nil until the program is launched
+	breakpoints   []*Breakpoint // the breakpoints set in the editor, rather than with the break command
+	source        dapSource
+	stopOnEntry   bool
+	noDebug       bool
+	configured    bool
+	started       bool
+	finished      bool
+	sent          int                    // how much of the program's output has been sent in output events
+	handles       []func() []dapVariable // the variables of each variablesReference, until the program is resumed
+	afterResponse func()                 // run after the response to the current request has been sent
+
+	running atomic.Bool
+	pausing atomic.Bool
+	wait    sync.WaitGroup
+}
+
+// the handler of each request the server supports
+var dapHandlers = map[string]func(s *DAPServer, arguments json.RawMessage) (any, error){
+	"initialize":        (*DAPServer).initialize,
+	"launch":            (*DAPServer).launch,
+	"setBreakpoints":    (*DAPServer).setBreakpoints,
+	"configurationDone": (*DAPServer).configurationDone,
+	"threads":           (*DAPServer).threads,
+	"stackTrace":        (*DAPServer).stackTrace,
+	"scopes":            (*DAPServer).scopes,
+	"variables":         (*DAPServer).variables,
+	"evaluate":          (*DAPServer).evaluate,
+	"continue":          (*DAPServer).resume,
+	"next":              (*DAPServer).next,
+	"stepIn":            (*DAPServer).next,
+	"stepOut":           (*DAPServer).next,
+	"stepBack":          (*DAPServer).stepBack,
+	"reverseContinue":   (*DAPServer).reverseContinue,
+	"pause":             (*DAPServer).pause,
+	"terminate":         (*DAPServer).terminate,
+	"disconnect":        (*DAPServer).disconnect,
+}
+
+func NewDAPServer(c *config.Config, reader io.Reader, writer io.Writer) *DAPServer {
+	return &DAPServer{
+		config:     c,
+		reader:     bufio.NewReader(reader),
+		writer:     writer,
+		lineBase:   1,
+		columnBase: 1,
+	}
+}
+
+// Serve handles requests until the client disconnects or closes the connection
+func (s *DAPServer) Serve() error {
+	defer s.stop()
+	for {
+		content, err := readDAPMessage(s.reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var request dapRequest
+		if err := json.Unmarshal(content, &request); err != nil {
+			return fmt.Errorf("invalid message: %w", err)
+		}
+		if request.Type != "request" {
+			continue
+		}
+		if err := s.handle(request); err != nil {
+			return err
+		}
+		if request.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+// handle responds to a request, returning an error only if the response can't be sent
+func (s *DAPServer) handle(request dapRequest) error {
+	var body any
+	var err error
+	handler, ok := dapHandlers[request.Command]
+	switch {
+	case !ok:
+		err = fmt.Errorf("%s requests aren't supported", request.Command)
+	case request.Command == "pause" || request.Command == "terminate" || request.Command == "disconnect":
+		// these stop the program running in the background, so can't wait for it to release the state first
+		body, err = handler(s, request.Arguments)
+	default:
+		s.state.Lock()
+		body, err = handler(s, request.Arguments)
+		s.state.Unlock()
+	}
+	response := &dapResponse{Type: "response", RequestSeq: request.Seq, Success: err == nil, Command: request.Command,
+		Body: body}
+	if err != nil {
+		response.Message = err.Error()
+	}
+	if err := s.send(response); err != nil {
+		return err
+	}
+	s.state.Lock()
+	defer s.state.Unlock()
+	if after := s.afterResponse; after != nil {
+		s.afterResponse = nil
+		after()
+	}
+	return nil
+}
+
+func (s *DAPServer) send(message any) error {
+	s.writing.Lock()
+	defer s.writing.Unlock()
+	s.seq++
+	switch m := message.(type) {
+	case *dapResponse:
+		m.Seq = s.seq
+	case *dapEvent:
+		m.Seq = s.seq
+	}
+	return writeDAPMessage(s.writer, message)
+}
+
+// event sends an event. Errors are ignored, as the connection failing will also stop requests being read
+func (s *DAPServer) event(event *dapEvent) {
+	_ = s.send(event)
+}
+
+func newDAPEvent(event string, body any) *dapEvent {
+	return &dapEvent{Type: "event", Event: event, Body: body}
+}
+
+func dapArguments(raw json.RawMessage, arguments any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, arguments); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+func (s *DAPServer) initialize(raw json.RawMessage) (any, error) {
+	var arguments dapInitializeArguments
+	if err := dapArguments(raw, &arguments); err != nil {
+		return nil, err
+	}
+	if arguments.LinesStartAt1 != nil && !*arguments.LinesStartAt1 {
+		s.lineBase = 0
+	}
+	if arguments.ColumnsStartAt1 != nil && !*arguments.ColumnsStartAt1 {
+		s.columnBase = 0
+	}
+	s.invalidate = arguments.SupportsInvalidatedEvent
+	s.afterResponse = func() { s.event(newDAPEvent("initialized", nil)) }
+	return dapCapabilities{
+		SupportsConfigurationDoneRequest:  true,
+		SupportsConditionalBreakpoints:    true,
+		SupportsHitConditionalBreakpoints: true,
+		SupportsEvaluateForHovers:         true,
+		SupportsStepBack:                  s.config.Debugger.HistoryLimit > 0,
+		SupportsTerminateRequest:          true,
+	}, nil
+}
+
+func (s *DAPServer) launch(raw json.RawMessage) (any, error) {
+	var arguments dapLaunchArguments
+	if err := dapArguments(raw, &arguments); err != nil {
+		return nil, err
+	}
+	if s.debugger != nil {
+		return nil, errors.New("a program has already been launched")
+	}
+	if arguments.Program == "" {
+		return nil, errors.New("the launch configuration must set program to the path of the program to debug")
+	}
+	program, err := os.ReadFile(arguments.Program)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read program %s: %w", arguments.Program, err)
+	}
+	var input []byte
+	if arguments.Input != "" {
+		if input, err = os.ReadFile(arguments.Input); err != nil {
+			return nil, fmt.Errorf("cannot read input %s: %w", arguments.Input, err)
+		}
+	}
+	s.debugger = NewDebugger(s.config, string(program), io.Discard, bytes.NewReader(input),
+		slices.Clone(s.breakpoints), nil, nil, 0)
+	// the output of commands is shown by the editor, which doesn't understand the terminal's colors
+	s.debugger.config.EnableColors = false
+	s.source = dapSource{Name: filepath.Base(arguments.Program), Path: arguments.Program}
+	s.stopOnEntry, s.noDebug = arguments.StopOnEntry, arguments.NoDebug
+	s.afterResponse = s.start
+	return nil, nil
+}
+
+func (s *DAPServer) configurationDone(json.RawMessage) (any, error) {
+	s.configured = true
+	s.afterResponse = s.start
+	return nil, nil
+}
+
+// start starts the program once it has been both launched and configured, which can happen in either order
+func (s *DAPServer) start() {
+	if s.debugger == nil || !s.configured || s.started {
+		return
+	}
+	s.started = true
+	if s.stopOnEntry && !s.noDebug {
+		s.event(s.stoppedEvent("entry"))
+		return
+	}
+	s.run(false)
+}
+
+// setBreakpoints replaces the breakpoints set in the editor. Breakpoints added with the break command are kept
+func (s *DAPServer) setBreakpoints(raw json.RawMessage) (any, error) {
+	var arguments dapSetBreakpointsArguments
+	if err := dapArguments(raw, &arguments); err != nil {
+		return nil, err
+	}
+	var breakpoints []*Breakpoint
+	results := make([]dapBreakpoint, len(arguments.Breakpoints))
+	for i, sourceBreakpoint := range arguments.Breakpoints {
+		results[i] = dapBreakpoint{Verified: true, Line: sourceBreakpoint.Line}
+		if sourceBreakpoint.Column != nil {
+			results[i].Column = *sourceBreakpoint.Column
+		}
+		b, err := s.parseBreakpoint(sourceBreakpoint)
+		if err != nil {
+			results[i].Verified, results[i].Message = false, err.Error()
+			continue
+		}
+		breakpoints = append(breakpoints, b)
+	}
+	if s.debugger != nil {
+		s.debugger.breakpoints = append(slices.DeleteFunc(s.debugger.breakpoints, func(b *Breakpoint) bool {
+			return slices.Contains(s.breakpoints, b)
+		}), breakpoints...)
+	}
+	s.breakpoints = breakpoints
+	return map[string]any{"breakpoints": results}, nil
+}
+
+// parseBreakpoint converts a breakpoint on a line and column of the program into a breakpoint on that position, with
+// the same conditions and hit count as a breakpoint's if and hit clauses. A breakpoint without a column is on the
+// whole row
+func (s *DAPServer) parseBreakpoint(sourceBreakpoint dapSourceBreakpoint) (*Breakpoint, error) {
+	x := 0
+	if sourceBreakpoint.Column != nil {
+		x = *sourceBreakpoint.Column - s.columnBase
+	}
+	str := fmt.Sprintf("%d,%d", x, sourceBreakpoint.Line-s.lineBase)
+	if sourceBreakpoint.Condition != "" {
+		str += " if " + sourceBreakpoint.Condition
+	}
+	if sourceBreakpoint.HitCondition != "" {
+		str += " hit " + sourceBreakpoint.HitCondition
+	}
+	b, err := ParseBreakpoint(str)
+	if err != nil {
+		return nil, err
+	}
+	b.row = sourceBreakpoint.Column == nil
+	return b, nil
+}
+
+func (s *DAPServer) threads(json.RawMessage) (any, error) {
+	threads := []dapThread{}
+	if s.debugger != nil {
+		threads = internal.MapSlice(s.debugger.befunge.IPs, func(ip *pkg.IP) dapThread {
+			return dapThread{ID: ip.ID + 1, Name: fmt.Sprintf("ip %d", ip.ID)}
+		})
+	}
+	return map[string]any{"threads": threads}, nil
+}
+
+func (s *DAPServer) stackTrace(raw json.RawMessage) (any, error) {
+	var arguments dapThreadArguments
+	if err := dapArguments(raw, &arguments); err != nil {
+		return nil, err
+	}
+	ip, err := s.ip(arguments.ThreadID)
+	if err != nil {
+		return nil, err
+	}
+	frame := dapStackFrame{
+		ID:     ip.ID + 1,
+		Name:   fmt.Sprintf("ip %d on '%c'", ip.ID, s.debugger.befunge.CharUnder(ip)),
+		Source: s.source,
+		Line:   ip.InstructionPointer.Y + s.lineBase,
+		Column: ip.InstructionPointer.X + s.columnBase,
+	}
+	return map[string]any{"stackFrames": []dapStackFrame{frame}, "totalFrames": 1}, nil
+}
+
+func (s *DAPServer) scopes(raw json.RawMessage) (any, error) {
+	var arguments dapScopesArguments
+	if err := dapArguments(raw, &arguments); err != nil {
+		return nil, err
+	}
+	ip, err := s.ip(arguments.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"scopes": []dapScope{
+		{Name: "Stack", VariablesReference: s.reference(func() []dapVariable { return s.stackVariables(ip) })},
+		{Name: "Instruction Pointer", VariablesReference: s.reference(func() []dapVariable { return s.ipVariables(ip) })},
+	}}, nil
+}
+
+func (s *DAPServer) variables(raw json.RawMessage) (any, error) {
+	var arguments dapVariablesArguments
+	if err := dapArguments(raw, &arguments); err != nil {
+		return nil, err
+	}
+	if arguments.VariablesReference < 1 || arguments.VariablesReference > len(s.handles) {
+		return nil, fmt.Errorf("unknown variables reference %d", arguments.VariablesReference)
+	}
+	return map[string]any{"variables": s.handles[arguments.VariablesReference-1]()}, nil
+}
+
+// reference returns a variablesReference for variables, which can be expanded until the program is resumed
+func (s *DAPServer) reference(variables func() []dapVariable) int {
+	s.handles = append(s.handles, variables)
+	return len(s.handles)
+}
+
+// stackVariables the values of the stack, or of each stack of the stack stack from the TOSS down if there's more than
+// one, as the terminal debugger shows them
+func (s *DAPServer) stackVariables(ip *pkg.IP) []dapVariable {
+	stacks := ip.Stacks.Stacks
+	if len(stacks) == 1 {
+		return s.valueVariables(stacks[0])
+	}
+	var variables []dapVariable
+	for i := len(stacks) - 1; i >= 0; i-- {
+		name := strconv.Itoa(len(stacks) - 1 - i)
+		switch i {
+		case len(stacks) - 1:
+			name += " (TOSS)"
+		case len(stacks) - 2:
+			name += " (SOSS)"
+		}
+		stack := stacks[i]
+		variables = append(variables, dapVariable{
+			Name:               name,
+			Value:              fmt.Sprintf("[%s]", s.debugger.stackToString(stack)),
+			VariablesReference: s.reference(func() []dapVariable { return s.valueVariables(stack) }),
+		})
+	}
+	return variables
+}
+
+// valueVariables the values of a stack from the top down, named by their depth as in the set stack command
+func (s *DAPServer) valueVariables(stack *pkg.Stack[int]) []dapVariable {
+	variables := []dapVariable{}
+	for i, value := range slices.Backward(stack.Values) {
+		variables = append(variables, dapVariable{
+			Name:  strconv.Itoa(len(stack.Values) - 1 - i),
+			Value: s.debugger.cellString(value),
+		})
+	}
+	return variables
+}
+
+func (s *DAPServer) ipVariables(ip *pkg.IP) []dapVariable {
+	return []dapVariable{
+		{Name: "id", Value: strconv.Itoa(ip.ID)},
+		{Name: "position", Value: ip.InstructionPointer.String()},
+		{Name: "delta", Value: ip.Delta().String()},
+		{Name: "instruction", Value: fmt.Sprintf("'%c'", s.debugger.befunge.CharUnder(ip))},
+		{Name: "string mode", Value: strconv.FormatBool(ip.StringMode)},
+		{Name: "storage offset", Value: ip.StorageOffset.String()},
+	}
+}
+
+// evaluate evaluates one of the variables which breakpoint conditions compare, for the frame's instruction pointer,
+// or runs a debugger command which doesn't move the program, returning what it prints
+func (s *DAPServer) evaluate(raw json.RawMessage) (any, error) {
+	var arguments dapEvaluateArguments
+	if err := dapArguments(raw, &arguments); err != nil {
+		return nil, err
+	}
+	if err := s.canInspect(); err != nil {
+		return nil, err
+	}
+	d := s.debugger
+	ip := d.befunge.IP
+	if arguments.FrameID != 0 {
+		var err error
+		if ip, err = s.ip(arguments.FrameID); err != nil {
+			return nil, err
+		}
+	}
+	expression := strings.TrimSpace(arguments.Expression)
+	switch expression {
+	case "top", "depth", "x", "y", "z":
+		return map[string]any{"result": variableValue(d.befunge, ip, expression).String(), "variablesReference": 0}, nil
+	case "dir":
+		return map[string]any{"result": directionString(ip.Delta()), "variablesReference": 0}, nil
+	}
+	if arguments.Context == "hover" {
+		return nil, errors.New("only top, depth, x, y, z and dir can be evaluated by hovering")
+	}
+	args := splitArgs(expression)
+	if len(args) == 0 {
+		return nil, errors.New("enter a command, or one of top, depth, x, y, z or dir")
+	}
+	c, ok := findCommand(strings.ToLower(args[0]))
+	if !ok {
+		return nil, fmt.Errorf("unknown command %s. Enter help to list the commands", args[0])
+	}
+	if c.moves {
+		return nil, fmt.Errorf("%s can't be evaluated, use the editor's controls instead", c.name)
+	}
+	_, err := c.run(d, args[1:])
+	result := strings.Join(d.messages, "\n")
+	d.messages = nil
+	if err != nil {
+		return nil, err
+	}
+	if s.invalidate {
+		// the command may have changed the state of the program
+		s.afterResponse = func() { s.event(newDAPEvent("invalidated", map[string]any{"areas": []string{"all"}})) }
+	}
+	return map[string]any{"result": result, "variablesReference": 0}, nil
+}
+
+// directionString the name of a cardinal direction, or the delta if it isn't one
+func directionString(delta *pkg.Vector) string {
+	for _, name := range []string{"east", "west", "south", "north", "high", "low"} {
+		if *directions[name] == *delta {
+			return name
+		}
+	}
+	return delta.String()
+}
+
+func (s *DAPServer) resume(json.RawMessage) (any, error) {
+	if err := s.canInspect(); err != nil {
+		return nil, err
+	}
+	s.debugger.stepMode = false
+	s.afterResponse = func() { s.run(true) }
+	return map[string]any{"allThreadsContinued": true}, nil
+}
+
+// next steps a single instruction, which is also what stepping in and out do, as there are no calls to step over
+func (s *DAPServer) next(json.RawMessage) (any, error) {
+	if err := s.canInspect(); err != nil {
+		return nil, err
+	}
+	s.debugger.stepMode, s.debugger.stepsLeft = true, 1
+	s.afterResponse = func() { s.run(true) }
+	return nil, nil
+}
+
+func (s *DAPServer) stepBack(json.RawMessage) (any, error) {
+	if err := s.canStepBack(); err != nil {
+		return nil, err
+	}
+	s.debugger.stepBack()
+	s.afterResponse = func() { s.event(s.stoppedEvent("step")) }
+	return nil, nil
+}
+
+func (s *DAPServer) reverseContinue(json.RawMessage) (any, error) {
+	if err := s.canStepBack(); err != nil {
+		return nil, err
+	}
+	s.debugger.reverseContinue()
+	reason := "step" // the start of the history was reached
+	if len(s.debugger.watched) > 0 {
+		reason = "data breakpoint"
+	} else if s.debugger.atBreakpoint() {
+		reason = "breakpoint"
+	}
+	s.afterResponse = func() { s.event(s.stoppedEvent(reason)) }
+	return nil, nil
+}
+
+func (s *DAPServer) pause(json.RawMessage) (any, error) {
+	if s.running.Load() {
+		s.pausing.Store(true)
+	}
+	return nil, nil
+}
+
+func (s *DAPServer) terminate(json.RawMessage) (any, error) {
+	s.stop()
+	s.state.Lock()
+	defer s.state.Unlock()
+	if s.debugger != nil && !s.finished {
+		s.finished = true
+		s.afterResponse = func() { s.event(newDAPEvent("terminated", nil)) }
+	}
+	return nil, nil
+}
+
+func (s *DAPServer) disconnect(json.RawMessage) (any, error) {
+	s.stop()
+	return nil, nil
+}
+
+// stop pauses the program if it is running, and waits for it to stop
+func (s *DAPServer) stop() {
+	if s.running.Load() {
+		s.pausing.Store(true)
+	}
+	s.wait.Wait()
+}
+
+// canInspect returns an error explaining why the program can't be inspected or resumed, if it can't
+func (s *DAPServer) canInspect() error {
+	switch {
+	case s.debugger == nil:
+		return errors.New("no program has been launched")
+	case s.running.Load():
+		return errors.New("the program is running")
+	case s.finished:
+		return errors.New("the program has terminated")
+	}
+	return nil
+}
+
+func (s *DAPServer) canStepBack() error {
+	if err := s.canInspect(); err != nil {
+		return err
+	}
+	return s.debugger.canStepBack()
+}
+
+// ip the instruction pointer of a thread, whose ID is one more than the instruction pointer's
+func (s *DAPServer) ip(threadID int) (*pkg.IP, error) {
+	if s.debugger == nil {
+		return nil, errors.New("no program has been launched")
+	}
+	for _, ip := range s.debugger.befunge.IPs {
+		if ip.ID+1 == threadID {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("there is no thread %d", threadID)
+}
+
+// run runs the program in the background until it stops. Whether to stop is checked before every step, except the
+// first when resuming, as the program stopped there
+func (s *DAPServer) run(resuming bool) {
+	s.pausing.Store(false)
+	s.running.Store(true)
+	s.handles = nil
+	s.wait.Add(1)
+	go func() {
+		defer s.wait.Done()
+		check := !resuming
+		for {
+			s.state.Lock()
+			events, stopped := s.advance(check)
+			if stopped {
+				s.running.Store(false)
+			}
+			s.state.Unlock()
+			for _, event := range events {
+				s.event(event)
+			}
+			if stopped {
+				return
+			}
+			check = true
+		}
+	}()
+}
+
+// advance steps the program unless it should stop first, returning the events to send and whether it stopped
+func (s *DAPServer) advance(check bool) ([]*dapEvent, bool) {
+	d := s.debugger
+	if s.pausing.Load() {
+		return []*dapEvent{s.stoppedEvent("pause")}, true
+	}
+	if check && !s.noDebug && d.paused() {
+		reason := "breakpoint"
+		if len(d.watched) > 0 {
+			reason = "data breakpoint"
+		} else if d.stepMode && d.stepsLeft <= 0 {
+			reason = "step"
+		}
+		return []*dapEvent{s.stoppedEvent(reason)}, true
+	}
+	proceed, err := d.step()
+	var events []*dapEvent
+	if output := d.output.Bytes(); len(output) > s.sent {
+		events = append(events, newDAPEvent("output", dapOutputEvent{Category: "stdout", Output: string(output[s.sent:])}))
+	}
+	s.sent = d.output.Len()
+	if err != nil {
+		events = append(events, newDAPEvent("output", dapOutputEvent{Category: "stderr", Output: err.Error() + "\n"}))
+	}
+	if err != nil || !proceed {
+		s.finished = true
+		events = append(events,
+			newDAPEvent("exited", map[string]any{"exitCode": d.ExitCode()}),
+			newDAPEvent("terminated", nil))
+		return events, true
+	}
+	return events, false
+}
+
+// stoppedEvent an event for the program stopping, which describes any watches which stopped it
+func (s *DAPServer) stoppedEvent(reason string) *dapEvent {
+	d := s.debugger
+	s.handles = nil
+	s.sent = min(s.sent, d.output.Len()) // stepping back takes back output
+	event := dapStoppedEvent{Reason: reason, ThreadID: d.befunge.IP.ID + 1, AllThreadsStopped: true}
+	if len(d.watched) > 0 {
+		event.Description = strings.Join(d.watched, "\n")
+		event.Text = event.Description
+		d.watched = nil
+	}
+	return newDAPEvent("stopped", event)
+}
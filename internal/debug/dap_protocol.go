@@ -0,0 +1,167 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// the messages of the Debug Adapter Protocol, limited to the fields used here.
+// See https://microsoft.github.io/debug-adapter-protocol/specification
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type dapResponse struct {
+	Seq        int    `json:"seq"`
+	Type       string `json:"type"`
+	RequestSeq int    `json:"request_seq"`
+	Success    bool   `json:"success"`
+	Command    string `json:"command"`
+	Message    string `json:"message,omitempty"`
+	Body       any    `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int    `json:"seq"`
+	Type  string `json:"type"`
+	Event string `json:"event"`
+	Body  any    `json:"body,omitempty"`
+}
+
+type dapCapabilities struct {
+	SupportsConfigurationDoneRequest  bool `json:"supportsConfigurationDoneRequest"`
+	SupportsConditionalBreakpoints    bool `json:"supportsConditionalBreakpoints"`
+	SupportsHitConditionalBreakpoints bool `json:"supportsHitConditionalBreakpoints"`
+	SupportsEvaluateForHovers         bool `json:"supportsEvaluateForHovers"`
+	SupportsStepBack                  bool `json:"supportsStepBack"`
+	SupportsTerminateRequest          bool `json:"supportsTerminateRequest"`
+}
+
+type dapInitializeArguments struct {
+	LinesStartAt1            *bool `json:"linesStartAt1"`
+	ColumnsStartAt1          *bool `json:"columnsStartAt1"`
+	SupportsInvalidatedEvent bool  `json:"supportsInvalidatedEvent"`
+}
+
+// dapLaunchArguments the arguments of a launch request, which are the attributes of a launch configuration
+type dapLaunchArguments struct {
+	Program     string `json:"program"`     // the path of the program to debug
+	Input       string `json:"input"`       // the path of a file to read the program's input from
+	StopOnEntry bool   `json:"stopOnEntry"` // whether to stop before the first instruction
+	NoDebug     bool   `json:"noDebug"`     // whether to run the program without stopping at breakpoints
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type dapSourceBreakpoint struct {
+	Line         int    `json:"line"`
+	Column       *int   `json:"column,omitempty"`
+	Condition    string `json:"condition,omitempty"`
+	HitCondition string `json:"hitCondition,omitempty"`
+}
+
+type dapSetBreakpointsArguments struct {
+	Source      dapSource             `json:"source"`
+	Breakpoints []dapSourceBreakpoint `json:"breakpoints"`
+}
+
+type dapBreakpoint struct {
+	Verified bool   `json:"verified"`
+	Message  string `json:"message,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+type dapThread struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type dapThreadArguments struct {
+	ThreadID int `json:"threadId"`
+}
+
+type dapStackFrame struct {
+	ID     int       `json:"id"`
+	Name   string    `json:"name"`
+	Source dapSource `json:"source"`
+	Line   int       `json:"line"`
+	Column int       `json:"column"`
+}
+
+type dapScopesArguments struct {
+	FrameID int `json:"frameId"`
+}
+
+type dapScope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type dapVariablesArguments struct {
+	VariablesReference int `json:"variablesReference"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type dapEvaluateArguments struct {
+	Expression string `json:"expression"`
+	FrameID    int    `json:"frameId"`
+	Context    string `json:"context"`
+}
+
+type dapStoppedEvent struct {
+	Reason            string `json:"reason"`
+	Description       string `json:"description,omitempty"`
+	ThreadID          int    `json:"threadId"`
+	AllThreadsStopped bool   `json:"allThreadsStopped"`
+	Text              string `json:"text,omitempty"`
+}
+
+type dapOutputEvent struct {
+	Category string `json:"category"`
+	Output   string `json:"output"`
+}
+
+// readDAPMessage reads the content of the next message, which follows a header giving its length
+func readDAPMessage(reader *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(reader, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// writeDAPMessage writes a message as JSON, preceded by a header giving its length
+func writeDAPMessage(writer io.Writer, message any) error {
+	content, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return err
+}
@@ -0,0 +1,332 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/kagof/kagofunge/config"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dapTestMessage any message sent by the server
+type dapTestMessage struct {
+	Type       string          `json:"type"`
+	Event      string          `json:"event"`
+	Command    string          `json:"command"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// dapClient a scripted client, which sends requests and reads the server's messages in order
+type dapClient struct {
+	asserts *assert.Assertions
+	writer  io.Writer
+	read    chan []byte // the content of each message sent by the server, read in the background
+	seq     int
+	events  []dapTestMessage // events read while waiting for a response
+	output  string           // the output of the program sent in output events
+	done    chan error
+}
+
+// newDAPClient serves a session for a program, returning a client connected to it and the path of the program
+func newDAPClient(t *testing.T, c *config.Config, program string) (*dapClient, string) {
+	path := filepath.Join(t.TempDir(), "program.bf")
+	if err := os.WriteFile(path, []byte(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	client := &dapClient{
+		asserts: assert.New(t),
+		writer:  clientWriter,
+		read:    make(chan []byte, 1024),
+		done:    make(chan error, 1),
+	}
+	// pipes don't buffer like a real connection would, so the server would block sending events while the client
+	// sends a request
+	go func() {
+		reader := bufio.NewReader(clientReader)
+		for {
+			content, err := readDAPMessage(reader)
+			if err != nil {
+				close(client.read)
+				return
+			}
+			client.read <- content
+		}
+	}()
+	go func() {
+		client.done <- NewDAPServer(c, serverReader, serverWriter).Serve()
+		_ = serverWriter.Close()
+	}()
+	t.Cleanup(func() { _ = clientWriter.Close() })
+	return client, path
+}
+
+func (c *dapClient) next() dapTestMessage {
+	content, ok := <-c.read
+	if !ok {
+		c.asserts.FailNow("the server closed the connection")
+	}
+	var message dapTestMessage
+	c.asserts.NoError(json.Unmarshal(content, &message))
+	return message
+}
+
+// request sends a request, returning the response to it, and decoding its body into body if it isn't nil
+func (c *dapClient) request(command string, arguments any, body any) dapTestMessage {
+	c.seq++
+	c.asserts.NoError(writeDAPMessage(c.writer, map[string]any{
+		"seq": c.seq, "type": "request", "command": command, "arguments": arguments,
+	}))
+	for {
+		message := c.next()
+		if message.Type == "event" {
+			c.events = append(c.events, message)
+			continue
+		}
+		c.asserts.Equal(c.seq, message.RequestSeq)
+		c.asserts.Equal(command, message.Command)
+		if body != nil && message.Success {
+			c.asserts.NoError(json.Unmarshal(message.Body, body))
+		}
+		return message
+	}
+}
+
+// succeed sends a request which should succeed
+func (c *dapClient) succeed(command string, arguments any, body any) {
+	response := c.request(command, arguments, body)
+	c.asserts.True(response.Success, "%s should succeed, but failed with %s", command, response.Message)
+}
+
+// until reads events until one with the name, decoding its body into body if it isn't nil. The output of output
+// events read on the way is kept
+func (c *dapClient) until(event string, body any) {
+	for {
+		var message dapTestMessage
+		if len(c.events) > 0 {
+			message, c.events = c.events[0], c.events[1:]
+		} else {
+			message = c.next()
+		}
+		if !c.asserts.Equal("event", message.Type) {
+			return
+		}
+		if message.Event == "output" {
+			var output dapOutputEvent
+			c.asserts.NoError(json.Unmarshal(message.Body, &output))
+			c.output += output.Output
+		}
+		if message.Event == event {
+			if body != nil {
+				c.asserts.NoError(json.Unmarshal(message.Body, body))
+			}
+			return
+		}
+	}
+}
+
+// stopped waits for the program to stop, returning why
+func (c *dapClient) stopped() string {
+	var stopped dapStoppedEvent
+	c.until("stopped", &stopped)
+	c.asserts.Equal(1, stopped.ThreadID)
+	return stopped.Reason
+}
+
+// frame the only stack frame of the first thread
+func (c *dapClient) frame() dapStackFrame {
+	var trace struct {
+		StackFrames []dapStackFrame `json:"stackFrames"`
+	}
+	c.succeed("stackTrace", map[string]any{"threadId": 1}, &trace)
+	if !c.asserts.Len(trace.StackFrames, 1) {
+		return dapStackFrame{}
+	}
+	return trace.StackFrames[0]
+}
+
+// evaluate evaluates an expression, returning the result, or the error if it failed
+func (c *dapClient) evaluate(expression string, context string) string {
+	var result struct {
+		Result string `json:"result"`
+	}
+	response := c.request("evaluate", map[string]any{"expression": expression, "context": context}, &result)
+	if !response.Success {
+		return response.Message
+	}
+	return result.Result
+}
+
+// disconnect ends the session, which should stop the server
+func (c *dapClient) disconnect() {
+	c.succeed("disconnect", nil, nil)
+	c.asserts.NoError(<-c.done)
+}
+
+func TestDAPServer_session(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.DefaultConfig()
+	client, path := newDAPClient(t, &cfg, "12.3.@")
+	asserts := client.asserts
+
+	var capabilities dapCapabilities
+	client.succeed("initialize", map[string]any{"adapterID": "kagofunge"}, &capabilities)
+	asserts.True(capabilities.SupportsStepBack)
+	client.until("initialized", nil)
+
+	var breakpoints struct {
+		Breakpoints []dapBreakpoint `json:"breakpoints"`
+	}
+	client.succeed("setBreakpoints", map[string]any{
+		"source": map[string]any{"path": path},
+		"breakpoints": []map[string]any{
+			{"line": 1, "column": 4},
+			{"line": 1, "column": 2, "condition": "top=="},
+		},
+	}, &breakpoints)
+	if asserts.Len(breakpoints.Breakpoints, 2) {
+		asserts.Equal(dapBreakpoint{Verified: true, Line: 1, Column: 4}, breakpoints.Breakpoints[0])
+		asserts.False(breakpoints.Breakpoints[1].Verified, "a breakpoint with an invalid condition isn't verified")
+	}
+
+	client.succeed("launch", map[string]any{"program": path}, nil)
+	client.succeed("configurationDone", nil, nil)
+	asserts.Equal("breakpoint", client.stopped())
+	asserts.Equal("2", client.output)
+
+	var threads struct {
+		Threads []dapThread `json:"threads"`
+	}
+	client.succeed("threads", nil, &threads)
+	asserts.Equal([]dapThread{{ID: 1, Name: "ip 0"}}, threads.Threads)
+	frame := client.frame()
+	asserts.Equal(dapStackFrame{ID: 1, Name: "ip 0 on '3'", Source: dapSource{Name: "program.bf", Path: path},
+		Line: 1, Column: 4}, frame)
+
+	var scopes struct {
+		Scopes []dapScope `json:"scopes"`
+	}
+	client.succeed("scopes", map[string]any{"frameId": frame.ID}, &scopes)
+	if asserts.Len(scopes.Scopes, 2) {
+		var variables struct {
+			Variables []dapVariable `json:"variables"`
+		}
+		client.succeed("variables", map[string]any{"variablesReference": scopes.Scopes[0].VariablesReference},
+			&variables)
+		asserts.Equal([]dapVariable{{Name: "0", Value: "1"}}, variables.Variables)
+		client.succeed("variables", map[string]any{"variablesReference": scopes.Scopes[1].VariablesReference},
+			&variables)
+		asserts.Contains(variables.Variables, dapVariable{Name: "position", Value: "(3,0)"})
+		asserts.Contains(variables.Variables, dapVariable{Name: "delta", Value: "(1,0)"})
+	}
+
+	asserts.Equal("1", client.evaluate("top", "watch"))
+	asserts.Equal("east", client.evaluate("dir", "hover"))
+	asserts.Equal("(0,0): '1' (49)", client.evaluate("peek 0 0", "repl"))
+	asserts.Equal("step can't be evaluated, use the editor's controls instead", client.evaluate("s", "repl"))
+	asserts.Equal("only top, depth, x, y, z and dir can be evaluated by hovering",
+		client.evaluate("poke 0 0 0", "hover"))
+
+	client.succeed("next", map[string]any{"threadId": 1}, nil)
+	asserts.Equal("step", client.stopped())
+	asserts.Equal(5, client.frame().Column)
+	client.succeed("stepBack", map[string]any{"threadId": 1}, nil)
+	asserts.Equal("step", client.stopped())
+	asserts.Equal(4, client.frame().Column)
+
+	client.succeed("continue", map[string]any{"threadId": 1}, nil)
+	var exited struct {
+		ExitCode int `json:"exitCode"`
+	}
+	client.until("exited", &exited)
+	asserts.Equal(0, exited.ExitCode)
+	client.until("terminated", nil)
+	asserts.Equal("23", client.output)
+	asserts.Equal("the program has terminated", client.request("next", nil, nil).Message)
+	client.disconnect()
+}
+
+func TestDAPServer_pause(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.DefaultConfig()
+	// pushes 1 and then bounces between v and ^ forever
+	client, path := newDAPClient(t, &cfg, "1v\n ^")
+	asserts := client.asserts
+
+	client.succeed("initialize", nil, nil)
+	client.succeed("launch", map[string]any{"program": path, "stopOnEntry": true}, nil)
+	client.succeed("configurationDone", nil, nil)
+	asserts.Equal("entry", client.stopped())
+	asserts.Equal(1, client.frame().Column)
+
+	client.succeed("continue", map[string]any{"threadId": 1}, nil)
+	client.succeed("pause", map[string]any{"threadId": 1}, nil)
+	asserts.Equal("pause", client.stopped())
+
+	// a breakpoint without a column is on the whole line
+	client.succeed("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": path},
+		"breakpoints": []map[string]any{{"line": 2, "hitCondition": "3"}},
+	}, nil)
+	for range 2 {
+		client.succeed("continue", map[string]any{"threadId": 1}, nil)
+		asserts.Equal("breakpoint", client.stopped())
+		asserts.Equal(2, client.frame().Line)
+	}
+
+	client.succeed("setBreakpoints", map[string]any{"source": map[string]any{"path": path}}, nil)
+	client.succeed("continue", map[string]any{"threadId": 1}, nil)
+	client.disconnect()
+}
+
+func TestDAPServer_parseBreakpoint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		base       int // the line and column base
+		breakpoint string
+		expected   string
+		row        bool
+	}{
+		{"position", 1, `{"line": 2, "column": 5}`, "4,1", false},
+		{"starting at 0", 0, `{"line": 2, "column": 5}`, "5,2", false},
+		{"row", 1, `{"line": 2}`, "0,1", true},
+		{"condition", 1, `{"line": 1, "column": 1, "condition": "top==0"}`, "0,0 if top==0", false},
+		{"hit count", 1, `{"line": 1, "column": 1, "hitCondition": "10"}`, "0,0 hit 10", false},
+		{"both", 1, `{"line": 1, "column": 1, "condition": "depth>1", "hitCondition": "2"}`,
+			"0,0 if depth>1 hit 2", false},
+		{"invalid hit count", 1, `{"line": 1, "column": 1, "hitCondition": ">2"}`, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+
+			cfg := config.DefaultConfig()
+			s := NewDAPServer(&cfg, nil, nil)
+			s.lineBase, s.columnBase = test.base, test.base
+			var sourceBreakpoint dapSourceBreakpoint
+			asserts.NoError(json.Unmarshal([]byte(test.breakpoint), &sourceBreakpoint))
+			b, err := s.parseBreakpoint(sourceBreakpoint)
+			if test.expected == "" {
+				asserts.Error(err)
+				return
+			}
+			if asserts.NoError(err) {
+				asserts.Equal(test.expected, b.String())
+				asserts.Equal(test.row, b.row)
+			}
+		})
+	}
+}
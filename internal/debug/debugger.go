@@ -2,13 +2,17 @@ package debug
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/fatih/color"
 	"github.com/kagof/kagofunge/config"
 	"github.com/kagof/kagofunge/internal"
 	"github.com/kagof/kagofunge/pkg"
+	"golang.org/x/term"
 	"io"
+	"math/rand/v2"
 	"os"
 	"slices"
 	"strings"
@@ -18,6 +22,14 @@ import (
 
 const clearAndReturn = "\033[2J\033[H"
 
+const (
+	// the columns and rows of the terminal used by everything but the torus, when fitting the torus to the terminal
+	viewportMarginWidth  = 8
+	viewportMarginHeight = 14
+	// the least number of columns and rows of the torus shown when fitting it to the terminal
+	viewportMinimum = 5
+)
+
 var (
 	noColor                   = color.New()
 	bold                      = color.New(color.Bold)
@@ -29,110 +41,229 @@ var (
 	redAndBoldAndUnderlined   = color.New(color.FgRed, color.Bold, color.Underline)
 	redBgAndBoldAndUnderlined = color.New(color.BgRed, color.Bold, color.Underline)
 	faint                     = color.New(color.Faint)
+	// each concurrent instruction pointer is highlighted in its own color, chosen by its ID
+	ipColors = []*color.Color{
+		boldAndUnderlined,
+		color.New(color.FgYellow, color.Bold, color.Underline),
+		color.New(color.FgMagenta, color.Bold, color.Underline),
+		color.New(color.FgBlue, color.Bold, color.Underline),
+		color.New(color.FgGreen, color.Bold, color.Underline),
+	}
 )
 
 type Debugger struct {
-	befunge     *pkg.Befunge
-	breakpoints []pkg.Vector2
-	output      *strings.Builder
-	outfile     io.Writer
-	autoSpeed   time.Duration
-	reader      bufio.Reader
-	config      config.DebuggerConfig
-	stepMode    bool
-	jumping     bool
-	hasPrinted  bool
-	isStarted   bool
-	isFinished  bool
-	stdinChan   chan string
-	usingChanR  bool
-}
-
-func NewDebugger(c *config.Config, s string, outFile io.Writer, inFile io.Reader, breakpoints []pkg.Vector2, speed time.Duration) *Debugger {
-	b := new(strings.Builder)
+	befunge      *pkg.Befunge
+	breakpoints  []*Breakpoint
+	watchpoints  []*Watchpoint
+	stackWatches []*StackWatch
+	watched      []string    // what each watch which has been triggered since the debugger last paused saw
+	history      []*pkg.Undo // the latest steps, up to the history limit, which can be stepped back through
+	messages     []string    // the output of the commands entered since the state of the program was last shown
+	output       *bytes.Buffer
+	outfile      io.Writer
+	autoSpeed    time.Duration
+	lines        lineReader
+	terminal     *terminal // nil unless stdin is a terminal
+	screen       io.Writer // where the state of the program is shown
+	config       config.DebuggerConfig
+	steps        int
+	stepMode     bool
+	stepsLeft    int // the number of steps to take before pausing again, in step mode
+	jumping      bool
+	quitting     bool
+	hasPrinted   bool
+	isStarted    bool
+	isFinished   bool
+	stdinChan    chan string
+	usingChanR   bool
+	stdinReader  *chanReader // the program's input, if it is read from stdin
+	tui          *tui        // nil unless the full-screen debugger is enabled
+	viewport     pkg.Vector  // the top left of the part of the torus shown, if it's too big to show all of
+	replay       *replay     // nil unless the program is replaying a trace
+	random       *seededSource
+	screenSize   func() (int, int, error)
+}
+
+func NewDebugger(c *config.Config, s string, outFile io.Writer, inFile io.Reader, breakpoints []*Breakpoint,
+	watchpoints []*Watchpoint, stackWatches []*StackWatch, speed time.Duration) *Debugger {
+	b := new(bytes.Buffer)
 	stdinChan := make(chan string)
 	var fungeIn io.Reader
 	var usingChanR bool
+	var stdinReader *chanReader
 	// if the input file is the same as the debugger input, we have to read from the channel for both
 	if inFile == os.Stdin {
-		fungeIn = &chanReader{stdinChan}
+		stdinReader = &chanReader{inChan: stdinChan}
+		fungeIn = stdinReader
 		usingChanR = true
 	} else {
 		fungeIn = inFile
 		usingChanR = false
 	}
 
-	return &Debugger{
-		befunge:     pkg.NewBefunge(c, s, b, fungeIn),
-		breakpoints: breakpoints,
-		output:      b,
-		outfile:     outFile,
-		reader:      *bufio.NewReader(os.Stdin),
-		config:      c.Debugger,
-		autoSpeed:   speed,
-		stdinChan:   stdinChan,
-		usingChanR:  usingChanR,
+	d := &Debugger{
+		befunge:      pkg.NewBefunge(c, s, b, fungeIn),
+		breakpoints:  breakpoints,
+		watchpoints:  watchpoints,
+		stackWatches: stackWatches,
+		output:       b,
+		outfile:      outFile,
+		lines:        plainLineReader{bufio.NewReader(os.Stdin)},
+		screen:       os.Stdout,
+		config:       c.Debugger,
+		autoSpeed:    speed,
+		stdinChan:    stdinChan,
+		usingChanR:   usingChanR,
+		stdinReader:  stdinReader,
+		screenSize:   func() (int, int, error) { return term.GetSize(int(os.Stdout.Fd())) },
 	}
+	d.random = newSeededSource(c.Interpreter.RandomSeed)
+	d.befunge.SetRandomSource(d.random)
+	d.befunge.OnPut(d.put)
+	return d
+}
+
+// seededSource the source of the program's randomness, seeded by the config or else randomly, so that the seed can be
+// printed for the run to be reproduced
+type seededSource struct {
+	rand.Source
+	seed uint64
+	used bool // whether the program has used any randomness
+}
+
+func newSeededSource(seed *uint64) *seededSource {
+	s := &seededSource{}
+	if seed != nil {
+		s.seed = *seed
+	} else {
+		s.seed = rand.Uint64()
+	}
+	s.Source = pkg.NewRandomSource(s.seed)
+	return s
+}
+
+func (s *seededSource) Uint64() uint64 {
+	s.used = true
+	return s.Source.Uint64()
+}
+
+// put records each watchpoint that contains the cell which was put
+func (d *Debugger) put(event pkg.PutEvent) {
+	for _, w := range d.watchpoints {
+		if w.Contains(event.Position) {
+			d.watched = append(d.watched, putMessage(event, "put"))
+			return
+		}
+	}
+}
+
+// putMessage describes a cell being put
+func putMessage(event pkg.PutEvent, verb string) string {
+	return fmt.Sprintf("%s %s by ip %d at %s: %q (%d) -> %q (%d)", &event.Position, verb, event.IP.ID,
+		event.IP.InstructionPointer, event.Old, event.Old, event.New, event.New)
 }
 
 type chanReader struct {
 	inChan chan string
+	prompt func() (string, bool) // reads a line from the full-screen debugger instead of the channel, if it's enabled
 }
 
 func (c *chanReader) Read(p []byte) (n int, err error) {
-	line, ok := <-c.inChan
+	var line string
+	var ok bool
+	if c.prompt != nil {
+		line, ok = c.prompt()
+	} else {
+		line, ok = <-c.inChan
+	}
 	if !ok {
 		return 0, io.EOF
 	}
 	return strings.NewReader(line).Read(p)
 }
 
+// paused whether the debugger should pause before the next step, either because it is stepping, because an
+// instruction pointer has hit a breakpoint, or because a watch has been triggered. Every breakpoint and stack watch is
+// checked, so that their hit counts and whether their conditions held stay accurate
 func (d *Debugger) paused() bool {
-	return d.stepMode ||
-		slices.Contains(d.breakpoints, *d.befunge.InstructionPointer)
+	hit := false
+	for _, ip := range d.befunge.IPs {
+		for _, b := range d.breakpoints {
+			if b.at(*ip.InstructionPointer) && b.hit(d.befunge, ip) {
+				hit = true
+			}
+		}
+		for _, w := range d.stackWatches {
+			if w.started(d.befunge, ip) {
+				d.watched = append(d.watched, fmt.Sprintf("%s on ip %d at %s", w, ip.ID, ip.InstructionPointer))
+			}
+		}
+	}
+	if d.replay != nil && d.replay.interrupt {
+		d.replay.interrupt = false
+		hit = true
+	}
+	if hit || len(d.watched) > 0 {
+		return true
+	}
+	if d.stepMode {
+		d.stepsLeft--
+		return d.stepsLeft <= 0
+	}
+	return false
 }
 
 func (d *Debugger) slowStepping() bool {
 	return d.autoSpeed > 0 && !d.jumping
 }
 
+// EnableTUI makes the debugger take over the terminal with a full-screen interface, rather than printing the state of
+// the program every time it pauses
+func (d *Debugger) EnableTUI() error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("the full-screen debugger needs stdin and stdout to be a terminal")
+	}
+	d.tui = newTUI(d, os.Stdout, terminalSize)
+	if d.stdinReader != nil {
+		d.stdinReader.prompt = d.tui.readInput
+	}
+	return nil
+}
+
 func (d *Debugger) Step() (bool, error) {
+	if d.tui != nil {
+		return d.tui.step()
+	}
 	// if this is the first step, start a go routine to read from stdin and output to a channel
 	// this allows us to slow step through the program and be interrupted by keyboard input
 	if !d.isStarted {
 		d.isStarted = true
+		if t, ok := newTerminal(d.complete); ok {
+			d.terminal, d.lines, d.screen = t, t, t
+		}
 		go func() {
 			for !d.isFinished {
-				readString, err := d.reader.ReadString('\n')
+				line, err := d.lines.ReadLine()
 				if err != nil {
+					if d.terminal != nil {
+						// raw mode reads ctrl+c rather than interrupting the process
+						d.terminal.restore()
+						os.Exit(130)
+					}
 					close(d.stdinChan)
 					return
 				}
-				d.stdinChan <- readString
+				d.stdinChan <- line + "\n"
 			}
 		}()
 	}
 
-	char := d.befunge.CurrentChar()
-	if d.nextStepWillPromptForInput(char) {
-		d.printDebug(d.awaitingInputControls(char))
+	if ip, awaiting := d.ipAwaitingInput(); awaiting {
+		d.printDebug(d.awaitingInputControls(d.befunge.CharUnder(ip)))
 		d.hasPrinted = true
 	} else if d.paused() {
 		d.jumping = false
-
-		d.printDebug(d.interruptedControls())
-		d.hasPrinted = true
-
-		str := <-d.stdinChan
-
-		if strings.Contains(str, "c") || strings.Contains(str, "C") {
-			d.stepMode = false
-		} else if strings.Contains(str, "j") || strings.Contains(str, "J") {
-			d.jumping = true
-			d.stepMode = false
-		} else {
-			d.stepMode = true
-		}
+		d.interrupt()
 	} else if d.slowStepping() {
 		d.printDebug(d.slowSteppingControls())
 		d.hasPrinted = true
@@ -144,33 +275,149 @@ func (d *Debugger) Step() (bool, error) {
 		// Wait for either stdin input or the context to timeout
 		select {
 		case <-d.stdinChan:
-			d.stepMode = true
+			d.stepMode, d.stepsLeft = true, 1
 			break
 		case <-ctx.Done():
 		}
 	}
 
-	proceed, err := d.befunge.Step()
+	if d.quitting {
+		d.finish()
+		return false, nil
+	}
+	proceed, err := d.step()
 	if !proceed {
-		d.isFinished = true // stop the stdin go routine
-		if d.hasPrinted {
-			fmt.Println(clearAndReturn)
-		}
-		_, err := fmt.Fprint(d.outfile, d.output.String())
-		if err != nil {
-			panic(err)
+		d.finish()
+	}
+	return proceed, err
+}
+
+// finish stops reading from stdin and writes the program's output
+func (d *Debugger) finish() {
+	d.isFinished = true // stop the stdin go routine
+	if d.hasPrinted {
+		_, _ = fmt.Fprintln(d.screen, clearAndReturn)
+	}
+	if d.terminal != nil {
+		d.terminal.restore()
+	}
+	if d.random.used {
+		_, _ = fmt.Fprintf(d.screen, "random seed: %d (rerun with --seed %d to make the same choices)\n", d.random.seed,
+			d.random.seed)
+	}
+	_, err := fmt.Fprint(d.outfile, d.output.String())
+	if err != nil {
+		panic(err)
+	}
+}
+
+// interrupt shows the state of the program and runs the commands entered, until one which continues the program
+func (d *Debugger) interrupt() {
+	for {
+		d.printDebug(d.interruptedControls())
+		d.hasPrinted = true
+
+		if d.execute(<-d.stdinChan) {
+			return
 		}
 	}
+}
+
+// step steps the program forwards, remembering how to step back if the history is enabled
+func (d *Debugger) step() (bool, error) {
+	if d.config.HistoryLimit == 0 {
+		d.steps++
+		return d.befunge.Step()
+	}
+	d.steps++
+	if d.replay != nil {
+		d.replay.save(d.config.HistoryLimit)
+	}
+	proceed, undo, err := d.befunge.StepWithUndo()
+	d.history = append(d.history, undo)
+	if len(d.history) > d.config.HistoryLimit {
+		d.history[0] = nil
+		d.history = d.history[1:]
+		d.befunge.Forget(d.history[0])
+	}
 	return proceed, err
 }
 
+// stepBack reverts the latest step in the history, returning nil if there are none
+func (d *Debugger) stepBack() *pkg.Undo {
+	if len(d.history) == 0 {
+		return nil
+	}
+	undo := d.history[len(d.history)-1]
+	d.history = d.history[:len(d.history)-1]
+	d.befunge.Revert(undo)
+	if d.replay != nil {
+		d.replay.restore()
+	}
+	d.steps--
+	d.output.Truncate(d.output.Len() - len(undo.Output()))
+	d.watched = nil
+	return undo
+}
+
+// canStepBack returns an error explaining why the debugger can't step back, if it can't
+func (d *Debugger) canStepBack() error {
+	if d.config.HistoryLimit == 0 {
+		return errors.New("stepping back is disabled, as debugger.history-limit is 0")
+	}
+	if len(d.history) == 0 {
+		return errors.New("there are no steps to step back through")
+	}
+	return nil
+}
+
+// reverseContinue steps back until an instruction pointer is at a breakpoint whose conditions hold, or until just
+// before a step which put a watched cell, or until the history runs out
+func (d *Debugger) reverseContinue() {
+	for undo := d.stepBack(); undo != nil; undo = d.stepBack() {
+		for _, event := range undo.Puts() {
+			if slices.ContainsFunc(d.watchpoints, func(w *Watchpoint) bool { return w.Contains(event.Position) }) {
+				d.watched = append(d.watched, putMessage(event, "is put next"))
+			}
+		}
+		if len(d.watched) > 0 || d.atBreakpoint() {
+			return
+		}
+	}
+}
+
+// atBreakpoint whether any instruction pointer is at a breakpoint whose conditions hold
+func (d *Debugger) atBreakpoint() bool {
+	for _, ip := range d.befunge.IPs {
+		for _, b := range d.breakpoints {
+			if b.at(*ip.InstructionPointer) && b.holds(d.befunge, ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d *Debugger) ExitCode() int {
+	return d.befunge.ExitCode()
+}
+
 // pretty hacky
-func (d *Debugger) nextStepWillPromptForInput(char rune) bool {
-	return d.usingChanR &&
-		!d.befunge.StringMode &&
-		(char == '~' ||
-			char == '&' ||
-			((char == '/') || (char == '%')) && d.befunge.StackPeek() == 0)
+func (d *Debugger) ipAwaitingInput() (*pkg.IP, bool) {
+	if !d.usingChanR {
+		return nil, false
+	}
+	for _, ip := range d.befunge.IPs {
+		char := d.befunge.CharUnder(ip)
+		divisor, _ := ip.Stack.Peek()
+		if !ip.StringMode &&
+			(char == '~' ||
+				char == '&' ||
+				((char == '/') || (char == '%')) && divisor == 0) {
+			return ip, true
+		}
+	}
+	return nil, false
 }
 
 func (d *Debugger) awaitingInputControls(char rune) string {
@@ -188,10 +435,17 @@ func (d *Debugger) interruptedControls() string {
 		jumpString = fmt.Sprintf(", %s to jump to next breakpoint", d.colorOrNot(green, noColor).Sprint("j"))
 	}
 
-	return fmt.Sprintf("[%s to step, %s to continue%s, %s to exit] ",
+	var backString string
+	if d.config.HistoryLimit > 0 {
+		backString = fmt.Sprintf(", %s to step back", d.colorOrNot(green, noColor).Sprint("b"))
+	}
+
+	return fmt.Sprintf("[%s to step%s, %s to continue%s, %s for more commands, %s to exit] ",
 		d.colorOrNot(green, noColor).Sprint("return"),
+		backString,
 		d.colorOrNot(green, noColor).Sprint("c"),
 		jumpString,
+		d.colorOrNot(green, noColor).Sprint("help"),
 		d.colorOrNot(green, noColor).Sprint("ctrl+c"))
 }
 
@@ -208,86 +462,223 @@ func (d *Debugger) torusOutput() string {
 
 func (d *Debugger) stackOutput() string {
 	if d.config.ShowStack {
-		return fmt.Sprintf(`%s: [%s]
+		return d.stacksString()
+	}
+	return ""
+}
+
+// stacksString the stack stack of each instruction pointer
+func (d *Debugger) stacksString() string {
+	if len(d.befunge.IPs) == 1 {
+		return d.stackStackOutput(d.befunge.IPs[0], "")
+	}
+	strBuilder := new(strings.Builder)
+	for _, ip := range d.befunge.IPs {
+		strBuilder.WriteString(d.stackStackOutput(ip, d.ipColor(ip).Sprintf("ip %d ", ip.ID)))
+	}
+	return strBuilder.String()
+}
+
+func (d *Debugger) stackStackOutput(ip *pkg.IP, prefix string) string {
+	stacks := ip.Stacks.Stacks
+	if len(stacks) == 1 {
+		return fmt.Sprintf(`%s%s: [%s]
 `,
+			prefix,
 			bold.Sprint("stack"),
-			strings.Join(internal.MapSlice(d.befunge.Stack.Values, func(t int) string {
-				var unicodeParen = ""
-				if unicode.IsPrint(rune(t)) {
-					unicodeParen = fmt.Sprintf(" (%c)", rune(t))
-				}
-				return fmt.Sprintf("%d%s", t, unicodeParen)
-			}), ", "))
+			d.stackToString(stacks[0]))
 	}
-	return ""
+	strBuilder := new(strings.Builder)
+	strBuilder.WriteString(fmt.Sprintf("%s%s:\n", prefix, bold.Sprint("stacks")))
+	// the TOSS is printed first, down to the bottom of the stack stack
+	for i := len(stacks) - 1; i >= 0; i-- {
+		var label string
+		switch i {
+		case len(stacks) - 1:
+			label = " (TOSS)"
+		case len(stacks) - 2:
+			label = " (SOSS)"
+		}
+		strBuilder.WriteString(fmt.Sprintf("  %s%s: [%s]\n",
+			d.colorOrNot(faint, noColor).Sprint(len(stacks)-1-i),
+			label,
+			d.stackToString(stacks[i])))
+	}
+	return strBuilder.String()
 }
 
-func (d *Debugger) printDebug(action string) {
-	fmt.Printf(`%s%s: %d %s: %d %s: '%c'
+func (d *Debugger) stackToString(stack *pkg.Stack[int]) string {
+	return strings.Join(internal.MapSlice(stack.Values, d.cellString), ", ")
+}
 
-%s%s
+// cellString the value of a stack cell, followed by its character if it is printable
+func (d *Debugger) cellString(t int) string {
+	value := d.befunge.CellValue(t)
+	var unicodeParen = ""
+	if value.IsInt64() && value.Int64() == int64(rune(t)) && unicode.IsPrint(rune(t)) {
+		unicodeParen = fmt.Sprintf(" (%c)", rune(t))
+	}
+	return fmt.Sprintf("%s%s", value, unicodeParen)
+}
+
+func (d *Debugger) ipsOutput() string {
+	if len(d.befunge.IPs) == 1 {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s\n",
+		bold.Sprint("ips"),
+		strings.Join(internal.MapSlice(d.befunge.IPs, func(ip *pkg.IP) string {
+			return d.ipColor(ip).Sprintf("%d %s '%c'", ip.ID, ip.InstructionPointer, d.befunge.CharUnder(ip))
+		}), ", "))
+}
+
+// ipString describes the state of an instruction pointer
+func (d *Debugger) ipString(ip *pkg.IP) string {
+	str := fmt.Sprintf("ip %d at %s moving %s on '%c'", ip.ID, ip.InstructionPointer, ip.Delta(), d.befunge.CharUnder(ip))
+	if ip.StringMode {
+		str += " in string mode"
+	}
+	if *ip.StorageOffset != *pkg.NewVector2(0, 0) {
+		str += fmt.Sprintf(" with storage offset %s", ip.StorageOffset)
+	}
+	return str
+}
+
+// messageOutput the output of the commands entered since the state was last shown, after which they are cleared
+func (d *Debugger) messageOutput() string {
+	strBuilder := new(strings.Builder)
+	for _, message := range d.messages {
+		strBuilder.WriteString(message)
+		strBuilder.WriteRune('\n')
+	}
+	d.messages = nil
+	return strBuilder.String()
+}
+
+// watchOutput what each triggered watch saw, after which they are cleared
+func (d *Debugger) watchOutput() string {
+	strBuilder := new(strings.Builder)
+	for _, watched := range d.watched {
+		strBuilder.WriteString(fmt.Sprintf("%s: %s\n", bold.Sprint("watch"), watched))
+	}
+	d.watched = nil
+	return strBuilder.String()
+}
+
+func (d *Debugger) zOutput() string {
+	if d.befunge.Dimensions() != 3 {
+		return ""
+	}
+	return fmt.Sprintf("%s: %d ", bold.Sprint("z"), d.befunge.InstructionPointer.Z)
+}
+
+func (d *Debugger) printDebug(action string) {
+	_, _ = fmt.Fprintf(d.screen, `%s%s: %d %s: %d %s%s: '%c'
+%s
+%s%s%s
 %s: %s
-%s`,
+%s%s`,
 		clearAndReturn,
 		bold.Sprint("x"),
 		d.befunge.InstructionPointer.X,
 		bold.Sprint("y"),
 		d.befunge.InstructionPointer.Y,
+		d.zOutput(),
 		bold.Sprint("char"),
-		d.befunge.Torus.CharAt(d.befunge.InstructionPointer.X, d.befunge.InstructionPointer.Y),
+		d.befunge.CurrentChar(),
+		d.ipsOutput(),
+		d.watchOutput(),
 		d.torusOutput(),
 		d.stackOutput(),
 		bold.Sprint("output"),
 		d.output.String(),
+		d.messageOutput(),
 		action,
 	)
 }
 
+// torusBounds the bounds of funge-space, grown to include any instruction pointers which have wandered outside it
+func (d *Debugger) torusBounds() (*pkg.Vector, *pkg.Vector) {
+	least, greatest := d.befunge.Space.Bounds()
+	for _, ip := range d.befunge.IPs {
+		position := ip.InstructionPointer
+		least = pkg.NewVector3(min(least.X, position.X), min(least.Y, position.Y), min(least.Z, position.Z))
+		greatest = pkg.NewVector3(max(greatest.X, position.X), max(greatest.Y, position.Y), max(greatest.Z, position.Z))
+	}
+	return least, greatest
+}
+
+// ipPositions the instruction pointer at each position. The first at a position takes precedence
+func (d *Debugger) ipPositions() map[pkg.Vector]*pkg.IP {
+	ips := make(map[pkg.Vector]*pkg.IP)
+	for _, ip := range slices.Backward(d.befunge.IPs) {
+		ips[*ip.InstructionPointer] = ip
+	}
+	return ips
+}
+
+// viewportSize the number of columns and rows of the torus to show, which are either configured, or as many as fit in
+// the terminal. 0 shows all of them
+func (d *Debugger) viewportSize() (int, int) {
+	width, height := d.config.ViewportWidth, d.config.ViewportHeight
+	if width > 0 && height > 0 {
+		return width, height
+	}
+	screenWidth, screenHeight, err := d.screenSize()
+	if err != nil || screenWidth == 0 || screenHeight == 0 {
+		return width, height
+	}
+	if width == 0 {
+		width = max(screenWidth-viewportMarginWidth, viewportMinimum)
+	}
+	if height == 0 {
+		height = max(screenHeight-viewportMarginHeight, viewportMinimum)
+	}
+	return width, height
+}
+
+// view the bounds of the part of the torus to show. If the torus is bigger than the viewport, the view scrolls to keep
+// the instruction pointer in it
+func (d *Debugger) view(least *pkg.Vector, greatest *pkg.Vector) (*pkg.Vector, *pkg.Vector) {
+	width, height := d.viewportSize()
+	focus := d.befunge.InstructionPointer
+	from, to := *least, *greatest
+	if width > 0 {
+		d.viewport.X = scroll(d.viewport.X, focus.X, width, least.X, greatest.X)
+		from.X, to.X = d.viewport.X, min(greatest.X, d.viewport.X+width-1)
+	}
+	if height > 0 {
+		d.viewport.Y = scroll(d.viewport.Y, focus.Y, height, least.Y, greatest.Y)
+		from.Y, to.Y = d.viewport.Y, min(greatest.Y, d.viewport.Y+height-1)
+	}
+	return &from, &to
+}
+
 func (d *Debugger) torusToString() string {
 	strBuilder := new(strings.Builder)
-	torus := d.befunge.Torus
-	strBuilder.WriteString(d.colorOrNot(cyan, noColor).Sprint("╔"))
-	strBuilder.WriteString(d.colorOrNot(cyan, noColor).Sprint(strings.Repeat("═", torus.Width)))
-	strBuilder.WriteString(d.colorOrNot(cyan, noColor).Sprint("╗"))
-	strBuilder.WriteString("\n")
-	for y, line := range torus.Chars {
-		strBuilder.WriteString(d.colorOrNot(cyan, noColor).Sprint("║"))
-		for x, char := range line {
-			currentPointer := *pkg.NewVector2(x, y)
-			out := string(char)
-			isBreakpoint := slices.Contains(d.breakpoints, currentPointer)
-			isCursor := *d.befunge.InstructionPointer == currentPointer
-			if isBreakpoint && isCursor {
-				if char == ' ' {
-					out = d.colorOrNot(redBgAndBoldAndUnderlined, boldAndUnderlined).Sprint(out)
-				} else {
-					out = d.colorOrNot(redAndBoldAndUnderlined, boldAndUnderlined).Sprint(out)
-				}
-			} else if isBreakpoint {
-				if char == ' ' {
-					out = d.colorOrNot(redBg, noColor).Sprint(out)
-				} else {
-					out = d.colorOrNot(red, noColor).Sprint(out)
-				}
-			} else if isCursor {
-				out = boldAndUnderlined.Sprint(out)
+	// instruction pointers can wander outside the bounds of an unbounded funge-space, so show them too
+	least, greatest := d.torusBounds()
+	from, to := d.view(least, greatest)
+	ips := d.ipPositions()
+	// Trefunge programs are shown one layer at a time
+	for z := least.Z; z <= greatest.Z; z++ {
+		if d.befunge.Dimensions() == 3 {
+			if z != least.Z {
+				strBuilder.WriteRune('\n')
 			}
-			strBuilder.WriteString(out)
+			strBuilder.WriteString(d.colorOrNot(faint, noColor).Sprintf("z=%d", z))
+			strBuilder.WriteRune('\n')
 		}
-		strBuilder.WriteString(d.colorOrNot(cyan, noColor).Sprint("║"))
-		strBuilder.WriteString(d.colorOrNot(faint, noColor).Sprint(y))
-		strBuilder.WriteRune('\n')
+		d.writeLayer(strBuilder, z, from, to, least, greatest, ips)
 	}
-	strBuilder.WriteString(d.colorOrNot(cyan, noColor).Sprint("╚"))
-	strBuilder.WriteString(d.colorOrNot(cyan, noColor).Sprint(strings.Repeat("═", torus.Width)))
-	strBuilder.WriteString(d.colorOrNot(cyan, noColor).Sprint("╝"))
 	if d.config.ShowTorusCoordinates {
 		strBuilder.WriteRune('\n')
 		var str0s strings.Builder
 		var str10s strings.Builder
 		var str100s strings.Builder
 		cFaint := d.colorOrNot(faint, noColor)
-		for i := range torus.Width {
+		for x := from.X; x <= to.X; x++ {
+			i := abs(x)
 			mod10 := i % 10
 			mod100 := i % 100
 			str0s.WriteString(cFaint.Sprint(mod10))
@@ -302,12 +693,13 @@ func (d *Debugger) torusToString() string {
 				str10s.WriteString(" ")
 			}
 		}
-		if torus.Width > 100 {
+		widest := max(abs(from.X), abs(to.X))
+		if widest >= 100 {
 			strBuilder.WriteString(" ")
 			strBuilder.WriteString(str100s.String())
 			strBuilder.WriteRune('\n')
 		}
-		if torus.Width > 10 {
+		if widest >= 10 {
 			strBuilder.WriteString(" ")
 			strBuilder.WriteString(str10s.String())
 			strBuilder.WriteRune('\n')
@@ -319,6 +711,77 @@ func (d *Debugger) torusToString() string {
 	return strBuilder.String()
 }
 
+// writeLayer writes the part of a layer of the torus between from and to in a box. The edges of the box are solid
+// where the instruction pointer wraps around to the opposite edge, or dashed with an arrow if the torus continues past
+// them out of view
+func (d *Debugger) writeLayer(strBuilder *strings.Builder, z int, from *pkg.Vector, to *pkg.Vector, least *pkg.Vector,
+	greatest *pkg.Vector, ips map[pkg.Vector]*pkg.IP) {
+	cCyan := d.colorOrNot(cyan, noColor)
+	width, height := to.X-from.X+1, to.Y-from.Y+1
+	strBuilder.WriteString(cCyan.Sprint("╔"))
+	strBuilder.WriteString(cCyan.Sprint(torusEdge(width, from.Y > least.Y, '═', '┄', '▲')))
+	strBuilder.WriteString(cCyan.Sprint("╗"))
+	strBuilder.WriteString("\n")
+	left := []rune(torusEdge(height, from.X > least.X, '║', '┆', '◀'))
+	right := []rune(torusEdge(height, to.X < greatest.X, '║', '┆', '▶'))
+	for y := from.Y; y <= to.Y; y++ {
+		strBuilder.WriteString(cCyan.Sprint(string(left[y-from.Y])))
+		for x := from.X; x <= to.X; x++ {
+			currentPointer := *pkg.NewVector3(x, y, z)
+			char := d.befunge.Space.Get(&currentPointer)
+			out := string(char)
+			isBreakpoint := slices.ContainsFunc(d.breakpoints, func(b *Breakpoint) bool {
+				return b.Position == currentPointer
+			})
+			ip, isCursor := ips[currentPointer]
+			if isBreakpoint && isCursor {
+				if char == ' ' {
+					out = d.colorOrNot(redBgAndBoldAndUnderlined, boldAndUnderlined).Sprint(out)
+				} else {
+					out = d.colorOrNot(redAndBoldAndUnderlined, boldAndUnderlined).Sprint(out)
+				}
+			} else if isBreakpoint {
+				if char == ' ' {
+					out = d.colorOrNot(redBg, noColor).Sprint(out)
+				} else {
+					out = d.colorOrNot(red, noColor).Sprint(out)
+				}
+			} else if isCursor {
+				out = d.ipColor(ip).Sprint(out)
+			}
+			strBuilder.WriteString(out)
+		}
+		strBuilder.WriteString(cCyan.Sprint(string(right[y-from.Y])))
+		strBuilder.WriteString(d.colorOrNot(faint, noColor).Sprint(y))
+		strBuilder.WriteRune('\n')
+	}
+	strBuilder.WriteString(cCyan.Sprint("╚"))
+	strBuilder.WriteString(cCyan.Sprint(torusEdge(width, to.Y < greatest.Y, '═', '┄', '▼')))
+	strBuilder.WriteString(cCyan.Sprint("╝"))
+}
+
+// torusEdge an edge of the box around the torus, which is dashed with an arrow in the middle if the torus continues past
+// it out of view
+func torusEdge(length int, clipped bool, solid rune, dashed rune, arrow rune) string {
+	if !clipped {
+		return strings.Repeat(string(solid), length)
+	}
+	edge := []rune(strings.Repeat(string(dashed), length))
+	edge[length/2] = arrow
+	return string(edge)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (d *Debugger) ipColor(ip *pkg.IP) *color.Color {
+	return d.colorOrNot(ipColors[ip.ID%len(ipColors)], boldAndUnderlined)
+}
+
 func (d *Debugger) colorOrNot(c *color.Color, def *color.Color) *color.Color {
 	if d.config.EnableColors {
 		return c
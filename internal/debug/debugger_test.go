@@ -0,0 +1,205 @@
+package debug
+
+import (
+	"errors"
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/pkg"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestDebugger_stepBack(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		historyLimit int
+		// the number of steps back which can be taken after four steps forwards, and the output left after taking them
+		stepsBack int
+		output    string
+	}{
+		{"unlimited", 10000, 4, ""},
+		{"limited", 2, 2, "1"},
+		{"disabled", 0, 0, "12"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+
+			cfg := config.DefaultConfig()
+			cfg.Debugger.HistoryLimit = test.historyLimit
+			d := NewDebugger(&cfg, "1.2.3.@", &strings.Builder{}, strings.NewReader(""), nil, nil, nil, 0)
+			for range 4 {
+				_, err := d.step()
+				asserts.NoError(err)
+			}
+			asserts.Equal("12", d.output.String())
+			stepsBack := 0
+			for d.stepBack() != nil {
+				stepsBack++
+			}
+			asserts.Equal(test.stepsBack, stepsBack)
+			asserts.Equal(test.output, d.output.String())
+			asserts.Equal(*pkg.NewVector2(4-test.stepsBack, 0), *d.befunge.InstructionPointer)
+		})
+	}
+}
+
+func TestDebugger_reverseContinue(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	// counts down from 3 to 0, reaching the > at (1,0) on steps 1, 10, 19 and 28 with 3, 2, 1 and 0 on top of the stack
+	breakpoint, err := ParseBreakpoint("1,0 if top==1")
+	if !asserts.NoError(err) {
+		return
+	}
+	cfg := config.DefaultConfig()
+	d := NewDebugger(&cfg, "3>:#v_@\n ^-1<", &strings.Builder{}, strings.NewReader(""),
+		[]*Breakpoint{breakpoint}, nil, nil, 0)
+	for range 30 {
+		_, err := d.step()
+		asserts.NoError(err)
+	}
+	d.reverseContinue()
+	asserts.Len(d.history, 19, "should stop before the last step where the breakpoint's condition held")
+	asserts.Equal(*pkg.NewVector2(1, 0), *d.befunge.InstructionPointer)
+	asserts.Equal([]int{1}, d.befunge.Stack.Values)
+	d.reverseContinue()
+	asserts.Empty(d.history, "should stop at the start of the history")
+	asserts.Equal(*pkg.NewVector2(0, 0), *d.befunge.InstructionPointer)
+
+	watchpoint, err := ParseWatchpoint("6,0")
+	if !asserts.NoError(err) {
+		return
+	}
+	d = NewDebugger(&cfg, `"1"50p"@"60p`, &strings.Builder{}, strings.NewReader(""), nil,
+		[]*Watchpoint{watchpoint}, nil, 0)
+	for range 14 {
+		_, err := d.step()
+		asserts.NoError(err)
+	}
+	d.watched = nil
+	d.reverseContinue()
+	asserts.Len(d.history, 11, "should stop before the step which put the watched cell")
+	asserts.Equal([]string{`(6,0) is put next by ip 0 at (11,0): '"' (34) -> '@' (64)`}, d.watched)
+}
+
+func TestDebugger_torusToString(t *testing.T) {
+	t.Parallel()
+
+	program := strings.Repeat("0123456789", 3) + "\n" + strings.Repeat("abcdefghij", 3) + "\n" +
+		strings.Repeat("ABCDEFGHIJ", 3)
+	tests := []struct {
+		name        string
+		width       int // the configured viewport width
+		height      int // the configured viewport height
+		screenWidth int // the width of the terminal, or 0 if it isn't one
+		ip          *pkg.Vector
+		coordinates bool
+		expected    []string
+	}{
+		{"whole torus", 0, 0, 0, pkg.NewVector2(0, 0), false, []string{
+			"╔" + strings.Repeat("═", 30) + "╗",
+			"║" + strings.Repeat("0123456789", 3) + "║0",
+			"║" + strings.Repeat("abcdefghij", 3) + "║1",
+			"║" + strings.Repeat("ABCDEFGHIJ", 3) + "║2",
+			"╚" + strings.Repeat("═", 30) + "╝",
+		}},
+		{"viewport", 10, 2, 0, pkg.NewVector2(0, 0), false, []string{
+			"╔══════════╗",
+			"║0123456789┆0",
+			"║abcdefghij▶1",
+			"╚┄┄┄┄┄▼┄┄┄┄╝",
+		}},
+		{"fits the terminal", 0, 2, 18, pkg.NewVector2(0, 0), false, []string{
+			"╔══════════╗",
+			"║0123456789┆0",
+			"║abcdefghij▶1",
+			"╚┄┄┄┄┄▼┄┄┄┄╝",
+		}},
+		{"follows the ip", 10, 2, 0, pkg.NewVector2(25, 2), false, []string{
+			"╔┄┄┄┄┄▲┄┄┄┄╗",
+			"┆ijabcdefgh┆1",
+			"◀IJABCDEFGH▶2",
+			"╚══════════╝",
+		}},
+		{"offset rulers", 10, 2, 0, pkg.NewVector2(25, 2), true, []string{
+			"╔┄┄┄┄┄▲┄┄┄┄╗",
+			"┆ijabcdefgh┆1",
+			"◀IJABCDEFGH▶2",
+			"╚══════════╝",
+			"   2       ",
+			" 8901234567",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.DefaultConfig()
+			cfg.Debugger.EnableColors = false
+			cfg.Debugger.ShowTorusCoordinates = test.coordinates
+			cfg.Debugger.ViewportWidth, cfg.Debugger.ViewportHeight = test.width, test.height
+			d := NewDebugger(&cfg, program, &strings.Builder{}, strings.NewReader(""), nil, nil, nil, 0)
+			d.screenSize = func() (int, int, error) {
+				if test.screenWidth == 0 {
+					return 0, 0, errors.New("not a terminal")
+				}
+				return test.screenWidth, 24, nil
+			}
+			*d.befunge.InstructionPointer = *test.ip
+			assert.Equal(t, strings.Join(test.expected, "\n"), d.torusToString())
+		})
+	}
+}
+
+func TestDebugger_randomSeed(t *testing.T) {
+	t.Parallel()
+
+	seed := uint64(3)
+	tests := []struct {
+		name   string
+		funge  string
+		seed   *uint64
+		screen string // what is shown when the debugger finishes
+	}{
+		{"seeded", "v\n?1.@\n2\n.\n@", &seed, "random seed: 3 (rerun with --seed 3 to make the same choices)\n"},
+		{"not random", "1.@", &seed, ""},
+		{"unseeded", "1.@", nil, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+
+			var outputs []string
+			for range 2 {
+				cfg := config.DefaultConfig()
+				cfg.Interpreter.RandomSeed = test.seed
+				d := NewDebugger(&cfg, test.funge, &strings.Builder{}, strings.NewReader(""), nil, nil, nil, 0)
+				screen := &strings.Builder{}
+				d.screen = screen
+				for proceed, i := true, 0; proceed && i < 100; i++ {
+					var err error
+					proceed, err = d.step()
+					asserts.NoError(err)
+				}
+				d.finish()
+				asserts.Equal(test.screen, screen.String())
+				outputs = append(outputs, d.output.String())
+
+				asserts.False(d.execute("info\n"))
+				if test.seed != nil {
+					asserts.Contains(d.messages, "random seed: 3")
+				}
+			}
+			asserts.Equal(outputs[0], outputs[1])
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package debug
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kagof/kagofunge/pkg"
+	"io"
+	"math/big"
+)
+
+// replay drives a program to follow a recorded trace, choosing the same direction at each ? as the trace did, and
+// pushing the same numbers at each of FIXP's D. The program reads the input consumed by the trace, so each & and ~ reads
+// the same input
+type replay struct {
+	records []*pkg.TraceRecord
+	replayState
+	history   []replayState // the state before each step in the debugger's history
+	interrupt bool          // whether the program has diverged since the debugger last paused
+}
+
+type replayState struct {
+	next     int  // the index of the record of the next instruction
+	diverged bool // whether the program has stopped following the trace
+}
+
+// ReplayInput the input consumed by a trace, which a program replaying it reads
+func ReplayInput(records []*pkg.TraceRecord) io.Reader {
+	var input []byte
+	for _, record := range records {
+		input = append(input, record.Input...)
+	}
+	return bytes.NewReader(input)
+}
+
+// Replay makes the program follow a recorded trace, pausing if it diverges from it. The program's input should be
+// ReplayInput of the same trace
+func (d *Debugger) Replay(records []*pkg.TraceRecord) {
+	d.replay = &replay{records: records}
+	d.befunge.OnStep(d.replayStep)
+}
+
+// replayStep checks that an instruction is the next one in the trace, and if its result was random, makes it the same as
+// in the trace
+func (d *Debugger) replayStep(event pkg.StepEvent) {
+	r := d.replay
+	if r.diverged {
+		return
+	}
+	if r.next >= len(r.records) {
+		r.diverged, r.interrupt = true, true
+		d.message("the program continued past the end of the trace, at ip %d executing %q at %s", event.IP.ID,
+			event.Char, &event.Position)
+		return
+	}
+	record := r.records[r.next]
+	position := *pkg.NewVector3(record.X, record.Y, record.Z)
+	if record.IP != event.IP.ID || position != event.Position || record.Char != event.Char {
+		r.diverged, r.interrupt = true, true
+		d.message("the program diverged from the trace at tick %d: ip %d executed %q at %s, rather than ip %d "+
+			"executing %q at %s", record.Tick, event.IP.ID, event.Char, &event.Position, record.IP, record.Char,
+			&position)
+		return
+	}
+	r.next++
+	if record.StringMode {
+		return
+	}
+	switch record.Char {
+	case '?', 'k':
+		// ? chooses a direction at random, including when it is iterated by k
+		event.IP.SetDelta(pkg.NewVector3(record.DX, record.DY, record.DZ))
+	}
+	switch record.Char {
+	case 'D', 'k':
+		// FIXP's D pushes a random number, including when it is iterated by k
+		if !d.replayStack(event.IP, record.Stack) {
+			r.diverged, r.interrupt = true, true
+			d.message("the program diverged from the trace at tick %d: ip %d's stack is not as recorded", record.Tick,
+				event.IP.ID)
+		}
+	}
+}
+
+// replayStack makes the value on top of the stack the one recorded in the trace, which is top first, as D pushes it at
+// random. Each D pops the value the one before it pushed, so even when iterated by k only the top value is random. The
+// values under it must be as recorded, otherwise it is false and the stack is left as it is
+func (d *Debugger) replayStack(ip *pkg.IP, values []*big.Int) bool {
+	stack := ip.Stack.Values
+	if len(stack) < len(values) {
+		return false
+	}
+	for i, value := range values {
+		if i > 0 && d.befunge.CellValue(stack[len(stack)-1-i]).Cmp(value) != 0 {
+			return false
+		}
+	}
+	if len(values) == 0 {
+		return true
+	}
+	top, err := d.befunge.Cell(values[0])
+	if err != nil {
+		return false
+	}
+	ip.Stack.Pop()
+	ip.Stack.Push(top)
+	return true
+}
+
+// save remembers the state before a step, so that it can be restored when the step is stepped back through
+func (r *replay) save(limit int) {
+	r.history = append(r.history, r.replayState)
+	if len(r.history) > limit {
+		r.history = r.history[1:]
+	}
+}
+
+func (r *replay) restore() {
+	r.replayState = r.history[len(r.history)-1]
+	r.history = r.history[:len(r.history)-1]
+}
+
+func (r *replay) String() string {
+	if r.diverged {
+		return fmt.Sprintf("diverged from record %d of %d", r.next+1, len(r.records))
+	}
+	return fmt.Sprintf("%d of %d records replayed", r.next, len(r.records))
+}
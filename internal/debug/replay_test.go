@@ -0,0 +1,197 @@
+package debug
+
+import (
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/pkg"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestDebugger_Replay(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		funge    string
+		trace    string
+		output   string
+		messages []string // the messages of the debugger when the program has finished
+	}{
+		{"west", "?1.@", "1 ip 0 (0,0) '?' -> (-1,0) []\n2 ip 0 (3,0) '@' -> (-1,0) []", "", nil},
+		{"east", "?1.@", strings.Join([]string{
+			"1 ip 0 (0,0) '?' -> (0,1) []",
+			"2 ip 0 (0,0) '?' -> (1,0) []",
+			"3 ip 0 (1,0) '1' -> (1,0) [1]",
+			`4 ip 0 (2,0) '.' -> (1,0) [] out "1"`,
+			"5 ip 0 (3,0) '@' -> (1,0) []",
+		}, "\n"), "1", nil},
+		{"input", "&~?.,@", strings.Join([]string{
+			`1 ip 0 (0,0) '&' -> (1,0) [12] in "12\n"`,
+			`2 ip 0 (1,0) '~' -> (1,0) [97 12] in "a"`,
+			"3 ip 0 (2,0) '?' -> (1,0) [97 12]",
+			`4 ip 0 (3,0) '.' -> (1,0) [12] out "97"`,
+			`5 ip 0 (4,0) ',' -> (1,0) [] out "\x0c"`,
+			"6 ip 0 (5,0) '@' -> (1,0) []",
+		}, "\n"), "97\x0c", nil},
+		{"diverged", "?2.@", "1 ip 0 (0,0) '?' -> (1,0) []\n2 ip 0 (1,0) '1' -> (1,0) [1]", "2", []string{
+			"the program diverged from the trace at tick 2: ip 0 executed '2' at (1,0), rather than ip 0 executing " +
+				"'1' at (1,0)",
+		}},
+		{"past the end", "?1.@", "1 ip 0 (0,0) '?' -> (1,0) []", "1", []string{
+			"the program continued past the end of the trace, at ip 0 executing '1' at (1,0)",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+
+			records, err := pkg.ReadTrace(strings.NewReader(test.trace))
+			if !asserts.NoError(err) {
+				return
+			}
+			// ? would go a random way each time if it weren't replayed
+			for range 10 {
+				cfg := config.DefaultConfig()
+				d := NewDebugger(&cfg, test.funge, &strings.Builder{}, ReplayInput(records), nil, nil, nil, 0)
+				d.Replay(records)
+				for proceed, i := true, 0; proceed && i < 100; i++ {
+					proceed, err = d.step()
+					asserts.NoError(err)
+				}
+				asserts.Equal(test.output, d.output.String())
+				asserts.Equal(test.messages, d.messages)
+				asserts.Equal(test.messages != nil, d.paused(), "the debugger pauses if the program diverges")
+			}
+		})
+	}
+}
+
+func TestDebugger_ReplayStepBack(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	records, err := pkg.ReadTrace(strings.NewReader(strings.Join([]string{
+		"1 ip 0 (0,0) '?' -> (0,1) []",
+		"2 ip 0 (0,0) '?' -> (1,0) []",
+		"3 ip 0 (1,0) '1' -> (1,0) [1]",
+	}, "\n")))
+	if !asserts.NoError(err) {
+		return
+	}
+	cfg := config.DefaultConfig()
+	d := NewDebugger(&cfg, "?1.@", &strings.Builder{}, ReplayInput(records), nil, nil, nil, 0)
+	d.Replay(records)
+	for range 3 {
+		_, err = d.step()
+		asserts.NoError(err)
+	}
+	asserts.Equal("3 of 3 records replayed", d.replay.String())
+	_, err = d.step()
+	asserts.NoError(err)
+	asserts.Equal("diverged from record 4 of 3", d.replay.String())
+
+	for range 3 {
+		d.stepBack()
+	}
+	asserts.Equal("1 of 3 records replayed", d.replay.String())
+	for range 2 {
+		_, err = d.step()
+		asserts.NoError(err)
+	}
+	asserts.Equal(*pkg.NewVector2(2, 0), *d.befunge.InstructionPointer, "the ? goes the same way again")
+}
+
+func TestDebugger_Replay98(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		funge string
+	}{
+		{"iterate", "3k?1.@"},
+		{"fixp", `"PXIF"4(fff**D.@`},
+		{"iterate_fixp", `"PXIF"4(fff**3kD.@`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+
+			cfg := config.DefaultConfig()
+			cfg.Interpreter.Dialect = config.Dialect98
+			var trace, output strings.Builder
+			befunge := pkg.NewBefunge(&cfg, test.funge, &output, strings.NewReader(""))
+			befunge.SetRandomSource(pkg.NewRandomSource(42))
+			writer, err := pkg.NewTraceWriter(&trace, pkg.TraceFormatText)
+			if !asserts.NoError(err) {
+				return
+			}
+			recorder := pkg.NewTraceRecorder(befunge, writer, 4)
+			for proceed, i := true, 0; proceed && i < 1000; i++ {
+				proceed, err = recorder.Step()
+				asserts.NoError(err)
+			}
+			records, err := pkg.ReadTrace(strings.NewReader(trace.String()))
+			if !asserts.NoError(err) {
+				return
+			}
+
+			// each replay makes different random choices unless they are replayed
+			for seed := range uint64(10) {
+				cfg.Interpreter.RandomSeed = &seed
+				d := NewDebugger(&cfg, test.funge, &strings.Builder{}, ReplayInput(records), nil, nil, nil, 0)
+				d.Replay(records)
+				for proceed, i := true, 0; proceed && i < 1000; i++ {
+					proceed, err = d.step()
+					asserts.NoError(err)
+				}
+				asserts.Equal(output.String(), d.output.String())
+				asserts.Nil(d.messages)
+			}
+		})
+	}
+}
+
+func TestDebugger_ReplayStack(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		trace    string
+		messages []string
+	}{
+		{"same", "1 ip 0 (0,0) '7' -> (1,0) [7]\n2 ip 0 (1,0) '2' -> (1,0) [2 7]\n3 ip 0 (2,0) 'k' -> (1,0) [1 1 7]",
+			[]string{"the program continued past the end of the trace, at ip 0 executing '.' at (4,0)"}},
+		// only the value on top of the stack can be random, so the others are compared with the trace
+		{"different", "1 ip 0 (0,0) '7' -> (1,0) [7]\n2 ip 0 (1,0) '2' -> (1,0) [2 7]\n3 ip 0 (2,0) 'k' -> (1,0) [1 1 8]",
+			[]string{"the program diverged from the trace at tick 3: ip 0's stack is not as recorded"}},
+		{"deeper", "1 ip 0 (0,0) '7' -> (1,0) [7]\n2 ip 0 (1,0) '2' -> (1,0) [2 7]\n3 ip 0 (2,0) 'k' -> (1,0) [1 1 7 0]",
+			[]string{"the program diverged from the trace at tick 3: ip 0's stack is not as recorded"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+
+			records, err := pkg.ReadTrace(strings.NewReader(test.trace))
+			if !asserts.NoError(err) {
+				return
+			}
+			cfg := config.DefaultConfig()
+			cfg.Interpreter.Dialect = config.Dialect98
+			d := NewDebugger(&cfg, "72k1.@", &strings.Builder{}, ReplayInput(records), nil, nil, nil, 0)
+			d.Replay(records)
+			for proceed, i := true, 0; proceed && i < 100; i++ {
+				proceed, err = d.step()
+				asserts.NoError(err)
+			}
+			asserts.Equal("1", d.output.String(), "the stack is left as it is when the program diverges")
+			asserts.Equal(test.messages, d.messages)
+		})
+	}
+}
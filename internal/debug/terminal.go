@@ -0,0 +1,60 @@
+package debug
+
+import (
+	"bufio"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strings"
+)
+
+const prompt = "> "
+
+// lineReader reads the lines typed into the debugger, without their line endings
+type lineReader interface {
+	ReadLine() (string, error)
+}
+
+// plainLineReader reads lines from input which isn't a terminal, such as a pipe
+type plainLineReader struct {
+	reader *bufio.Reader
+}
+
+func (r plainLineReader) ReadLine() (string, error) {
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// terminal puts stdin into raw mode so that lines can be edited, with a history of the lines entered and tab completion
+// of commands. The screen is written to through the terminal, so that it can keep the line being edited below it
+type terminal struct {
+	*term.Terminal
+	fd    int
+	state *term.State
+}
+
+// newTerminal sets up the terminal if stdin and stdout are both terminals, or returns false if not
+func newTerminal(complete func(line string, pos int, key rune) (string, int, bool)) (*terminal, bool) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil, false
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, false
+	}
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, prompt)
+	t.AutoCompleteCallback = complete
+	return &terminal{Terminal: t, fd: fd, state: state}, true
+}
+
+// restore takes the terminal out of raw mode
+func (t *terminal) restore() {
+	_ = term.Restore(t.fd, t.state)
+}
@@ -0,0 +1,788 @@
+package debug
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/kagof/kagofunge/internal"
+	"github.com/kagof/kagofunge/pkg"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// the smallest terminal the full-screen debugger can be drawn in
+	tuiMinWidth  = 50
+	tuiMinHeight = 16
+	// how often the screen is redrawn while the program is running
+	tuiRedrawInterval = 50 * time.Millisecond
+	// the most messages kept for the messages pane
+	tuiMaxMessages = 500
+)
+
+var (
+	reverse   = color.New(color.ReverseVideo)
+	regexANSI = regexp.MustCompile("\033\\[[0-9;]*m")
+)
+
+// key a keystroke read in raw mode, which is either a printable character or the name of another key
+type key string
+
+const (
+	keyUp        key = "up"
+	keyDown      key = "down"
+	keyLeft      key = "left"
+	keyRight     key = "right"
+	keyEnter     key = "enter"
+	keyEscape    key = "escape"
+	keyBackspace key = "backspace"
+	keyTab       key = "tab"
+	keyCtrlC     key = "ctrl+c"
+	keyCtrlD     key = "ctrl+d"
+)
+
+// parseKeys parses the keystrokes in bytes read from a terminal in raw mode. Escape sequences for keys which aren't
+// used are dropped
+func parseKeys(b []byte) []key {
+	var keys []key
+	for len(b) > 0 {
+		switch c := b[0]; {
+		case c == '\033' && len(b) > 2 && (b[1] == '[' || b[1] == 'O'):
+			// a control sequence ends with a byte in the range @ to ~
+			end := 2
+			for end < len(b) && (b[end] < '@' || b[end] > '~') {
+				end++
+			}
+			if end < len(b) {
+				switch b[end] {
+				case 'A':
+					keys = append(keys, keyUp)
+				case 'B':
+					keys = append(keys, keyDown)
+				case 'C':
+					keys = append(keys, keyRight)
+				case 'D':
+					keys = append(keys, keyLeft)
+				}
+			}
+			b = b[min(end+1, len(b)):]
+			continue
+		case c == '\033':
+			keys = append(keys, keyEscape)
+		case c == '\r' || c == '\n':
+			keys = append(keys, keyEnter)
+		case c == 0x7f || c == '\b':
+			keys = append(keys, keyBackspace)
+		case c == '\t':
+			keys = append(keys, keyTab)
+		case c == 0x03:
+			keys = append(keys, keyCtrlC)
+		case c == 0x04:
+			keys = append(keys, keyCtrlD)
+		case c < ' ':
+		default:
+			r, size := utf8.DecodeRune(b)
+			keys = append(keys, key(string(r)))
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// tuiPrompt a line being typed into the full-screen debugger, either a command or input for the program
+type tuiPrompt struct {
+	input   bool
+	line    string
+	history int // the index of the command from the history being edited, or len(history) for a new command
+}
+
+// tui the full-screen debugger. It draws the torus, stacks, breakpoints, input, output and messages in separate panes,
+// redrawing only the lines of the screen which have changed, and is controlled by single keystrokes
+type tui struct {
+	d       *Debugger
+	screen  io.Writer
+	size    func() (int, int)
+	keys    chan key
+	started bool
+	restore func() // takes the terminal out of raw mode and the alternate screen
+
+	frame    []string    // the lines last drawn
+	drawn    time.Time   // when the screen was last drawn
+	state    string      // what the program is doing, eg paused
+	origin   pkg.Vector  // the top left of the torus pane's view of the torus
+	cursor   *pkg.Vector // the cell selected with the arrow keys, or nil to follow the instruction pointer
+	prompt   *tuiPrompt  // the line being typed, or nil
+	queue    []string    // lines of input typed before the program reads them
+	eof      bool        // whether the end of the input has been entered
+	history  []string    // the commands entered
+	messages []string    // the output of commands and watches
+}
+
+func newTUI(d *Debugger, screen io.Writer, size func() (int, int)) *tui {
+	return &tui{d: d, screen: screen, size: size, keys: make(chan key, 64)}
+}
+
+// terminalSize the size of the terminal stdout is, or a typical size if it isn't one or its size is unknown
+func terminalSize() (int, int) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width == 0 || height == 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// start puts the terminal into raw mode and switches to the alternate screen, and starts reading keystrokes
+func (t *tui) start() error {
+	t.started = true
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	_, _ = io.WriteString(t.screen, "\033[?1049h\033[?25l")
+	t.restore = func() {
+		_, _ = io.WriteString(t.screen, "\033[?25h\033[?1049l")
+		_ = term.Restore(fd, state)
+	}
+	go t.readKeys(os.Stdin)
+	return nil
+}
+
+func (t *tui) readKeys(reader io.Reader) {
+	buf := make([]byte, 256)
+	for {
+		n, err := reader.Read(buf)
+		for _, k := range parseKeys(buf[:n]) {
+			t.keys <- k
+		}
+		if err != nil {
+			close(t.keys)
+			return
+		}
+	}
+}
+
+func (t *tui) close() {
+	if t.restore != nil {
+		t.restore()
+		t.restore = nil
+	}
+}
+
+// step steps the program, first letting the user control it if it has paused, or if a key was pressed while running
+func (t *tui) step() (bool, error) {
+	d := t.d
+	if !t.started {
+		if err := t.start(); err != nil {
+			return false, err
+		}
+	}
+	if d.paused() {
+		d.jumping = false
+		t.interrupt()
+	} else if d.slowStepping() {
+		t.state = "stepping"
+		t.draw()
+		select {
+		case k, ok := <-t.keys:
+			t.running(k, ok)
+		case <-time.After(d.autoSpeed):
+		}
+	} else {
+		t.state = "running"
+		select {
+		case k, ok := <-t.keys:
+			t.running(k, ok)
+		default:
+		}
+		if time.Since(t.drawn) >= tuiRedrawInterval {
+			t.draw()
+		}
+	}
+
+	if d.quitting {
+		t.close()
+		d.finish()
+		return false, nil
+	}
+	proceed, err := d.step()
+	if err != nil {
+		t.close()
+		return proceed, err
+	}
+	if !proceed {
+		t.state = fmt.Sprintf("finished with exit code %d, press any key to exit", d.ExitCode())
+		t.draw()
+		<-t.keys
+		t.close()
+		d.finish()
+	}
+	return proceed, nil
+}
+
+// running handles a key pressed while the program is running, which can pause or quit it
+func (t *tui) running(k key, ok bool) {
+	switch {
+	case !ok || k == keyCtrlC || k == "q":
+		t.d.quitting = true
+	case k == "p" || k == " " || k == keyEscape:
+		t.interrupt()
+	}
+}
+
+// interrupt handles keys until one resumes the program
+func (t *tui) interrupt() {
+	t.state = "paused"
+	t.collect()
+	for {
+		t.draw()
+		k, ok := <-t.keys
+		if !ok {
+			t.d.quitting = true
+			return
+		}
+		if t.handle(k) {
+			return
+		}
+	}
+}
+
+// shortcuts the command run by each key while the program is paused
+var shortcuts = map[key]string{
+	"s":      "step",
+	" ":      "step",
+	keyEnter: "step",
+	"c":      "continue",
+	"b":      "back",
+	"r":      "reverse-continue",
+	"j":      "jump",
+	"q":      "quit",
+	keyCtrlC: "quit",
+}
+
+// handle handles a key pressed while the program is paused, returning whether it resumes the program
+func (t *tui) handle(k key) bool {
+	if t.prompt != nil {
+		return t.edit(k)
+	}
+	d := t.d
+	if command, ok := shortcuts[k]; ok {
+		if command == "jump" && d.autoSpeed == 0 {
+			return false
+		}
+		return t.execute(command)
+	}
+	switch k {
+	case keyUp, keyDown, keyLeft, keyRight:
+		if t.cursor == nil {
+			position := *d.befunge.InstructionPointer
+			t.cursor = &position
+		}
+		switch k {
+		case keyUp:
+			t.cursor.Y--
+		case keyDown:
+			t.cursor.Y++
+		case keyLeft:
+			t.cursor.X--
+		default:
+			t.cursor.X++
+		}
+	case "f":
+		t.cursor = nil
+	case "t":
+		t.toggleBreakpoint()
+	case "i":
+		if d.stdinReader == nil {
+			t.message("the program's input is read from a file")
+		} else {
+			t.prompt = &tuiPrompt{input: true}
+		}
+	case ":":
+		t.prompt = &tuiPrompt{history: len(t.history)}
+	}
+	return false
+}
+
+// edit handles a key pressed while a line is being typed, returning whether entering it resumes the program
+func (t *tui) edit(k key) bool {
+	p := t.prompt
+	switch k {
+	case keyEnter:
+		t.prompt = nil
+		if p.input {
+			t.queue = append(t.queue, p.line)
+			return false
+		}
+		if p.line != "" {
+			t.history = append(t.history, p.line)
+		}
+		return t.execute(p.line)
+	case keyEscape, keyCtrlC, keyCtrlD:
+		t.prompt = nil
+		if p.input && k != keyEscape {
+			t.eof = true
+		}
+	case keyBackspace:
+		if p.line != "" {
+			_, size := utf8.DecodeLastRuneInString(p.line)
+			p.line = p.line[:len(p.line)-size]
+		}
+	case keyTab:
+		if !p.input {
+			if line, _, ok := t.d.complete(p.line, len(p.line), '\t'); ok {
+				p.line = line
+			}
+		}
+	case keyUp, keyDown:
+		if !p.input && len(t.history) > 0 {
+			if k == keyUp {
+				p.history = max(p.history-1, 0)
+			} else {
+				p.history = min(p.history+1, len(t.history))
+			}
+			p.line = ""
+			if p.history < len(t.history) {
+				p.line = t.history[p.history]
+			}
+		}
+	default:
+		if utf8.RuneCountInString(string(k)) == 1 {
+			p.line += string(k)
+		}
+	}
+	return false
+}
+
+// execute runs a command, keeping what it prints, and returns whether it resumes the program
+func (t *tui) execute(line string) bool {
+	resume := t.d.execute(line)
+	t.collect()
+	return resume
+}
+
+// readInput reads a line of the program's input, letting the user type it if none has been typed already
+func (t *tui) readInput() (string, bool) {
+	for len(t.queue) == 0 {
+		if t.eof {
+			return "", false
+		}
+		state := t.state
+		t.state = "awaiting input"
+		t.prompt = &tuiPrompt{input: true}
+		for t.prompt != nil && t.prompt.input {
+			t.draw()
+			k, ok := <-t.keys
+			if !ok {
+				t.eof = true
+				break
+			}
+			// escape only stops typing ahead, the program needs the input now
+			if k == keyEscape {
+				k = keyCtrlD
+			}
+			t.edit(k)
+		}
+		t.prompt, t.state = nil, state
+	}
+	line := t.queue[0]
+	t.queue = t.queue[1:]
+	return line + "\n", true
+}
+
+// toggleBreakpoint adds a breakpoint at the cursor, or at the instruction pointer, or deletes the one there
+func (t *tui) toggleBreakpoint() {
+	d := t.d
+	position := *t.focus()
+	if i := slices.IndexFunc(d.breakpoints, func(b *Breakpoint) bool { return b.Position == position }); i >= 0 {
+		t.message(fmt.Sprintf("deleted breakpoint %d: %s", i+1, d.breakpoints[i]))
+		d.breakpoints = slices.Delete(d.breakpoints, i, i+1)
+		return
+	}
+	d.breakpoints = append(d.breakpoints, &Breakpoint{Position: position, source: position.String()})
+	t.message(fmt.Sprintf("breakpoint %d: %s", len(d.breakpoints), &position))
+}
+
+// focus the cell the torus pane follows, which is the cursor if it has been moved, or the instruction pointer
+func (t *tui) focus() *pkg.Vector {
+	if t.cursor != nil {
+		return t.cursor
+	}
+	return t.d.befunge.InstructionPointer
+}
+
+// collect moves the messages of the commands run, and what the triggered watches saw, into the messages pane
+func (t *tui) collect() {
+	d := t.d
+	for _, watched := range d.watched {
+		t.message("watch: " + watched)
+	}
+	for _, message := range d.messages {
+		t.message(message)
+	}
+	d.watched, d.messages = nil, nil
+}
+
+func (t *tui) message(message string) {
+	// messages may be colored for the line-based debugger, which the panes can't show
+	message = regexANSI.ReplaceAllString(message, "")
+	t.messages = append(t.messages, strings.Split(message, "\n")...)
+	if len(t.messages) > tuiMaxMessages {
+		t.messages = slices.Clone(t.messages[len(t.messages)-tuiMaxMessages:])
+	}
+}
+
+// draw draws the screen, only writing the lines which have changed since it was last drawn
+func (t *tui) draw() {
+	width, height := t.size()
+	lines := t.render(width, height)
+	var sb strings.Builder
+	if len(lines) != len(t.frame) {
+		// the terminal has been resized
+		sb.WriteString(clearAndReturn)
+		t.frame = nil
+	}
+	for i, line := range lines {
+		if i < len(t.frame) && t.frame[i] == line {
+			continue
+		}
+		_, _ = fmt.Fprintf(&sb, "\033[%d;1H%s\033[K", i+1, line)
+	}
+	if sb.Len() > 0 {
+		_, _ = io.WriteString(t.screen, sb.String())
+	}
+	t.frame, t.drawn = lines, time.Now()
+}
+
+// render lays out the panes in a screen of the size, returning its lines
+func (t *tui) render(width int, height int) []string {
+	c := newCanvas(width, height)
+	if width < tuiMinWidth || height < tuiMinHeight {
+		c.text(0, 0, width, fmt.Sprintf("the terminal must be at least %dx%d", tuiMinWidth, tuiMinHeight), nil)
+		return c.lines()
+	}
+	sideWidth := min(max(width/3, 24), 48)
+	mainWidth := width - sideWidth
+	bottomHeight := max(4, (height-2)/4+2)
+	mainHeight := height - 2 - bottomHeight
+	smallHeight := max(3, mainHeight/4)
+
+	t.renderStatus(c)
+	t.renderTorus(c, 0, 1, mainWidth, mainHeight)
+	t.renderStacks(c, mainWidth, 1, sideWidth, mainHeight-2*smallHeight)
+	t.renderBreakpoints(c, mainWidth, 1+mainHeight-2*smallHeight, sideWidth, smallHeight)
+	t.renderInput(c, mainWidth, 1+mainHeight-smallHeight, sideWidth, smallHeight)
+	t.renderLines(c, 0, 1+mainHeight, mainWidth, bottomHeight, "output", wrap(t.d.output.String(), mainWidth-2))
+	t.renderLines(c, mainWidth, 1+mainHeight, sideWidth, bottomHeight, "messages", t.messages)
+	t.renderKeys(c, height-1)
+	return c.lines()
+}
+
+func (t *tui) renderStatus(c *canvas) {
+	d := t.d
+	ip := d.befunge.IP
+	position := fmt.Sprintf("x: %d y: %d", ip.InstructionPointer.X, ip.InstructionPointer.Y)
+	if d.befunge.Dimensions() == 3 {
+		position += fmt.Sprintf(" z: %d", ip.InstructionPointer.Z)
+	}
+	status := fmt.Sprintf(" kagofunge │ %s │ char: '%c' │ steps: %d │ %s", position, printable(d.befunge.CharUnder(ip)),
+		d.steps, t.state)
+	style := d.colorOrNot(reverse, reverse)
+	c.fill(0, 0, c.width, 1, style)
+	c.text(0, 0, c.width, status, style)
+}
+
+func (t *tui) renderTorus(c *canvas, x int, y int, width int, height int) {
+	d := t.d
+	least, greatest := d.torusBounds()
+	focus := t.focus()
+	title := "torus"
+	if d.befunge.Dimensions() == 3 {
+		title += fmt.Sprintf(" z=%d", focus.Z)
+	}
+	c.box(x, y, width, height, title, d.colorOrNot(cyan, noColor))
+	x, y, width, height = x+1, y+1, width-2, height-2
+
+	gutter := 0
+	if d.config.ShowTorusCoordinates {
+		// a ruler of the ones digit of each x coordinate above, and the y coordinate of each row to the left
+		gutter = max(len(strconv.Itoa(least.Y)), len(strconv.Itoa(greatest.Y))) + 1
+		y, height = y+1, height-1
+	}
+	width -= gutter
+	// a configured viewport is the most of the torus shown, even if more would fit
+	if d.config.ViewportWidth > 0 {
+		width = min(width, d.config.ViewportWidth)
+	}
+	if d.config.ViewportHeight > 0 {
+		height = min(height, d.config.ViewportHeight)
+	}
+	t.origin.X = scroll(t.origin.X, focus.X, width, least.X, greatest.X)
+	t.origin.Y = scroll(t.origin.Y, focus.Y, height, least.Y, greatest.Y)
+	cFaint := d.colorOrNot(faint, noColor)
+	if d.config.ShowTorusCoordinates {
+		for col := range min(width, greatest.X-t.origin.X+1) {
+			c.set(x+gutter+col, y-1, rune('0'+abs(t.origin.X+col)%10), cFaint)
+		}
+	}
+
+	ips := d.ipPositions()
+	for row := range min(height, greatest.Y-t.origin.Y+1) {
+		cellY := t.origin.Y + row
+		if gutter > 0 {
+			label := strconv.Itoa(cellY)
+			c.text(x+gutter-1-len(label), y+row, len(label), label, cFaint)
+		}
+		for col := range min(width, greatest.X-t.origin.X+1) {
+			position := *pkg.NewVector3(t.origin.X+col, cellY, focus.Z)
+			char := d.befunge.Space.Get(&position)
+			style := noColor
+			if !unicode.IsPrint(char) {
+				style = cFaint
+			}
+			isBreakpoint := slices.ContainsFunc(d.breakpoints, func(b *Breakpoint) bool {
+				return b.Position == position
+			})
+			if ip, ok := ips[position]; ok {
+				style = d.ipColor(ip)
+			} else if isBreakpoint && char == ' ' {
+				style = d.colorOrNot(redBg, noColor)
+			} else if isBreakpoint {
+				style = d.colorOrNot(red, noColor)
+			}
+			if t.cursor != nil && *t.cursor == position {
+				style = reverse
+			}
+			c.set(x+gutter+col, y+row, printable(char), style)
+		}
+	}
+}
+
+// scroll moves the start of a view of a size along an axis as little as possible to keep the focus in view, with a
+// margin around it, but not past the bounds of the torus unless the focus is
+func scroll(start int, focus int, size int, least int, greatest int) int {
+	if greatest-least+1 <= size {
+		return least
+	}
+	margin := min(size/4, 5)
+	if focus < start+margin {
+		start = focus - margin
+	}
+	if focus > start+size-1-margin {
+		start = focus - size + 1 + margin
+	}
+	return max(least, min(start, greatest-size+1))
+}
+
+func (t *tui) renderStacks(c *canvas, x int, y int, width int, height int) {
+	d := t.d
+	var lines []string
+	var styles []*color.Color
+	for _, ip := range d.befunge.IPs {
+		if len(d.befunge.IPs) > 1 {
+			lines, styles = append(lines, fmt.Sprintf("ip %d", ip.ID)), append(styles, d.ipColor(ip))
+		}
+		stacks := ip.Stacks.Stacks
+		for i := len(stacks) - 1; i >= 0; i-- {
+			if len(stacks) > 1 {
+				label := strconv.Itoa(len(stacks) - 1 - i)
+				switch i {
+				case len(stacks) - 1:
+					label += " (TOSS)"
+				case len(stacks) - 2:
+					label += " (SOSS)"
+				}
+				lines, styles = append(lines, label), append(styles, d.colorOrNot(faint, noColor))
+			}
+			for depth, value := range slices.Backward(stacks[i].Values) {
+				lines = append(lines, fmt.Sprintf("%3d  %s", len(stacks[i].Values)-1-depth, d.cellString(value)))
+				styles = append(styles, nil)
+			}
+		}
+	}
+	c.box(x, y, width, height, "stack", d.colorOrNot(cyan, noColor))
+	for i := range min(len(lines), height-2) {
+		c.text(x+1, y+1+i, width-2, lines[i], styles[i])
+	}
+}
+
+func (t *tui) renderBreakpoints(c *canvas, x int, y int, width int, height int) {
+	d := t.d
+	var lines []string
+	for i, b := range d.breakpoints {
+		lines = append(lines, fmt.Sprintf("%d  %s", i+1, b))
+	}
+	for i := range len(d.watchpoints) + len(d.stackWatches) {
+		lines = append(lines, fmt.Sprintf("w%d %s", i+1, d.watchString(i)))
+	}
+	c.box(x, y, width, height, "breakpoints", d.colorOrNot(cyan, noColor))
+	for i := range min(len(lines), height-2) {
+		c.text(x+1, y+1+i, width-2, lines[i], nil)
+	}
+}
+
+func (t *tui) renderInput(c *canvas, x int, y int, width int, height int) {
+	d := t.d
+	c.box(x, y, width, height, "input", d.colorOrNot(cyan, noColor))
+	if d.stdinReader == nil {
+		c.text(x+1, y+1, width-2, "read from a file", d.colorOrNot(faint, noColor))
+		return
+	}
+	lines := internal.MapSlice(t.queue, strconv.Quote)
+	if t.eof {
+		lines = append(lines, "end of input")
+	}
+	for i := range min(len(lines), height-2) {
+		c.text(x+1, y+1+i, width-2, lines[i], nil)
+	}
+}
+
+// renderLines renders the last lines that fit in a pane
+func (t *tui) renderLines(c *canvas, x int, y int, width int, height int, title string, lines []string) {
+	c.box(x, y, width, height, title, t.d.colorOrNot(cyan, noColor))
+	lines = lines[max(0, len(lines)-(height-2)):]
+	for i, line := range lines {
+		c.text(x+1, y+1+i, width-2, line, nil)
+	}
+}
+
+func (t *tui) renderKeys(c *canvas, y int) {
+	d := t.d
+	if t.prompt != nil {
+		label := ": "
+		if t.prompt.input {
+			label = "input: "
+		}
+		n := c.text(0, y, c.width, label, d.colorOrNot(green, bold))
+		n += c.text(n, y, c.width-n, t.prompt.line, nil)
+		c.set(n, y, ' ', reverse)
+		return
+	}
+	var help string
+	switch t.state {
+	case "running", "stepping":
+		help = "p pause  q quit"
+	case "paused":
+		help = "s step  c continue  b back  r reverse  t breakpoint  arrows cursor  f follow  i input  : command  q quit"
+		if d.autoSpeed > 0 {
+			help = "j jump  " + help
+		}
+	}
+	c.text(0, y, c.width, help, d.colorOrNot(faint, noColor))
+}
+
+// wrap splits text into lines no wider than width
+func wrap(text string, width int) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(line)
+		for len(runes) > width {
+			lines, runes = append(lines, string(runes[:width])), runes[width:]
+		}
+		lines = append(lines, string(runes))
+	}
+	return lines
+}
+
+// printable the character, or a dot if it can't be printed in a single cell
+func printable(r rune) rune {
+	if !unicode.IsPrint(r) {
+		return '·'
+	}
+	return r
+}
+
+// canvas a grid of styled characters, which are drawn into and then turned into lines of text
+type canvas struct {
+	width  int
+	height int
+	chars  [][]rune
+	styles [][]*color.Color
+}
+
+func newCanvas(width int, height int) *canvas {
+	c := &canvas{width: width, height: height, chars: make([][]rune, height), styles: make([][]*color.Color, height)}
+	for y := range height {
+		c.chars[y] = []rune(strings.Repeat(" ", width))
+		c.styles[y] = make([]*color.Color, width)
+	}
+	return c
+}
+
+func (c *canvas) set(x int, y int, r rune, style *color.Color) {
+	if x >= 0 && x < c.width && y >= 0 && y < c.height {
+		c.chars[y][x], c.styles[y][x] = r, style
+	}
+}
+
+func (c *canvas) fill(x int, y int, width int, height int, style *color.Color) {
+	for row := y; row < y+height; row++ {
+		for col := x; col < x+width; col++ {
+			c.set(col, row, ' ', style)
+		}
+	}
+}
+
+// text writes text, cut off at a width, returning the width written. Characters which can't be printed are replaced
+func (c *canvas) text(x int, y int, width int, text string, style *color.Color) int {
+	n := 0
+	for _, r := range text {
+		if n >= width {
+			break
+		}
+		if r == '\t' {
+			r = ' '
+		}
+		c.set(x+n, y, printable(r), style)
+		n++
+	}
+	return n
+}
+
+// box draws a border around a pane, with its title in the top border
+func (c *canvas) box(x int, y int, width int, height int, title string, style *color.Color) {
+	for col := x + 1; col < x+width-1; col++ {
+		c.set(col, y, '─', style)
+		c.set(col, y+height-1, '─', style)
+	}
+	for row := y + 1; row < y+height-1; row++ {
+		c.set(x, row, '│', style)
+		c.set(x+width-1, row, '│', style)
+	}
+	c.set(x, y, '┌', style)
+	c.set(x+width-1, y, '┐', style)
+	c.set(x, y+height-1, '└', style)
+	c.set(x+width-1, y+height-1, '┘', style)
+	c.text(x+2, y, width-4, " "+title+" ", style)
+}
+
+// lines the lines of the canvas, with each run of characters of the same style styled together
+func (c *canvas) lines() []string {
+	lines := make([]string, c.height)
+	for y := range c.height {
+		var sb strings.Builder
+		for x := 0; x < c.width; {
+			end := x + 1
+			for end < c.width && c.styles[y][end] == c.styles[y][x] {
+				end++
+			}
+			run := string(c.chars[y][x:end])
+			if style := c.styles[y][x]; style != nil {
+				run = style.Sprint(run)
+			}
+			sb.WriteString(run)
+			x = end
+		}
+		lines[y] = sb.String()
+	}
+	return lines
+}
@@ -0,0 +1,197 @@
+package debug
+
+import (
+	"bytes"
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/pkg"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		input    string
+		expected []key
+	}{
+		{"empty", "", nil},
+		{"characters", "sc:", []key{"s", "c", ":"}},
+		{"unicode", "ü", []key{"ü"}},
+		{"arrows", "\033[A\033[B\033[C\033[D", []key{keyUp, keyDown, keyRight, keyLeft}},
+		{"application arrows", "\033OA", []key{keyUp}},
+		{"escape", "\033", []key{keyEscape}},
+		{"unused sequence", "\033[5~s", []key{"s"}},
+		{"control keys", "\r\n\x7f\b\t\x03\x04", []key{keyEnter, keyEnter, keyBackspace, keyBackspace, keyTab,
+			keyCtrlC, keyCtrlD}},
+		{"other control characters", "\x01a", []key{"a"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.expected, parseKeys([]byte(test.input)))
+		})
+	}
+}
+
+func TestScroll(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		start    int
+		focus    int
+		size     int
+		expected int
+	}{
+		{"in view", 0, 10, 40, 0},
+		{"past the end", 0, 60, 40, 26},
+		{"before the start", 50, 20, 40, 15},
+		{"at the least", 10, 0, 40, 0},
+		{"at the greatest", 0, 199, 40, 160},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.expected, scroll(test.start, test.focus, test.size, 0, 199))
+		})
+	}
+	assert.Equal(t, -5, scroll(3, 2, 40, -5, 20), "a torus smaller than the view starts at its least")
+}
+
+func newTestTUI(program string) *tui {
+	cfg := config.DefaultConfig()
+	d := NewDebugger(&cfg, program, &strings.Builder{}, strings.NewReader(""), nil, nil, nil, 0)
+	return newTUI(d, &bytes.Buffer{}, func() (int, int) { return 80, 24 })
+}
+
+func TestTUI_render(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	ui := newTestTUI("12.3.@")
+	ui.state = "paused"
+	screen := strings.Join(ui.render(80, 24), "\n")
+	asserts.Contains(screen, "x: 0 y: 0 │ char: '1' │ steps: 0 │ paused")
+	asserts.Contains(screen, "12.3.@")
+	asserts.Contains(screen, "s step")
+
+	_, err := ui.d.step()
+	asserts.NoError(err)
+	_, err = ui.d.step()
+	asserts.NoError(err)
+	screen = strings.Join(ui.render(80, 24), "\n")
+	asserts.Contains(screen, "  0  2", "the stack pane shows the top of the stack first")
+	asserts.Contains(screen, "  1  1")
+
+	small := ui.render(40, 1)
+	if asserts.Len(small, 1) {
+		asserts.Contains(small[0], "the terminal must be at least 50x16")
+	}
+}
+
+func TestTUI_renderFollows(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	ui := newTestTUI(strings.Repeat("0123456789", 20) + "@")
+	ui.d.befunge.InstructionPointer.X = 150
+	screen := strings.Join(ui.render(80, 24), "\n")
+	asserts.Contains(screen, "x: 150 y: 0")
+	asserts.Contains(screen, "8901234567890123456789")
+	asserts.NotContains(screen, "│0 0123456789", "the start of the row has scrolled out of view")
+
+	ui.cursor = pkg.NewVector2(0, 0)
+	screen = strings.Join(ui.render(80, 24), "\n")
+	asserts.Contains(screen, "│0 0123456789", "the view follows the cursor once it has moved")
+}
+
+func TestTUI_handle(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	ui := newTestTUI("12.3.@")
+	d := ui.d
+
+	asserts.False(ui.handle("t"))
+	if asserts.Len(d.breakpoints, 1) {
+		asserts.Equal("(0,0)", d.breakpoints[0].String())
+	}
+	asserts.False(ui.handle(keyRight))
+	asserts.False(ui.handle(keyRight))
+	asserts.Equal(pkg.NewVector2(2, 0), ui.cursor)
+	asserts.False(ui.handle("t"))
+	asserts.Len(d.breakpoints, 2)
+	asserts.False(ui.handle("f"))
+	asserts.Nil(ui.cursor)
+	asserts.False(ui.handle("t"))
+	if asserts.Len(d.breakpoints, 1) {
+		asserts.Equal("(2,0)", d.breakpoints[0].String())
+	}
+
+	for _, k := range parseKeys([]byte(":peek 0 0x\x7f\r")) {
+		asserts.False(ui.handle(k))
+	}
+	asserts.Nil(ui.prompt)
+	asserts.Contains(ui.messages, "(0,0): '1' (49)")
+	asserts.Equal([]string{"peek 0 0"}, ui.history)
+
+	asserts.False(ui.handle(":"))
+	asserts.False(ui.handle(keyUp))
+	asserts.Equal("peek 0 0", ui.prompt.line, "up recalls the previous command")
+	asserts.False(ui.handle(keyEscape))
+	asserts.Nil(ui.prompt)
+
+	asserts.True(ui.handle("s"))
+	asserts.True(d.stepMode)
+	asserts.False(ui.handle("j"), "jump does nothing without --speed")
+}
+
+func TestTUI_readInput(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	ui := newTestTUI("~.@")
+	ui.queue = []string{"typed ahead"}
+	line, ok := ui.readInput()
+	asserts.True(ok)
+	asserts.Equal("typed ahead\n", line)
+
+	for _, k := range parseKeys([]byte("hi\r\x04")) {
+		ui.keys <- k
+	}
+	line, ok = ui.readInput()
+	asserts.True(ok)
+	asserts.Equal("hi\n", line)
+	_, ok = ui.readInput()
+	asserts.False(ok, "ctrl+d ends the input")
+}
+
+func TestTUI_draw(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	ui := newTestTUI("12.3.@")
+	screen := ui.screen.(*bytes.Buffer)
+	ui.draw()
+	asserts.True(strings.HasPrefix(screen.String(), clearAndReturn), "the first frame clears the screen")
+	asserts.Equal(24, strings.Count(screen.String(), "\033[K"))
+
+	screen.Reset()
+	ui.draw()
+	asserts.Empty(screen.String(), "an unchanged frame isn't redrawn")
+
+	ui.message("hello")
+	ui.draw()
+	asserts.Equal(1, strings.Count(screen.String(), "\033[K"), "only the changed line is redrawn")
+	asserts.Contains(screen.String(), "hello")
+
+	screen.Reset()
+	ui.size = func() (int, int) { return 80, 30 }
+	ui.draw()
+	asserts.True(strings.HasPrefix(screen.String(), clearAndReturn), "a resized frame clears the screen")
+}
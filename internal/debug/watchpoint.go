@@ -0,0 +1,95 @@
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kagof/kagofunge/pkg"
+	"strings"
+)
+
+// Watchpoint a box of funge-space cells which pauses the debugger after any of them is put
+type Watchpoint struct {
+	Least    pkg.Vector
+	Greatest pkg.Vector
+	source   string
+}
+
+// ParseWatchpoint parses a watchpoint, which is either a single position or a range of positions separated by ..,
+// each in any of the formats of pkg.ParseVector. A range watches every cell in the box with the positions at its
+// corners
+//
+// eg 3,4, (3,4), or 0,0..9,2
+func ParseWatchpoint(str string) (*Watchpoint, error) {
+	str = strings.TrimSpace(str)
+	first, second, isRange := strings.Cut(str, "..")
+	from, err := pkg.ParseVector(first)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("invalid watchpoint %s", str), err)
+	}
+	to := from
+	if isRange {
+		to, err = pkg.ParseVector(second)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("invalid watchpoint %s", str), err)
+		}
+	}
+	return &Watchpoint{
+		Least:    *pkg.NewVector3(min(from.X, to.X), min(from.Y, to.Y), min(from.Z, to.Z)),
+		Greatest: *pkg.NewVector3(max(from.X, to.X), max(from.Y, to.Y), max(from.Z, to.Z)),
+		source:   str,
+	}, nil
+}
+
+// Contains whether the position is one of the watched cells
+func (w *Watchpoint) Contains(position pkg.Vector) bool {
+	return w.Least.X <= position.X && position.X <= w.Greatest.X &&
+		w.Least.Y <= position.Y && position.Y <= w.Greatest.Y &&
+		w.Least.Z <= position.Z && position.Z <= w.Greatest.Z
+}
+
+func (w *Watchpoint) String() string {
+	return w.source
+}
+
+// StackWatch conditions on the state of an instruction pointer, which pause the debugger whenever they start to hold
+// for any instruction pointer
+type StackWatch struct {
+	comparisons []comparison
+	holding     map[int]bool // whether the conditions held for each instruction pointer, by ID, when last checked
+	source      string
+}
+
+// ParseStackWatch parses a stack watch, which is one or more comparisons joined by &&, in the same format as the if
+// clause of a breakpoint
+//
+// eg depth>10, top==0, or depth>2 && top<0
+func ParseStackWatch(str string) (*StackWatch, error) {
+	str = strings.TrimSpace(str)
+	comparisons, rest, err := parseConditions(str)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("invalid stack watch %s", str), err)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected %s in stack watch %s", rest, str)
+	}
+	return &StackWatch{comparisons: comparisons, holding: make(map[int]bool), source: str}, nil
+}
+
+// started checks the conditions for an instruction pointer, returning whether they hold now but didn't the last time
+// they were checked
+func (w *StackWatch) started(f *pkg.Befunge, ip *pkg.IP) bool {
+	holds := true
+	for _, c := range w.comparisons {
+		if !c.holds(f, ip) {
+			holds = false
+			break
+		}
+	}
+	held := w.holding[ip.ID]
+	w.holding[ip.ID] = holds
+	return holds && !held
+}
+
+func (w *StackWatch) String() string {
+	return w.source
+}
@@ -0,0 +1,153 @@
+package debug
+
+import (
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/pkg"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestParseWatchpoint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		watchpoint string
+		least      pkg.Vector
+		greatest   pkg.Vector
+		valid      bool
+	}{
+		{"position", "3,4", *pkg.NewVector2(3, 4), *pkg.NewVector2(3, 4), true},
+		{"parenthesised_position", "(3, 4)", *pkg.NewVector2(3, 4), *pkg.NewVector2(3, 4), true},
+		{"range", "0,0..9,2", *pkg.NewVector2(0, 0), *pkg.NewVector2(9, 2), true},
+		{"reversed_range", "(9,0)..(0,2)", *pkg.NewVector2(0, 0), *pkg.NewVector2(9, 2), true},
+		{"trefunge_range", "(0,0,1)..(1,1,0)", *pkg.NewVector3(0, 0, 0), *pkg.NewVector3(1, 1, 1), true},
+		{"invalid_position", "a,b", pkg.Vector{}, pkg.Vector{}, false},
+		{"invalid_range", "0,0..a,b", pkg.Vector{}, pkg.Vector{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+
+			w, err := ParseWatchpoint(test.watchpoint)
+			if !test.valid {
+				asserts.Error(err)
+				return
+			}
+			if !asserts.NoError(err) {
+				return
+			}
+			asserts.Equal(test.least, w.Least)
+			asserts.Equal(test.greatest, w.Greatest)
+			asserts.True(w.Contains(test.least))
+			asserts.True(w.Contains(test.greatest))
+			asserts.False(w.Contains(*test.greatest.Add(pkg.XPos())))
+			asserts.Equal(test.watchpoint, w.String())
+		})
+	}
+}
+
+func TestParseStackWatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		stackWatch  string
+		comparisons int
+		valid       bool
+	}{
+		{"depth", "depth>10", 1, true},
+		{"top", "top == -1", 1, true},
+		{"conjunction", "depth>2 && top<0", 2, true},
+		{"unknown_variable", "height>10", 0, false},
+		{"trailing_clause", "depth>10 hit 5", 0, false},
+		{"empty", "", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+
+			w, err := ParseStackWatch(test.stackWatch)
+			if !test.valid {
+				asserts.Error(err)
+				return
+			}
+			if !asserts.NoError(err) {
+				return
+			}
+			asserts.Len(w.comparisons, test.comparisons)
+			asserts.Equal(test.stackWatch, w.String())
+		})
+	}
+}
+
+func TestStackWatch_started(t *testing.T) {
+	t.Parallel()
+
+	// counts down from 3 to 0, reaching the > at (1,0) on steps 1, 10, 19 and 28 with 3, 2, 1 and 0 on top of the stack
+	const countdown = "3>:#v_@\n ^-1<"
+
+	tests := []struct {
+		name       string
+		funge      string
+		stackWatch string
+		// the number of the steps, counting from 0, before which the stack watch pauses
+		expected []int
+	}{
+		{"depth", "12$3$$@", "depth>=2", []int{2, 4}},
+		{"top", countdown, "top==1", []int{8, 17}},
+		{"top_empty_stack", "1$@", "top==0", []int{0, 2}},
+		{"conjunction", "12$3@", "depth==2 && top==2", []int{2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+
+			w, err := ParseStackWatch(test.stackWatch)
+			if !asserts.NoError(err) {
+				return
+			}
+			cfg := config.DefaultConfig()
+			befunge := pkg.NewBefunge(&cfg, test.funge, &strings.Builder{}, strings.NewReader(""))
+			var paused []int
+			for i := range 40 {
+				if w.started(befunge, befunge.IPs[0]) {
+					paused = append(paused, i)
+				}
+				hasNext, err := befunge.Step()
+				if !asserts.NoError(err) || !hasNext {
+					break
+				}
+			}
+			asserts.Equal(test.expected, paused)
+		})
+	}
+}
+
+func TestDebugger_put(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	watchpoint, err := ParseWatchpoint("5,0..6,0")
+	if !asserts.NoError(err) {
+		return
+	}
+	cfg := config.DefaultConfig()
+	cfg.Debugger.EnableColors = false
+	d := NewDebugger(&cfg, `"1"50p"@"60p`, &strings.Builder{}, strings.NewReader(""), nil,
+		[]*Watchpoint{watchpoint}, nil, 0)
+	for range 6 {
+		_, err := d.befunge.Step()
+		asserts.NoError(err)
+	}
+	asserts.Equal([]string{`(5,0) put by ip 0 at (5,0): 'p' (112) -> '1' (49)`}, d.watched)
+	asserts.Contains(d.watchOutput(), `(5,0) put by ip 0 at (5,0): 'p' (112) -> '1' (49)`)
+	asserts.Empty(d.watched, "watches should be cleared once they have been output")
+}
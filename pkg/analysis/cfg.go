@@ -0,0 +1,222 @@
+// Package analysis statically analyses Befunge-93 programs without running them
+package analysis
+
+import (
+	"errors"
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/pkg"
+)
+
+// Direction the direction the instruction pointer is moving in
+type Direction string
+
+const (
+	Right Direction = "right"
+	Left  Direction = "left"
+	Down  Direction = "down"
+	Up    Direction = "up"
+)
+
+// delta the amount the instruction pointer moves by in the direction
+func (d Direction) delta() (int, int) {
+	switch d {
+	case Left:
+		return -1, 0
+	case Down:
+		return 0, 1
+	case Up:
+		return 0, -1
+	default:
+		return 1, 0
+	}
+}
+
+// reverse the opposite direction
+func (d Direction) reverse() Direction {
+	switch d {
+	case Left:
+		return Right
+	case Down:
+		return Up
+	case Up:
+		return Down
+	default:
+		return Left
+	}
+}
+
+// State the state of the instruction pointer: its position and direction, and whether it is in string mode
+type State struct {
+	X          int       `json:"x"`
+	Y          int       `json:"y"`
+	Direction  Direction `json:"direction"`
+	StringMode bool      `json:"stringMode"`
+}
+
+// Node a state of the instruction pointer which is reachable, along with the instruction at its position
+type Node struct {
+	State
+	Instruction string `json:"instruction"`
+}
+
+// EdgeKind why the instruction pointer can move from one state to another
+type EdgeKind string
+
+const (
+	// EdgeNext the instruction pointer moves on to the next cell after executing the instruction
+	EdgeNext EdgeKind = "next"
+	// EdgeZero _ or | popped zero
+	EdgeZero EdgeKind = "zero"
+	// EdgeNonZero _ or | popped a value other than zero
+	EdgeNonZero EdgeKind = "nonzero"
+	// EdgeRandom ? picked the direction
+	EdgeRandom EdgeKind = "random"
+	// EdgeSkip # jumped over the next cell
+	EdgeSkip EdgeKind = "skip"
+	// EdgeReflect / or % divided by zero, and reflected the instruction pointer
+	EdgeReflect EdgeKind = "reflect"
+)
+
+// Edge a possible move of the instruction pointer from one node to another, by their indexes
+type Edge struct {
+	From int      `json:"from"`
+	To   int      `json:"to"`
+	Kind EdgeKind `json:"kind"`
+	// whether the move wraps around the edge of the torus
+	Wraps bool `json:"wraps,omitempty"`
+}
+
+// Graph the control-flow graph of a Befunge-93 program, with a node for each reachable state of the instruction
+// pointer. The first node is where the program starts, at (0, 0) heading right. The graph describes the program as it
+// was loaded, so programs which modify themselves with p can reach states it doesn't contain
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	// the edges, ordered by the node they are from
+	Edges []Edge `json:"edges"`
+
+	torus   *pkg.Torus
+	config  config.InterpreterConfig
+	indexes map[State]int
+	// the index of the first edge from each node, with a final entry for the number of edges
+	offsets []int
+}
+
+// NewGraph builds the control-flow graph of the program, using the config for the size of the torus and for whether
+// / and % can reflect
+func NewGraph(program string, c config.InterpreterConfig) (*Graph, error) {
+	if c.Dialect == config.Dialect98 {
+		return nil, errors.New("only Befunge-93 programs can be analysed")
+	}
+	maxLines, maxColumns := -1, -1
+	if c.EnforceTorusSizeRestriction {
+		maxLines, maxColumns = c.TorusSizeRestrictionHeight, c.TorusSizeRestrictionWidth
+	}
+	torus := pkg.NewTorus(program, maxLines, maxColumns)
+	if torus.Width == 0 || torus.Height == 0 {
+		return nil, errors.New("cannot analyse an empty program")
+	}
+	g := &Graph{torus: torus, config: c, indexes: make(map[State]int)}
+	g.explore(State{Direction: Right})
+	return g, nil
+}
+
+// Index the index of the node for the state, if it is reachable
+func (g *Graph) Index(s State) (int, bool) {
+	i, ok := g.indexes[s]
+	return i, ok
+}
+
+// Successors the edges from the node
+func (g *Graph) Successors(node int) []Edge {
+	return g.Edges[g.offsets[node]:g.offsets[node+1]]
+}
+
+// Char the character at the state's position
+func (g *Graph) Char(s State) rune {
+	return g.torus.CharAt(s.X, s.Y)
+}
+
+// explore adds every state reachable from the entry state, in breadth first order
+func (g *Graph) explore(entry State) {
+	g.add(entry)
+	for i := 0; i < len(g.Nodes); i++ {
+		g.offsets = append(g.offsets, len(g.Edges))
+		for _, next := range g.successors(g.Nodes[i].State) {
+			to, ok := g.indexes[next.state]
+			if !ok {
+				to = g.add(next.state)
+			}
+			g.Edges = append(g.Edges, Edge{From: i, To: to, Kind: next.kind, Wraps: next.wraps})
+		}
+	}
+	g.offsets = append(g.offsets, len(g.Edges))
+}
+
+func (g *Graph) add(s State) int {
+	g.indexes[s] = len(g.Nodes)
+	g.Nodes = append(g.Nodes, Node{State: s, Instruction: string(g.Char(s))})
+	return len(g.Nodes) - 1
+}
+
+// successor a state which can follow another, before it has been added to the graph
+type successor struct {
+	state State
+	kind  EdgeKind
+	wraps bool
+}
+
+// move turns the instruction pointer to the direction and moves it by the number of cells
+func (g *Graph) move(s State, d Direction, cells int, kind EdgeKind) successor {
+	dx, dy := d.delta()
+	x, y := s.X+cells*dx, s.Y+cells*dy
+	s.X, s.Y, s.Direction = g.torus.ModWidth(x), g.torus.ModHeight(y), d
+	return successor{state: s, kind: kind, wraps: x != s.X || y != s.Y}
+}
+
+// successors the states which can follow the state
+func (g *Graph) successors(s State) []successor {
+	c := g.Char(s)
+	if c == '"' {
+		s.StringMode = !s.StringMode
+		return []successor{g.move(s, s.Direction, 1, EdgeNext)}
+	}
+	if s.StringMode {
+		return []successor{g.move(s, s.Direction, 1, EdgeNext)}
+	}
+	switch c {
+	case '>':
+		return []successor{g.move(s, Right, 1, EdgeNext)}
+	case '<':
+		return []successor{g.move(s, Left, 1, EdgeNext)}
+	case 'v':
+		return []successor{g.move(s, Down, 1, EdgeNext)}
+	case '^':
+		return []successor{g.move(s, Up, 1, EdgeNext)}
+	case '_':
+		return []successor{g.move(s, Right, 1, EdgeZero), g.move(s, Left, 1, EdgeNonZero)}
+	case '|':
+		return []successor{g.move(s, Down, 1, EdgeZero), g.move(s, Up, 1, EdgeNonZero)}
+	case '?':
+		return []successor{
+			g.move(s, Right, 1, EdgeRandom),
+			g.move(s, Left, 1, EdgeRandom),
+			g.move(s, Down, 1, EdgeRandom),
+			g.move(s, Up, 1, EdgeRandom),
+		}
+	case '#':
+		return []successor{g.move(s, s.Direction, 2, EdgeSkip)}
+	case '/', '%':
+		behaviour := g.config.DivideByZeroBehaviour
+		if c == '%' {
+			behaviour = g.config.ModulusByZeroBehaviour
+		}
+		if behaviour == config.Div0Reflect {
+			return []successor{g.move(s, s.Direction, 1, EdgeNext), g.move(s, s.Direction.reverse(), 1, EdgeReflect)}
+		}
+		return []successor{g.move(s, s.Direction, 1, EdgeNext)}
+	case '@':
+		return nil
+	default:
+		return []successor{g.move(s, s.Direction, 1, EdgeNext)}
+	}
+}
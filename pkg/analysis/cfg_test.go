@@ -0,0 +1,165 @@
+package analysis
+
+import (
+	"encoding/json"
+	"github.com/kagof/kagofunge/config"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestNewGraph(t *testing.T) {
+	t.Parallel()
+
+	right := func(x, y int) State { return State{X: x, Y: y, Direction: Right} }
+	tests := []struct {
+		name   string
+		funge  string
+		config func(c *config.InterpreterConfig)
+		nodes  []State
+		edges  []Edge
+	}{
+		{"straight_line", "1.@", nil,
+			[]State{right(0, 0), right(1, 0), right(2, 0)},
+			[]Edge{{0, 1, EdgeNext, false}, {1, 2, EdgeNext, false}}},
+		{"wraparound", "<@", nil,
+			[]State{right(0, 0), {X: 1, Direction: Left}},
+			[]Edge{{0, 1, EdgeNext, true}}},
+		{"skip", "#1@", nil,
+			[]State{right(0, 0), right(2, 0)},
+			[]Edge{{0, 1, EdgeSkip, false}}},
+		{"skip_wraps", "2#", nil,
+			[]State{right(0, 0), right(1, 0)},
+			[]Edge{{0, 1, EdgeNext, false}, {1, 1, EdgeSkip, true}}},
+		{"horizontal_if", "_@", nil,
+			[]State{right(0, 0), right(1, 0), {X: 1, Direction: Left}},
+			[]Edge{{0, 1, EdgeZero, false}, {0, 2, EdgeNonZero, true}}},
+		{"vertical_if", "|\n@", nil,
+			[]State{right(0, 0), {Y: 1, Direction: Down}, {Y: 1, Direction: Up}},
+			[]Edge{{0, 1, EdgeZero, false}, {0, 2, EdgeNonZero, true}}},
+		{"random", "?@", nil,
+			[]State{right(0, 0), right(1, 0), {X: 1, Direction: Left}, {Direction: Down}, {Direction: Up}},
+			[]Edge{
+				{0, 1, EdgeRandom, false},
+				{0, 2, EdgeRandom, true},
+				{0, 3, EdgeRandom, true},
+				{0, 4, EdgeRandom, true},
+				// going down or up wraps back around to the ?
+				{3, 1, EdgeRandom, false},
+				{3, 2, EdgeRandom, true},
+				{3, 3, EdgeRandom, true},
+				{3, 4, EdgeRandom, true},
+				{4, 1, EdgeRandom, false},
+				{4, 2, EdgeRandom, true},
+				{4, 3, EdgeRandom, true},
+				{4, 4, EdgeRandom, true},
+			}},
+		{"string_mode", `"@"@`, nil,
+			[]State{right(0, 0), {X: 1, Direction: Right, StringMode: true}, {X: 2, Direction: Right, StringMode: true},
+				right(3, 0)},
+			[]Edge{{0, 1, EdgeNext, false}, {1, 2, EdgeNext, false}, {2, 3, EdgeNext, false}}},
+		{"divide_by_zero", "/@", nil,
+			[]State{right(0, 0), right(1, 0)},
+			[]Edge{{0, 1, EdgeNext, false}}},
+		{"divide_by_zero_reflect", "/@", func(c *config.InterpreterConfig) {
+			c.DivideByZeroBehaviour = config.Div0Reflect
+		},
+			[]State{right(0, 0), right(1, 0), {X: 1, Direction: Left}},
+			[]Edge{{0, 1, EdgeNext, false}, {0, 2, EdgeReflect, true}}},
+		{"modulus_by_zero_reflect", "%@", func(c *config.InterpreterConfig) {
+			c.ModulusByZeroBehaviour = config.Div0Reflect
+		},
+			[]State{right(0, 0), right(1, 0), {X: 1, Direction: Left}},
+			[]Edge{{0, 1, EdgeNext, false}, {0, 2, EdgeReflect, true}}},
+		{"torus_size_restriction", "1.@", func(c *config.InterpreterConfig) {
+			c.EnforceTorusSizeRestriction = true
+			c.TorusSizeRestrictionHeight = 1
+			c.TorusSizeRestrictionWidth = 2
+		},
+			[]State{right(0, 0), right(1, 0)},
+			[]Edge{{0, 1, EdgeNext, false}, {1, 0, EdgeNext, true}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+			cfg := config.DefaultConfig()
+			if test.config != nil {
+				test.config(&cfg.Interpreter)
+			}
+
+			g, err := NewGraph(test.funge, cfg.Interpreter)
+			if !asserts.NoError(err) {
+				return
+			}
+			var nodes []State
+			for i, n := range g.Nodes {
+				nodes = append(nodes, n.State)
+				index, ok := g.Index(n.State)
+				asserts.True(ok)
+				asserts.Equal(i, index)
+				asserts.Equal(string(g.Char(n.State)), n.Instruction)
+			}
+			asserts.Equal(test.nodes, nodes, "nodes not as expected")
+			asserts.Equal(test.edges, g.Edges, "edges not as expected")
+			var successors []Edge
+			for i := range g.Nodes {
+				for _, e := range g.Successors(i) {
+					asserts.Equal(i, e.From)
+					successors = append(successors, e)
+				}
+			}
+			asserts.Equal(g.Edges, successors)
+		})
+	}
+}
+
+func TestNewGraph_unsupported(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.Interpreter.Dialect = config.Dialect98
+	_, err := NewGraph("1.@", cfg.Interpreter)
+	asserts.Error(err)
+
+	cfg = config.DefaultConfig()
+	_, err = NewGraph("", cfg.Interpreter)
+	asserts.Error(err)
+}
+
+func TestGraph_WriteDot(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	g, err := NewGraph("_@", config.DefaultConfig().Interpreter)
+	asserts.NoError(err)
+	var sb strings.Builder
+	asserts.NoError(g.WriteDot(&sb))
+	asserts.Equal(`digraph cfg {
+	node [shape=box, fontname=monospace];
+	n0 [label="(0, 0) right\n'_'", style=bold];
+	n1 [label="(1, 0) right\n'@'", shape=doubleoctagon];
+	n2 [label="(1, 0) left\n'@'", shape=doubleoctagon];
+	n0 -> n1 [label="zero"];
+	n0 -> n2 [label="nonzero", style=dashed];
+}
+`, sb.String())
+}
+
+func TestGraph_WriteJSON(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	g, err := NewGraph(`"\"`, config.DefaultConfig().Interpreter)
+	asserts.NoError(err)
+	var sb strings.Builder
+	asserts.NoError(g.WriteJSON(&sb))
+	var decoded Graph
+	asserts.NoError(json.Unmarshal([]byte(sb.String()), &decoded))
+	asserts.Equal(g.Nodes, decoded.Nodes)
+	asserts.Equal(g.Edges, decoded.Edges)
+	asserts.Contains(sb.String(), `"instruction": "\\"`)
+	asserts.Contains(sb.String(), `"stringMode": true`)
+}
@@ -0,0 +1,196 @@
+package analysis
+
+import (
+	"github.com/kagof/kagofunge/pkg"
+	"slices"
+)
+
+// the most values an abstract stack tracks. Deeper values are forgotten, so that loops which push values converge
+const maxTrackedValues = 16
+
+// value a value on the stack, which is either a known constant or unknown
+type value struct {
+	n     int64
+	known bool
+}
+
+func constant(n int64) value {
+	return value{n: n, known: true}
+}
+
+var unknown = value{}
+
+// abstractStack what is known about the stack when the instruction pointer reaches a state, on every path that
+// reaches it
+type abstractStack struct {
+	values []value // from the bottom of the tracked values to the top of the stack
+	// whether the values below the tracked values are unknown. Otherwise there are none, so popping them gives 0
+	unknownBase bool
+}
+
+func (s abstractStack) push(v value) abstractStack {
+	s.values = append(slices.Clip(s.values), v)
+	if len(s.values) > maxTrackedValues {
+		s.values = s.values[1:]
+		s.unknownBase = true
+	}
+	return s
+}
+
+func (s abstractStack) pop() (abstractStack, value) {
+	if len(s.values) == 0 {
+		if s.unknownBase {
+			return s, unknown
+		}
+		return s, constant(0)
+	}
+	return abstractStack{values: s.values[:len(s.values)-1], unknownBase: s.unknownBase}, s.values[len(s.values)-1]
+}
+
+func (s abstractStack) popN(n int) abstractStack {
+	for range n {
+		s, _ = s.pop()
+	}
+	return s
+}
+
+// join what is known about the stack on either of two paths. Only the values at the top of both stacks are kept, and
+// are known if they are the same on both
+func (s abstractStack) join(other abstractStack) abstractStack {
+	n := min(len(s.values), len(other.values))
+	joined := abstractStack{
+		values:      make([]value, n),
+		unknownBase: s.unknownBase || other.unknownBase || len(s.values) != len(other.values),
+	}
+	for i := range n {
+		a, b := s.values[len(s.values)-n+i], other.values[len(other.values)-n+i]
+		if a == b {
+			joined.values[i] = a
+		} else {
+			joined.values[i] = unknown
+		}
+	}
+	return joined
+}
+
+func (s abstractStack) equal(other abstractStack) bool {
+	return s.unknownBase == other.unknownBase && slices.Equal(s.values, other.values)
+}
+
+// constants finds what is known about the stack when the instruction pointer reaches each node, by propagating
+// constants through the graph until nothing changes. The known values fit in both the configured cell width and a
+// funge-space cell, so arithmetic which could overflow gives unknown values
+func (g *Graph) constants() []abstractStack {
+	bits := pkg.CellBits(g.config.CellWidth)
+	if bits == 0 || bits > 32 {
+		bits = 32
+	}
+	least, greatest := int64(-1)<<(bits-1), int64(1)<<(bits-1)-1
+	fit := func(n int64) value {
+		if n < least || n > greatest {
+			return unknown
+		}
+		return constant(n)
+	}
+
+	stacks := make([]abstractStack, len(g.Nodes))
+	reached := make([]bool, len(g.Nodes))
+	reached[0] = true
+	queue := []int{0}
+	queued := map[int]bool{0: true}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		queued[node] = false
+		after := g.transfer(g.Nodes[node].State, stacks[node], fit)
+		for _, e := range g.Successors(node) {
+			next := after
+			if e.Kind == EdgeReflect {
+				next = stacks[node].popN(2) // dividing by zero reflects without pushing anything
+			}
+			if reached[e.To] {
+				next = stacks[e.To].join(next)
+				if next.equal(stacks[e.To]) {
+					continue
+				}
+			}
+			stacks[e.To], reached[e.To] = next, true
+			if !queued[e.To] {
+				queued[e.To] = true
+				queue = append(queue, e.To)
+			}
+		}
+	}
+	return stacks
+}
+
+// transfer what is known about the stack after the state's instruction is executed
+func (g *Graph) transfer(state State, s abstractStack, fit func(int64) value) abstractStack {
+	c := g.Char(state)
+	if state.StringMode {
+		if c == '"' {
+			return s
+		}
+		return s.push(constant(int64(c)))
+	}
+	switch {
+	case '0' <= c && c <= '9':
+		return s.push(constant(int64(c - '0')))
+	case c == '+' || c == '-' || c == '*' || c == '/' || c == '%' || c == '`':
+		s, a := s.pop()
+		s, b := s.pop()
+		if !a.known || !b.known {
+			return s.push(unknown)
+		}
+		switch c {
+		case '+':
+			return s.push(fit(b.n + a.n))
+		case '-':
+			return s.push(fit(b.n - a.n))
+		case '*':
+			return s.push(fit(b.n * a.n))
+		case '/':
+			if a.n == 0 {
+				return s.push(unknown)
+			}
+			return s.push(fit(b.n / a.n))
+		case '%':
+			if a.n == 0 {
+				return s.push(unknown)
+			}
+			return s.push(fit(b.n % a.n))
+		default:
+			if b.n > a.n {
+				return s.push(constant(1))
+			}
+			return s.push(constant(0))
+		}
+	case c == '!':
+		s, a := s.pop()
+		switch {
+		case !a.known:
+			return s.push(unknown)
+		case a.n == 0:
+			return s.push(constant(1))
+		default:
+			return s.push(constant(0))
+		}
+	case c == ':':
+		_, a := s.pop()
+		return s.push(a)
+	case c == '\\':
+		s, a := s.pop()
+		s, b := s.pop()
+		return s.push(a).push(b)
+	case c == '$' || c == '.' || c == ',' || c == '_' || c == '|':
+		return s.popN(1)
+	case c == 'g':
+		return s.popN(2).push(unknown)
+	case c == 'p':
+		return s.popN(3)
+	case c == '&' || c == '~':
+		return s.push(unknown)
+	default:
+		return s
+	}
+}
@@ -0,0 +1,83 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteDot writes the graph in the DOT language, for rendering with Graphviz. The entry node is bold and nodes which
+// end the program are octagons. Edges which wrap around the torus are dashed, and edges other than EdgeNext are
+// labelled with their kind
+func (g *Graph) WriteDot(w io.Writer) error {
+	_, err := fmt.Fprintln(w, "digraph cfg {\n\tnode [shape=box, fontname=monospace];")
+	if err != nil {
+		return err
+	}
+	for i, n := range g.Nodes {
+		label := fmt.Sprintf("(%d, %d) %s\n'%s'", n.X, n.Y, n.Direction, n.Instruction)
+		if n.StringMode {
+			label += " string"
+		}
+		attributes := ""
+		switch {
+		case i == 0:
+			attributes = ", style=bold"
+		case n.Instruction == "@" && !n.StringMode:
+			attributes = ", shape=doubleoctagon"
+		}
+		_, err = fmt.Fprintf(w, "\tn%d [label=%s%s];\n", i, strconv.Quote(label), attributes)
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range g.Edges {
+		var attributes []string
+		if e.Kind != EdgeNext {
+			attributes = append(attributes, "label="+strconv.Quote(string(e.Kind)))
+		}
+		if e.Wraps {
+			attributes = append(attributes, "style=dashed")
+		}
+		if len(attributes) > 0 {
+			_, err = fmt.Fprintf(w, "\tn%d -> n%d [%s];\n", e.From, e.To, strings.Join(attributes, ", "))
+		} else {
+			_, err = fmt.Fprintf(w, "\tn%d -> n%d;\n", e.From, e.To)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintln(w, "}")
+	return err
+}
+
+// WriteJSON writes the graph as JSON, with its nodes and then its edges, which refer to nodes by their index
+func (g *Graph) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(g)
+}
+
+// WriteDiagnostics writes each diagnostic on its own line, in a human-readable format
+func WriteDiagnostics(w io.Writer, diagnostics []Diagnostic) error {
+	for _, d := range diagnostics {
+		_, err := fmt.Fprintln(w, d.String())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteDiagnosticsJSON writes the diagnostics as a JSON array
+func WriteDiagnosticsJSON(w io.Writer, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diagnostics)
+}
@@ -0,0 +1,260 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/kagof/kagofunge/config"
+	"slices"
+	"strconv"
+)
+
+// Rule identifies the kind of mistake a Diagnostic reports
+type Rule string
+
+const (
+	RuleUnreachable         Rule = "unreachable"
+	RuleUnterminatedString  Rule = "unterminated-string"
+	RuleNeverHalts          Rule = "never-halts"
+	RuleGetOutOfBounds      Rule = "get-out-of-bounds"
+	RulePutOutOfBounds      Rule = "put-out-of-bounds"
+	RuleNonASCIIInstruction Rule = "non-ascii-instruction"
+)
+
+// Rules every rule which Lint checks
+var Rules = []Rule{
+	RuleUnreachable,
+	RuleUnterminatedString,
+	RuleNeverHalts,
+	RuleGetOutOfBounds,
+	RulePutOutOfBounds,
+	RuleNonASCIIInstruction,
+}
+
+// Description a short description of what the rule reports
+func (r Rule) Description() string {
+	switch r {
+	case RuleUnreachable:
+		return "Cells which are never executed"
+	case RuleUnterminatedString:
+		return "String mode which is never ended, so it wraps around the whole row or column"
+	case RuleNeverHalts:
+		return "Paths which can never reach @"
+	case RuleGetOutOfBounds:
+		return "g with constant coordinates outside the torus"
+	case RulePutOutOfBounds:
+		return "p with constant coordinates outside the torus"
+	case RuleNonASCIIInstruction:
+		return "Non-ASCII characters which are executed outside string mode"
+	default:
+		return string(r)
+	}
+}
+
+// Severity how serious a Diagnostic is
+type Severity string
+
+const (
+	// SeverityError the program will fail if it reaches the diagnostic
+	SeverityError Severity = "error"
+	// SeverityWarning the program probably doesn't do what was intended
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic a likely mistake in a program, at a position in the torus
+type Diagnostic struct {
+	Rule     Rule     `json:"rule"`
+	Severity Severity `json:"severity"`
+	X        int      `json:"x"`
+	Y        int      `json:"y"`
+	// the number of cells in the row which the diagnostic covers, starting at its position
+	Length  int    `json:"length"`
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("(%d, %d): %s: %s [%s]", d.X, d.Y, d.Severity, d.Message, d.Rule)
+}
+
+// Lint finds likely mistakes in the graph's program, ordered by their position
+func Lint(g *Graph) []Diagnostic {
+	var diagnostics []Diagnostic
+	diagnostics = append(diagnostics, g.unreachable()...)
+	diagnostics = append(diagnostics, g.unterminatedStrings()...)
+	diagnostics = append(diagnostics, g.neverHalts()...)
+	diagnostics = append(diagnostics, g.outOfBounds()...)
+	diagnostics = append(diagnostics, g.nonASCII()...)
+	slices.SortStableFunc(diagnostics, func(a, b Diagnostic) int {
+		if a.Y != b.Y {
+			return a.Y - b.Y
+		}
+		return a.X - b.X
+	})
+	return diagnostics
+}
+
+// executes whether a reachable state executes the instruction, rather than pushing it in string mode
+func (g *Graph) executes(c rune) bool {
+	return slices.ContainsFunc(g.Nodes, func(n Node) bool {
+		return !n.StringMode && g.Char(n.State) == c
+	})
+}
+
+// unreachable reports each run of cells in a row which are neither spaces nor reached by any state
+func (g *Graph) unreachable() []Diagnostic {
+	reached := make(map[[2]int]bool)
+	for _, n := range g.Nodes {
+		reached[[2]int{n.X, n.Y}] = true
+	}
+	var diagnostics []Diagnostic
+	for y, line := range g.torus.Chars {
+		for x := 0; x < len(line); x++ {
+			if line[x] == ' ' || reached[[2]int{x, y}] {
+				continue
+			}
+			start := x
+			for x+1 < len(line) && line[x+1] != ' ' && !reached[[2]int{x + 1, y}] {
+				x++
+			}
+			message := fmt.Sprintf("'%c' is never executed", line[start])
+			if x > start {
+				message = fmt.Sprintf("cells (%d, %d) to (%d, %d) are never executed", start, y, x, y)
+			}
+			diagnostics = append(diagnostics, Diagnostic{Rule: RuleUnreachable, Severity: SeverityWarning, X: start, Y: y,
+				Length: x - start + 1, Message: message})
+		}
+	}
+	return diagnostics
+}
+
+// unterminatedStrings reports each " which starts string mode which is only ended by the same ", after wrapping
+// around the whole row or column
+func (g *Graph) unterminatedStrings() []Diagnostic {
+	var diagnostics []Diagnostic
+	reported := make(map[State]bool)
+	for i, n := range g.Nodes {
+		if n.StringMode || g.Char(n.State) != '"' {
+			continue
+		}
+		// string mode moves in a straight line, so each state has a single successor
+		node := g.Successors(i)[0].To
+		for g.Char(g.Nodes[node].State) != '"' {
+			node = g.Successors(node)[0].To
+		}
+		end := g.Nodes[node]
+		if end.X != n.X || end.Y != n.Y || reported[end.State] {
+			continue
+		}
+		reported[end.State] = true
+		along := "row"
+		if n.Direction == Up || n.Direction == Down {
+			along = "column"
+		}
+		diagnostics = append(diagnostics, Diagnostic{Rule: RuleUnterminatedString, Severity: SeverityWarning, X: n.X,
+			Y: n.Y, Length: 1,
+			Message: fmt.Sprintf("string mode is never ended, so the whole %s is pushed heading %s", along, n.Direction)})
+	}
+	return diagnostics
+}
+
+// neverHalts reports each state where the program first takes a path which can never reach @. Programs which use p
+// aren't checked, as they can write an @ along the path
+func (g *Graph) neverHalts() []Diagnostic {
+	if g.executes('p') {
+		return nil
+	}
+	predecessors := make([][]int, len(g.Nodes))
+	var queue []int
+	halts := make([]bool, len(g.Nodes))
+	for i, n := range g.Nodes {
+		for _, e := range g.Successors(i) {
+			predecessors[e.To] = append(predecessors[e.To], i)
+		}
+		if !n.StringMode && g.Char(n.State) == '@' {
+			halts[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, p := range predecessors[node] {
+			if !halts[p] {
+				halts[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+	if !halts[0] {
+		return []Diagnostic{{Rule: RuleNeverHalts, Severity: SeverityWarning, X: 0, Y: 0, Length: 1,
+			Message: "the program can never reach @"}}
+	}
+	var diagnostics []Diagnostic
+	reported := make(map[[2]int]bool)
+	for _, e := range g.Edges {
+		to := g.Nodes[e.To]
+		if halts[e.From] && !halts[e.To] && !reported[[2]int{to.X, to.Y}] {
+			reported[[2]int{to.X, to.Y}] = true
+			diagnostics = append(diagnostics, Diagnostic{Rule: RuleNeverHalts, Severity: SeverityWarning, X: to.X,
+				Y: to.Y, Length: 1,
+				Message: fmt.Sprintf("the program can never reach @ after reaching here heading %s", to.Direction)})
+		}
+	}
+	return diagnostics
+}
+
+// outOfBounds reports each g and p whose coordinates are always the same, and outside the torus
+func (g *Graph) outOfBounds() []Diagnostic {
+	stacks := g.constants()
+	var diagnostics []Diagnostic
+	reported := make(map[[2]int]bool)
+	for i, n := range g.Nodes {
+		c := g.Char(n.State)
+		if n.StringMode || (c != 'g' && c != 'p') || reported[[2]int{n.X, n.Y}] {
+			continue
+		}
+		s, y := stacks[i].pop()
+		_, x := s.pop()
+		if !x.known || !y.known || (0 <= x.n && x.n < int64(g.torus.Width) && 0 <= y.n && y.n < int64(g.torus.Height)) {
+			continue
+		}
+		reported[[2]int{n.X, n.Y}] = true
+		wrapped := fmt.Sprintf("(%d, %d)", g.torus.ModWidth(int(x.n)), g.torus.ModHeight(int(y.n)))
+		rule, behaviour, key, consequence := RuleGetOutOfBounds, g.config.GetOutOfBoundsBehaviour,
+			"get-out-of-bounds-behaviour", ""
+		if c == 'p' {
+			rule, behaviour, key = RulePutOutOfBounds, g.config.PutOutOfBoundsBehaviour, "put-out-of-bounds-behaviour"
+		}
+		severity := SeverityWarning
+		switch {
+		case behaviour == config.OobWrap:
+			consequence = "it wraps around to " + wrapped
+		case behaviour == config.OobZero && c == 'g':
+			consequence = "it pushes 0"
+		case behaviour == config.OobZero || behaviour == config.OobNoOp:
+			consequence = "it does nothing"
+		default:
+			severity, consequence = SeverityError, "it halts the program with an error"
+		}
+		diagnostics = append(diagnostics, Diagnostic{Rule: rule, Severity: severity, X: n.X, Y: n.Y, Length: 1,
+			Message: fmt.Sprintf("%c is always out of bounds at (%d, %d), which is outside the %dx%d torus. "+
+				"interpreter.%s is %s, so %s", c, x.n, y.n, g.torus.Width, g.torus.Height, key, behaviour, consequence)})
+	}
+	return diagnostics
+}
+
+// nonASCII reports each non-ASCII character which is executed outside string mode, where it does nothing
+func (g *Graph) nonASCII() []Diagnostic {
+	var diagnostics []Diagnostic
+	reported := make(map[[2]int]bool)
+	for _, n := range g.Nodes {
+		c := g.Char(n.State)
+		if n.StringMode || c < 0x80 || reported[[2]int{n.X, n.Y}] {
+			continue
+		}
+		reported[[2]int{n.X, n.Y}] = true
+		diagnostics = append(diagnostics, Diagnostic{Rule: RuleNonASCIIInstruction, Severity: SeverityWarning, X: n.X,
+			Y: n.Y, Length: 1,
+			Message: fmt.Sprintf("non-ASCII character %s is executed outside string mode, where it does nothing",
+				strconv.QuoteRune(c))})
+	}
+	return diagnostics
+}
@@ -0,0 +1,157 @@
+package analysis
+
+import (
+	"encoding/json"
+	"github.com/kagof/kagofunge/config"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+
+	// the position, rule and severity of a diagnostic
+	type expected struct {
+		x, y     int
+		rule     Rule
+		severity Severity
+	}
+	tests := []struct {
+		name     string
+		funge    string
+		config   func(c *config.InterpreterConfig)
+		expected []expected
+	}{
+		{"hello_world", `64+"!dlroW ,olleH">:#,_@`, nil, nil},
+		{"unreachable", "1.@ 23\n45", nil, []expected{
+			{4, 0, RuleUnreachable, SeverityWarning},
+			{0, 1, RuleUnreachable, SeverityWarning},
+		}},
+		{"skipped_is_unreachable", "#1@", nil, []expected{{1, 0, RuleUnreachable, SeverityWarning}}},
+		{"unterminated_string", `"ab@`, nil, []expected{{0, 0, RuleUnterminatedString, SeverityWarning}}},
+		{"string_wraps_to_other_quote", `b"@"a`, nil, []expected{{0, 0, RuleNeverHalts, SeverityWarning}}},
+		{"unterminated_string_column", "v\n\"\n@", nil, []expected{
+			{0, 1, RuleUnterminatedString, SeverityWarning},
+		}},
+		{"never_halts", ">1v\n^ <", nil, []expected{{0, 0, RuleNeverHalts, SeverityWarning}}},
+		{"branch_never_halts", "&|\n @\n >v", nil, []expected{{1, 2, RuleNeverHalts, SeverityWarning}}},
+		{"never_halts_self_modifying", `"@"20p`, nil, nil},
+		{"get_out_of_bounds", "55g.@", nil, []expected{{2, 0, RuleGetOutOfBounds, SeverityWarning}}},
+		{"get_out_of_bounds_panic", "55g.@", func(c *config.InterpreterConfig) {
+			c.GetOutOfBoundsBehaviour = config.OobPanic
+		}, []expected{{2, 0, RuleGetOutOfBounds, SeverityError}}},
+		{"get_in_bounds", "40g.@", nil, nil},
+		{"get_unknown", "&&g.@", nil, nil},
+		{"get_arithmetic", "19-1g.@", nil, []expected{{4, 0, RuleGetOutOfBounds, SeverityWarning}}},
+		{"get_empty_stack", "g.@", nil, nil},
+		{"get_string_mode", `"a"1g.@`, nil, []expected{{4, 0, RuleGetOutOfBounds, SeverityWarning}}},
+		{"get_joined_paths_differ", "&  v\nv1 _9v\n>    >9g.@", nil, nil},
+		{"get_joined_paths_agree", "&  v\nv9 _9v\n>    >9g.@", nil, []expected{{7, 2, RuleGetOutOfBounds, SeverityWarning}}},
+		{"get_cell_overflow", "88*2*0g.@", func(c *config.InterpreterConfig) {
+			c.CellWidth = config.CellWidth8
+		}, nil},
+		{"put_out_of_bounds", "099p@", nil, []expected{{3, 0, RulePutOutOfBounds, SeverityWarning}}},
+		{"put_out_of_bounds_panic", "099p@", func(c *config.InterpreterConfig) {
+			c.PutOutOfBoundsBehaviour = config.OobPanic
+		}, []expected{{3, 0, RulePutOutOfBounds, SeverityError}}},
+		{"put_out_of_bounds_wrap", "099p@", func(c *config.InterpreterConfig) {
+			c.PutOutOfBoundsBehaviour = config.OobWrap
+		}, []expected{{3, 0, RulePutOutOfBounds, SeverityWarning}}},
+		{"loop_converges", ">1:v\n^  <", nil, []expected{{0, 0, RuleNeverHalts, SeverityWarning}}},
+		{"non_ascii", `é"é"@`, nil, []expected{{0, 0, RuleNonASCIIInstruction, SeverityWarning}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+			cfg := config.DefaultConfig()
+			if test.config != nil {
+				test.config(&cfg.Interpreter)
+			}
+
+			g, err := NewGraph(test.funge, cfg.Interpreter)
+			if !asserts.NoError(err) {
+				return
+			}
+			var actual []expected
+			for _, d := range Lint(g) {
+				actual = append(actual, expected{d.X, d.Y, d.Rule, d.Severity})
+				asserts.NotEmpty(d.Message)
+				asserts.Positive(d.Length)
+			}
+			asserts.Equal(test.expected, actual)
+		})
+	}
+}
+
+func TestLint_messages(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.Interpreter.PutOutOfBoundsBehaviour = config.OobWrap
+	g, err := NewGraph("1.@ 23 4\n092p", cfg.Interpreter)
+	asserts.NoError(err)
+	var sb strings.Builder
+	asserts.NoError(WriteDiagnostics(&sb, Lint(g)))
+	asserts.Equal(`(4, 0): warning: cells (4, 0) to (5, 0) are never executed [unreachable]
+(7, 0): warning: '4' is never executed [unreachable]
+(0, 1): warning: cells (0, 1) to (3, 1) are never executed [unreachable]
+`, sb.String())
+
+	g, err = NewGraph("099p@", cfg.Interpreter)
+	asserts.NoError(err)
+	diagnostics := Lint(g)
+	if asserts.Len(diagnostics, 1) {
+		asserts.Equal("p is always out of bounds at (9, 9), which is outside the 5x1 torus. "+
+			"interpreter.put-out-of-bounds-behaviour is WRAP, so it wraps around to (4, 0)", diagnostics[0].Message)
+	}
+}
+
+func TestWriteDiagnosticsJSON(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	var sb strings.Builder
+	asserts.NoError(WriteDiagnosticsJSON(&sb, nil))
+	asserts.Equal("[]\n", sb.String())
+
+	diagnostics := []Diagnostic{{RuleUnreachable, SeverityWarning, 1, 2, 3, "message"}}
+	sb.Reset()
+	asserts.NoError(WriteDiagnosticsJSON(&sb, diagnostics))
+	var decoded []Diagnostic
+	asserts.NoError(json.Unmarshal([]byte(sb.String()), &decoded))
+	asserts.Equal(diagnostics, decoded)
+}
+
+func TestWriteSARIF(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	var sb strings.Builder
+	asserts.NoError(WriteSARIF(&sb, []Diagnostic{{RuleGetOutOfBounds, SeverityError, 1, 2, 3, "message"}},
+		"programs/main.bf"))
+	var log sarifLog
+	asserts.NoError(json.Unmarshal([]byte(sb.String()), &log))
+	asserts.Equal("2.1.0", log.Version)
+	if !asserts.Len(log.Runs, 1) {
+		return
+	}
+	asserts.Len(log.Runs[0].Tool.Driver.Rules, len(Rules))
+	asserts.Equal([]sarifResult{{
+		RuleID:  "get-out-of-bounds",
+		Level:   "error",
+		Message: sarifMessage{Text: "message"},
+		Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: &sarifArtifactLocation{URI: "programs/main.bf"},
+			Region:           sarifRegion{StartLine: 3, StartColumn: 2, EndColumn: 5},
+		}}},
+	}}, log.Runs[0].Results)
+
+	sb.Reset()
+	asserts.NoError(WriteSARIF(&sb, nil, ""))
+	asserts.Contains(sb.String(), `"results": []`)
+	asserts.NotContains(sb.String(), "artifactLocation")
+}
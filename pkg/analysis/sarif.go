@@ -0,0 +1,107 @@
+package analysis
+
+import (
+	"encoding/json"
+	"github.com/kagof/kagofunge/internal"
+	"github.com/kagof/kagofunge/pkg"
+	"io"
+)
+
+// the subset of the Static Analysis Results Interchange Format (SARIF) 2.1.0 which WriteSARIF uses. See
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation *sarifArtifactLocation `json:"artifactLocation,omitempty"`
+	Region           sarifRegion            `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// WriteSARIF writes the diagnostics as a SARIF log, which code scanning tools can use to annotate the program's
+// source. Diagnostics are located in the file at the uri, if it isn't empty, with lines and columns counted in
+// characters from 1
+func WriteSARIF(w io.Writer, diagnostics []Diagnostic, uri string) error {
+	var artifact *sarifArtifactLocation
+	if uri != "" {
+		artifact = &sarifArtifactLocation{URI: uri}
+	}
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "kagofunge",
+				Version:        pkg.Version,
+				InformationURI: "https://github.com/kagof/kagofunge",
+				Rules: internal.MapSlice(Rules, func(r Rule) sarifRule {
+					return sarifRule{ID: string(r), ShortDescription: sarifMessage{Text: r.Description()}}
+				}),
+			}},
+			ColumnKind: "unicodeCodePoints",
+			Results: internal.MapSlice(diagnostics, func(d Diagnostic) sarifResult {
+				return sarifResult{
+					RuleID:  string(d.Rule),
+					Level:   string(d.Severity),
+					Message: sarifMessage{Text: d.Message},
+					Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: artifact,
+						Region:           sarifRegion{StartLine: d.Y + 1, StartColumn: d.X + 1, EndColumn: d.X + d.Length + 1},
+					}}},
+				}
+			}),
+		}},
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
@@ -4,45 +4,127 @@ import (
 	"bufio"
 	"github.com/kagof/kagofunge/config"
 	"io"
+	"math/big"
+	"math/rand/v2"
+	"slices"
 )
 
 type Befunge struct {
-	writer             io.Writer
-	reader             *bufio.Reader
-	Stack              *Stack[int]
-	Torus              *Torus
-	Config             config.InterpreterConfig
-	InstructionPointer *Vector2
-	StringMode         bool
-	delta              *Vector2
-	halted             bool
+	*IP              // the instruction pointer currently executing
+	IPs              []*IP
+	writer           io.Writer
+	reader           *bufio.Reader
+	Space            FungeSpace
+	Config           config.InterpreterConfig
+	random           *rand.Rand // the randomness of ? and FIXP D, or the global source if nil
+	halted           bool
+	exitCode         int
+	nextIPID         int
+	dimensions       int
+	cellBits         int
+	boxes            map[int]*big.Int // bignums too big for an int, by their handle on the stack
+	nextBox          int
+	boxSweepAt       int
+	fingerprintState map[string]any
+	parseInstruction func(rune) InstructionPerformer
+	putListeners     []func(PutEvent)
+	stepListeners    []func(StepEvent)
+	undo             *Undo // records the changes made by the current step, if it can be reverted
+	reverting        bool
+	input            *inputLog
+	output           *outputLog
 }
 
 func NewBefunge(c *config.Config, s string, w io.Writer, r io.Reader) *Befunge {
-	var maxLines, maxColumns int
-	if c.Interpreter.EnforceTorusSizeRestriction {
-		maxLines = c.Interpreter.TorusSizeRestrictionHeight
-		maxColumns = c.Interpreter.TorusSizeRestrictionWidth
+	var space FungeSpace
+	var parse func(rune) InstructionPerformer
+	dimensions := 2
+	if c.Interpreter.Dialect == config.Dialect98 {
+		if c.Interpreter.Dimensions != 0 {
+			dimensions = c.Interpreter.Dimensions
+		}
+		space = NewLaheySpace(s, dimensions)
+		parse = func(char rune) InstructionPerformer {
+			return ParseFungeInstruction(char, dimensions)
+		}
 	} else {
-		maxLines = -1
-		maxColumns = -1
+		var maxLines, maxColumns int
+		if c.Interpreter.EnforceTorusSizeRestriction {
+			maxLines = c.Interpreter.TorusSizeRestrictionHeight
+			maxColumns = c.Interpreter.TorusSizeRestrictionWidth
+		} else {
+			maxLines = -1
+			maxColumns = -1
+		}
+		space = NewTorus(s, maxLines, maxColumns)
+		parse = ParseInstruction
 	}
-	torus := NewTorus(s, maxLines, maxColumns)
+	var random *rand.Rand
+	if c.Interpreter.RandomSeed != nil {
+		random = rand.New(NewRandomSource(*c.Interpreter.RandomSeed))
+	}
+	ip := NewIP(0)
 	return &Befunge{
-		writer:             w,
-		reader:             bufio.NewReader(r),
-		Stack:              NewStack[int](),
-		Torus:              torus,
-		Config:             c.Interpreter,
-		InstructionPointer: NewVector2(0, 0),
-		StringMode:         false,
-		delta:              XPos(),
-		halted:             false,
+		IP:               ip,
+		IPs:              []*IP{ip},
+		writer:           w,
+		reader:           bufio.NewReader(r),
+		Space:            space,
+		Config:           c.Interpreter,
+		random:           random,
+		halted:           false,
+		nextIPID:         1,
+		dimensions:       dimensions,
+		cellBits:         CellBits(c.Interpreter.CellWidth),
+		fingerprintState: make(map[string]any),
+		parseInstruction: parse,
 	}
 }
 
 func (f *Befunge) CurrentChar() rune {
-	return f.Torus.CharAt(f.InstructionPointer.X, f.InstructionPointer.Y)
+	return f.CharUnder(f.IP)
+}
+
+// CharUnder the character under the given instruction pointer
+func (f *Befunge) CharUnder(ip *IP) rune {
+	return f.Space.Get(ip.InstructionPointer)
+}
+
+// ExitCode the exit code the program requested when terminating. Only Funge-98 programs can request a non-zero exit
+// code, using q
+func (f *Befunge) ExitCode() int {
+	return f.exitCode
+}
+
+// Dimensions the number of dimensions of funge-space: 1 for Unefunge, 2 for Befunge, or 3 for Trefunge
+func (f *Befunge) Dimensions() int {
+	return f.dimensions
+}
+
+func (f *Befunge) is98() bool {
+	return f.Config.Dialect == config.Dialect98
+}
+
+// NewRandomSource the source of randomness for a seed, which makes the choices of a program the same on each run with
+// that seed, including when compiled to Go
+func NewRandomSource(seed uint64) rand.Source {
+	return rand.NewPCG(seed, seed)
+}
+
+// SetRandomSource makes ? and FIXP D take their randomness from the source, or from the global source if it is nil
+func (f *Befunge) SetRandomSource(source rand.Source) {
+	f.random = nil
+	if source != nil {
+		f.random = rand.New(source)
+	}
+}
+
+// randomInt a random integer in [0,n), from the random source if it is set
+func (f *Befunge) randomInt(n int) int {
+	if f.random == nil {
+		return rand.IntN(n)
+	}
+	return f.random.IntN(n)
 }
 
 func (f *Befunge) stackPop() int {
@@ -53,6 +135,12 @@ func (f *Befunge) stackPop() int {
 	return 0
 }
 
+// popVector pops a vector with a component for each dimension, eg y and then x for Befunge, which is false when a
+// component is a bignum too big for an int
+func (f *Befunge) popVector() (*Vector, bool) {
+	return f.popVectorFrom(f.Stack)
+}
+
 func (f *Befunge) StackPeek() int {
 	v, b := f.Stack.Peek()
 	if b {
@@ -61,30 +149,120 @@ func (f *Befunge) StackPeek() int {
 	return 0
 }
 
+// Step Process the next tick, in which each instruction pointer executes one instruction, in order
 func (f *Befunge) Step() (bool, error) {
+	if f.output != nil && f.undo == nil {
+		// only the input and output of the current step are needed, along with any input which is still buffered
+		f.output.written = f.output.written[:0]
+		f.input.discard(f.consumedInput())
+	}
+	ips := f.IPs
+	if len(ips) > 1 {
+		// instruction pointers spawned during this tick do not execute until the next one
+		ips = slices.Clone(ips)
+	}
+	for _, ip := range ips {
+		f.IP = ip
+		err := f.stepIP()
+		if f.halted {
+			return false, mapErr(f, err)
+		}
+	}
+	f.IPs = slices.DeleteFunc(f.IPs, func(ip *IP) bool {
+		return ip.terminated
+	})
+	if len(f.IPs) == 0 {
+		return false, nil
+	}
+	f.IP = f.IPs[0]
+	return true, nil
+}
+
+// stepIP processes the next instruction of the current instruction pointer
+func (f *Befunge) stepIP() error {
 	var err error
+	if f.is98() {
+		f.skipSpacesAndComments()
+	}
 	char := f.CurrentChar()
+	var event *pendingStepEvent
+	if len(f.stepListeners) > 0 {
+		event = f.startStepEvent(char)
+	}
 	if f.StringMode && char != '"' {
-		f.Stack.Push(int(char))
+		err = num{val: int(char)}.PerformInstruction(f)
+		if char == ' ' && f.is98() {
+			// Funge-98 string mode collapses consecutive spaces into a single space
+			for f.charAtOffset(f.delta) == ' ' {
+				f.move()
+			}
+		}
 	} else {
-		instruction := ParseInstruction(char)
+		instruction := f.Space.Instruction(f.InstructionPointer, f.parseInstruction)
 		err = instruction.PerformInstruction(f)
 	}
-	if f.halted {
-		return false, mapErr(f, err)
+	if event != nil {
+		f.finishStepEvent(event)
+	}
+	if f.halted || f.terminated {
+		return err
 	}
 	f.step()
-	return true, nil
+	return nil
 }
 
 func (f *Befunge) step() {
-	if f.delta.X != 0 { //saving some modulus operations
-		f.InstructionPointer.X = f.Torus.ModWidth(f.InstructionPointer.X + f.delta.X)
+	f.move()
+	if f.is98() {
+		f.skipSpacesAndComments()
 	}
-	if f.delta.Y != 0 { //saving some modulus operations
-		f.InstructionPointer.Y = f.Torus.ModHeight(f.InstructionPointer.Y + f.delta.Y)
+}
+
+// move the instruction pointer once by its delta, wrapping around the funge-space
+func (f *Befunge) move() {
+	f.InstructionPointer = f.positionAtOffset(f.delta)
+}
+
+func (f *Befunge) positionAtOffset(offset *Vector) *Vector {
+	return f.Space.Next(f.InstructionPointer, offset)
+}
+
+func (f *Befunge) charAtOffset(offset *Vector) rune {
+	pos := f.positionAtOffset(offset)
+	return f.Space.Get(pos)
+}
+
+// skipSpacesAndComments moves past spaces and ;-delimited comments, which take no time in Funge-98. A path containing
+// nothing but spaces would loop forever, so the search gives up after visiting as many cells as the program contains.
+func (f *Befunge) skipSpacesAndComments() {
+	if f.StringMode {
+		return
+	}
+	if char := f.CurrentChar(); char != ' ' && char != ';' {
+		return // nothing to skip
+	}
+	least, greatest := f.Space.Bounds()
+	inComment := false
+	for range (greatest.X - least.X + 1) * (greatest.Y - least.Y + 1) * (greatest.Z - least.Z + 1) {
+		char := f.CurrentChar()
+		if char == ';' {
+			inComment = !inComment
+		} else if char != ' ' && !inComment {
+			return
+		}
+		f.move()
 	}
-	f.delta = f.delta.ScaleToOne()
+}
+
+// nextInstructionPosition finds the position of the next instruction along the current delta, as used by k
+func (f *Befunge) nextInstructionPosition() *Vector {
+	current := f.InstructionPointer
+	defer func() {
+		f.InstructionPointer = current
+	}()
+	f.move()
+	f.skipSpacesAndComments()
+	return f.InstructionPointer
 }
 
 func mapErr(funge *Befunge, err error) error {
@@ -94,7 +272,7 @@ func mapErr(funge *Befunge, err error) error {
 	return &BefungeExecutionError{
 		X:   funge.InstructionPointer.X,
 		Y:   funge.InstructionPointer.Y,
-		Val: funge.Torus.CharAt(funge.InstructionPointer.X, funge.InstructionPointer.Y),
+		Val: funge.Space.Get(funge.InstructionPointer),
 		Err: err,
 	}
 }
@@ -65,25 +65,637 @@ func TestBefunge(t *testing.T) {
 			"",
 			"0", // putting out of bounds should not wrap, but should just discard
 		},
+		{
+			"self_modifying",
+			`2."@"10p`,
+			"",
+			"2", // the . should be replaced by @ before the second pass
+		},
+	}
+
+	cfg := config.DefaultConfig()
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			output, _ := runProgram(t, &cfg, test.funge, test.input)
+			asserts.Equal(test.expected, output, "%s output not as expected", test.name)
+		})
+	}
+}
+
+func TestFunge98(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	var cases = []struct {
+		name     string
+		funge    string
+		input    string
+		expected string
+	}{
+		{
+			"hello_world",
+			` >               v
+ v"Hello, World!"<
+ >:v
+ ^,_@`,
+			"",
+			"Hello, World!",
+		},
+		{
+			"hex_digits",
+			"af*.@",
+			"",
+			"150",
+		},
+		{
+			"fetch_char",
+			"'A,@",
+			"",
+			"A",
+		},
+		{
+			"store_char",
+			"'Qs@30g,@",
+			"",
+			"Q",
+		},
+		{
+			"iterate",
+			"3k1++.@",
+			"",
+			"3",
+		},
+		{
+			"iterate_zero",
+			"0k.5.@",
+			"",
+			"5",
+		},
+		{
+			"absolute_delta",
+			"20x.7.. @",
+			"",
+			"7",
+		},
+		{
+			"jump",
+			"2j..5.@",
+			"",
+			"5",
+		},
+		{
+			"turn_left",
+			`v @
+  .
+>5[`,
+			"",
+			"5",
+		},
+		{
+			"turn_right",
+			`7]
+ .
+ @`,
+			"",
+			"7",
+		},
+		{
+			"compare",
+			`521w
+   .
+   @`,
+			"",
+			"5",
+		},
+		{
+			"reflect",
+			"5#.r@",
+			"",
+			"5",
+		},
+		{
+			"unknown_instruction_reflects",
+			"5#.X@",
+			"",
+			"5",
+		},
+		{
+			"comment",
+			"5;.@;.@",
+			"",
+			"5",
+		},
+		{
+			"clear_stack",
+			"12n.@",
+			"",
+			"0",
+		},
+		{
+			"begin_block",
+			"1232{..@",
+			"",
+			"32",
+		},
+		{
+			"end_block",
+			"1232{1}...@",
+			"",
+			"310",
+		},
+		{
+			"end_block_without_soss_reflects",
+			"5#.}@",
+			"",
+			"5",
+		},
+		{
+			"storage_offset",
+			"1{$00g,@",
+			"",
+			"$",
+		},
+		{
+			"stack_under_stack",
+			"1230{4u....@",
+			"",
+			"2300",
+		},
+		{
+			// 2^63 overflows to the smallest int, which can't be negated
+			"begin_block_min_int_reflects",
+			"1" + strings.Repeat(":+", 63) + "{@.2",
+			"",
+			"2",
+		},
+		{
+			"begin_block_huge_count_reflects",
+			"1" + strings.Repeat(":+", 40) + "{@.2",
+			"",
+			"2",
+		},
+		{
+			"end_block_min_int_empties_soss",
+			"1" + strings.Repeat(":+", 63) + "1{}1.@",
+			"",
+			"1",
+		},
+		{
+			"end_block_huge_count_reflects",
+			"1" + strings.Repeat(":+", 40) + "1{}@.2",
+			"",
+			"2",
+		},
+		{
+			"stack_under_stack_huge_count_reflects",
+			"0{1" + strings.Repeat(":+", 40) + "u@.2",
+			"",
+			"2",
+		},
+		{
+			"stack_under_stack_min_int_reflects",
+			"0{1" + strings.Repeat(":+", 63) + "u@.2",
+			"",
+			"2",
+		},
+		{
+			"sysinfo_stack_count",
+			"0{bb+y.@",
+			"",
+			"2",
+		},
+		{
+			"put_far_outside_program",
+			"'A99*0p99*0g,@",
+			"",
+			"A",
+		},
+		{
+			"put_negative",
+			"'A01-0p01-0g,@",
+			"",
+			"A",
+		},
+		{
+			"split",
+			"1t3.@.",
+			"",
+			"13", // the child travels west and executes before its parent
+		},
+		{
+			"split_terminating_parent",
+			"t@  .7<",
+			"",
+			"7",
+		},
+		{
+			"sysinfo_flags",
+			"1y.@",
+			"",
+			"17",
+		},
+		{
+			"string_mode_collapses_spaces",
+			`"a   b",,,@`,
+			"",
+			"b a",
+		},
+		{
+			"sysinfo_dimensions",
+			"7y.@",
+			"",
+			"2",
+		},
+		{
+			"self_modifying",
+			`2."@"10p`,
+			"",
+			"2",
+		},
+		{
+			"sysinfo_version",
+			"4y.@",
+			"",
+			"10",
+		},
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Interpreter.Dialect = config.Dialect98
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			output, _ := runProgram(t, &cfg, test.funge, test.input)
+			asserts.Equal(test.expected, output, "%s output not as expected", test.name)
+		})
+	}
+}
+
+func TestFunge98_dimensions(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	var cases = []struct {
+		name       string
+		dimensions int
+		funge      string
+		expected   string
+	}{
+		{
+			"unefunge_2d_instructions_reflect",
+			1,
+			"5#.v@",
+			"5",
+		},
+		{
+			"unefunge_put_get",
+			1,
+			"'A9p9g,@",
+			"A",
+		},
+		{
+			"unefunge_sysinfo_dimensions",
+			1,
+			"7y.@",
+			"1",
+		},
+		{
+			"trefunge_go_low",
+			3,
+			"l\f>5.@",
+			"5",
+		},
+		{
+			"trefunge_go_high",
+			3,
+			"h\f>7.@",
+			"7",
+		},
+		{
+			"trefunge_put_get",
+			3,
+			"'A101p101g,@",
+			"A",
+		},
+		{
+			"trefunge_sysinfo_dimensions",
+			3,
+			"7y.@",
+			"3",
+		},
+		{
+			"befunge_3d_instructions_reflect",
+			2,
+			"5#.h@",
+			"5",
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := config.DefaultConfig()
+			cfg.Interpreter.Dialect = config.Dialect98
+			cfg.Interpreter.Dimensions = test.dimensions
+			output, _ := runProgram(t, &cfg, test.funge, "")
+			asserts.Equal(test.expected, output, "%s output not as expected", test.name)
+		})
+	}
+}
+
+func TestBefunge_cellWidth(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	var cases = []struct {
+		name     string
+		width    config.CellWidth
+		overflow config.OverflowBehaviour
+		funge    string
+		expected string
+	}{
+		{"8_wrap", config.CellWidth8, config.OverflowWrap, "88*2*.@", "-128"},
+		{"8_saturate", config.CellWidth8, config.OverflowSaturate, "88*2*.@", "127"},
+		{"8_get", config.CellWidth8, config.OverflowWrap, "50g.@È", "-56"},
+		{"8_string_mode", config.CellWidth8, config.OverflowWrap, `"é".@`, "-23"},
+		{"8_string_mode_saturate", config.CellWidth8, config.OverflowSaturate, `"é".@`, "127"},
+		{"16_wrap", config.CellWidth16, config.OverflowWrap, "88*:*8*.@", "-32768"},
+		{"32_wrap", config.CellWidth32, config.OverflowWrap, "88*:*:*88*2**.@", "-2147483648"},
+		{"32_saturate", config.CellWidth32, config.OverflowSaturate, "88*:*:*88*2**.@", "2147483647"},
+		{"32_saturate_negative", config.CellWidth32, config.OverflowSaturate, "088*:*:*88*2**-1-.@", "-2147483648"},
+		{"64_wrap", config.CellWidth64, config.OverflowWrap, "88*:*:*:*:*.@", "0"},
+		{"64_saturate", config.CellWidth64, config.OverflowSaturate, "88*:*:*:*:*.@", "9223372036854775807"},
+		{"bignum", config.CellWidthBignum, config.OverflowWrap, "88*:*:*:*:*.@", "79228162514264337593543950336"},
+		{"bignum_negative", config.CellWidthBignum, config.OverflowWrap, "088*:*:*:*:*-.@", "-79228162514264337593543950336"},
+		{"bignum_divide", config.CellWidthBignum, config.OverflowWrap, "88*:*:*:*:*88*:*:*:*/.@", "281474976710656"},
+		{"bignum_compare", config.CellWidthBignum, config.OverflowWrap, "88*:*:*:*:*1`.@", "1"},
+		{"bignum_put_wraps_to_space_cell", config.CellWidthBignum, config.OverflowWrap, "88*:*:*:*:*1+00p00g.@", "1"},
+		{"bignum_discarded", config.CellWidthBignum, config.OverflowWrap, "88*:*:*:*:*$1.@", "1"},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := config.DefaultConfig()
+			cfg.Interpreter.CellWidth = test.width
+			cfg.Interpreter.OverflowBehaviour = test.overflow
+			output, _ := runProgram(t, &cfg, test.funge, "")
+			asserts.Equal(test.expected, output, "%s output not as expected", test.name)
+		})
+	}
+}
+
+func TestFunge98_cellWidth(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+	var cases = []struct {
+		name     string
+		width    config.CellWidth
+		funge    string
+		expected string
+	}{
+		{"8_fetch_char", config.CellWidth8, "'é.@", "-23"},
+		{"bignum_jump_reflects", config.CellWidthBignum, "88*:*:*:*:*j@.2", "2"},
+		{"bignum_iterate_reflects", config.CellWidthBignum, "88*:*:*:*:*k@.2", "2"},
+		{"bignum_begin_block_reflects", config.CellWidthBignum, "88*:*:*:*:*{@.2", "2"},
+		{"bignum_get_reflects", config.CellWidthBignum, "88*:*:*:*:*0g@.2", "2"},
+		{"bignum_absolute_delta_reflects", config.CellWidthBignum, "88*:*:*:*:*0x@.2", "2"},
+		{"bignum_sys_info_reflects", config.CellWidthBignum, "88*:*:*:*:*y@.2", "2"},
+		{"bignum_compare", config.CellWidthBignum, "88*:*:*:*:*1w\n            2\n            .\n            @", "2"},
+		{"bignum_fixp_random_min_int", config.CellWidthBignum, "\"PXIF\"4(088*:*:*:*88*:*8**-D0`!.@", "1"},
+		{"bignum_strn_itoa", config.CellWidthBignum, "\"NRTS\"4(88*:*:*:*:*S>:#,_@", "79228162514264337593543950336"},
+		{"bignum_bool_min_int", config.CellWidthBignum, "\"LOOB\"4(088*:*:*:*88*8*8*8**-N.@", "9223372036854775807"},
+		{"bignum_bool_reflects", config.CellWidthBignum, "\"LOOB\"4(v\n        [88*:*:*:*:*1O.@\n        2\n        .\n        @", "2"},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := config.DefaultConfig()
+			cfg.Interpreter.Dialect = config.Dialect98
+			cfg.Interpreter.CellWidth = test.width
+			output, _ := runProgram(t, &cfg, test.funge, "")
+			asserts.Equal(test.expected, output, "%s output not as expected", test.name)
+		})
+	}
+}
+
+func TestBefunge_divideByZero(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+	var cases = []struct {
+		name     string
+		divide   config.DivideByZeroBehaviour
+		modulus  config.DivideByZeroBehaviour
+		funge    string
+		expected string
+	}{
+		{"divide_return_zero", config.Div0ReturnZero, config.Div0PromptForInput, "70/.@", "0"},
+		{"modulus_return_zero", config.Div0PromptForInput, config.Div0ReturnZero, "70%.@", "0"},
+		// reflecting reverses the direction of the instruction pointer, which wraps around to the 2
+		{"divide_reflect", config.Div0Reflect, config.Div0PromptForInput, "70/@.2", "2"},
+		{"modulus_reflect", config.Div0PromptForInput, config.Div0Reflect, "70%@.2", "2"},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := config.DefaultConfig()
+			cfg.Interpreter.DivideByZeroBehaviour = test.divide
+			cfg.Interpreter.ModulusByZeroBehaviour = test.modulus
+			output, _ := runProgram(t, &cfg, test.funge, "")
+			asserts.Equal(test.expected, output, "%s output not as expected", test.name)
+		})
+	}
+}
+
+func TestBefunge_overflowPanic(t *testing.T) {
+	t.Parallel()
+	cfg := config.DefaultConfig()
+	cfg.Interpreter.CellWidth = config.CellWidth8
+	cfg.Interpreter.OverflowBehaviour = config.OverflowPanic
+	befunge := NewBefunge(&cfg, "88*2*.@", &strings.Builder{}, strings.NewReader(""))
+	var hasNext = true
+	var err error
+	for hasNext && err == nil {
+		hasNext, err = befunge.Step()
+	}
+	assert.ErrorIs(t, err, errOverflow)
+}
+
+func TestBefunge_bignumSweep(t *testing.T) {
+	t.Parallel()
+	cfg := config.DefaultConfig()
+	cfg.Interpreter.CellWidth = config.CellWidthBignum
+	// keeps squaring 2^96, discarding each result, while keeping 2^96 on the stack
+	befunge := NewBefunge(&cfg, "88*:*:*:*:*>::*$v\n           ^    <", &strings.Builder{}, strings.NewReader(""))
+	for range 10 * minBoxSweep {
+		_, err := befunge.Step()
+		assert.NoError(t, err)
+	}
+	assert.Less(t, len(befunge.boxes), 2*minBoxSweep, "discarded bignums should be swept")
+	assert.Equal(t, "79228162514264337593543950336", befunge.CellValue(befunge.StackPeek()).String())
+}
+
+// randomProgram prints 8 digits from 1 to 3, each chosen by a ?
+const randomProgram = "9>1-:#v_@\n ^  .3?1.v\n      2\n      .\n ^    <  <"
+
+// constantSource a source of randomness which always gives the same value
+type constantSource uint64
+
+func (s constantSource) Uint64() uint64 {
+	return uint64(s)
+}
+
+func TestBefunge_randomSeed(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	outputs := make(map[string]bool)
+	for seed := range uint64(10) {
+		cfg := config.DefaultConfig()
+		cfg.Interpreter.RandomSeed = &seed
+		output, _ := runProgram(t, &cfg, randomProgram, "")
+		asserts.Len(output, 8)
+		again, _ := runProgram(t, &cfg, randomProgram, "")
+		asserts.Equal(output, again, "the same seed should make the same choices")
+		outputs[output] = true
+	}
+	asserts.Greater(len(outputs), 1, "different seeds should make different choices")
+
+	cfg := config.DefaultConfig()
+	cfg.Interpreter.Dialect = config.Dialect98
+	seed := uint64(7)
+	cfg.Interpreter.RandomSeed = &seed
+	output, _ := runProgram(t, &cfg, `"PXIF"4(a:*D.a:*D.a:*D.@`, "")
+	again, _ := runProgram(t, &cfg, `"PXIF"4(a:*D.a:*D.a:*D.@`, "")
+	asserts.Equal(output, again, "the same seed should give FIXP D the same values")
+}
+
+func TestBefunge_SetRandomSource(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	cfg := config.DefaultConfig()
+	var writer strings.Builder
+	befunge := NewBefunge(&cfg, randomProgram, &writer, strings.NewReader(""))
+	befunge.SetRandomSource(constantSource(0))
+	for hasNext, i := true, 0; hasNext && i < maxSteps; i++ {
+		var err error
+		hasNext, err = befunge.Step()
+		asserts.NoError(err)
+	}
+	asserts.Equal("11111111", writer.String(), "? should go east each time the source gives 0")
+}
+
+func TestFunge98_quit(t *testing.T) {
+	t.Parallel()
+	cfg := config.DefaultConfig()
+	cfg.Interpreter.Dialect = config.Dialect98
+	_, befunge := runProgram(t, &cfg, "3q", "")
+	assert.Equal(t, 3, befunge.ExitCode(), "exit code not as expected")
+}
+
+func runProgram(t *testing.T, cfg *config.Config, funge string, input string) (string, *Befunge) {
+	var writer strings.Builder
+	befunge := NewBefunge(cfg, funge, &writer, strings.NewReader(input))
+
+	var hasNext = true
+	var err error
+	var i = 0
+	for hasNext && i < maxSteps {
+		hasNext, err = befunge.Step()
+		assert.NoError(t, err, "no error expected while executing %s", funge)
+		i += 1
+	}
+	assert.Less(t, i, maxSteps, "exceeded %d steps executing %s", maxSteps, funge)
+	return writer.String(), befunge
+}
+
+func TestFunge98_fingerprints(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	RegisterFingerprint(&Fingerprint{Name: "KGFT", Instructions: map[rune]InstructionPerformer{
+		'T': InstructionFunc(func(f *Befunge) error {
+			f.Stack.Push(42)
+			return nil
+		}),
+	}})
+
+	var cases = []struct {
+		name     string
+		funge    string
+		input    string
+		expected string
+	}{
+		{"load_pushes_success", `"AMOR"4(.@`, "", "1"},
+		{"load_pushes_id", `"AMOR"4($.@`, "", "1380928833"},
+		{"load_unknown_reflects", `"ZZZZ"4(@.2`, "", "2"},
+		{"load_huge_count_reflects", `ffffffffff*********(@.2`, "", "2"},
+		{"load_count_past_empty_stack_reflects", `"AMOR"5(@.2`, "", "2"},
+		{"unbound_reflects", "A@.2", "", "2"},
+		{"registered", `"TFGK"4(T.@`, "", "42"},
+		{"unload_restores_previous", `"AMOR"4("UDOM"4("UDOM"4)M.@`, "", "1000"},
+		{"loaded_overrides_previous", `"AMOR"4("UDOM"4(73M.@`, "", "1"},
+		{"null", `"AMOR"4("LLUN"4(5#@.M`, "", "51"},
+		{"roma", `"AMOR"4(MD+.@`, "", "1500"},
+		{"modu_floored", `"UDOM"4(07-3M.@`, "", "2"},
+		{"modu_floored_negative_divisor", `"UDOM"4(703-M.@`, "", "-2"},
+		{"modu_unsigned", `"UDOM"4(703-U.@`, "", "1"},
+		{"modu_remainder", `"UDOM"4(07-3R.@`, "", "-1"},
+		{"modu_zero", `"UDOM"4(70M.@`, "", "0"},
+		{"bool_and", `"LOOB"4(63A.@`, "", "2"},
+		{"bool_or", `"LOOB"4(63O.@`, "", "7"},
+		{"bool_xor", `"LOOB"4(63X.@`, "", "5"},
+		{"bool_not", `"LOOB"4(0N.@`, "", "-1"},
+		{"fixp_sin", `"PXIF"4(9aaaaa*****I.@`, "", "10000"},
+		{"fixp_cos", `"PXIF"4(0C.@`, "", "10000"},
+		{"fixp_asin", `"PXIF"4(aaaa***J.@`, "", "900000"},
+		{"fixp_sqrt", `"PXIF"4(99*Q.@`, "", "9"},
+		{"fixp_pow", `"PXIF"4(23R.@`, "", "8"},
+		{"fixp_abs", `"PXIF"4(05-V.@`, "", "5"},
+		{"fixp_sign", `"PXIF"4(05-S.@`, "", "-1"},
+		{"fixp_neg", `"PXIF"4(5N.@`, "", "-5"},
+		{"fixp_pi", `"PXIF"4(2P.@`, "", "6"},
+		{"strn_display", `"NRTS"4(0"olleh"D@`, "", "hello"},
+		{"strn_length", `"NRTS"4(0"olleh"N.@`, "", "5"},
+		{"strn_append", `"NRTS"4(0"dlrow"0"olleh"AD@`, "", "helloworld"},
+		{"strn_compare", `"NRTS"4(0"a"0"b"C.@`, "", "1"},
+		{"strn_find", `"NRTS"4(0"ol"0"olleh"FD@`, "", "lo"},
+		{"strn_left", `"NRTS"4(0"olleh"2LD@`, "", "he"},
+		{"strn_right", `"NRTS"4(0"olleh"2RD@`, "", "lo"},
+		{"strn_middle", `"NRTS"4(0"olleh"13MD@`, "", "ell"},
+		{"strn_itoa", `"NRTS"4(aa*SD@`, "", "100"},
+		{"strn_atoi", `"NRTS"4(0"24"V1+.@`, "", "43"},
+		{"strn_input", `"NRTS"4(ID@`, "abc\n", "abc"},
+		{"strn_put_get", `"NRTS"4(0"ih"55P55GD@`, "", "hi"},
+		{"orth_bitwise", `"HTRO"4(63E.@`, "", "5"},
+		{"orth_put_get", `"HTRO"4('A98P98G,@`, "", "A"},
+		{"orth_skip_if_zero", `"HTRO"4(0Z@7.@`, "", "7"},
+		{"orth_set_x", `"HTRO"4(fX@@@@@@7.@`, "", "7"},
+		{"orth_string", `"HTRO"4(0"ih"S@`, "", "hi"},
+		{"refc", `"CFER"4(12R34R$D..@`, "", "21"},
 	}
 
 	cfg := config.DefaultConfig()
+	cfg.Interpreter.Dialect = config.Dialect98
 	for _, test := range cases {
 		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
-			var writer strings.Builder
-			befunge := NewBefunge(&cfg, test.funge, &writer, strings.NewReader(test.input))
-
-			var hasNext = true
-			var err error
-			var i = 0
-			for hasNext && i < maxSteps {
-				hasNext, err = befunge.Step()
-				asserts.NoError(err, "no error expected while executing %s", test.name)
-				i += 1
-			}
-			asserts.Less(i, maxSteps, "exceeded %d steps executing %s", maxSteps, test.name)
-			asserts.Equal(test.expected, writer.String(), "%s output not as expected", test.name)
+			output, _ := runProgram(t, &cfg, test.funge, test.input)
+			asserts.Equal(test.expected, output, "%s output not as expected", test.name)
 		})
 	}
 }
+
+func TestRegisterFingerprint_invalid(t *testing.T) {
+	t.Parallel()
+	assert.Panics(t, func() {
+		RegisterFingerprint(&Fingerprint{Name: "KGFX", Instructions: map[rune]InstructionPerformer{'a': reflect{}}})
+	})
+	assert.Panics(t, func() {
+		RegisterFingerprint(&Fingerprint{})
+	})
+}
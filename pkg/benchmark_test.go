@@ -0,0 +1,101 @@
+package pkg
+
+import (
+	"github.com/kagof/kagofunge/config"
+	"io"
+	"strings"
+	"testing"
+)
+
+var benchmarks = []struct {
+	name  string
+	funge string
+	input string
+}{
+	{
+		"factorial",
+		`&>:1-:v v *_$.@
+ ^    _$>\:^`,
+		"20",
+	},
+	{
+		"quine",
+		"01->1# +# :# 0# g# ,# :# 5# 8# *# 4# +# -# _@",
+		"",
+	},
+	{
+		"count_to_10000",
+		`0>1+:"d":*-v
+ ^         _.@`,
+		"",
+	},
+}
+
+func BenchmarkBefunge(b *testing.B) {
+	cfg := config.DefaultConfig()
+	cfg.Interpreter.Dialect = config.Dialect98
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			for range b.N {
+				runBenchmark(b, NewBefunge(&cfg, bench.funge, io.Discard, strings.NewReader(bench.input)))
+			}
+		})
+		// decoding every instruction each time it is executed, for comparison
+		b.Run(bench.name+"_uncached", func(b *testing.B) {
+			for range b.N {
+				befunge := NewBefunge(&cfg, bench.funge, io.Discard, strings.NewReader(bench.input))
+				befunge.Space = uncachedSpace{befunge.Space}
+				runBenchmark(b, befunge)
+			}
+		})
+		b.Run(bench.name+"_trace", func(b *testing.B) {
+			for range b.N {
+				runBenchmark(b, NewTraceEngine(NewBefunge(&cfg, bench.funge, io.Discard, strings.NewReader(bench.input))))
+			}
+		})
+	}
+}
+
+func BenchmarkBefunge93(b *testing.B) {
+	cfg := config.DefaultConfig()
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			for range b.N {
+				runBenchmark(b, NewBefunge(&cfg, bench.funge, io.Discard, strings.NewReader(bench.input)))
+			}
+		})
+		b.Run(bench.name+"_uncached", func(b *testing.B) {
+			for range b.N {
+				befunge := NewBefunge(&cfg, bench.funge, io.Discard, strings.NewReader(bench.input))
+				befunge.Space = uncachedSpace{befunge.Space}
+				runBenchmark(b, befunge)
+			}
+		})
+		b.Run(bench.name+"_trace", func(b *testing.B) {
+			for range b.N {
+				runBenchmark(b, NewTraceEngine(NewBefunge(&cfg, bench.funge, io.Discard, strings.NewReader(bench.input))))
+			}
+		})
+	}
+}
+
+func runBenchmark(b *testing.B, befunge Stepper) {
+	for {
+		hasNext, err := befunge.Step()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !hasNext {
+			return
+		}
+	}
+}
+
+// uncachedSpace decodes instructions every time they are needed
+type uncachedSpace struct {
+	FungeSpace
+}
+
+func (u uncachedSpace) Instruction(position *Vector, decode func(rune) InstructionPerformer) InstructionPerformer {
+	return decode(u.Get(position))
+}
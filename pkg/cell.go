@@ -0,0 +1,208 @@
+package pkg
+
+import (
+	"errors"
+	"github.com/kagof/kagofunge/config"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// cells in funge-space are runes, so they are always at most 32 bits wide
+const spaceCellBits = 32
+
+// bignums which don't fit in an int are boxed, and the stack holds a handle to them instead. Handles are taken from the
+// very bottom of the range of int, so the values there are boxed as well
+const (
+	boxBase  = math.MinInt
+	boxRange = 1 << (strconv.IntSize - 16)
+)
+
+// sweep the boxes for bignums which are no longer on any stack once there are at least this many
+const minBoxSweep = 1024
+
+var errOverflow = errors.New("cell overflow")
+
+// CellBits the number of bits in a stack cell of the given width, or 0 for bignum cells which have no limit
+func CellBits(width config.CellWidth) int {
+	switch width {
+	case config.CellWidth8:
+		return 8
+	case config.CellWidth16:
+		return 16
+	case config.CellWidth32:
+		return 32
+	case config.CellWidthBignum:
+		return 0
+	default:
+		return strconv.IntSize
+	}
+}
+
+// fitsInHalfWidth whether arithmetic on the cell can be done on ints without any chance of overflowing
+func fitsInHalfWidth(c int) bool {
+	const half = 1 << (strconv.IntSize/2 - 1)
+	return -half < c && c < half
+}
+
+// wrapsNatively whether cells behave the same as ints, so that arithmetic never needs to check for overflow
+func (f *Befunge) wrapsNatively() bool {
+	return f.cellBits == strconv.IntSize &&
+		f.Config.OverflowBehaviour != config.OverflowSaturate && f.Config.OverflowBehaviour != config.OverflowPanic
+}
+
+// fit converts an int into a stack cell, applying the configured cell width and overflow behaviour
+func (f *Befunge) fit(v int) (int, error) {
+	if f.cellBits == 0 {
+		if v < boxBase+boxRange {
+			return f.box(big.NewInt(int64(v))), nil
+		}
+		return v, nil
+	}
+	return f.fitBits(v, f.cellBits)
+}
+
+func (f *Befunge) fitBits(v int, bits int) (int, error) {
+	if bits >= strconv.IntSize {
+		return v, nil
+	}
+	least, greatest := -1<<(bits-1), 1<<(bits-1)-1
+	if least <= v && v <= greatest {
+		return v, nil
+	}
+	switch f.Config.OverflowBehaviour {
+	case config.OverflowSaturate:
+		return min(max(v, least), greatest), nil
+	case config.OverflowPanic:
+		return 0, errOverflow
+	case config.OverflowWrap:
+		fallthrough
+	default:
+		// sign extend from the lowest bits
+		shift := strconv.IntSize - bits
+		return v << shift >> shift, nil
+	}
+}
+
+// cell converts the exact result of an operation into a stack cell, applying the configured cell width and overflow
+// behaviour
+func (f *Befunge) cell(v *big.Int) (int, error) {
+	if f.cellBits == 0 {
+		if v.IsInt64() && v.Int64() >= boxBase+boxRange {
+			return int(v.Int64()), nil
+		}
+		return f.box(v), nil
+	}
+	return f.cellOfBits(v, f.cellBits)
+}
+
+func (f *Befunge) cellOfBits(v *big.Int, bits int) (int, error) {
+	if v.IsInt64() {
+		return f.fitBits(int(v.Int64()), bits)
+	}
+	switch f.Config.OverflowBehaviour {
+	case config.OverflowSaturate:
+		if v.Sign() < 0 {
+			return -1 << (bits - 1), nil
+		}
+		return 1<<(bits-1) - 1, nil
+	case config.OverflowPanic:
+		return 0, errOverflow
+	case config.OverflowWrap:
+		fallthrough
+	default:
+		// big.Int's bitwise operations use two's complement, so this keeps the lowest bits in the same way as an int
+		lowest := new(big.Int).And(v, new(big.Int).SetUint64(math.MaxUint64)).Uint64()
+		return f.fitBits(int(lowest), bits)
+	}
+}
+
+// spaceCell converts a stack cell into a funge-space cell, applying the configured overflow behaviour
+func (f *Befunge) spaceCell(c int) (rune, error) {
+	bits := spaceCellBits
+	if f.cellBits != 0 {
+		bits = min(bits, f.cellBits)
+	}
+	if f.isBoxed(c) {
+		v, err := f.cellOfBits(f.boxes[c], bits)
+		return rune(v), err
+	}
+	v, err := f.fitBits(c, bits)
+	return rune(v), err
+}
+
+// Cell the stack cell holding the value, applying the configured cell width and overflow behaviour. This is the inverse
+// of CellValue
+func (f *Befunge) Cell(v *big.Int) (int, error) {
+	return f.cell(v)
+}
+
+// CellValue the value of a stack cell. This is the same as the cell itself unless it is a boxed bignum
+func (f *Befunge) CellValue(c int) *big.Int {
+	if f.isBoxed(c) {
+		return f.boxes[c]
+	}
+	return big.NewInt(int64(c))
+}
+
+// intValue the value of a stack cell as an int, which is false when it is a bignum too big for an int. Such a value
+// wraps to its lowest bits, as it would have with 64 bit cells
+func (f *Befunge) intValue(c int) (int, bool) {
+	if !f.isBoxed(c) {
+		return c, true
+	}
+	v := f.boxes[c]
+	if v.IsInt64() {
+		return int(v.Int64()), true
+	}
+	return int(new(big.Int).And(v, new(big.Int).SetUint64(math.MaxUint64)).Uint64()), false
+}
+
+// popInt pops the value of a stack cell as an int, which is false when it is a bignum too big for an int
+func (f *Befunge) popInt() (int, bool) {
+	return f.intValue(f.stackPop())
+}
+
+func (f *Befunge) isBoxed(c int) bool {
+	return f.cellBits == 0 && c < boxBase+boxRange
+}
+
+func (f *Befunge) box(v *big.Int) int {
+	if f.boxes == nil {
+		f.boxes = make(map[int]*big.Int)
+		f.boxSweepAt = minBoxSweep
+	}
+	if len(f.boxes) >= f.boxSweepAt {
+		f.sweepBoxes()
+	}
+	handle := boxBase + f.nextBox
+	f.nextBox = (f.nextBox + 1) % boxRange
+	f.boxes[handle] = v
+	return handle
+}
+
+// sweepBoxes discards the bignums which aren't on any stack any more
+func (f *Befunge) sweepBoxes() {
+	live := make(map[int]bool)
+	for _, ip := range f.IPs {
+		for _, stack := range ip.Stacks.Stacks {
+			for _, c := range stack.Values {
+				if f.isBoxed(c) {
+					live[c] = true
+				}
+			}
+		}
+	}
+	for handle := range f.boxes {
+		if !live[handle] {
+			if f.undo != nil {
+				if f.undo.boxes == nil {
+					f.undo.boxes = make(map[int]*big.Int)
+				}
+				f.undo.boxes[handle] = f.boxes[handle]
+			}
+			delete(f.boxes, handle)
+		}
+	}
+	f.boxSweepAt = max(minBoxSweep, 2*len(f.boxes))
+}
@@ -0,0 +1,654 @@
+package compiler
+
+import (
+	"fmt"
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/internal"
+	"github.com/kagof/kagofunge/pkg"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// CompileC compiles a Befunge-93 program into the source of a standalone C99 program, which reads from stdin and
+// writes to stdout. In the same way as CompileGo, programs which can't modify themselves are compiled into a state
+// machine with a label for each reachable state of the instruction pointer, while programs with a reachable p
+// instruction embed a minimal interpreter along with their initial torus
+func CompileC(program string, c config.InterpreterConfig) (string, error) {
+	m, err := newMachine(program, c)
+	if err != nil {
+		return "", err
+	}
+	bits := pkg.CellBits(c.CellWidth)
+	source := cSource{
+		Bits:        bits,
+		SpaceBits:   min(bits, 32),
+		Checked:     bits >= 64 && c.OverflowBehaviour != config.OverflowWrap,
+		Config:      c,
+		Width:       m.torus.Width,
+		Height:      m.torus.Height,
+		Interpreter: m.selfModifying,
+		UsesSpace:   m.selfModifying || m.uses('g'),
+		UsesRandom:  m.selfModifying || m.uses('?'),
+	}
+	if source.UsesRandom && c.RandomSeed != nil && *c.RandomSeed > math.MaxUint32 {
+		return "", fmt.Errorf("random seed %d is too big for C, whose srand only takes 32 bits", *c.RandomSeed)
+	}
+	if !m.selfModifying {
+		source.States = m.cStates()
+	}
+	if source.UsesSpace {
+		for _, line := range m.torus.Chars {
+			source.Space = append(source.Space, strings.Join(internal.MapSlice(line, func(c rune) string {
+				return strconv.Itoa(int(c))
+			}), ", "))
+		}
+	}
+	var sb strings.Builder
+	err = cTemplate.Execute(&sb, source)
+	if err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+type cSource struct {
+	Bits      int
+	SpaceBits int // the number of bits in a funge-space cell, which is never more than 32
+	// whether arithmetic needs to check for overflow, as cells are as wide as an int64_t
+	Checked     bool
+	Config      config.InterpreterConfig
+	Width       int
+	Height      int
+	Interpreter bool
+	UsesSpace   bool
+	UsesRandom  bool
+	Space       []string // the comma separated cells of each line of the torus
+	States      string   // the body of main when compiled to a state machine
+}
+
+// cStates the body of main for the state machine, with a label for each state followed by its instruction and a goto
+// to the next state
+func (m *machine) cStates() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\tgoto %s;\n", label(m.entry))
+	for _, s := range m.states {
+		c := m.char(s)
+		next := m.successors(s)
+		fmt.Fprintf(&sb, "%s: /* (%d, %d) %s */\n", label(s), s.x, s.y, strconv.QuoteRune(c))
+		switch {
+		case m.folded(s):
+			// a path which loops forever without reaching an instruction
+		case s.stringMode && m.fitsCell(c):
+			fmt.Fprintf(&sb, "\tpush(%d);\n", c)
+		case s.stringMode:
+			fmt.Fprintf(&sb, "\tat = (struct position){%d, %d, %d};\n\tpush(fit(%d));\n", s.x, s.y, c, c)
+		case c == '_' || c == '|':
+			fmt.Fprintf(&sb, "\tif (pop() == 0) goto %s;\n", label(next[0]))
+			next = next[1:]
+		case c == '?':
+			fmt.Fprintf(&sb, "\tswitch (rand() %% 4) {\n\tcase 0: goto %s;\n\tcase 1: goto %s;\n\tcase 2: goto %s;\n\t}\n",
+				label(next[0]), label(next[1]), label(next[2]))
+			next = next[3:]
+		case c == '@':
+			sb.WriteString("\tfflush(stdout);\n\treturn 0;\n")
+		default:
+			if canFail(c) {
+				fmt.Fprintf(&sb, "\tat = (struct position){%d, %d, %d};\n", s.x, s.y, c)
+			}
+			reflect := ""
+			if len(next) > 1 {
+				reflect = "goto " + label(next[1]) + ";"
+			}
+			fmt.Fprintf(&sb, "\t%s\n", cStatement(c, m.config, reflect))
+		}
+		if len(next) > 0 {
+			fmt.Fprintf(&sb, "\tgoto %s;\n", label(next[0]))
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// cStatement the C code for an instruction which doesn't move the instruction pointer, other than / and % reflecting
+// it using the given code
+func cStatement(c rune, cfg config.InterpreterConfig, reflect string) string {
+	switch {
+	case '0' <= c && c <= '9':
+		return fmt.Sprintf("push(%d);", c-'0')
+	case c == '/' || c == '%':
+		behaviour, operation := cfg.DivideByZeroBehaviour, "cell_div"
+		if c == '%' {
+			behaviour, operation = cfg.ModulusByZeroBehaviour, "cell_mod"
+		}
+		var byZero string
+		switch behaviour {
+		case config.Div0PromptForInput:
+			byZero = "push(read_int());"
+		case config.Div0ReturnZero:
+			byZero = "push(0);"
+		case config.Div0Reflect:
+			byZero = reflect
+		case config.Div0Panic:
+			fallthrough
+		default:
+			byZero = `fail("divide by zero");`
+		}
+		return fmt.Sprintf("{ cell a = pop(); cell b = pop(); if (a != 0) push(%s(b, a)); else %s }", operation, byZero)
+	}
+	return map[rune]string{
+		'+':  "binary(cell_add);",
+		'-':  "binary(cell_sub);",
+		'*':  "binary(cell_mul);",
+		'`':  "binary(greater);",
+		'!':  "push(pop() == 0);",
+		':':  "push(peek());",
+		'\\': "swap();",
+		'$':  "pop();",
+		'.':  "write_int(pop());",
+		',':  "write_char(pop());",
+		'g':  "get();",
+		'p':  "put();",
+		'&':  "push(read_int());",
+		'~':  "push(read_char());",
+	}[c]
+}
+
+var cTemplate = template.Must(template.New("c").Funcs(template.FuncMap{
+	"statement": cStatement,
+}).Parse(`/* Code generated by kagofunge compile. DO NOT EDIT. */
+
+#include <ctype.h>
+#include <inttypes.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+{{- if .UsesRandom}}
+#include <time.h>
+{{- end}}
+
+#define WIDTH {{.Width}}
+#define HEIGHT {{.Height}}
+
+typedef int64_t cell;
+
+/* an instruction in funge-space */
+struct position {
+	int x, y;
+	int32_t c;
+};
+
+static cell *stack;
+static size_t stack_size, stack_capacity;
+static struct position at; /* the last instruction which can fail, for error messages */
+{{- if .UsesSpace}}
+
+static int32_t space[HEIGHT][WIDTH] = {
+{{- range .Space}}
+	{ {{- .}}},
+{{- end}}
+};
+{{- end}}
+
+/* encode writes the UTF-8 encoding of a character, returning its length. Invalid characters are encoded as U+FFFD */
+static int encode(int32_t r, char *s) {
+	if (r < 0 || r > 0x10FFFF || (r >= 0xD800 && r <= 0xDFFF)) {
+		r = 0xFFFD;
+	}
+	if (r < 0x80) {
+		s[0] = (char) r;
+		return 1;
+	} else if (r < 0x800) {
+		s[0] = (char) (0xC0 | r >> 6);
+		s[1] = (char) (0x80 | (r & 0x3F));
+		return 2;
+	} else if (r < 0x10000) {
+		s[0] = (char) (0xE0 | r >> 12);
+		s[1] = (char) (0x80 | (r >> 6 & 0x3F));
+		s[2] = (char) (0x80 | (r & 0x3F));
+		return 3;
+	}
+	s[0] = (char) (0xF0 | r >> 18);
+	s[1] = (char) (0x80 | (r >> 12 & 0x3F));
+	s[2] = (char) (0x80 | (r >> 6 & 0x3F));
+	s[3] = (char) (0x80 | (r & 0x3F));
+	return 4;
+}
+
+/* fail halts the program with an error at the last instruction which can fail */
+static void fail(const char *msg) {
+	char c[5] = {0};
+	encode(at.c, c);
+	fflush(stdout);
+	fprintf(stderr, "Error: Befunge execution error at position (%d, %d) '%s': %s\n", at.x, at.y, c, msg);
+	exit(1);
+}
+
+static void push(cell v) {
+	if (stack_size == stack_capacity) {
+		stack_capacity = stack_capacity ? 2 * stack_capacity : 64;
+		stack = realloc(stack, stack_capacity * sizeof(cell));
+		if (stack == NULL) {
+			fail("out of memory");
+		}
+	}
+	stack[stack_size++] = v;
+}
+
+static cell pop(void) {
+	return stack_size ? stack[--stack_size] : 0;
+}
+
+static cell peek(void) {
+	return stack_size ? stack[stack_size - 1] : 0;
+}
+
+static void swap(void) {
+	cell a = pop();
+	cell b = pop();
+	push(a);
+	push(b);
+}
+
+/* binary pops a and then b, and pushes the result of the operator on b and a */
+static void binary(cell (*operator)(cell, cell)) {
+	cell a = pop();
+	cell b = pop();
+	push(operator(b, a));
+}
+
+static cell greater(cell b, cell a) {
+	return b > a;
+}
+
+static cell fit_bits(cell v, int bits) {
+	cell least, greatest;
+	if (bits >= 64) {
+		return v;
+	}
+	least = -((cell) 1 << (bits - 1));
+	greatest = ((cell) 1 << (bits - 1)) - 1;
+	if (least <= v && v <= greatest) {
+		return v;
+	}
+{{- if eq .Config.OverflowBehaviour "SATURATE"}}
+	return v < least ? least : greatest;
+{{- else if eq .Config.OverflowBehaviour "PANIC"}}
+	fail("cell overflow");
+	return 0;
+{{- else}}
+	{
+		/* sign extend from the lowest bits */
+		uint64_t mask = ((uint64_t) 1 << bits) - 1;
+		uint64_t u = (uint64_t) v & mask;
+		if (u >> (bits - 1)) {
+			u |= ~mask;
+		}
+		return (cell) u;
+	}
+{{- end}}
+}
+
+/* fit converts a value into a stack cell */
+static cell fit(cell v) {
+	return fit_bits(v, {{.Bits}});
+}
+{{- if .Checked}}
+
+/* overflowed the cell for a result which is too big for a cell, given whether it is positive */
+static cell overflowed(int positive) {
+{{- if eq .Config.OverflowBehaviour "PANIC"}}
+	(void) positive;
+	fail("cell overflow");
+	return 0;
+{{- else}}
+	return positive ? INT64_MAX : INT64_MIN;
+{{- end}}
+}
+
+static cell cell_add(cell b, cell a) {
+	if ((a > 0 && b > INT64_MAX - a) || (a < 0 && b < INT64_MIN - a)) {
+		return overflowed(a > 0);
+	}
+	return b + a;
+}
+
+static cell cell_sub(cell b, cell a) {
+	if ((a < 0 && b > INT64_MAX + a) || (a > 0 && b < INT64_MIN + a)) {
+		return overflowed(a < 0);
+	}
+	return b - a;
+}
+
+static cell cell_mul(cell b, cell a) {
+	if (a == 0 || b == 0) {
+		return 0;
+	}
+	if (a == -1) {
+		return b == INT64_MIN ? overflowed(1) : -b;
+	}
+	if (a > 0 ? b > INT64_MAX / a || b < INT64_MIN / a : b < INT64_MAX / a || b > INT64_MIN / a) {
+		return overflowed((a > 0) == (b > 0));
+	}
+	return b * a;
+}
+
+static cell cell_div(cell b, cell a) {
+	if (a == -1 && b == INT64_MIN) {
+		return overflowed(1);
+	}
+	return b / a;
+}
+{{- else}}
+
+/* arithmetic is done on unsigned values, which wrap around rather than overflowing */
+static cell cell_add(cell b, cell a) {
+	return fit((cell) ((uint64_t) b + (uint64_t) a));
+}
+
+static cell cell_sub(cell b, cell a) {
+	return fit((cell) ((uint64_t) b - (uint64_t) a));
+}
+
+static cell cell_mul(cell b, cell a) {
+	return fit((cell) ((uint64_t) b * (uint64_t) a));
+}
+
+static cell cell_div(cell b, cell a) {
+	if (a == -1 && b == INT64_MIN) {
+		return fit(INT64_MIN);
+	}
+	return fit(b / a);
+}
+{{- end}}
+
+static cell cell_mod(cell b, cell a) {
+	if (a == -1) {
+		return 0;
+	}
+	return fit(b % a);
+}
+{{- if .UsesSpace}}
+
+/* get pushes the cell at the popped position */
+static void get(void) {
+	cell y = pop();
+	cell x = pop();
+	if (x < 0 || x >= WIDTH || y < 0 || y >= HEIGHT) {
+{{- if eq .Config.GetOutOfBoundsBehaviour "ZERO"}}
+		push(0);
+		return;
+{{- else if eq .Config.GetOutOfBoundsBehaviour "NO_OP"}}
+		return;
+{{- else if eq .Config.GetOutOfBoundsBehaviour "WRAP"}}
+		x = (x % WIDTH + WIDTH) % WIDTH;
+		y = (y % HEIGHT + HEIGHT) % HEIGHT;
+{{- else}}
+		fail("get index out of bounds");
+{{- end}}
+	}
+	push(fit(space[y][x]));
+}
+{{- end}}
+{{- if .Interpreter}}
+
+/* put sets the cell at the popped position to the popped value */
+static void put(void) {
+	cell y = pop();
+	cell x = pop();
+	int32_t v = (int32_t) fit_bits(pop(), {{.SpaceBits}});
+	if (x < 0 || x >= WIDTH || y < 0 || y >= HEIGHT) {
+{{- if eq .Config.PutOutOfBoundsBehaviour "WRAP"}}
+		x = (x % WIDTH + WIDTH) % WIDTH;
+		y = (y % HEIGHT + HEIGHT) % HEIGHT;
+{{- else if eq .Config.PutOutOfBoundsBehaviour "PANIC"}}
+		fail("put index out of bounds");
+{{- else}}
+		return;
+{{- end}}
+	}
+	space[y][x] = v;
+}
+{{- end}}
+
+static void write_int(cell v) {
+	printf("%" PRId64, v);
+}
+
+/* write_char writes a character as UTF-8. Only the lowest 32 bits of the cell are used */
+static void write_char(cell v) {
+	char s[4];
+	fwrite(s, 1, encode((int32_t) (uint32_t) v, s), stdout);
+}
+
+/* parse_int parses a line containing an integer, surrounded by any amount of whitespace. Returns 0 if it isn't one */
+static int parse_int(const char *s, size_t n, cell *v) {
+	size_t i = 0;
+	int negative = 0;
+	uint64_t u = 0, limit;
+	while (n > 0 && isspace((unsigned char) s[n - 1])) {
+		n--;
+	}
+	while (i < n && isspace((unsigned char) s[i])) {
+		i++;
+	}
+	if (i < n && (s[i] == '+' || s[i] == '-')) {
+		negative = s[i++] == '-';
+	}
+	if (i == n) {
+		return 0;
+	}
+	limit = negative ? (uint64_t) INT64_MAX + 1 : (uint64_t) INT64_MAX;
+	for (; i < n; i++) {
+		if (s[i] < '0' || s[i] > '9' || u > (limit - (uint64_t) (s[i] - '0')) / 10) {
+			return 0;
+		}
+		u = u * 10 + (uint64_t) (s[i] - '0');
+	}
+	*v = negative ? (cell) (0 - u) : (cell) u;
+	return 1;
+}
+
+/* read_int reads a line containing an integer, skipping any lines which don't. Returns 0 at the end of the input */
+static cell read_int(void) {
+	char *line = NULL;
+	size_t length, capacity = 0;
+	int c;
+	cell v;
+	fflush(stdout);
+	for (;;) {
+		length = 0;
+		while ((c = getchar()) != EOF && c != '\n') {
+			if (length == capacity) {
+				capacity = capacity ? 2 * capacity : 64;
+				line = realloc(line, capacity);
+				if (line == NULL) {
+					fail("out of memory");
+				}
+			}
+			line[length++] = (char) c;
+		}
+		if (c == EOF && length == 0) {
+			free(line);
+			if (ferror(stdin)) {
+				fail("error reading input");
+			}
+			return 0;
+		}
+		if (parse_int(line, length, &v)) {
+			free(line);
+			return fit(v);
+		}
+	}
+}
+
+/* read_rune reads a UTF-8 encoded character, or -1 at the end of the input. Invalid characters are read as U+FFFD */
+static int32_t read_rune(void) {
+	int c = getchar(), n, i;
+	int32_t r, least;
+	if (c == EOF) {
+		if (ferror(stdin)) {
+			fail("error reading input");
+		}
+		return -1;
+	}
+	if (c < 0x80) {
+		return c;
+	} else if ((c & 0xE0) == 0xC0) {
+		n = 1, r = c & 0x1F, least = 0x80;
+	} else if ((c & 0xF0) == 0xE0) {
+		n = 2, r = c & 0x0F, least = 0x800;
+	} else if ((c & 0xF8) == 0xF0) {
+		n = 3, r = c & 0x07, least = 0x10000;
+	} else {
+		return 0xFFFD;
+	}
+	for (i = 0; i < n; i++) {
+		c = getchar();
+		if (c == EOF || (c & 0xC0) != 0x80) {
+			if (c != EOF) {
+				ungetc(c, stdin);
+			}
+			return 0xFFFD;
+		}
+		r = r << 6 | (c & 0x3F);
+	}
+	if (r < least || r > 0x10FFFF || (r >= 0xD800 && r <= 0xDFFF)) {
+		return 0xFFFD;
+	}
+	return r;
+}
+
+/* read_char reads a character, skipping line breaks. Returns 0 at the end of the input */
+static cell read_char(void) {
+	int32_t r;
+	fflush(stdout);
+	do {
+		r = read_rune();
+		if (r < 0) {
+			return 0;
+		}
+	} while (r == '\n' || r == '\r');
+	return fit(r);
+}
+
+int main(void) {
+{{- if .UsesRandom}}
+	{{- with .Config.RandomSeed}}
+	srand((unsigned) {{.}}ULL); /* seeded, so that each run makes the same choices */
+	{{- else}}
+	srand((unsigned) time(NULL));
+	{{- end}}
+{{- end}}
+{{- if .Interpreter}}
+	int x = 0, y = 0, dx = 1, dy = 0, string_mode = 0;
+	for (;;) {
+		int32_t c = space[y][x];
+		at = (struct position){x, y, c};
+		if (string_mode && c != '"') {
+			push(fit(c));
+		} else {
+			switch (c) {
+			case '0': case '1': case '2': case '3': case '4': case '5': case '6': case '7': case '8': case '9':
+				push(c - '0');
+				break;
+			case '+':
+				{{statement '+' .Config ""}}
+				break;
+			case '-':
+				{{statement '-' .Config ""}}
+				break;
+			case '*':
+				{{statement '*' .Config ""}}
+				break;
+			case '/':
+				{{statement '/' .Config "{ dx = -dx; dy = -dy; }"}}
+				break;
+			case '%':
+				{{statement '%' .Config "{ dx = -dx; dy = -dy; }"}}
+				break;
+			case '!':
+				{{statement '!' .Config ""}}
+				break;
+			case '` + "`" + `':
+				{{statement '` + "`" + `' .Config ""}}
+				break;
+			case '>':
+				dx = 1, dy = 0;
+				break;
+			case '<':
+				dx = -1, dy = 0;
+				break;
+			case 'v':
+				dx = 0, dy = 1;
+				break;
+			case '^':
+				dx = 0, dy = -1;
+				break;
+			case '?':
+				switch (rand() % 4) {
+				case 0:
+					dx = 1, dy = 0;
+					break;
+				case 1:
+					dx = -1, dy = 0;
+					break;
+				case 2:
+					dx = 0, dy = 1;
+					break;
+				default:
+					dx = 0, dy = -1;
+					break;
+				}
+				break;
+			case '_':
+				dx = pop() == 0 ? 1 : -1, dy = 0;
+				break;
+			case '|':
+				dx = 0, dy = pop() == 0 ? 1 : -1;
+				break;
+			case '"':
+				string_mode = !string_mode;
+				break;
+			case ':':
+				{{statement ':' .Config ""}}
+				break;
+			case '\\':
+				{{statement '\\' .Config ""}}
+				break;
+			case '$':
+				{{statement '$' .Config ""}}
+				break;
+			case '.':
+				{{statement '.' .Config ""}}
+				break;
+			case ',':
+				{{statement ',' .Config ""}}
+				break;
+			case '#':
+				x = (x + dx + WIDTH) % WIDTH, y = (y + dy + HEIGHT) % HEIGHT;
+				break;
+			case 'p':
+				{{statement 'p' .Config ""}}
+				break;
+			case 'g':
+				{{statement 'g' .Config ""}}
+				break;
+			case '&':
+				{{statement '&' .Config ""}}
+				break;
+			case '~':
+				{{statement '~' .Config ""}}
+				break;
+			case '@':
+				fflush(stdout);
+				return 0;
+			}
+		}
+		x = (x + dx + WIDTH) % WIDTH, y = (y + dy + HEIGHT) % HEIGHT;
+	}
+{{- else}}
+{{.States}}
+{{- end}}
+}
+`))
@@ -0,0 +1,219 @@
+// Package compiler compiles Befunge-93 programs ahead of time into standalone programs in other languages, which
+// behave the same as running them with pkg.Befunge
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/pkg"
+	"strings"
+)
+
+// the characters which are Befunge-93 instructions. Every other character is a no-op
+const instructions = "0123456789+-*/%!`><^v?_|\":\\$.,#pg&~@"
+
+// state the state of the instruction pointer: its position and delta, and whether it is in string mode
+type state struct {
+	x, y       int
+	dx, dy     int
+	stringMode bool
+}
+
+// machine a Befunge-93 program as a state machine over the states of the instruction pointer. Instructions which only
+// move the instruction pointer in a fixed way (spaces, <>^v, # and ") are folded into the states which reach them, so
+// each state of the machine performs an instruction which depends on or changes more than where the instruction
+// pointer is
+type machine struct {
+	torus  *pkg.Torus
+	config config.InterpreterConfig
+	entry  state
+	// the reachable states, in the order they were found
+	states []state
+	// whether a p instruction is reachable, in which case the program can modify itself and so can't be compiled to a
+	// state machine
+	selfModifying bool
+}
+
+func newMachine(program string, c config.InterpreterConfig) (*machine, error) {
+	if c.Dialect == config.Dialect98 {
+		return nil, errors.New("only Befunge-93 programs can be compiled")
+	}
+	if pkg.CellBits(c.CellWidth) == 0 {
+		return nil, errors.New("programs with BIGNUM cells can't be compiled")
+	}
+	maxLines, maxColumns := -1, -1
+	if c.EnforceTorusSizeRestriction {
+		maxLines, maxColumns = c.TorusSizeRestrictionHeight, c.TorusSizeRestrictionWidth
+	}
+	torus := pkg.NewTorus(program, maxLines, maxColumns)
+	if torus.Width == 0 || torus.Height == 0 {
+		return nil, errors.New("cannot compile an empty program")
+	}
+	m := &machine{torus: torus, config: c}
+	m.entry = m.resolve(state{dx: 1})
+	m.explore()
+	m.selfModifying = m.uses('p')
+	return m, nil
+}
+
+// explore finds every state reachable from the entry state
+func (m *machine) explore() {
+	found := map[state]bool{m.entry: true}
+	queue := []state{m.entry}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		m.states = append(m.states, s)
+		for _, next := range m.successors(s) {
+			if !found[next] {
+				found[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+}
+
+func (m *machine) char(s state) rune {
+	return m.torus.CharAt(s.x, s.y)
+}
+
+// advance moves the instruction pointer once by its delta
+func (m *machine) advance(s state) state {
+	s.x, s.y = m.torus.ModWidth(s.x+s.dx), m.torus.ModHeight(s.y+s.dy)
+	return s
+}
+
+// turn sets the delta of the instruction pointer and then moves it
+func (m *machine) turn(s state, dx, dy int) state {
+	s.dx, s.dy = dx, dy
+	return m.advance(s)
+}
+
+// folded whether the state's instruction only moves the instruction pointer in a fixed way
+func (m *machine) folded(s state) bool {
+	c := m.char(s)
+	if s.stringMode {
+		return c == '"'
+	}
+	return strings.ContainsRune("><^v#\"", c) || !strings.ContainsRune(instructions, c)
+}
+
+// step performs a folded instruction
+func (m *machine) step(s state) state {
+	switch m.char(s) {
+	case '>':
+		return m.turn(s, 1, 0)
+	case '<':
+		return m.turn(s, -1, 0)
+	case 'v':
+		return m.turn(s, 0, 1)
+	case '^':
+		return m.turn(s, 0, -1)
+	case '#':
+		return m.advance(m.advance(s))
+	case '"':
+		s.stringMode = !s.stringMode
+		return m.advance(s)
+	default:
+		return m.advance(s)
+	}
+}
+
+// resolve follows the folded instructions from the state to the next instruction which isn't folded. Paths which
+// loop forever without reaching one stop where they start repeating
+func (m *machine) resolve(s state) state {
+	visited := make(map[state]bool)
+	for m.folded(s) && !visited[s] {
+		visited[s] = true
+		s = m.step(s)
+	}
+	return s
+}
+
+// successors the states which can follow the state. These are, in order:
+//   - _ and |: the state when the popped value is zero, and then when it isn't
+//   - ?: the states after going right, left, down and up
+//   - / and %: the state after dividing, and then the reflected state if dividing by zero reflects
+//   - @: none
+//   - anything else: the single next state
+func (m *machine) successors(s state) []state {
+	if m.folded(s) {
+		return []state{m.resolve(m.step(s))}
+	}
+	if s.stringMode {
+		return []state{m.resolve(m.advance(s))}
+	}
+	switch m.char(s) {
+	case '_':
+		return []state{m.resolve(m.turn(s, 1, 0)), m.resolve(m.turn(s, -1, 0))}
+	case '|':
+		return []state{m.resolve(m.turn(s, 0, 1)), m.resolve(m.turn(s, 0, -1))}
+	case '?':
+		return []state{
+			m.resolve(m.turn(s, 1, 0)),
+			m.resolve(m.turn(s, -1, 0)),
+			m.resolve(m.turn(s, 0, 1)),
+			m.resolve(m.turn(s, 0, -1)),
+		}
+	case '/', '%':
+		if m.div0Behaviour(m.char(s)) == config.Div0Reflect {
+			return []state{m.resolve(m.advance(s)), m.resolve(m.turn(s, -s.dx, -s.dy))}
+		}
+		return []state{m.resolve(m.advance(s))}
+	case '@':
+		return nil
+	default:
+		return []state{m.resolve(m.advance(s))}
+	}
+}
+
+// uses whether the instruction can be executed by any reachable state
+func (m *machine) uses(c rune) bool {
+	for _, s := range m.states {
+		if !s.stringMode && !m.folded(s) && m.char(s) == c {
+			return true
+		}
+	}
+	return false
+}
+
+// div0Behaviour the configured behaviour when / or % divides by zero
+func (m *machine) div0Behaviour(c rune) config.DivideByZeroBehaviour {
+	if c == '%' {
+		return m.config.ModulusByZeroBehaviour
+	}
+	return m.config.DivideByZeroBehaviour
+}
+
+// label a name for the state which is unique within the program, for the targets which compile the state machine into
+// labels and gotos
+func label(s state) string {
+	label := fmt.Sprintf("x%dy%d", s.x, s.y)
+	switch {
+	case s.dx > 0:
+		label += "Right"
+	case s.dx < 0:
+		label += "Left"
+	case s.dy > 0:
+		label += "Down"
+	default:
+		label += "Up"
+	}
+	if s.stringMode {
+		label += "String"
+	}
+	return label
+}
+
+// fitsCell whether a character pushed in string mode already fits a stack cell, so needs no conversion
+func (m *machine) fitsCell(c rune) bool {
+	bits := pkg.CellBits(m.config.CellWidth)
+	return bits > 32 || -1<<(bits-1) <= int(c) && int(c) <= 1<<(bits-1)-1
+}
+
+// canFail whether the instruction can halt the program with an error, depending on the config, and so needs its
+// position to be kept for error messages
+func canFail(c rune) bool {
+	return strings.ContainsRune("+-*/%g&~", c)
+}
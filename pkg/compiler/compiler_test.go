@@ -0,0 +1,336 @@
+package compiler
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var cases = []struct {
+	name   string
+	funge  string
+	input  string
+	config func(c *config.InterpreterConfig)
+}{
+	{"hello_world", `64+"!dlroW ,olleH">:#,_@`, "", nil},
+	{"factorial", "&>:1-:v v *_$.@\n ^    _$>\\:^", "10", nil},
+	{"quine", "01->1# +# :# 0# g# ,# :# 5# 8# *# 4# +# -# _@", "", nil},
+	{"self_modifying", `2."@"10p`, "", nil},
+	{"self_modifying_loop", `>1.  "@"40p`, "", nil},
+	{"read_char", "~~,,@", "\nab", nil},
+	{"read_int", "&&+.@", "x\n4\n5\n", nil},
+	{"read_eof", "&~+.@", "", nil},
+	{"read_int_out_of_range", "&.@", "99999999999999999999\n -42 \n", nil},
+	{"read_char_unicode", "~.~,@", "é☃", nil},
+	{"write_invalid_char", "01-,@", "", nil},
+	{"string_mode", `"a b"...@`, "", nil},
+	{"comparison", "32`.23`.!.@", "", nil},
+	{"swap_dup_discard", "12\\..3:..4$.@", "", nil},
+	{"empty_stack", ".:.\\..@", "", nil},
+	{"negative_division", "05-2/.05-2%.@", "", nil},
+	{"div0_prompt", "10/.@", "7\n", nil},
+	{"div0_return_zero", "10/.@", "", func(c *config.InterpreterConfig) {
+		c.DivideByZeroBehaviour = config.Div0ReturnZero
+	}},
+	{"div0_reflect", "10/.@ .9", "", func(c *config.InterpreterConfig) {
+		c.DivideByZeroBehaviour = config.Div0Reflect
+	}},
+	{"mod0_reflect_self_modifying", "10%.@ .900p", "", func(c *config.InterpreterConfig) {
+		c.ModulusByZeroBehaviour = config.Div0Reflect
+	}},
+	{"div0_panic", "1.10/.@", "", func(c *config.InterpreterConfig) {
+		c.DivideByZeroBehaviour = config.Div0Panic
+	}},
+	{"get_out_of_bounds_zero", "1.09-0g.@", "", nil},
+	{"get_out_of_bounds_wrap", "90g,@", "", func(c *config.InterpreterConfig) {
+		c.GetOutOfBoundsBehaviour = config.OobWrap
+	}},
+	{"get_out_of_bounds_no_op", "7099g.@", "", func(c *config.InterpreterConfig) {
+		c.GetOutOfBoundsBehaviour = config.OobNoOp
+	}},
+	{"get_out_of_bounds_panic", "1.99g.@", "", func(c *config.InterpreterConfig) {
+		c.GetOutOfBoundsBehaviour = config.OobPanic
+	}},
+	{"put_out_of_bounds_wrap", `"@"99p.@`, "", func(c *config.InterpreterConfig) {
+		c.PutOutOfBoundsBehaviour = config.OobWrap
+	}},
+	{"put_out_of_bounds_panic", `"@"99p.@`, "", func(c *config.InterpreterConfig) {
+		c.PutOutOfBoundsBehaviour = config.OobPanic
+	}},
+	{"cell_width_wrap", "88*:*.88*2*.@", "", func(c *config.InterpreterConfig) {
+		c.CellWidth = config.CellWidth8
+	}},
+	{"cell_width_saturate", "88*:*.88*2*.@", "", func(c *config.InterpreterConfig) {
+		c.CellWidth, c.OverflowBehaviour = config.CellWidth8, config.OverflowSaturate
+	}},
+	{"cell_width_panic", "88*.88*2*.@", "", func(c *config.InterpreterConfig) {
+		c.CellWidth, c.OverflowBehaviour = config.CellWidth8, config.OverflowPanic
+	}},
+	{"cell_width_string_mode", "\"é\".@", "", func(c *config.InterpreterConfig) {
+		c.CellWidth = config.CellWidth8
+	}},
+	{"cell_width_string_mode_self_modifying", "\"é\".\" \"00p@", "", func(c *config.InterpreterConfig) {
+		c.CellWidth = config.CellWidth8
+	}},
+	{"cell_width_string_mode_panic", "\"é\".@", "", func(c *config.InterpreterConfig) {
+		c.CellWidth, c.OverflowBehaviour = config.CellWidth8, config.OverflowPanic
+	}},
+	{"int_overflow_wrap", "88*:*:*:*:*:.2*.@", "", nil},
+	{"int_overflow_saturate", "88*:*:*:*:*:.2*.01-*2*.@", "", func(c *config.InterpreterConfig) {
+		c.OverflowBehaviour = config.OverflowSaturate
+	}},
+	{"int_overflow_panic", "88*:*:*:*:*:.2*.@", "", func(c *config.InterpreterConfig) {
+		c.OverflowBehaviour = config.OverflowPanic
+	}},
+	{"random", "vv\n>?1.@\n ^", "", nil},
+	{"torus_size_restriction", "v\n\n\n>1.@", "", func(c *config.InterpreterConfig) {
+		c.EnforceTorusSizeRestriction = true
+		c.TorusSizeRestrictionHeight = 2
+		c.TorusSizeRestrictionWidth = 5
+	}},
+}
+
+// TestCompileGo compiles each program, and checks that the compiled program behaves the same as interpreting it
+func TestCompileGo(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not on the path")
+	}
+	testCompiled(t, CompileGo, goRunner)
+}
+
+func TestCompileC(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("cc is not on the path")
+	}
+	testCompiled(t, CompileC, cRunner)
+}
+
+// TestCompileWasm runs each compiled module with wazero
+func TestCompileWasm(t *testing.T) {
+	t.Parallel()
+	testCompiled(t, CompileWasm, wasmRunner)
+}
+
+var goRunner = executable("main.go", func(dir string) *exec.Cmd {
+	return exec.Command("go", "build", "-o", filepath.Join(dir, "main"), filepath.Join(dir, "main.go"))
+})
+
+var cRunner = executable("main.c", func(dir string) *exec.Cmd {
+	return exec.Command("cc", "-std=c99", "-Wall", "-Werror", "-Wno-unused-function", "-Wno-unused-label",
+		"-O2", "-o", filepath.Join(dir, "main"), filepath.Join(dir, "main.c"))
+})
+
+func wasmRunner(t *testing.T, ctx context.Context, module string, stdin io.Reader, stdout io.Writer,
+	stderr io.Writer) (bool, error) {
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	defer runtime.Close(ctx)
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+	_, err := runtime.InstantiateWithConfig(ctx, []byte(module), wazero.NewModuleConfig().
+		WithStdin(stdin).WithStdout(stdout).WithStderr(stderr).WithRandSource(rand.Reader))
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() != 0 {
+		return true, nil
+	}
+	return false, err
+}
+
+// runner runs the compiled program, returning whether it exited with an error. Errors which mean the program couldn't
+// be run are returned
+type runner func(t *testing.T, ctx context.Context, compiled string, stdin io.Reader, stdout io.Writer,
+	stderr io.Writer) (bool, error)
+
+// executable a runner which writes the compiled source to the source file, builds it into an executable named main
+// with the build command, and runs it
+func executable(sourceFile string, build func(dir string) *exec.Cmd) runner {
+	return func(t *testing.T, ctx context.Context, source string, stdin io.Reader, stdout io.Writer,
+		stderr io.Writer) (bool, error) {
+		dir := t.TempDir()
+		err := os.WriteFile(filepath.Join(dir, sourceFile), []byte(source), 0644)
+		if err != nil {
+			return false, err
+		}
+		builder := build(dir)
+		builder.Dir = dir
+		output, err := builder.CombinedOutput()
+		if err != nil {
+			return false, fmt.Errorf("%w\n%s\n%s", err, output, source)
+		}
+		run := exec.CommandContext(ctx, filepath.Join(dir, "main"))
+		run.Stdin, run.Stdout, run.Stderr = stdin, stdout, stderr
+		err = run.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			return true, nil
+		}
+		return false, err
+	}
+}
+
+// testCompiled compiles each case, and checks that running it behaves the same as interpreting the case
+func testCompiled(t *testing.T, compile func(string, config.InterpreterConfig) (string, error), run runner) {
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+			cfg := config.DefaultConfig()
+			if test.config != nil {
+				test.config(&cfg.Interpreter)
+			}
+			expected, expectedErr := interpret(&cfg, test.funge, test.input)
+
+			compiled, err := compile(test.funge, cfg.Interpreter)
+			if !asserts.NoError(err) {
+				return
+			}
+			var stdout, stderr strings.Builder
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			failed, err := run(t, ctx, compiled, strings.NewReader(test.input), &stdout, &stderr)
+			if !asserts.NoError(err) {
+				return
+			}
+			asserts.Equal(expected, stdout.String(), "%s output not as expected", test.name)
+			if expectedErr != nil {
+				asserts.True(failed)
+				asserts.Equal("Error: "+expectedErr.Error()+"\n", stderr.String())
+			} else {
+				asserts.False(failed)
+				asserts.Empty(stderr.String())
+			}
+		})
+	}
+}
+
+func TestCompileGo_unsupported(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	for _, compile := range []func(string, config.InterpreterConfig) (string, error){CompileGo, CompileC, CompileWasm} {
+		cfg := config.DefaultConfig()
+		cfg.Interpreter.Dialect = config.Dialect98
+		_, err := compile("1.@", cfg.Interpreter)
+		asserts.Error(err)
+
+		cfg = config.DefaultConfig()
+		cfg.Interpreter.CellWidth = config.CellWidthBignum
+		_, err = compile("1.@", cfg.Interpreter)
+		asserts.Error(err)
+
+		cfg = config.DefaultConfig()
+		_, err = compile("", cfg.Interpreter)
+		asserts.Error(err)
+	}
+
+	// C's srand only takes 32 bits of the seed
+	seed := uint64(math.MaxUint32 + 1)
+	cfg := config.DefaultConfig()
+	cfg.Interpreter.RandomSeed = &seed
+	_, err := CompileC("?@", cfg.Interpreter)
+	asserts.Error(err)
+	_, err = CompileC("1.@", cfg.Interpreter)
+	asserts.NoError(err, "the seed doesn't matter to a program without ?")
+}
+
+func TestCompileGo_stateMachine(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	cfg := config.DefaultConfig()
+	source, err := CompileGo("1.@", cfg.Interpreter)
+	asserts.NoError(err)
+	asserts.Contains(source, "x0y0Right:")
+	asserts.NotContains(source, "var space")
+
+	source, err = CompileGo(`2."@"10p`, cfg.Interpreter)
+	asserts.NoError(err)
+	asserts.NotContains(source, "x0y0Right:")
+	asserts.Contains(source, "var space")
+}
+
+// TestCompile_seeded checks that programs compiled with a random seed make the same choices on each run. Go programs
+// make the same choices as interpreting them with the seed
+func TestCompile_seeded(t *testing.T) {
+	t.Parallel()
+	// prints 8 digits from 1 to 3, each chosen by a ?
+	program := "9>1-:#v_@\n ^  .3?1.v\n      2\n      .\n ^    <  <"
+	// the same, but putting a cell first so that it's compiled with the embedded interpreter
+	selfModifying := "000p" + strings.ReplaceAll(program, "\n", "\n    ")
+
+	tests := []struct {
+		name        string
+		compile     func(string, config.InterpreterConfig) (string, error)
+		run         runner
+		tool        string // the tool needed to build the program, if any
+		interpreted bool   // whether the program makes the same choices as the interpreter
+	}{
+		{"go", CompileGo, goRunner, "go", true},
+		{"c", CompileC, cRunner, "cc", false},
+		{"wasm", CompileWasm, wasmRunner, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+			if _, err := exec.LookPath(test.tool); test.tool != "" && err != nil {
+				t.Skipf("%s is not on the path", test.tool)
+			}
+			for _, funge := range []string{program, selfModifying} {
+				seed := uint64(12345)
+				cfg := config.DefaultConfig()
+				cfg.Interpreter.RandomSeed = &seed
+				compiled, err := test.compile(funge, cfg.Interpreter)
+				if !asserts.NoError(err) {
+					return
+				}
+				var outputs []string
+				for range 2 {
+					var stdout, stderr strings.Builder
+					ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+					_, err = test.run(t, ctx, compiled, strings.NewReader(""), &stdout, &stderr)
+					cancel()
+					asserts.NoError(err)
+					asserts.Empty(stderr.String())
+					outputs = append(outputs, stdout.String())
+				}
+				asserts.Len(outputs[0], 8)
+				asserts.Equal(outputs[0], outputs[1], "the same seed should make the same choices")
+				if test.interpreted {
+					expected, err := interpret(&cfg, funge, "")
+					asserts.NoError(err)
+					asserts.Equal(expected, outputs[0])
+				}
+			}
+		})
+	}
+}
+
+// interpret runs the program with pkg.Befunge, stopping it if it runs for too long
+func interpret(cfg *config.Config, funge string, input string) (string, error) {
+	var writer strings.Builder
+	befunge := pkg.NewBefunge(cfg, funge, &writer, strings.NewReader(input))
+	for range 100_000 {
+		hasNext, err := befunge.Step()
+		if err != nil || !hasNext {
+			return writer.String(), err
+		}
+	}
+	return writer.String(), nil
+}
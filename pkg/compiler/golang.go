@@ -0,0 +1,528 @@
+package compiler
+
+import (
+	"fmt"
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/pkg"
+	"go/format"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// CompileGo compiles a Befunge-93 program into the source of a standalone Go program, which reads from stdin and writes
+// to stdout. Programs which can't modify themselves are compiled into a state machine over the states of the
+// instruction pointer, while programs with a reachable p instruction embed a minimal interpreter along with their
+// initial torus
+func CompileGo(program string, c config.InterpreterConfig) (string, error) {
+	m, err := newMachine(program, c)
+	if err != nil {
+		return "", err
+	}
+	bits := pkg.CellBits(c.CellWidth)
+	source := goSource{
+		Bits:        bits,
+		SpaceBits:   min(bits, 32),
+		Checked:     bits >= strconv.IntSize && c.OverflowBehaviour != config.OverflowWrap,
+		Config:      c,
+		Width:       m.torus.Width,
+		Height:      m.torus.Height,
+		Interpreter: m.selfModifying,
+		UsesSpace:   m.selfModifying || m.uses('g'),
+		UsesRandom:  m.selfModifying || m.uses('?'),
+	}
+	if !m.selfModifying {
+		source.States = m.goStates()
+	}
+	if source.UsesSpace {
+		for _, line := range m.torus.Chars {
+			source.Space = append(source.Space, strconv.Quote(string(line)))
+		}
+	}
+	var sb strings.Builder
+	err = goTemplate.Execute(&sb, source)
+	if err != nil {
+		return "", err
+	}
+	formatted, err := format.Source([]byte(sb.String()))
+	if err != nil {
+		return "", err
+	}
+	return string(formatted), nil
+}
+
+type goSource struct {
+	Bits      int
+	SpaceBits int // the number of bits in a funge-space cell, which is never more than a rune
+	// whether arithmetic needs to check for overflow, as cells are as wide as an int
+	Checked     bool
+	Config      config.InterpreterConfig
+	Width       int
+	Height      int
+	Interpreter bool
+	UsesSpace   bool
+	UsesRandom  bool
+	Space       []string // the quoted lines of the torus
+	States      string   // the body of main when compiled to a state machine
+}
+
+// goStates the body of main for the state machine, with a label for each state followed by its instruction and a goto
+// to the next state
+func (m *machine) goStates() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "goto %s\n", label(m.entry))
+	for _, s := range m.states {
+		c := m.char(s)
+		next := m.successors(s)
+		fmt.Fprintf(&sb, "%s: // (%d, %d) %s\n", label(s), s.x, s.y, strconv.QuoteRune(c))
+		switch {
+		case m.folded(s):
+			// a path which loops forever without reaching an instruction
+		case s.stringMode && m.fitsCell(c):
+			fmt.Fprintf(&sb, "push(%d)\n", c)
+		case s.stringMode:
+			fmt.Fprintf(&sb, "at = position{%d, %d, %s}\npush(fit(%d))\n", s.x, s.y, strconv.QuoteRune(c), c)
+		case c == '_' || c == '|':
+			fmt.Fprintf(&sb, "if pop() == 0 {\ngoto %s\n}\n", label(next[0]))
+			next = next[1:]
+		case c == '?':
+			fmt.Fprintf(&sb, "switch random.IntN(4) {\ncase 0:\ngoto %s\ncase 1:\ngoto %s\ncase 2:\ngoto %s\n}\n",
+				label(next[0]), label(next[1]), label(next[2]))
+			next = next[3:]
+		case c == '@':
+			sb.WriteString("out.Flush()\nreturn\n")
+		default:
+			if canFail(c) {
+				fmt.Fprintf(&sb, "at = position{%d, %d, %s}\n", s.x, s.y, strconv.QuoteRune(c))
+			}
+			reflect := ""
+			if len(next) > 1 {
+				reflect = "goto " + label(next[1])
+			}
+			sb.WriteString(goStatement(c, m.config, reflect))
+			sb.WriteString("\n")
+		}
+		if len(next) > 0 {
+			fmt.Fprintf(&sb, "goto %s\n", label(next[0]))
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// goStatement the Go code for an instruction which doesn't move the instruction pointer, other than / and % reflecting
+// it using the given code
+func goStatement(c rune, cfg config.InterpreterConfig, reflect string) string {
+	switch {
+	case '0' <= c && c <= '9':
+		return fmt.Sprintf("push(%d)", c-'0')
+	case c == '/' || c == '%':
+		behaviour, operation := cfg.DivideByZeroBehaviour, "div"
+		if c == '%' {
+			behaviour, operation = cfg.ModulusByZeroBehaviour, "mod"
+		}
+		var byZero string
+		switch behaviour {
+		case config.Div0PromptForInput:
+			byZero = "push(readInt())"
+		case config.Div0ReturnZero:
+			byZero = "push(0)"
+		case config.Div0Reflect:
+			byZero = reflect
+		case config.Div0Panic:
+			fallthrough
+		default:
+			byZero = `fail("divide by zero")`
+		}
+		return fmt.Sprintf("if b, a := pop2(); a != 0 {\npush(%s(b, a))\n} else {\n%s\n}", operation, byZero)
+	}
+	return map[rune]string{
+		'+':  "push(add(pop2()))",
+		'-':  "push(sub(pop2()))",
+		'*':  "push(mul(pop2()))",
+		'`':  "push(greater(pop2()))",
+		'!':  "push(not(pop()))",
+		':':  "push(peek())",
+		'\\': "swap()",
+		'$':  "pop()",
+		'.':  "writeInt(pop())",
+		',':  "writeChar(pop())",
+		'g':  "get()",
+		'p':  "put()",
+		'&':  "push(readInt())",
+		'~':  "push(readChar())",
+	}[c]
+}
+
+var goTemplate = template.Must(template.New("go").Funcs(template.FuncMap{
+	"statement": goStatement,
+}).Parse(`// Code generated by kagofunge compile. DO NOT EDIT.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	{{- if .UsesRandom}}
+	"math/rand/v2"
+	{{- end}}
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	minInt = -1 << (strconv.IntSize - 1)
+	maxInt = 1<<(strconv.IntSize-1) - 1
+	width  = {{.Width}}
+	height = {{.Height}}
+)
+
+// position an instruction in funge-space
+type position struct {
+	x, y int
+	c    rune
+}
+
+var (
+	stack []int
+	out   = bufio.NewWriter(os.Stdout)
+	in    = bufio.NewReader(os.Stdin)
+	at    position // the last instruction which can fail, for error messages
+	{{- if .UsesRandom}}
+	{{- with .Config.RandomSeed}}
+	random = rand.New(rand.NewPCG({{.}}, {{.}})) // seeded, so that each run makes the same choices
+	{{- else}}
+	random = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	{{- end}}
+	{{- end}}
+)
+{{- if .UsesSpace}}
+
+var space = [height][]rune{
+	{{- range .Space}}
+	[]rune({{.}}),
+	{{- end}}
+}
+{{- end}}
+
+func main() {
+{{- if .Interpreter}}
+	x, y, dx, dy := 0, 0, 1, 0
+	stringMode := false
+	for {
+		c := space[y][x]
+		at = position{x, y, c}
+		if stringMode && c != '"' {
+			push(fit(int(c)))
+		} else {
+			switch c {
+			case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+				push(int(c - '0'))
+			case '+':
+				{{statement '+' .Config ""}}
+			case '-':
+				{{statement '-' .Config ""}}
+			case '*':
+				{{statement '*' .Config ""}}
+			case '/':
+				{{statement '/' .Config "dx, dy = -dx, -dy"}}
+			case '%':
+				{{statement '%' .Config "dx, dy = -dx, -dy"}}
+			case '!':
+				{{statement '!' .Config ""}}
+			case '` + "`" + `':
+				{{statement '` + "`" + `' .Config ""}}
+			case '>':
+				dx, dy = 1, 0
+			case '<':
+				dx, dy = -1, 0
+			case 'v':
+				dx, dy = 0, 1
+			case '^':
+				dx, dy = 0, -1
+			case '?':
+				switch random.IntN(4) {
+				case 0:
+					dx, dy = 1, 0
+				case 1:
+					dx, dy = -1, 0
+				case 2:
+					dx, dy = 0, 1
+				default:
+					dx, dy = 0, -1
+				}
+			case '_':
+				if pop() == 0 {
+					dx, dy = 1, 0
+				} else {
+					dx, dy = -1, 0
+				}
+			case '|':
+				if pop() == 0 {
+					dx, dy = 0, 1
+				} else {
+					dx, dy = 0, -1
+				}
+			case '"':
+				stringMode = !stringMode
+			case ':':
+				{{statement ':' .Config ""}}
+			case '\\':
+				{{statement '\\' .Config ""}}
+			case '$':
+				{{statement '$' .Config ""}}
+			case '.':
+				{{statement '.' .Config ""}}
+			case ',':
+				{{statement ',' .Config ""}}
+			case '#':
+				x, y = (x+dx+width)%width, (y+dy+height)%height
+			case 'p':
+				{{statement 'p' .Config ""}}
+			case 'g':
+				{{statement 'g' .Config ""}}
+			case '&':
+				{{statement '&' .Config ""}}
+			case '~':
+				{{statement '~' .Config ""}}
+			case '@':
+				out.Flush()
+				return
+			}
+		}
+		x, y = (x+dx+width)%width, (y+dy+height)%height
+	}
+{{- else}}
+{{.States}}
+{{- end}}
+}
+
+func push(v int) {
+	stack = append(stack, v)
+}
+
+func pop() int {
+	if len(stack) == 0 {
+		return 0
+	}
+	v := stack[len(stack)-1]
+	stack = stack[:len(stack)-1]
+	return v
+}
+
+// pop2 pops a and then b, returning them in the order that binary operators take them
+func pop2() (int, int) {
+	a, b := pop(), pop()
+	return b, a
+}
+
+func peek() int {
+	if len(stack) == 0 {
+		return 0
+	}
+	return stack[len(stack)-1]
+}
+
+func swap() {
+	a, b := pop(), pop()
+	push(a)
+	push(b)
+}
+
+func not(a int) int {
+	if a == 0 {
+		return 1
+	}
+	return 0
+}
+
+func greater(b, a int) int {
+	if b > a {
+		return 1
+	}
+	return 0
+}
+
+// fail halts the program with an error at the last instruction which can fail
+func fail(msg string) {
+	out.Flush()
+	fmt.Fprintf(os.Stderr, "Error: Befunge execution error at position (%d, %d) '%c': %s\n", at.x, at.y, at.c, msg)
+	os.Exit(1)
+}
+
+// fit converts an int into a stack cell
+func fit(v int) int {
+	return fitBits(v, {{.Bits}})
+}
+
+func fitBits(v int, bits int) int {
+	if bits >= strconv.IntSize {
+		return v
+	}
+	least, greatest := -1<<(bits-1), 1<<(bits-1)-1
+	if least <= v && v <= greatest {
+		return v
+	}
+{{- if eq .Config.OverflowBehaviour "SATURATE"}}
+	return min(max(v, least), greatest)
+{{- else if eq .Config.OverflowBehaviour "PANIC"}}
+	fail("cell overflow")
+	return 0
+{{- else}}
+	// sign extend from the lowest bits
+	shift := strconv.IntSize - bits
+	return v << shift >> shift
+{{- end}}
+}
+{{- if .Checked}}
+
+// overflowed the cell for a result which is too big for an int, given whether it is positive
+func overflowed(positive bool) int {
+{{- if eq .Config.OverflowBehaviour "PANIC"}}
+	fail("cell overflow")
+	return 0
+{{- else}}
+	if positive {
+		return maxInt
+	}
+	return minInt
+{{- end}}
+}
+
+func add(b, a int) int {
+	if a > 0 && b > maxInt-a || a < 0 && b < minInt-a {
+		return overflowed(a > 0)
+	}
+	return b + a
+}
+
+func sub(b, a int) int {
+	if a < 0 && b > maxInt+a || a > 0 && b < minInt+a {
+		return overflowed(a < 0)
+	}
+	return b - a
+}
+
+func mul(b, a int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if p := b * a; p/a != b || a == -1 && b == minInt {
+		return overflowed((a > 0) == (b > 0))
+	}
+	return b * a
+}
+
+func div(b, a int) int {
+	if a == -1 && b == minInt {
+		return overflowed(true)
+	}
+	return b / a
+}
+{{- else}}
+
+func add(b, a int) int {
+	return fit(b + a)
+}
+
+func sub(b, a int) int {
+	return fit(b - a)
+}
+
+func mul(b, a int) int {
+	return fit(b * a)
+}
+
+func div(b, a int) int {
+	return fit(b / a)
+}
+{{- end}}
+
+func mod(b, a int) int {
+	return fit(b % a)
+}
+{{- if .UsesSpace}}
+
+// get pushes the cell at the popped position
+func get() {
+	y, x := pop(), pop()
+	if x < 0 || x >= width || y < 0 || y >= height {
+{{- if eq .Config.GetOutOfBoundsBehaviour "ZERO"}}
+		push(0)
+		return
+{{- else if eq .Config.GetOutOfBoundsBehaviour "NO_OP"}}
+		return
+{{- else if eq .Config.GetOutOfBoundsBehaviour "WRAP"}}
+		x, y = (x%width+width)%width, (y%height+height)%height
+{{- else}}
+		fail("get index out of bounds")
+{{- end}}
+	}
+	push(fit(int(space[y][x])))
+}
+{{- end}}
+{{- if .Interpreter}}
+
+// put sets the cell at the popped position to the popped value
+func put() {
+	y, x := pop(), pop()
+	v := rune(fitBits(pop(), {{.SpaceBits}}))
+	if x < 0 || x >= width || y < 0 || y >= height {
+{{- if eq .Config.PutOutOfBoundsBehaviour "WRAP"}}
+		x, y = (x%width+width)%width, (y%height+height)%height
+{{- else if eq .Config.PutOutOfBoundsBehaviour "PANIC"}}
+		fail("put index out of bounds")
+{{- else}}
+		return
+{{- end}}
+	}
+	space[y][x] = v
+}
+{{- end}}
+
+func writeInt(v int) {
+	out.WriteString(strconv.Itoa(v))
+}
+
+// writeChar writes a character, flushing the output at the end of each line so that it isn't held back by programs
+// which never terminate
+func writeChar(v int) {
+	out.WriteString(string(rune(v)))
+	if v == '\n' {
+		out.Flush()
+	}
+}
+
+// readInt reads a line containing an integer, skipping any lines which don't. Returns 0 at the end of the input
+func readInt() int {
+	out.Flush()
+	for {
+		line, _, err := in.ReadLine()
+		if err == io.EOF {
+			return 0
+		} else if err != nil {
+			fail(err.Error())
+		}
+		if v, err := strconv.Atoi(strings.TrimSpace(string(line))); err == nil {
+			return fit(v)
+		}
+	}
+}
+
+// readChar reads a character, skipping line breaks. Returns 0 at the end of the input
+func readChar() int {
+	out.Flush()
+	for {
+		ch, _, err := in.ReadRune()
+		if err == io.EOF {
+			return 0
+		} else if err != nil {
+			fail(err.Error())
+		}
+		if ch != '\n' && ch != '\r' {
+			return fit(int(ch))
+		}
+	}
+}
+`))
@@ -0,0 +1,755 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"github.com/kagof/kagofunge/config"
+	"github.com/kagof/kagofunge/pkg"
+	"math"
+	"strings"
+)
+
+// the layout of the module's memory. The stack starts after funge-space, and the memory grows as the stack does
+const (
+	wasmIOVec    = 0  // the iovec passed to fd_read and fd_write
+	wasmIOResult = 8  // the number of bytes read or written
+	wasmInByte   = 12 // the byte read
+	wasmRandom   = 13 // the random byte generated for ?
+	wasmStrings  = 16 // the messages written when failing
+	wasmDigits   = 1024
+	wasmDigitEnd = wasmDigits + 32
+	wasmSeed     = wasmDigitEnd // the state of the generator for ?, when it is seeded
+	wasmOut      = 2048         // output is buffered here
+	wasmOutSize  = 4096
+	wasmSpace    = wasmOut + wasmOutSize // funge-space, with 4 bytes for each cell
+	wasmPageSize = 65536
+)
+
+// the kinds of instructions the embedded interpreter dispatches on. Digits share a kind
+const wasmKinds = "0+-*/%!`><v^?_|\":\\$.,#pg&~@"
+
+// CompileWasm compiles a Befunge-93 program into a WebAssembly module in the binary format, which uses WASI to read
+// from stdin and write to stdout. The module exports the _start function which runs the program, and its memory. In
+// the same way as CompileGo, programs which can't modify themselves are compiled into a state machine, which
+// dispatches on the state of the instruction pointer with a br_table, while programs with a reachable p instruction
+// embed a minimal interpreter along with their initial torus. The returned string holds the bytes of the module
+func CompileWasm(program string, c config.InterpreterConfig) (string, error) {
+	m, err := newMachine(program, c)
+	if err != nil {
+		return "", err
+	}
+	bits := pkg.CellBits(c.CellWidth)
+	w := &wasmCompiler{
+		machine:       m,
+		module:        &wasmModule{},
+		stringOffsets: make(map[string]int32),
+		bits:          bits,
+		spaceBits:     min(bits, 32),
+		checked:       bits >= 64 && c.OverflowBehaviour != config.OverflowWrap,
+		seed:          c.RandomSeed,
+		stackBase:     (wasmSpace + 4*m.torus.Width*m.torus.Height + 7) / 8 * 8,
+	}
+	return string(w.compile()), nil
+}
+
+type wasmCompiler struct {
+	*machine
+	module        *wasmModule
+	strings       []byte
+	stringOffsets map[string]int32
+	bits          int
+	spaceBits     int
+	checked       bool    // whether arithmetic needs to check for overflow, as cells are as wide as an i64
+	seed          *uint64 // seeds the generator for ?, rather than asking WASI for randomness, if set
+	stackBase     int
+
+	// WASI
+	fdWrite, fdRead, procExit, randomGet *wasmFunction
+
+	// the runtime
+	flush, putByte, writeString, writeInt, putRune, readByte, readRune, readInt, readChar *wasmFunction
+	push, pop, peek, fail, fitBits, fit, overflowed, random, get, put                     *wasmFunction
+	arithmetic                                                                            map[rune]*wasmFunction
+
+	// globals
+	sp, outLen, outFd, peeked, atX, atY, atC uint32
+}
+
+func (w *wasmCompiler) compile() []byte {
+	m := w.module
+	const wasi = "wasi_snapshot_preview1"
+	w.fdWrite = m.importFunction(wasi, "fd_write", []byte{i32, i32, i32, i32}, []byte{i32})
+	w.fdRead = m.importFunction(wasi, "fd_read", []byte{i32, i32, i32, i32}, []byte{i32})
+	w.procExit = m.importFunction(wasi, "proc_exit", []byte{i32}, nil)
+	if w.seed == nil {
+		w.randomGet = m.importFunction(wasi, "random_get", []byte{i32, i32}, []byte{i32})
+	}
+
+	w.sp = m.global(int32(w.stackBase))
+	w.outLen = m.global(0)
+	w.outFd = m.global(1)
+	w.peeked = m.global(-1)
+	w.atX, w.atY, w.atC = m.global(0), m.global(0), m.global(0)
+
+	w.flush = m.function("flush", nil, nil)
+	w.putByte = m.function("put_byte", []byte{i32}, nil)
+	w.writeString = m.function("write_string", []byte{i32, i32}, nil)
+	w.writeInt = m.function("write_int", []byte{i64}, nil)
+	w.putRune = m.function("put_rune", []byte{i32}, nil)
+	w.readByte = m.function("read_byte", nil, []byte{i32})
+	w.readRune = m.function("read_rune", nil, []byte{i32})
+	w.readInt = m.function("read_int", nil, []byte{i64})
+	w.readChar = m.function("read_char", nil, []byte{i64})
+	w.push = m.function("push", []byte{i64}, nil)
+	w.pop = m.function("pop", nil, []byte{i64})
+	w.peek = m.function("peek", nil, []byte{i64})
+	w.fail = m.function("fail", []byte{i32, i32}, nil)
+	w.fitBits = m.function("fit_bits", []byte{i64, i32}, []byte{i64})
+	w.fit = m.function("fit", []byte{i64}, []byte{i64})
+	w.overflowed = m.function("overflowed", []byte{i32}, []byte{i64})
+	w.random = m.function("random", nil, []byte{i32})
+	w.get = m.function("get", nil, nil)
+	w.put = m.function("put", nil, nil)
+	w.arithmetic = map[rune]*wasmFunction{}
+	for _, op := range "+-*/%" {
+		w.arithmetic[op] = m.function("operator"+string(op), []byte{i64, i64}, []byte{i64})
+	}
+	start := m.function("_start", nil, nil)
+	m.exports = append(m.exports, start)
+
+	w.writeFlush()
+	w.writePutByte()
+	w.writeWriteString()
+	w.writeWriteInt()
+	w.writePutRune()
+	w.writeReadByte()
+	w.writeReadRune()
+	w.writeReadInt()
+	w.writeReadChar()
+	w.writeStack()
+	w.writeFail()
+	w.writeFitBits()
+	w.writeArithmetic()
+	w.writeRandom()
+	w.writeGet()
+	w.writePut()
+	if w.selfModifying {
+		w.writeInterpreter(start)
+	} else {
+		w.writeStateMachine(start)
+	}
+
+	var space []byte
+	for _, line := range w.torus.Chars {
+		for _, c := range line {
+			space = append(space, byte(c), byte(c>>8), byte(c>>16), byte(c>>24))
+		}
+	}
+	m.data = []wasmData{{offset: wasmStrings, bytes: w.strings}, {offset: wasmSpace, bytes: space}}
+	if w.seed != nil {
+		m.data = append(m.data, wasmData{offset: wasmSeed, bytes: binary.LittleEndian.AppendUint64(nil, *w.seed)})
+	}
+	m.pages = w.stackBase/wasmPageSize + 1
+	return m.encode()
+}
+
+// str the offset and length of the string in memory
+func (w *wasmCompiler) str(s string) (int32, int32) {
+	offset, ok := w.stringOffsets[s]
+	if !ok {
+		offset = int32(wasmStrings + len(w.strings))
+		w.strings = append(w.strings, s...)
+		w.stringOffsets[s] = offset
+	}
+	return offset, int32(len(s))
+}
+
+// failWith halts the program with the message
+func (w *wasmCompiler) failWith(c *wasmCode, msg string) *wasmCode {
+	offset, length := w.str(msg)
+	return c.i32(offset).i32(length).call(w.fail)
+}
+
+// writeFlush writes the buffered output to the current output file descriptor
+func (w *wasmCompiler) writeFlush() {
+	c := &w.flush.code
+	c.i32(wasmIOVec).i32(wasmOut).memory(opI32Store, 2, 0)
+	c.i32(wasmIOVec).getGlobal(w.outLen).memory(opI32Store, 2, 4)
+	c.getGlobal(w.outFd).i32(wasmIOVec).i32(1).i32(wasmIOResult).call(w.fdWrite).op(opDrop)
+	c.i32(0).setGlobal(w.outLen)
+}
+
+func (w *wasmCompiler) writePutByte() {
+	c := &w.putByte.code
+	c.getGlobal(w.outLen).i32(wasmOutSize).op(opI32Eq).ifThen().call(w.flush).end()
+	c.getGlobal(w.outLen).get(0).memory(opI32Store8, 0, wasmOut)
+	c.getGlobal(w.outLen).i32(1).op(opI32Add).setGlobal(w.outLen)
+}
+
+func (w *wasmCompiler) writeWriteString() {
+	c := &w.writeString.code
+	c.block("done").loop("next")
+	c.get(1).op(opI32Eqz).brIf("done")
+	c.get(0).memory(opI32Load8U, 0, 0).call(w.putByte)
+	c.get(0).i32(1).op(opI32Add).set(0)
+	c.get(1).i32(1).op(opI32Sub).set(1)
+	c.br("next").end().end()
+}
+
+func (w *wasmCompiler) writeWriteInt() {
+	f := w.writeInt
+	c := &f.code
+	p := f.local(i32)
+	// the digits are written backwards from the end of the scratch space, using the magnitude as an unsigned value so
+	// that the least int works too
+	c.get(0).i64(0).op(opI64LtS).ifThen()
+	c.i32('-').call(w.putByte)
+	c.i64(0).get(0).op(opI64Sub).set(0)
+	c.end()
+	c.i32(wasmDigitEnd).set(p)
+	c.loop("digit")
+	c.get(p).i32(1).op(opI32Sub).set(p)
+	c.get(p).get(0).i64(10).op(opI64RemU, opI32WrapI64).i32('0').op(opI32Add).memory(opI32Store8, 0, 0)
+	c.get(0).i64(10).op(opI64DivU).tee(0).i64(0).op(opI64Ne).brIf("digit")
+	c.end()
+	c.block("done").loop("write")
+	c.get(p).i32(wasmDigitEnd).op(opI32Eq).brIf("done")
+	c.get(p).memory(opI32Load8U, 0, 0).call(w.putByte)
+	c.get(p).i32(1).op(opI32Add).set(p)
+	c.br("write").end().end()
+}
+
+// writePutRune writes the UTF-8 encoding of a character, with invalid characters written as U+FFFD
+func (w *wasmCompiler) writePutRune() {
+	c := &w.putRune.code
+	continuation := func(shift int32) {
+		c.get(0).i32(shift).op(opI32ShrU).i32(0x3f).op(opI32And).i32(0x80).op(opI32Or).call(w.putByte)
+	}
+	lead := func(shift int32, mark int32) {
+		c.get(0).i32(shift).op(opI32ShrU).i32(mark).op(opI32Or).call(w.putByte)
+	}
+	c.get(0).i32(0x10ffff).op(opI32GtU)
+	c.get(0).i32(-0x800).op(opI32And).i32(0xd800).op(opI32Eq)
+	c.op(opI32Or).ifThen().i32(0xfffd).set(0).end()
+	c.get(0).i32(0x80).op(opI32LtU).ifThen().get(0).call(w.putByte).op(opReturn).end()
+	c.get(0).i32(0x800).op(opI32LtU).ifThen()
+	lead(6, 0xc0)
+	continuation(0)
+	c.op(opReturn).end()
+	c.get(0).i32(0x10000).op(opI32LtU).ifThen()
+	lead(12, 0xe0)
+	continuation(6)
+	continuation(0)
+	c.op(opReturn).end()
+	lead(18, 0xf0)
+	continuation(12)
+	continuation(6)
+	continuation(0)
+}
+
+// writeReadByte reads a byte from stdin, or -1 at the end of the input. A byte which was peeked is read first
+func (w *wasmCompiler) writeReadByte() {
+	c := &w.readByte.code
+	c.getGlobal(w.peeked).i32(-1).op(opI32Ne).ifThen()
+	c.getGlobal(w.peeked).i32(-1).setGlobal(w.peeked).op(opReturn)
+	c.end()
+	c.i32(wasmIOVec).i32(wasmInByte).memory(opI32Store, 2, 0)
+	c.i32(wasmIOVec).i32(1).memory(opI32Store, 2, 4)
+	c.i32(0).i32(wasmIOVec).i32(1).i32(wasmIOResult).call(w.fdRead).ifThen()
+	w.failWith(c, "error reading input")
+	c.end()
+	c.i32(wasmIOResult).memory(opI32Load, 2, 0).op(opI32Eqz).ifThen().i32(-1).op(opReturn).end()
+	c.i32(wasmInByte).memory(opI32Load8U, 0, 0)
+}
+
+// writeReadRune reads a UTF-8 encoded character, or -1 at the end of the input. Invalid characters are read as U+FFFD
+func (w *wasmCompiler) writeReadRune() {
+	f := w.readRune
+	c := &f.code
+	b, n, r, least := f.local(i32), f.local(i32), f.local(i32), f.local(i32)
+	lead := func(mask, marker, dataMask, count, minimum int32) {
+		c.get(b).i32(mask).op(opI32And).i32(marker).op(opI32Eq).ifThen()
+		c.i32(count).set(n).get(b).i32(dataMask).op(opI32And).set(r).i32(minimum).set(least)
+		c.orElse()
+	}
+	c.call(w.readByte).tee(b).i32(0).op(opI32LtS).ifThen().i32(-1).op(opReturn).end()
+	c.get(b).i32(0x80).op(opI32LtU).ifThen().get(b).op(opReturn).end()
+	lead(0xe0, 0xc0, 0x1f, 1, 0x80)
+	lead(0xf0, 0xe0, 0x0f, 2, 0x800)
+	lead(0xf8, 0xf0, 0x07, 3, 0x10000)
+	c.i32(0xfffd).op(opReturn)
+	c.end().end().end()
+	c.block("done").loop("continuation")
+	c.get(n).op(opI32Eqz).brIf("done")
+	c.call(w.readByte).tee(b).i32(0xc0).op(opI32And).i32(0x80).op(opI32Ne).ifThen()
+	c.get(b).i32(0).op(opI32GeS).ifThen().get(b).setGlobal(w.peeked).end()
+	c.i32(0xfffd).op(opReturn)
+	c.end()
+	c.get(r).i32(6).op(opI32Shl).get(b).i32(0x3f).op(opI32And).op(opI32Or).set(r)
+	c.get(n).i32(1).op(opI32Sub).set(n)
+	c.br("continuation").end().end()
+	c.get(r).get(least).op(opI32LtU)
+	c.get(r).i32(0x10ffff).op(opI32GtU).op(opI32Or)
+	c.get(r).i32(-0x800).op(opI32And).i32(0xd800).op(opI32Eq).op(opI32Or)
+	c.ifResult(i32).i32(0xfffd).orElse().get(r).end()
+}
+
+// writeReadInt reads a line containing an integer, skipping any lines which don't. Returns 0 at the end of the input.
+// Lines are parsed as they are read: an integer is an optional sign followed by digits, which can be surrounded by
+// whitespace
+func (w *wasmCompiler) writeReadInt() {
+	f := w.readInt
+	c := &f.code
+	b, read, started, ended, negative, invalid, digits := f.local(i32), f.local(i32), f.local(i32), f.local(i32),
+		f.local(i32), f.local(i32), f.local(i32)
+	u, d := f.local(i64), f.local(i64)
+	invalidate := func() {
+		c.i32(1).set(invalid).br("char").end()
+	}
+	c.call(w.flush)
+	c.loop("line")
+	for _, local := range []uint32{read, started, ended, negative, invalid, digits} {
+		c.i32(0).set(local)
+	}
+	c.i64(0).set(u)
+	c.block("eol").loop("char")
+	c.call(w.readByte).tee(b).i32(0).op(opI32LtS).ifThen()
+	c.get(read).op(opI32Eqz).ifThen().i64(0).op(opReturn).end()
+	c.br("eol")
+	c.end()
+	c.i32(1).set(read)
+	c.get(b).i32('\n').op(opI32Eq).brIf("eol")
+	// whitespace ends the integer if it has started
+	c.get(b).i32(' ').op(opI32Eq).get(b).i32('\t').op(opI32Sub).i32(4).op(opI32LeU).op(opI32Or).ifThen()
+	c.get(ended).get(started).op(opI32Or).set(ended).br("char")
+	c.end()
+	c.get(ended).ifThen()
+	invalidate()
+	c.get(started).op(opI32Eqz).get(b).i32('+').op(opI32Eq).get(b).i32('-').op(opI32Eq).op(opI32Or, opI32And).ifThen()
+	c.i32(1).set(started).get(b).i32('-').op(opI32Eq).set(negative).br("char")
+	c.end()
+	c.i32(1).set(started)
+	c.get(b).i32('0').op(opI32Sub).i32(9).op(opI32GtU).ifThen()
+	invalidate()
+	c.get(b).i32('0').op(opI32Sub).op(opI64ExtendU32).set(d)
+	// the magnitude can be one more than the greatest int when it is negative
+	c.get(u).i64(math.MaxInt64).get(negative).op(opI64ExtendU32).op(opI64Add).get(d).op(opI64Sub).i64(10).op(opI64DivU)
+	c.op(opI64GtU).ifThen()
+	invalidate()
+	c.get(u).i64(10).op(opI64Mul).get(d).op(opI64Add).set(u)
+	c.get(digits).i32(1).op(opI32Add).set(digits)
+	c.br("char")
+	c.end().end()
+	c.get(invalid).op(opI32Eqz).get(digits).i32(0).op(opI32Ne).op(opI32And).ifThen()
+	c.i64(0).get(u).op(opI64Sub).get(u).get(negative).op(opSelect).call(w.fit).op(opReturn)
+	c.end()
+	c.br("line")
+	c.end()
+	c.op(opUnreachable)
+}
+
+// writeReadChar reads a character, skipping line breaks. Returns 0 at the end of the input
+func (w *wasmCompiler) writeReadChar() {
+	f := w.readChar
+	c := &f.code
+	r := f.local(i32)
+	c.call(w.flush)
+	c.loop("char")
+	c.call(w.readRune).tee(r).i32(0).op(opI32LtS).ifThen().i64(0).op(opReturn).end()
+	c.get(r).i32('\n').op(opI32Eq).get(r).i32('\r').op(opI32Eq).op(opI32Or).brIf("char")
+	c.end()
+	c.get(r).op(opI64ExtendI32).call(w.fit)
+}
+
+func (w *wasmCompiler) writeStack() {
+	c := &w.push.code
+	// grow the memory when the stack reaches the end of it
+	c.getGlobal(w.sp).i32(8).op(opI32Add).op(opMemorySize, 0).i32(16).op(opI32Shl).op(opI32GtU).ifThen()
+	c.i32(1).op(opMemoryGrow, 0).i32(-1).op(opI32Eq).ifThen()
+	w.failWith(c, "out of memory")
+	c.end().end()
+	c.getGlobal(w.sp).get(0).memory(opI64Store, 3, 0)
+	c.getGlobal(w.sp).i32(8).op(opI32Add).setGlobal(w.sp)
+
+	c = &w.pop.code
+	c.getGlobal(w.sp).i32(int32(w.stackBase)).op(opI32Eq).ifResult(i64).i64(0).orElse()
+	c.getGlobal(w.sp).i32(8).op(opI32Sub).setGlobal(w.sp)
+	c.getGlobal(w.sp).memory(opI64Load, 3, 0)
+	c.end()
+
+	c = &w.peek.code
+	c.getGlobal(w.sp).i32(int32(w.stackBase)).op(opI32Eq).ifResult(i64).i64(0).orElse()
+	c.getGlobal(w.sp).i32(8).op(opI32Sub).memory(opI64Load, 3, 0)
+	c.end()
+}
+
+// writeFail halts the program with an error at the last instruction which can fail, written to stderr
+func (w *wasmCompiler) writeFail() {
+	c := &w.fail.code
+	text := func(s string) {
+		offset, length := w.str(s)
+		c.i32(offset).i32(length).call(w.writeString)
+	}
+	c.call(w.flush)
+	c.i32(2).setGlobal(w.outFd)
+	text("Error: Befunge execution error at position (")
+	c.getGlobal(w.atX).op(opI64ExtendI32).call(w.writeInt)
+	text(", ")
+	c.getGlobal(w.atY).op(opI64ExtendI32).call(w.writeInt)
+	text(") '")
+	c.getGlobal(w.atC).call(w.putRune)
+	text("': ")
+	c.get(0).get(1).call(w.writeString)
+	c.i32('\n').call(w.putByte)
+	c.call(w.flush)
+	c.i32(1).call(w.procExit)
+}
+
+func (w *wasmCompiler) writeFitBits() {
+	f := w.fitBits
+	c := &f.code
+	least, greatest := f.local(i64), f.local(i64)
+	c.get(1).i32(64).op(opI32GeS).ifThen().get(0).op(opReturn).end()
+	c.i64(-1).get(1).i32(1).op(opI32Sub).op(opI64ExtendU32).op(opI64Shl).tee(least)
+	c.i64(-1).op(opI64Xor).set(greatest)
+	c.get(0).get(least).op(opI64GeS).get(0).get(greatest).op(opI64LeS).op(opI32And).ifThen()
+	c.get(0).op(opReturn)
+	c.end()
+	switch w.config.OverflowBehaviour {
+	case config.OverflowSaturate:
+		c.get(least).get(greatest).get(0).get(least).op(opI64LtS).op(opSelect)
+	case config.OverflowPanic:
+		w.failWith(c, "cell overflow").i64(0)
+	default:
+		// sign extend from the lowest bits
+		c.get(0).i64(64).get(1).op(opI64ExtendU32).op(opI64Sub).op(opI64Shl)
+		c.i64(64).get(1).op(opI64ExtendU32).op(opI64Sub).op(opI64ShrS)
+	}
+
+	c = &w.fit.code
+	c.get(0).i32(int32(w.bits)).call(w.fitBits)
+}
+
+// writeArithmetic writes the operators, which take b and then a
+func (w *wasmCompiler) writeArithmetic() {
+	c := &w.overflowed.code
+	if w.config.OverflowBehaviour == config.OverflowPanic {
+		w.failWith(c, "cell overflow").i64(0)
+	} else {
+		c.i64(math.MaxInt64).i64(math.MinInt64).get(0).op(opSelect)
+	}
+
+	const b, a = 0, 1
+	for op, f := range w.arithmetic {
+		c := &f.code
+		if w.checked {
+			switch op {
+			case '+':
+				c.get(a).i64(0).op(opI64GtS).get(b).i64(math.MaxInt64).get(a).op(opI64Sub, opI64GtS, opI32And)
+				c.get(a).i64(0).op(opI64LtS).get(b).i64(math.MinInt64).get(a).op(opI64Sub, opI64LtS, opI32And)
+				c.op(opI32Or).ifThen().get(a).i64(0).op(opI64GtS).call(w.overflowed).op(opReturn).end()
+				c.get(b).get(a).op(opI64Add)
+			case '-':
+				c.get(a).i64(0).op(opI64LtS).get(b).i64(math.MaxInt64).get(a).op(opI64Add, opI64GtS, opI32And)
+				c.get(a).i64(0).op(opI64GtS).get(b).i64(math.MinInt64).get(a).op(opI64Add, opI64LtS, opI32And)
+				c.op(opI32Or).ifThen().get(a).i64(0).op(opI64LtS).call(w.overflowed).op(opReturn).end()
+				c.get(b).get(a).op(opI64Sub)
+			case '*':
+				c.get(a).op(opI64Eqz).get(b).op(opI64Eqz).op(opI32Or).ifThen().i64(0).op(opReturn).end()
+				c.get(a).i64(-1).op(opI64Eq).ifThen()
+				c.get(b).i64(math.MinInt64).op(opI64Eq).ifThen().i32(1).call(w.overflowed).op(opReturn).end()
+				c.i64(0).get(b).op(opI64Sub).op(opReturn)
+				c.end()
+				c.get(a).i64(0).op(opI64GtS).ifResult(i32)
+				c.get(b).i64(math.MaxInt64).get(a).op(opI64DivS, opI64GtS)
+				c.get(b).i64(math.MinInt64).get(a).op(opI64DivS, opI64LtS, opI32Or)
+				c.orElse()
+				c.get(b).i64(math.MaxInt64).get(a).op(opI64DivS, opI64LtS)
+				c.get(b).i64(math.MinInt64).get(a).op(opI64DivS, opI64GtS, opI32Or)
+				c.end().ifThen()
+				c.get(a).i64(0).op(opI64GtS).get(b).i64(0).op(opI64GtS, opI32Eq).call(w.overflowed).op(opReturn)
+				c.end()
+				c.get(b).get(a).op(opI64Mul)
+			case '/':
+				c.get(a).i64(-1).op(opI64Eq).get(b).i64(math.MinInt64).op(opI64Eq, opI32And).ifThen()
+				c.i32(1).call(w.overflowed).op(opReturn)
+				c.end()
+				c.get(b).get(a).op(opI64DivS)
+			case '%':
+				c.get(b).get(a).op(opI64RemS)
+			}
+			continue
+		}
+		// i64 arithmetic wraps around, other than dividing the least i64 by -1
+		switch op {
+		case '+':
+			c.get(b).get(a).op(opI64Add)
+		case '-':
+			c.get(b).get(a).op(opI64Sub)
+		case '*':
+			c.get(b).get(a).op(opI64Mul)
+		case '/':
+			c.get(a).i64(-1).op(opI64Eq).ifResult(i64).i64(0).get(b).op(opI64Sub).orElse().get(b).get(a).op(opI64DivS)
+			c.end()
+		case '%':
+			c.get(b).get(a).op(opI64RemS)
+		}
+		c.call(w.fit)
+	}
+}
+
+// writeRandom generates a random direction from 0 to 3. When seeded, the direction is the top two bits of a linear
+// congruential generator, which are its most random
+func (w *wasmCompiler) writeRandom() {
+	c := &w.random.code
+	if w.seed != nil {
+		c.i32(wasmSeed).i32(wasmSeed).memory(opI64Load, 3, 0)
+		c.i64(6364136223846793005).op(opI64Mul).i64(1442695040888963407).op(opI64Add).memory(opI64Store, 3, 0)
+		c.i32(wasmSeed).memory(opI64Load, 3, 0).i64(62).op(opI64ShrU).op(opI32WrapI64)
+		return
+	}
+	c.i32(wasmRandom).i32(1).call(w.randomGet).op(opDrop)
+	c.i32(wasmRandom).memory(opI32Load8U, 0, 0).i32(3).op(opI32And)
+}
+
+// outOfBounds handles a position outside funge-space with the behaviour, leaving x and y wrapped into funge-space if it
+// doesn't return
+func (w *wasmCompiler) outOfBounds(f *wasmFunction, x, y uint32, behaviour config.OutOfBoundsBehaviour, msg string) {
+	c := &f.code
+	width, height := int64(w.torus.Width), int64(w.torus.Height)
+	// negative positions are out of bounds too, as unsigned values
+	c.get(x).i64(width).op(opI64GeU).get(y).i64(height).op(opI64GeU).op(opI32Or).ifThen()
+	switch behaviour {
+	case config.OobZero:
+		if f == w.get {
+			c.i64(0).call(w.push)
+		}
+		c.op(opReturn)
+	case config.OobNoOp:
+		c.op(opReturn)
+	case config.OobWrap:
+		c.get(x).i64(width).op(opI64RemS).i64(width).op(opI64Add).i64(width).op(opI64RemS).set(x)
+		c.get(y).i64(height).op(opI64RemS).i64(height).op(opI64Add).i64(height).op(opI64RemS).set(y)
+	default:
+		w.failWith(c, msg).op(opReturn)
+	}
+	c.end()
+	// the address of the cell
+	c.get(y).i64(width).op(opI64Mul).get(x).op(opI64Add, opI32WrapI64).i32(2).op(opI32Shl)
+}
+
+func (w *wasmCompiler) writeGet() {
+	f := w.get
+	c := &f.code
+	x, y := f.local(i64), f.local(i64)
+	c.call(w.pop).set(y).call(w.pop).set(x)
+	w.outOfBounds(f, x, y, w.config.GetOutOfBoundsBehaviour, "get index out of bounds")
+	c.memory(opI32Load, 2, wasmSpace).op(opI64ExtendI32).call(w.fit).call(w.push)
+}
+
+func (w *wasmCompiler) writePut() {
+	f := w.put
+	c := &f.code
+	x, y, v := f.local(i64), f.local(i64), f.local(i32)
+	c.call(w.pop).set(y).call(w.pop).set(x)
+	c.call(w.pop).i32(int32(w.spaceBits)).call(w.fitBits).op(opI32WrapI64).set(v)
+	w.outOfBounds(f, x, y, w.config.PutOutOfBoundsBehaviour, "put index out of bounds")
+	c.get(v).memory(opI32Store, 2, wasmSpace)
+}
+
+// statement writes an instruction which doesn't move the instruction pointer, other than / and % reflecting it by
+// calling reflect. a and b are i64 locals for the operands
+func (w *wasmCompiler) statement(c *wasmCode, char rune, a, b uint32, reflect func()) {
+	switch {
+	case '0' <= char && char <= '9':
+		c.i64(int64(char - '0')).call(w.push)
+	case char == '/' || char == '%':
+		c.call(w.pop).set(a).call(w.pop).set(b)
+		c.get(a).op(opI64Eqz).ifThen()
+		switch w.div0Behaviour(char) {
+		case config.Div0PromptForInput:
+			c.call(w.readInt).call(w.push)
+		case config.Div0ReturnZero:
+			c.i64(0).call(w.push)
+		case config.Div0Reflect:
+			reflect()
+		default:
+			w.failWith(c, "divide by zero")
+		}
+		c.orElse()
+		c.get(b).get(a).call(w.arithmetic[char]).call(w.push)
+		c.end()
+	case strings.ContainsRune("+-*", char):
+		c.call(w.pop).set(a).call(w.pop).get(a).call(w.arithmetic[char]).call(w.push)
+	case char == '`':
+		c.call(w.pop).set(a).call(w.pop).get(a).op(opI64GtS, opI64ExtendU32).call(w.push)
+	case char == '!':
+		c.call(w.pop).op(opI64Eqz, opI64ExtendU32).call(w.push)
+	case char == ':':
+		c.call(w.peek).call(w.push)
+	case char == '\\':
+		c.call(w.pop).set(a).call(w.pop).set(b).get(a).call(w.push).get(b).call(w.push)
+	case char == '$':
+		c.call(w.pop).op(opDrop)
+	case char == '.':
+		c.call(w.pop).call(w.writeInt)
+	case char == ',':
+		c.call(w.pop).op(opI32WrapI64).call(w.putRune)
+	case char == 'g':
+		c.call(w.get)
+	case char == 'p':
+		c.call(w.put)
+	case char == '&':
+		c.call(w.readInt).call(w.push)
+	case char == '~':
+		c.call(w.readChar).call(w.push)
+	}
+}
+
+// writeStateMachine writes the state machine as a loop which dispatches on the current state, with a block for each
+// state. The code for each state follows the end of its block, and sets the next state before branching back to the
+// start of the loop, or falls through to the next state's code if that is the next state
+func (w *wasmCompiler) writeStateMachine(start *wasmFunction) {
+	c := &start.code
+	current, r := start.local(i32), start.local(i32)
+	a, b := start.local(i64), start.local(i64)
+	index := make(map[state]int32)
+	labels := make([]string, len(w.states))
+	for i, s := range w.states {
+		index[s] = int32(i)
+		labels[i] = label(s)
+	}
+	goTo := func(i int, next state) {
+		if index[next] != int32(i+1) {
+			c.i32(index[next]).set(current).br("dispatch")
+		}
+	}
+	c.i32(index[w.entry]).set(current)
+	c.loop("dispatch")
+	for i := len(labels) - 1; i >= 0; i-- {
+		c.block(labels[i])
+	}
+	c.get(current).brTable(labels, labels[0])
+	for i, s := range w.states {
+		c.end()
+		char := w.char(s)
+		next := w.successors(s)
+		switch {
+		case w.folded(s):
+			// a path which loops forever without reaching an instruction
+		case s.stringMode && w.fitsCell(char):
+			c.i64(int64(char)).call(w.push)
+		case s.stringMode:
+			c.i32(int32(s.x)).setGlobal(w.atX).i32(int32(s.y)).setGlobal(w.atY).i32(char).setGlobal(w.atC)
+			c.i64(int64(char)).call(w.fit).call(w.push)
+		case char == '_' || char == '|':
+			c.i32(index[next[0]]).i32(index[next[1]]).call(w.pop).op(opI64Eqz, opSelect).set(current).br("dispatch")
+			continue
+		case char == '?':
+			c.call(w.random).set(r)
+			for _, next := range next {
+				c.i32(index[next])
+			}
+			c.get(r).i32(2).op(opI32Eq, opSelect)
+			c.get(r).i32(1).op(opI32Eq, opSelect)
+			c.get(r).op(opI32Eqz, opSelect)
+			c.set(current).br("dispatch")
+			continue
+		case char == '@':
+			c.call(w.flush).op(opReturn)
+			continue
+		default:
+			if canFail(char) {
+				c.i32(int32(s.x)).setGlobal(w.atX).i32(int32(s.y)).setGlobal(w.atY).i32(char).setGlobal(w.atC)
+			}
+			w.statement(c, char, a, b, func() {
+				c.i32(index[next[1]]).set(current).br("dispatch")
+			})
+		}
+		goTo(i, next[0])
+	}
+	c.end()
+}
+
+// writeInterpreter writes a minimal interpreter, which dispatches on the kind of each instruction it executes
+func (w *wasmCompiler) writeInterpreter(start *wasmFunction) {
+	c := &start.code
+	x, y, dx, dy, stringMode, char, r := start.local(i32), start.local(i32), start.local(i32), start.local(i32),
+		start.local(i32), start.local(i32), start.local(i32)
+	a, b := start.local(i64), start.local(i64)
+	width, height := int32(w.torus.Width), int32(w.torus.Height)
+	move := func() {
+		c.get(x).get(dx).op(opI32Add).i32(width).op(opI32Add).i32(width).op(opI32RemU).set(x)
+		c.get(y).get(dy).op(opI32Add).i32(height).op(opI32Add).i32(height).op(opI32RemU).set(y)
+	}
+	turn := func(newDx, newDy int32) {
+		c.i32(newDx).set(dx).i32(newDy).set(dy)
+	}
+
+	c.i32(1).set(dx)
+	c.loop("run")
+	c.get(y).i32(width).op(opI32Mul).get(x).op(opI32Add).i32(2).op(opI32Shl).memory(opI32Load, 2, wasmSpace).set(char)
+	c.block("next")
+	c.get(x).setGlobal(w.atX).get(y).setGlobal(w.atY).get(char).setGlobal(w.atC)
+	c.get(stringMode).get(char).i32('"').op(opI32Ne, opI32And).ifThen()
+	c.get(char).op(opI64ExtendI32).call(w.fit).call(w.push).br("next")
+	c.end()
+
+	kinds := []rune(wasmKinds)
+	labels := make([]string, len(kinds))
+	for i, kind := range kinds {
+		labels[i] = string(kind)
+	}
+	c.block("noop")
+	for i := len(kinds) - 1; i >= 0; i-- {
+		c.block(labels[i])
+	}
+	table := make([]string, 128)
+	for i := range table {
+		table[i] = "noop"
+		if '0' <= i && i <= '9' {
+			table[i] = "0"
+		} else if strings.ContainsRune(wasmKinds, rune(i)) {
+			table[i] = string(rune(i))
+		}
+	}
+	c.get(char).brTable(table, "noop")
+	for _, kind := range kinds {
+		c.end()
+		switch kind {
+		case '0':
+			c.get(char).i32('0').op(opI32Sub, opI64ExtendI32).call(w.push)
+		case '>':
+			turn(1, 0)
+		case '<':
+			turn(-1, 0)
+		case 'v':
+			turn(0, 1)
+		case '^':
+			turn(0, -1)
+		case '?':
+			c.call(w.random).set(r)
+			c.i32(1).i32(-1).i32(0).get(r).i32(1).op(opI32Eq, opSelect).get(r).op(opI32Eqz, opSelect).set(dx)
+			c.i32(1).i32(-1).i32(0).get(r).i32(3).op(opI32Eq, opSelect).get(r).i32(2).op(opI32Eq, opSelect).set(dy)
+		case '_':
+			c.i32(1).i32(-1).call(w.pop).op(opI64Eqz, opSelect).set(dx).i32(0).set(dy)
+		case '|':
+			c.i32(0).set(dx).i32(1).i32(-1).call(w.pop).op(opI64Eqz, opSelect).set(dy)
+		case '"':
+			c.get(stringMode).op(opI32Eqz).set(stringMode)
+		case '#':
+			move()
+		case '@':
+			c.call(w.flush).op(opReturn)
+		default:
+			w.statement(c, kind, a, b, func() {
+				c.i32(0).get(dx).op(opI32Sub).set(dx).i32(0).get(dy).op(opI32Sub).set(dy)
+			})
+		}
+		c.br("noop")
+	}
+	c.end() // noop
+	c.end() // next
+	move()
+	c.br("run")
+	c.end()
+}
@@ -0,0 +1,344 @@
+package compiler
+
+import (
+	"fmt"
+	"slices"
+)
+
+// value types
+const (
+	i32 byte = 0x7f
+	i64 byte = 0x7e
+)
+
+// the opcodes of the instructions used by the WebAssembly target
+const (
+	opUnreachable  byte = 0x00
+	opBlock        byte = 0x02
+	opLoop         byte = 0x03
+	opIf           byte = 0x04
+	opElse         byte = 0x05
+	opEnd          byte = 0x0b
+	opBr           byte = 0x0c
+	opBrIf         byte = 0x0d
+	opBrTable      byte = 0x0e
+	opReturn       byte = 0x0f
+	opCall         byte = 0x10
+	opDrop         byte = 0x1a
+	opSelect       byte = 0x1b
+	opLocalGet     byte = 0x20
+	opLocalSet     byte = 0x21
+	opLocalTee     byte = 0x22
+	opGlobalGet    byte = 0x23
+	opGlobalSet    byte = 0x24
+	opI32Load      byte = 0x28
+	opI64Load      byte = 0x29
+	opI32Load8U    byte = 0x2d
+	opI32Store     byte = 0x36
+	opI64Store     byte = 0x37
+	opI32Store8    byte = 0x3a
+	opMemorySize   byte = 0x3f
+	opMemoryGrow   byte = 0x40
+	opI32Const     byte = 0x41
+	opI64Const     byte = 0x42
+	opI32Eqz       byte = 0x45
+	opI32Eq        byte = 0x46
+	opI32Ne        byte = 0x47
+	opI32LtS       byte = 0x48
+	opI32LtU       byte = 0x49
+	opI32GtU       byte = 0x4b
+	opI32LeU       byte = 0x4d
+	opI32GeS       byte = 0x4e
+	opI32GeU       byte = 0x4f
+	opI64Eqz       byte = 0x50
+	opI64Eq        byte = 0x51
+	opI64Ne        byte = 0x52
+	opI64LtS       byte = 0x53
+	opI64GtS       byte = 0x55
+	opI64GtU       byte = 0x56
+	opI64LeS       byte = 0x57
+	opI64GeS       byte = 0x59
+	opI64GeU       byte = 0x5a
+	opI32Add       byte = 0x6a
+	opI32Sub       byte = 0x6b
+	opI32Mul       byte = 0x6c
+	opI32RemU      byte = 0x70
+	opI32And       byte = 0x71
+	opI32Or        byte = 0x72
+	opI32Xor       byte = 0x73
+	opI32Shl       byte = 0x74
+	opI32ShrU      byte = 0x76
+	opI64Add       byte = 0x7c
+	opI64Sub       byte = 0x7d
+	opI64Mul       byte = 0x7e
+	opI64DivS      byte = 0x7f
+	opI64DivU      byte = 0x80
+	opI64RemS      byte = 0x81
+	opI64RemU      byte = 0x82
+	opI64Xor       byte = 0x85
+	opI64Shl       byte = 0x86
+	opI64ShrS      byte = 0x87
+	opI64ShrU      byte = 0x88
+	opI32WrapI64   byte = 0xa7
+	opI64ExtendI32 byte = 0xac // signed
+	opI64ExtendU32 byte = 0xad
+)
+
+// wasmModule builds a WebAssembly module in the binary format, with a single memory and functions which are either
+// imported or defined by the module
+type wasmModule struct {
+	types     [][]byte // encoded function types
+	imports   []*wasmFunction
+	functions []*wasmFunction
+	globals   []int32 // the initial values of the mutable i32 globals
+	pages     int     // the initial size of the memory
+	data      []wasmData
+	exports   []*wasmFunction // the memory is always exported too, so that WASI can access it
+}
+
+type wasmData struct {
+	offset int
+	bytes  []byte
+}
+
+type wasmFunction struct {
+	index    int
+	typeIdx  int
+	importOf string // the module the function is imported from, if any
+	name     string
+	params   int
+	locals   []byte // the types of the locals after the parameters
+	code     wasmCode
+}
+
+// wasmCode the body of a function, with the labels of the blocks which are currently open so that branches can target
+// them by name
+type wasmCode struct {
+	bytes  []byte
+	labels []string
+}
+
+func (m *wasmModule) functionType(params []byte, results []byte) int {
+	t := append(append(append([]byte{0x60}, uleb(uint64(len(params)))...), params...),
+		append(uleb(uint64(len(results))), results...)...)
+	i := slices.IndexFunc(m.types, func(other []byte) bool {
+		return slices.Equal(other, t)
+	})
+	if i < 0 {
+		m.types = append(m.types, t)
+		i = len(m.types) - 1
+	}
+	return i
+}
+
+// importFunction declares a function imported from another module. All imports must be declared before any functions
+// are defined
+func (m *wasmModule) importFunction(module string, name string, params []byte, results []byte) *wasmFunction {
+	f := &wasmFunction{index: len(m.imports), typeIdx: m.functionType(params, results), importOf: module,
+		name: name, params: len(params)}
+	m.imports = append(m.imports, f)
+	return f
+}
+
+// function declares a function defined by the module, whose code can be written later
+func (m *wasmModule) function(name string, params []byte, results []byte) *wasmFunction {
+	f := &wasmFunction{index: len(m.imports) + len(m.functions), typeIdx: m.functionType(params, results),
+		name: name, params: len(params)}
+	m.functions = append(m.functions, f)
+	return f
+}
+
+// global declares a mutable i32 global, returning its index
+func (m *wasmModule) global(initial int32) uint32 {
+	m.globals = append(m.globals, initial)
+	return uint32(len(m.globals) - 1)
+}
+
+// local declares a local of the given type in the function, returning its index
+func (f *wasmFunction) local(t byte) uint32 {
+	f.locals = append(f.locals, t)
+	return uint32(f.params + len(f.locals) - 1)
+}
+
+func (m *wasmModule) encode() []byte {
+	out := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	out = appendSection(out, 1, vector(m.types, func(t []byte) []byte { return t }))
+	out = appendSection(out, 2, vector(m.imports, func(f *wasmFunction) []byte {
+		return slices.Concat(name(f.importOf), name(f.name), []byte{0x00}, uleb(uint64(f.typeIdx)))
+	}))
+	out = appendSection(out, 3, vector(m.functions, func(f *wasmFunction) []byte {
+		return uleb(uint64(f.typeIdx))
+	}))
+	out = appendSection(out, 5, slices.Concat(uleb(1), []byte{0x00}, uleb(uint64(m.pages))))
+	out = appendSection(out, 6, vector(m.globals, func(v int32) []byte {
+		return slices.Concat([]byte{i32, 0x01, opI32Const}, sleb(int64(v)), []byte{opEnd})
+	}))
+	exports := slices.Concat(uleb(uint64(len(m.exports)+1)), name("memory"), []byte{0x02, 0x00})
+	for _, f := range m.exports {
+		exports = slices.Concat(exports, name(f.name), []byte{0x00}, uleb(uint64(f.index)))
+	}
+	out = appendSection(out, 7, exports)
+	out = appendSection(out, 10, vector(m.functions, func(f *wasmFunction) []byte {
+		// locals are declared in runs of the same type
+		var locals [][]byte
+		for i := 0; i < len(f.locals); {
+			run := 1
+			for i+run < len(f.locals) && f.locals[i+run] == f.locals[i] {
+				run++
+			}
+			locals = append(locals, slices.Concat(uleb(uint64(run)), []byte{f.locals[i]}))
+			i += run
+		}
+		body := slices.Concat(vector(locals, func(l []byte) []byte { return l }), f.code.bytes, []byte{opEnd})
+		return slices.Concat(uleb(uint64(len(body))), body)
+	}))
+	out = appendSection(out, 11, vector(m.data, func(d wasmData) []byte {
+		return slices.Concat([]byte{0x00, opI32Const}, sleb(int64(d.offset)), []byte{opEnd},
+			uleb(uint64(len(d.bytes))), d.bytes)
+	}))
+	return out
+}
+
+func appendSection(out []byte, id byte, content []byte) []byte {
+	return slices.Concat(out, []byte{id}, uleb(uint64(len(content))), content)
+}
+
+func vector[T any](items []T, encode func(T) []byte) []byte {
+	out := uleb(uint64(len(items)))
+	for _, item := range items {
+		out = append(out, encode(item)...)
+	}
+	return out
+}
+
+func name(s string) []byte {
+	return slices.Concat(uleb(uint64(len(s))), []byte(s))
+}
+
+// uleb the unsigned LEB128 encoding of v
+func uleb(v uint64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+// sleb the signed LEB128 encoding of v
+func sleb(v int64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 && b&0x40 == 0 || v == -1 && b&0x40 != 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func (c *wasmCode) op(ops ...byte) *wasmCode {
+	c.bytes = append(c.bytes, ops...)
+	return c
+}
+
+func (c *wasmCode) i32(v int32) *wasmCode {
+	return c.op(opI32Const).op(sleb(int64(v))...)
+}
+
+func (c *wasmCode) i64(v int64) *wasmCode {
+	return c.op(opI64Const).op(sleb(v)...)
+}
+
+func (c *wasmCode) call(f *wasmFunction) *wasmCode {
+	return c.op(opCall).op(uleb(uint64(f.index))...)
+}
+
+func (c *wasmCode) get(local uint32) *wasmCode {
+	return c.op(opLocalGet).op(uleb(uint64(local))...)
+}
+
+func (c *wasmCode) set(local uint32) *wasmCode {
+	return c.op(opLocalSet).op(uleb(uint64(local))...)
+}
+
+func (c *wasmCode) tee(local uint32) *wasmCode {
+	return c.op(opLocalTee).op(uleb(uint64(local))...)
+}
+
+func (c *wasmCode) getGlobal(global uint32) *wasmCode {
+	return c.op(opGlobalGet).op(uleb(uint64(global))...)
+}
+
+func (c *wasmCode) setGlobal(global uint32) *wasmCode {
+	return c.op(opGlobalSet).op(uleb(uint64(global))...)
+}
+
+// memory an instruction which accesses memory, with the alignment as a power of 2 and a constant offset
+func (c *wasmCode) memory(op byte, align int, offset int) *wasmCode {
+	return c.op(op).op(uleb(uint64(align))...).op(uleb(uint64(offset))...)
+}
+
+// block opens a block, which branching to label leaves
+func (c *wasmCode) block(label string) *wasmCode {
+	c.labels = append(c.labels, label)
+	return c.op(opBlock, 0x40)
+}
+
+// loop opens a loop, which branching to label restarts
+func (c *wasmCode) loop(label string) *wasmCode {
+	c.labels = append(c.labels, label)
+	return c.op(opLoop, 0x40)
+}
+
+// ifThen opens an if block with no result, which is executed when the popped i32 isn't zero
+func (c *wasmCode) ifThen() *wasmCode {
+	c.labels = append(c.labels, "")
+	return c.op(opIf, 0x40)
+}
+
+// ifResult opens an if block which results in a value of the given type
+func (c *wasmCode) ifResult(t byte) *wasmCode {
+	c.labels = append(c.labels, "")
+	return c.op(opIf, t)
+}
+
+func (c *wasmCode) orElse() *wasmCode {
+	return c.op(opElse)
+}
+
+func (c *wasmCode) end() *wasmCode {
+	c.labels = c.labels[:len(c.labels)-1]
+	return c.op(opEnd)
+}
+
+// depth the relative depth of the innermost open block with the label
+func (c *wasmCode) depth(label string) uint64 {
+	for i := len(c.labels) - 1; i >= 0; i-- {
+		if c.labels[i] == label {
+			return uint64(len(c.labels) - 1 - i)
+		}
+	}
+	panic(fmt.Sprintf("branch to %s, which isn't open", label))
+}
+
+func (c *wasmCode) br(label string) *wasmCode {
+	return c.op(opBr).op(uleb(c.depth(label))...)
+}
+
+func (c *wasmCode) brIf(label string) *wasmCode {
+	return c.op(opBrIf).op(uleb(c.depth(label))...)
+}
+
+// brTable branches to the label at the index popped, or to the default label if it is out of range
+func (c *wasmCode) brTable(labels []string, defaultLabel string) *wasmCode {
+	c.op(opBrTable).op(uleb(uint64(len(labels)))...)
+	for _, label := range labels {
+		c.op(uleb(c.depth(label))...)
+	}
+	return c.op(uleb(c.depth(defaultLabel))...)
+}
@@ -0,0 +1,143 @@
+package pkg
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Fingerprint a Funge-98 semantic extension. While loaded with (, each of its instructions is bound to one of the
+// instructions A-Z for the instruction pointer which loaded it. Embedders can make their own fingerprints available to
+// programs using RegisterFingerprint
+type Fingerprint struct {
+	// Name the name of the fingerprint, eg ROMA. Its ID is calculated from the name
+	Name string
+	// Instructions the instructions to bind to A-Z while the fingerprint is loaded
+	Instructions map[rune]InstructionPerformer
+}
+
+// ID the fingerprint ID, formed by treating each character of the name as a base 256 digit, eg 0x524f4d41 for ROMA
+func (fp *Fingerprint) ID() int {
+	return fingerprintID([]rune(fp.Name))
+}
+
+func fingerprintID(cells []rune) int {
+	id := 0
+	for _, cell := range cells {
+		id = id*256 + int(cell)
+	}
+	return id
+}
+
+// InstructionFunc allows a function to be used as an InstructionPerformer
+type InstructionFunc func(f *Befunge) error
+
+func (i InstructionFunc) PerformInstruction(f *Befunge) error {
+	return i(f)
+}
+
+var (
+	fingerprintsLock sync.RWMutex
+	fingerprints     = make(map[int]*Fingerprint)
+)
+
+// RegisterFingerprint makes the fingerprint available to be loaded by Funge-98 programs. Registering a fingerprint with
+// the same name as an existing one replaces it. Like database/sql.Register, it panics if the fingerprint is invalid
+func RegisterFingerprint(fingerprint *Fingerprint) {
+	if fingerprint.Name == "" {
+		panic("fingerprint has no name")
+	}
+	for char := range fingerprint.Instructions {
+		if char < 'A' || char > 'Z' {
+			panic(fmt.Sprintf("fingerprint %s binds '%c', but can only bind A-Z", fingerprint.Name, char))
+		}
+	}
+	fingerprintsLock.Lock()
+	defer fingerprintsLock.Unlock()
+	fingerprints[fingerprint.ID()] = fingerprint
+}
+
+// LookupFingerprint finds the registered fingerprint with the given ID
+func LookupFingerprint(id int) (*Fingerprint, bool) {
+	fingerprintsLock.RLock()
+	defer fingerprintsLock.RUnlock()
+	fingerprint, ok := fingerprints[id]
+	return fingerprint, ok
+}
+
+// FingerprintState the state kept by the named fingerprint for this program, created using init on first use. This lets
+// fingerprints keep state between instructions without it being shared between programs
+func (f *Befunge) FingerprintState(name string, init func() any) any {
+	state, ok := f.fingerprintState[name]
+	if !ok {
+		state = init()
+		f.fingerprintState[name] = state
+	}
+	return state
+}
+
+// popFingerprint pops a count and then that many cells, finding the fingerprint they identify. Once the stack is empty
+// the rest of the cells are zeros, which each shift the ID a byte further, so that no more than 8 of them matter
+func (f *Befunge) popFingerprint() (*Fingerprint, bool) {
+	count, ok := f.popInt()
+	if !ok || count <= 0 {
+		return nil, false
+	}
+	id := 0
+	for i := range count {
+		cell, ok := f.Stack.Pop()
+		if !ok {
+			for range min(count-i, 8) {
+				id *= 256
+			}
+			break
+		}
+		id = id*256 + int(rune(cell))
+	}
+	return LookupFingerprint(id)
+}
+
+type loadFingerprint struct {
+}
+
+func (l loadFingerprint) PerformInstruction(f *Befunge) error {
+	fingerprint, ok := f.popFingerprint()
+	if !ok {
+		return reflect{}.PerformInstruction(f)
+	}
+	f.saveSemantics()
+	for char, instruction := range fingerprint.Instructions {
+		f.semantics[char-'A'].Push(instruction)
+	}
+	f.Stack.Push(fingerprint.ID())
+	f.Stack.Push(1)
+	return nil
+}
+
+type unloadFingerprint struct {
+}
+
+func (u unloadFingerprint) PerformInstruction(f *Befunge) error {
+	fingerprint, ok := f.popFingerprint()
+	if !ok {
+		return reflect{}.PerformInstruction(f)
+	}
+	f.saveSemantics()
+	// unloading pops the semantics for each of the fingerprint's instructions, whichever fingerprint they came from
+	for char := range fingerprint.Instructions {
+		f.semantics[char-'A'].Pop()
+	}
+	return nil
+}
+
+// semantic one of the instructions A-Z, whose meaning depends on the loaded fingerprints
+type semantic struct {
+	char rune
+}
+
+func (s semantic) PerformInstruction(f *Befunge) error {
+	instruction, ok := f.semantics[s.char-'A'].Peek()
+	if !ok {
+		return reflect{}.PerformInstruction(f)
+	}
+	return instruction.PerformInstruction(f)
+}
@@ -0,0 +1,401 @@
+package pkg
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// the fingerprints built in to kagofunge
+func init() {
+	RegisterFingerprint(nullFingerprint())
+	RegisterFingerprint(romaFingerprint())
+	RegisterFingerprint(moduFingerprint())
+	RegisterFingerprint(boolFingerprint())
+	RegisterFingerprint(fixpFingerprint())
+	RegisterFingerprint(strnFingerprint())
+	RegisterFingerprint(orthFingerprint())
+	RegisterFingerprint(refcFingerprint())
+}
+
+// pushing creates an instruction which pushes a constant
+func pushing(val int) InstructionPerformer {
+	return num{val: val}
+}
+
+// unary creates an instruction which pops a value and pushes the result of the operator. It reflects when the value
+// is a bignum too big for an int
+func unary(operator func(int) int) InstructionPerformer {
+	return InstructionFunc(func(f *Befunge) error {
+		a, ok := f.popInt()
+		if !ok {
+			return reflect{}.PerformInstruction(f)
+		}
+		return pushing(operator(a)).PerformInstruction(f)
+	})
+}
+
+// binary creates an instruction which pops b and then a, and pushes the result of the operator. It reflects when
+// either is a bignum too big for an int
+func binary(operator func(a int, b int) int) InstructionPerformer {
+	return InstructionFunc(func(f *Befunge) error {
+		b, bFits := f.popInt()
+		a, aFits := f.popInt()
+		if !aFits || !bFits {
+			return reflect{}.PerformInstruction(f)
+		}
+		return pushing(operator(a, b)).PerformInstruction(f)
+	})
+}
+
+// NULL binds every instruction to reflect
+func nullFingerprint() *Fingerprint {
+	instructions := make(map[rune]InstructionPerformer)
+	for char := 'A'; char <= 'Z'; char++ {
+		instructions[char] = reflect{}
+	}
+	return &Fingerprint{Name: "NULL", Instructions: instructions}
+}
+
+// ROMA pushes the values of roman numerals
+func romaFingerprint() *Fingerprint {
+	return &Fingerprint{Name: "ROMA", Instructions: map[rune]InstructionPerformer{
+		'C': pushing(100),
+		'D': pushing(500),
+		'I': pushing(1),
+		'L': pushing(50),
+		'M': pushing(1000),
+		'V': pushing(5),
+		'X': pushing(10),
+	}}
+}
+
+// MODU alternative modulus operations. Each gives 0 when the divisor is 0
+func moduFingerprint() *Fingerprint {
+	modulus := func(operator func(a int, b int) int) InstructionPerformer {
+		return binary(func(a int, b int) int {
+			if b == 0 {
+				return 0
+			}
+			return operator(a, b)
+		})
+	}
+	return &Fingerprint{Name: "MODU", Instructions: map[rune]InstructionPerformer{
+		// signed result, with the same sign as the divisor
+		'M': modulus(func(a int, b int) int {
+			r := a % b
+			if r != 0 && (r < 0) != (b < 0) {
+				r += b
+			}
+			return r
+		}),
+		// unsigned result
+		'U': modulus(func(a int, b int) int {
+			r := a % b
+			if r < 0 {
+				r += abs(b)
+			}
+			return r
+		}),
+		// C style remainder, with the same sign as the dividend
+		'R': modulus(func(a int, b int) int {
+			return a % b
+		}),
+	}}
+}
+
+// BOOL bitwise logic operations
+func boolFingerprint() *Fingerprint {
+	return &Fingerprint{Name: "BOOL", Instructions: map[rune]InstructionPerformer{
+		'A': binary(func(a int, b int) int { return a & b }),
+		'N': unary(func(a int) int { return ^a }),
+		'O': binary(func(a int, b int) int { return a | b }),
+		'X': binary(func(a int, b int) int { return a ^ b }),
+	}}
+}
+
+// FIXP fixed point maths, where values are scaled by 10000 and angles are in degrees
+func fixpFingerprint() *Fingerprint {
+	const scale = 10000.0
+	toRadians := func(a int) float64 {
+		return float64(a) / scale * math.Pi / 180
+	}
+	trig := func(fun func(float64) float64) InstructionPerformer {
+		return unary(func(a int) int {
+			return int(math.Round(fun(toRadians(a)) * scale))
+		})
+	}
+	inverseTrig := func(fun func(float64) float64) InstructionPerformer {
+		return unary(func(a int) int {
+			return int(math.Round(fun(float64(a)/scale) * 180 / math.Pi * scale))
+		})
+	}
+	return &Fingerprint{Name: "FIXP", Instructions: map[rune]InstructionPerformer{
+		'A': binary(func(a int, b int) int { return a & b }),
+		'B': inverseTrig(math.Acos),
+		'C': trig(math.Cos),
+		'D': InstructionFunc(func(f *Befunge) error {
+			a, ok := f.popInt()
+			switch {
+			case !ok:
+				return reflect{}.PerformInstruction(f)
+			case a > 0:
+				return pushing(f.randomInt(a)).PerformInstruction(f)
+			case a < 0:
+				// -math.MinInt doesn't fit in an int, so its range is one short
+				return pushing(-f.randomInt(-max(a, -math.MaxInt))).PerformInstruction(f)
+			default:
+				f.Stack.Push(0)
+			}
+			return nil
+		}),
+		'I': trig(math.Sin),
+		'J': inverseTrig(math.Asin),
+		'N': unary(func(a int) int { return -a }),
+		'O': binary(func(a int, b int) int { return a | b }),
+		'P': unary(func(a int) int { return int(float64(a) * math.Pi) }),
+		'Q': unary(func(a int) int { return int(math.Sqrt(float64(a))) }),
+		'R': binary(func(a int, b int) int { return int(math.Pow(float64(a), float64(b))) }),
+		'S': unary(func(a int) int {
+			switch {
+			case a > 0:
+				return 1
+			case a < 0:
+				return -1
+			default:
+				return 0
+			}
+		}),
+		'T': trig(math.Tan),
+		'U': inverseTrig(math.Atan),
+		'V': unary(abs),
+		'X': binary(func(a int, b int) int { return a ^ b }),
+	}}
+}
+
+// STRN operations on null terminated strings
+func strnFingerprint() *Fingerprint {
+	return &Fingerprint{Name: "STRN", Instructions: map[rune]InstructionPerformer{
+		// append the second string to the top string
+		'A': InstructionFunc(func(f *Befunge) error {
+			top, second := popString(f.Stack), popString(f.Stack)
+			pushString(f.Stack, top+second)
+			return nil
+		}),
+		'C': InstructionFunc(func(f *Befunge) error {
+			top, second := popString(f.Stack), popString(f.Stack)
+			f.Stack.Push(strings.Compare(top, second))
+			return nil
+		}),
+		'D': InstructionFunc(func(f *Befunge) error {
+			_, err := f.writer.Write([]byte(popString(f.Stack)))
+			if err != nil {
+				f.halted = true
+			}
+			return err
+		}),
+		// find the second string within the top string, leaving the remainder of the top string from the match
+		'F': InstructionFunc(func(f *Befunge) error {
+			top, second := popString(f.Stack), popString(f.Stack)
+			i := strings.Index(top, second)
+			if i < 0 {
+				pushString(f.Stack, "")
+			} else {
+				pushString(f.Stack, top[i:])
+			}
+			return nil
+		}),
+		'G': InstructionFunc(func(f *Befunge) error {
+			position, ok := f.popVector()
+			if !ok {
+				return reflect{}.PerformInstruction(f)
+			}
+			position = position.Add(f.StorageOffset)
+			var str strings.Builder
+			// strings in funge-space can't be longer than the program, otherwise this would never end
+			least, greatest := f.Space.Bounds()
+			for range (greatest.X - least.X + 1) * (greatest.Y - least.Y + 1) * (greatest.Z - least.Z + 1) {
+				c := f.Space.Get(position)
+				if c == 0 {
+					break
+				}
+				str.WriteRune(c)
+				position = position.Add(XPos())
+			}
+			pushString(f.Stack, str.String())
+			return nil
+		}),
+		'I': InstructionFunc(func(f *Befunge) error {
+			line, err := f.reader.ReadString('\n')
+			if err != nil && line == "" {
+				return reflect{}.PerformInstruction(f)
+			}
+			pushString(f.Stack, strings.TrimRight(line, "\r\n"))
+			return nil
+		}),
+		'L': InstructionFunc(func(f *Befunge) error {
+			n, ok := f.popInt()
+			str := []rune(popString(f.Stack))
+			if !ok {
+				return reflect{}.PerformInstruction(f)
+			}
+			pushString(f.Stack, string(str[:max(0, min(n, len(str)))]))
+			return nil
+		}),
+		'M': InstructionFunc(func(f *Befunge) error {
+			n, nFits := f.popInt()
+			start, startFits := f.popInt()
+			str := []rune(popString(f.Stack))
+			if !nFits || !startFits {
+				return reflect{}.PerformInstruction(f)
+			}
+			start = max(0, min(start, len(str)))
+			pushString(f.Stack, string(str[start:max(start, min(start+n, len(str)))]))
+			return nil
+		}),
+		'N': InstructionFunc(func(f *Befunge) error {
+			str := popString(f.Stack)
+			pushString(f.Stack, str)
+			f.Stack.Push(len([]rune(str)))
+			return nil
+		}),
+		'P': InstructionFunc(func(f *Befunge) error {
+			position, ok := f.popVector()
+			if !ok {
+				return reflect{}.PerformInstruction(f)
+			}
+			position = position.Add(f.StorageOffset)
+			for _, c := range popString(f.Stack) + "\x00" {
+				f.Space.Put(position, c)
+				position = position.Add(XPos())
+			}
+			return nil
+		}),
+		'R': InstructionFunc(func(f *Befunge) error {
+			n, ok := f.popInt()
+			str := []rune(popString(f.Stack))
+			if !ok {
+				return reflect{}.PerformInstruction(f)
+			}
+			pushString(f.Stack, string(str[len(str)-max(0, min(n, len(str))):]))
+			return nil
+		}),
+		'S': InstructionFunc(func(f *Befunge) error {
+			pushString(f.Stack, f.CellValue(f.stackPop()).String())
+			return nil
+		}),
+		'V': InstructionFunc(func(f *Befunge) error {
+			v, _ := strconv.Atoi(strings.TrimSpace(popString(f.Stack)))
+			f.Stack.Push(v)
+			return nil
+		}),
+	}}
+}
+
+// ORTH orthogonal easement, giving direct access to the instruction pointer and operations in x, y order
+func orthFingerprint() *Fingerprint {
+	return &Fingerprint{Name: "ORTH", Instructions: map[rune]InstructionPerformer{
+		'A': binary(func(a int, b int) int { return a & b }),
+		'E': binary(func(a int, b int) int { return a ^ b }),
+		'G': InstructionFunc(func(f *Befunge) error {
+			x, xFits := f.popInt()
+			y, yFits := f.popInt()
+			if !xFits || !yFits {
+				return reflect{}.PerformInstruction(f)
+			}
+			f.Stack.Push(int(f.Space.Get(NewVector3(x, y, 0).Add(f.StorageOffset))))
+			return nil
+		}),
+		'O': binary(func(a int, b int) int { return a | b }),
+		'P': InstructionFunc(func(f *Befunge) error {
+			x, xFits := f.popInt()
+			y, yFits := f.popInt()
+			v, err := f.spaceCell(f.stackPop())
+			if err != nil {
+				f.halted = true
+				return err
+			}
+			if !xFits || !yFits {
+				return reflect{}.PerformInstruction(f)
+			}
+			f.Space.Put(NewVector3(x, y, 0).Add(f.StorageOffset), v)
+			return nil
+		}),
+		'S': InstructionFunc(func(f *Befunge) error {
+			_, err := f.writer.Write([]byte(popString(f.Stack)))
+			if err != nil {
+				f.halted = true
+			}
+			return err
+		}),
+		'V': InstructionFunc(func(f *Befunge) error {
+			v, ok := f.popInt()
+			if !ok {
+				return reflect{}.PerformInstruction(f)
+			}
+			f.delta = NewVector3(v, f.delta.Y, f.delta.Z)
+			return nil
+		}),
+		'W': InstructionFunc(func(f *Befunge) error {
+			v, ok := f.popInt()
+			if !ok {
+				return reflect{}.PerformInstruction(f)
+			}
+			f.delta = NewVector3(f.delta.X, v, f.delta.Z)
+			return nil
+		}),
+		'X': InstructionFunc(func(f *Befunge) error {
+			v, ok := f.popInt()
+			if !ok {
+				return reflect{}.PerformInstruction(f)
+			}
+			f.InstructionPointer = NewVector3(v, f.InstructionPointer.Y, f.InstructionPointer.Z)
+			return nil
+		}),
+		'Y': InstructionFunc(func(f *Befunge) error {
+			v, ok := f.popInt()
+			if !ok {
+				return reflect{}.PerformInstruction(f)
+			}
+			f.InstructionPointer = NewVector3(f.InstructionPointer.X, v, f.InstructionPointer.Z)
+			return nil
+		}),
+		'Z': InstructionFunc(func(f *Befunge) error {
+			if f.stackPop() == 0 {
+				f.move()
+			}
+			return nil
+		}),
+	}}
+}
+
+// REFC references, which let vectors be stored as single cells
+func refcFingerprint() *Fingerprint {
+	const name = "REFC"
+	references := func(f *Befunge) *[]*Vector {
+		return f.FingerprintState(name, func() any {
+			return new([]*Vector)
+		}).(*[]*Vector)
+	}
+	return &Fingerprint{Name: name, Instructions: map[rune]InstructionPerformer{
+		'D': InstructionFunc(func(f *Befunge) error {
+			refs := references(f)
+			i, ok := f.popInt()
+			if !ok || i < 0 || i >= len(*refs) {
+				return reflect{}.PerformInstruction(f)
+			}
+			pushVector(f.Stack, (*refs)[i], f.dimensions)
+			return nil
+		}),
+		'R': InstructionFunc(func(f *Befunge) error {
+			refs := references(f)
+			v, ok := f.popVector()
+			if !ok {
+				return reflect{}.PerformInstruction(f)
+			}
+			*refs = append(*refs, v)
+			f.Stack.Push(len(*refs) - 1)
+			return nil
+		}),
+	}}
+}
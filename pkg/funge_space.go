@@ -0,0 +1,19 @@
+package pkg
+
+// FungeSpace the space that a program's instructions are loaded into and executed from. The dense Torus is used by
+// Befunge-93, while Funge-98 uses the unbounded LaheySpace
+type FungeSpace interface {
+	// Get the character at the given position. Positions outside the space are wrapped into it
+	Get(position *Vector) rune
+	// Put sets the character at the given position. Positions outside the space are wrapped into it
+	Put(position *Vector, v rune)
+	// Contains whether the position can be accessed by p and g without being out of bounds
+	Contains(position *Vector) bool
+	// Next the position reached by travelling from position by delta, wrapping around the space if needed
+	Next(position *Vector, delta *Vector) *Vector
+	// Bounds the least and greatest points (inclusive) of the box containing the program
+	Bounds() (least *Vector, greatest *Vector)
+	// Instruction the instruction in the cell at the given position, decoded using decode. Decoded instructions are kept
+	// alongside the cells until they are next put, so decode must always give the same instruction for a character
+	Instruction(position *Vector, decode func(rune) InstructionPerformer) InstructionPerformer
+}
@@ -0,0 +1,221 @@
+package pkg
+
+import (
+	"bufio"
+	"io"
+	"maps"
+	"math/big"
+	"slices"
+)
+
+// Undo the changes made by a single step, which can be reverted with Befunge.Revert. Fingerprint state, such as REFC's
+// references, and anything outside the program, such as files written by o, are not reverted
+type Undo struct {
+	ip       *IP
+	ips      []*IP
+	states   []ipState
+	nextIPID int
+	exitCode int
+	puts     []PutEvent
+	bounds   *laheyBounds     // the bounds of Lahey-space before the step, if it put any cells
+	boxes    map[int]*big.Int // bignums swept during the step
+	input    int              // how much input had been consumed before the step, including any discarded since
+	output   []byte
+}
+
+// ipState the state of an instruction pointer before a step
+type ipState struct {
+	ip            *IP
+	position      Vector
+	delta         Vector
+	storageOffset Vector
+	stringMode    bool
+	terminated    bool
+	stacks        []*Stack[int] // each of which is watched until the step is finished, and its changes reduced to deltas
+	deltas        []stackDelta
+	semantics     *[26]Stack[InstructionPerformer] // only saved when the step loads or unloads a fingerprint
+}
+
+// laheyBounds the bounds of Lahey-space, which only ever grow until a step which grew them is reverted
+type laheyBounds struct {
+	least    Vector
+	greatest Vector
+	empty    bool
+}
+
+// stackDelta reverts a stack by truncating it to length and then pushing values
+type stackDelta struct {
+	stack  *Stack[int]
+	length int
+	values []int
+}
+
+// inputLog records the input read, so that the input consumed by reverted steps can be read again
+type inputLog struct {
+	r         io.Reader
+	read      []byte // everything read since discarded, including input which has been buffered but not yet consumed
+	pending   []byte // input to read again before reading any more from r
+	discarded int    // how much was read before read, which is no longer needed
+}
+
+// discard drops the first n bytes read
+func (l *inputLog) discard(n int) {
+	l.read = append(l.read[:0], l.read[n:]...)
+	l.discarded += n
+}
+
+func (l *inputLog) Read(p []byte) (int, error) {
+	var n int
+	var err error
+	if len(l.pending) > 0 {
+		n = copy(p, l.pending)
+		l.pending = l.pending[n:]
+	} else {
+		n, err = l.r.Read(p)
+	}
+	l.read = append(l.read, p[:n]...)
+	return n, err
+}
+
+// outputLog records the output written
+type outputLog struct {
+	w       io.Writer
+	written []byte
+}
+
+func (l *outputLog) Write(p []byte) (int, error) {
+	n, err := l.w.Write(p)
+	l.written = append(l.written, p[:n]...)
+	return n, err
+}
+
+// Output the output written during the step, which can't be taken back by reverting it
+func (u *Undo) Output() []byte {
+	return u.output
+}
+
+// Puts the cells put during the step, in the order they were put
+func (u *Undo) Puts() []PutEvent {
+	return u.puts
+}
+
+// StepWithUndo processes the next tick like Step, also returning an Undo which reverts it
+func (f *Befunge) StepWithUndo() (bool, *Undo, error) {
+	f.logIO()
+	f.listenToPuts()
+	u := &Undo{ip: f.IP, ips: slices.Clone(f.IPs), nextIPID: f.nextIPID, exitCode: f.exitCode,
+		input: f.input.discarded + f.consumedInput()}
+	for _, ip := range f.IPs {
+		u.states = append(u.states, saveIP(ip))
+	}
+	f.output.written = nil
+	f.undo = u
+	proceed, err := f.Step()
+	f.undo = nil
+	u.output = f.output.written
+	for i := range u.states {
+		u.states[i].reduce()
+	}
+	return proceed, u, err
+}
+
+// logIO starts recording the input read and the output written, if they aren't already being recorded
+func (f *Befunge) logIO() {
+	if f.input == nil {
+		f.input = &inputLog{r: f.reader}
+		f.reader = bufio.NewReader(f.input)
+		f.output = &outputLog{w: f.writer}
+		f.writer = f.output
+	}
+}
+
+// consumedInput how much of the input log has been consumed by the program, rather than just buffered
+func (f *Befunge) consumedInput() int {
+	return len(f.input.read) - f.reader.Buffered()
+}
+
+// Revert undoes a step, which must be the latest step which hasn't been reverted
+func (f *Befunge) Revert(u *Undo) {
+	f.reverting = true
+	for _, put := range slices.Backward(u.puts) {
+		f.Space.Put(&put.Position, put.Old)
+	}
+	f.reverting = false
+	if lahey, ok := f.Space.(*listenedSpace).FungeSpace.(*LaheySpace); ok && u.bounds != nil {
+		lahey.least, lahey.greatest, lahey.empty = u.bounds.least, u.bounds.greatest, u.bounds.empty
+	}
+	for _, s := range u.states {
+		s.restore()
+	}
+	f.IP, f.IPs, f.nextIPID, f.exitCode, f.halted = u.ip, u.ips, u.nextIPID, u.exitCode, false
+	maps.Copy(f.boxes, u.boxes)
+	// the input consumed during the step, and anything buffered since, is read again
+	start := u.input - f.input.discarded
+	f.input.pending = append(slices.Clone(f.input.read[start:]), f.input.pending...)
+	f.input.read = f.input.read[:start]
+	f.reader.Reset(f.input)
+}
+
+// Forget discards the input kept to revert the steps before u, once they will no longer be reverted
+func (f *Befunge) Forget(u *Undo) {
+	if n := u.input - f.input.discarded; n > 0 {
+		f.input.discard(n)
+	}
+}
+
+// saveIP saves the state of the instruction pointer before a step. Its stacks are watched rather than copied, so that
+// only the values the step pops need to be kept
+func saveIP(ip *IP) ipState {
+	s := ipState{
+		ip:            ip,
+		position:      *ip.InstructionPointer,
+		delta:         *ip.delta,
+		storageOffset: *ip.StorageOffset,
+		stringMode:    ip.StringMode,
+		terminated:    ip.terminated,
+		stacks:        slices.Clone(ip.Stacks.Stacks),
+	}
+	for _, stack := range s.stacks {
+		stack.startWatching()
+	}
+	return s
+}
+
+// saveSemantics saves the loaded fingerprints of the current instruction pointer before the step changes them, if it
+// can be undone
+func (f *Befunge) saveSemantics() {
+	if f.undo == nil {
+		return
+	}
+	for i := range f.undo.states {
+		if s := &f.undo.states[i]; s.ip == f.IP && s.semantics == nil {
+			s.semantics = new([26]Stack[InstructionPerformer])
+			for j, semantics := range f.IP.semantics {
+				s.semantics[j] = *semantics.Clone()
+			}
+		}
+	}
+}
+
+// reduce stops watching each stack, keeping the changes needed to revert it from its values after the step
+func (s *ipState) reduce() {
+	for _, stack := range s.stacks {
+		if length, values, changed := stack.stopWatching(); changed {
+			s.deltas = append(s.deltas, stackDelta{stack: stack, length: length, values: values})
+		}
+	}
+}
+
+func (s *ipState) restore() {
+	ip := s.ip
+	ip.InstructionPointer, ip.delta, ip.StorageOffset = &s.position, &s.delta, &s.storageOffset
+	ip.StringMode, ip.terminated = s.stringMode, s.terminated
+	if s.semantics != nil {
+		ip.semantics = *s.semantics
+	}
+	for _, d := range s.deltas {
+		d.stack.Values = append(d.stack.Values[:d.length], d.values...)
+	}
+	ip.Stacks.Stacks = slices.Clone(s.stacks)
+	ip.Stack = ip.Stacks.TOSS()
+}
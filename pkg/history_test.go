@@ -0,0 +1,149 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/kagof/kagofunge/config"
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// snapshot describes everything about the state of the program which reverting a step should restore
+func snapshot(f *Befunge) string {
+	var sb strings.Builder
+	for _, ip := range f.IPs {
+		_, _ = fmt.Fprintf(&sb, "ip %d at %s delta %s offset %s string %t stacks", ip.ID, ip.InstructionPointer,
+			ip.delta, ip.StorageOffset, ip.StringMode)
+		for _, stack := range ip.Stacks.Stacks {
+			_, _ = fmt.Fprintf(&sb, " %v", stack.Values)
+		}
+		sb.WriteString(" semantics")
+		for _, semantics := range ip.semantics {
+			_, _ = fmt.Fprintf(&sb, " %d", len(semantics.Values))
+		}
+		sb.WriteRune('\n')
+	}
+	_, _ = fmt.Fprintf(&sb, "current %d next %d\n", f.IP.ID, f.nextIPID)
+	least, greatest := f.Space.Bounds()
+	for z := least.Z; z <= greatest.Z; z++ {
+		for y := least.Y; y <= greatest.Y; y++ {
+			for x := least.X; x <= greatest.X; x++ {
+				sb.WriteRune(f.Space.Get(NewVector3(x, y, z)))
+			}
+			sb.WriteRune('\n')
+		}
+	}
+	return sb.String()
+}
+
+func TestBefunge_Revert(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range engineCases {
+		widths := []config.CellWidth{config.CellWidth64}
+		if test.dialect == config.Dialect93 {
+			widths = append(widths, config.CellWidthBignum)
+		}
+		for _, width := range widths {
+			t.Run(string(test.dialect)+"/"+string(width)+"/"+test.name,
+				func(t *testing.T) {
+					t.Parallel()
+					asserts := assert.New(t)
+					cfg := config.DefaultConfig()
+					cfg.Interpreter.Dialect, cfg.Interpreter.CellWidth = test.dialect, width
+					expected, _ := runProgram(t, &cfg, test.funge, test.input)
+					var writer strings.Builder
+					befunge := NewBefunge(&cfg, test.funge, &writer, strings.NewReader(test.input))
+
+					var snapshots []string
+					var undos []*Undo
+					hasNext := true
+					for hasNext && len(undos) < maxSteps {
+						snapshots = append(snapshots, snapshot(befunge))
+						var undo *Undo
+						var err error
+						hasNext, undo, err = befunge.StepWithUndo()
+						asserts.NoError(err)
+						undos = append(undos, undo)
+					}
+					output := ""
+					for i := len(undos) - 1; i >= 0; i-- {
+						befunge.Revert(undos[i])
+						output = string(undos[i].Output()) + output
+						if !asserts.Equal(snapshots[i], snapshot(befunge), "reverting step %d", i) {
+							return
+						}
+					}
+					asserts.Equal(expected, output, "the output of the reverted steps should be the whole output")
+
+					// running the program again reads the same input, so gives the same output
+					writer.Reset()
+					for hasNext = true; hasNext; {
+						var err error
+						hasNext, _, err = befunge.StepWithUndo()
+						asserts.NoError(err)
+					}
+					asserts.Equal(expected, writer.String())
+				})
+		}
+	}
+}
+
+func TestBefunge_Revert_input(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	cfg := config.DefaultConfig()
+	var writer strings.Builder
+	// reads and prints two numbers
+	befunge := NewBefunge(&cfg, "&.&.@", &writer, strings.NewReader("12\n34\n"))
+	_, first, _ := befunge.StepWithUndo()
+	_, second, _ := befunge.StepWithUndo()
+	_, third, _ := befunge.StepWithUndo()
+	asserts.Equal("12", writer.String())
+	befunge.Revert(third)
+	asserts.Empty(befunge.Stack.Values)
+	_, third, _ = befunge.StepWithUndo()
+	asserts.Equal([]int{34}, befunge.Stack.Values, "reverting should let the input be read again")
+	befunge.Revert(third)
+	befunge.Revert(second)
+	asserts.Equal([]int{12}, befunge.Stack.Values)
+	befunge.Revert(first)
+	asserts.Empty(befunge.Stack.Values)
+	asserts.Equal(*NewVector2(0, 0), *befunge.InstructionPointer)
+	for hasNext := true; hasNext; {
+		hasNext, _, _ = befunge.StepWithUndo()
+	}
+	asserts.Equal("121234", writer.String(), "all the input should be read again from the start")
+}
+
+func TestBefunge_Forget(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	cfg := config.DefaultConfig()
+	var writer strings.Builder
+	// echoes its input
+	befunge := NewBefunge(&cfg, "~:!#@_,", &writer, strings.NewReader(strings.Repeat("abcdefgh", 1000)))
+	var undos []*Undo
+	for hasNext := true; hasNext; {
+		var undo *Undo
+		hasNext, undo, _ = befunge.StepWithUndo()
+		undos = append(undos, undo)
+		if len(undos) > 13 {
+			undos = undos[1:]
+			befunge.Forget(undos[0])
+		}
+		asserts.LessOrEqual(befunge.consumedInput(), 13, "only the input of the last 13 steps should be kept")
+	}
+	for _, undo := range slices.Backward(undos) {
+		befunge.Revert(undo)
+	}
+	writer.Reset()
+	for hasNext := true; hasNext; {
+		hasNext, _ = befunge.Step()
+	}
+	// back to printing the g, before the h was read
+	asserts.Equal("gh", writer.String(), "the input of the steps still in the history should be read again")
+}
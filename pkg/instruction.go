@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"github.com/kagof/kagofunge/config"
 	"io"
-	"math/rand/v2"
+	"math/big"
 	"strconv"
 	"strings"
 )
@@ -28,18 +28,40 @@ type num struct {
 }
 
 func (n num) PerformInstruction(f *Befunge) error {
-	f.Stack.Push(n.val)
+	v, err := f.fit(n.val)
+	if err != nil {
+		f.halted = true
+		return err
+	}
+	f.Stack.Push(v)
 	return nil
 }
 
 type op2 struct {
-	operator      func(int, int) (int, error)
+	operator func(int, int) (int, error)
+	// exact performs the operation without overflowing, for when operator might. Returns nil when dividing by zero
+	exact         func(*big.Int, *big.Int) *big.Int
 	div0ConfigVal func(*Befunge) config.DivideByZeroBehaviour
 }
 
 func (o op2) PerformInstruction(f *Befunge) error {
 	a, b := f.stackPop(), f.stackPop()
-	res, err := o.operator(a, b)
+	var res int
+	var err error
+	if o.exact == nil || f.wrapsNatively() || fitsInHalfWidth(a) && fitsInHalfWidth(b) {
+		res, err = o.operator(a, b)
+		if err == nil {
+			res, err = f.fit(res)
+		}
+	} else if exact := o.exact(f.CellValue(a), f.CellValue(b)); exact != nil {
+		res, err = f.cell(exact)
+	} else {
+		err = errors.New("divide by zero")
+	}
+	if errors.Is(err, errOverflow) {
+		f.halted = true
+		return err
+	}
 	if err != nil {
 		if strings.Contains(err.Error(), "divide by zero") {
 			switch o.div0ConfigVal(f) {
@@ -49,8 +71,7 @@ func (o op2) PerformInstruction(f *Befunge) error {
 				f.Stack.Push(0)
 				return nil
 			case config.Div0Reflect:
-				f.InstructionPointer = f.InstructionPointer.Multiply(-1)
-				return nil
+				return reflect{}.PerformInstruction(f)
 			case config.Div0Panic:
 				fallthrough
 			default:
@@ -78,7 +99,7 @@ func (n not) PerformInstruction(f *Befunge) error {
 }
 
 type dir struct {
-	delta func() *Vector2
+	delta func() *Vector
 }
 
 func (d dir) PerformInstruction(f *Befunge) error {
@@ -86,9 +107,19 @@ func (d dir) PerformInstruction(f *Befunge) error {
 	return nil
 }
 
+// random sends the instruction pointer in one of the directions, chosen by the Befunge's random source
+type random struct {
+	directions []func() *Vector
+}
+
+func (r random) PerformInstruction(f *Befunge) error {
+	f.delta = r.directions[f.randomInt(len(r.directions))]()
+	return nil
+}
+
 type conditionalDir struct {
-	zeroDir func() *Vector2
-	elseDir func() *Vector2
+	zeroDir func() *Vector
+	elseDir func() *Vector
 }
 
 func (d conditionalDir) PerformInstruction(f *Befunge) error {
@@ -127,11 +158,11 @@ func (d discard) PerformInstruction(f *Befunge) error {
 }
 
 type write struct {
-	writeFun func(io.Writer, int) (int, error)
+	writeFun func(*Befunge, io.Writer, int) (int, error)
 }
 
 func (w write) PerformInstruction(f *Befunge) error {
-	_, err := w.writeFun(f.writer, f.stackPop())
+	_, err := w.writeFun(f, f.writer, f.stackPop())
 	if err != nil {
 		f.halted = true
 		return err
@@ -143,7 +174,7 @@ type skip struct {
 }
 
 func (s skip) PerformInstruction(f *Befunge) error {
-	f.delta = f.delta.Add(f.delta)
+	f.move()
 	return nil
 }
 
@@ -151,15 +182,25 @@ type put struct {
 }
 
 func (p put) PerformInstruction(f *Befunge) error {
-	y, x, v := f.stackPop(), f.stackPop(), rune(f.stackPop())
-	if y >= f.Torus.Height || y < 0 || x >= f.Torus.Width || x < 0 {
+	position, fits := f.popVector()
+	v, err := f.spaceCell(f.stackPop())
+	if err != nil {
+		f.halted = true
+		return err
+	}
+	if !fits && f.is98() {
+		return reflect{}.PerformInstruction(f)
+	}
+	position = position.Add(f.StorageOffset)
+	// a coordinate too big for an int is out of bounds
+	if !fits || !f.Space.Contains(position) {
 		switch f.Config.PutOutOfBoundsBehaviour {
 		case config.OobZero:
 			fallthrough // zero isn't meaningful for put
 		case config.OobNoOp:
 			return nil
 		case config.OobWrap:
-			f.Torus.SetCharAt(x, y, v)
+			f.Space.Put(position, v)
 			return nil
 		case config.OobPanic:
 			fallthrough
@@ -168,7 +209,7 @@ func (p put) PerformInstruction(f *Befunge) error {
 			return errors.New("put index out of bounds")
 		}
 	}
-	f.Torus.SetCharAt(x, y, v)
+	f.Space.Put(position, v)
 	return nil
 }
 
@@ -176,8 +217,13 @@ type get struct {
 }
 
 func (g get) PerformInstruction(f *Befunge) error {
-	y, x := f.stackPop(), f.stackPop()
-	if y >= f.Torus.Height || y < 0 || x >= f.Torus.Width || x < 0 {
+	position, fits := f.popVector()
+	if !fits && f.is98() {
+		return reflect{}.PerformInstruction(f)
+	}
+	position = position.Add(f.StorageOffset)
+	// a coordinate too big for an int is out of bounds
+	if !fits || !f.Space.Contains(position) {
 		switch f.Config.GetOutOfBoundsBehaviour {
 		case config.OobZero:
 			f.Stack.Push(0)
@@ -185,8 +231,7 @@ func (g get) PerformInstruction(f *Befunge) error {
 		case config.OobNoOp:
 			return nil
 		case config.OobWrap:
-			f.Stack.Push(int(f.Torus.CharAt(x, y)))
-			return nil
+			return g.push(f, position)
 		case config.OobPanic:
 			fallthrough
 		default:
@@ -194,7 +239,16 @@ func (g get) PerformInstruction(f *Befunge) error {
 			return errors.New("get index out of bounds")
 		}
 	}
-	f.Stack.Push(int(f.Torus.CharAt(x, y)))
+	return g.push(f, position)
+}
+
+func (g get) push(f *Befunge, position *Vector) error {
+	v, err := f.fit(int(f.Space.Get(position)))
+	if err != nil {
+		f.halted = true
+		return err
+	}
+	f.Stack.Push(v)
 	return nil
 }
 
@@ -204,6 +258,9 @@ type read struct {
 
 func (r read) PerformInstruction(f *Befunge) error {
 	i, err := r.readFun(f.reader)
+	if err == nil {
+		i, err = f.fit(i)
+	}
 	if err == nil {
 		f.Stack.Push(i)
 		return nil
@@ -217,7 +274,7 @@ type terminate struct {
 }
 
 func (t terminate) PerformInstruction(f *Befunge) error {
-	f.halted = true
+	f.terminated = true
 	return nil
 }
 
@@ -228,11 +285,14 @@ func (n noop) PerformInstruction(f *Befunge) error {
 	return nil
 }
 
-var intWrite = write{writeFun: func(w io.Writer, a int) (int, error) {
+var intWrite = write{writeFun: func(f *Befunge, w io.Writer, a int) (int, error) {
+	if f.isBoxed(a) {
+		return fmt.Fprint(w, f.CellValue(a))
+	}
 	return fmt.Fprintf(w, "%d", a)
 }}
 
-var charWrite = write{writeFun: func(w io.Writer, a int) (int, error) {
+var charWrite = write{writeFun: func(f *Befunge, w io.Writer, a int) (int, error) {
 	return fmt.Fprint(w, string(rune(a)))
 }}
 
@@ -281,14 +341,20 @@ func ParseInstruction(char rune) InstructionPerformer {
 	case char == '+':
 		return op2{operator: func(a int, b int) (int, error) {
 			return a + b, nil
+		}, exact: func(a *big.Int, b *big.Int) *big.Int {
+			return new(big.Int).Add(a, b)
 		}}
 	case char == '-':
 		return op2{operator: func(a int, b int) (int, error) {
 			return b - a, nil
+		}, exact: func(a *big.Int, b *big.Int) *big.Int {
+			return new(big.Int).Sub(b, a)
 		}}
 	case char == '*':
 		return op2{operator: func(a int, b int) (int, error) {
 			return a * b, nil
+		}, exact: func(a *big.Int, b *big.Int) *big.Int {
+			return new(big.Int).Mul(a, b)
 		}}
 	case char == '/':
 		return op2{
@@ -298,6 +364,12 @@ func ParseInstruction(char rune) InstructionPerformer {
 				}
 				return b / a, nil
 			},
+			exact: func(a *big.Int, b *big.Int) *big.Int {
+				if a.Sign() == 0 {
+					return nil
+				}
+				return new(big.Int).Quo(b, a)
+			},
 			div0ConfigVal: func(f *Befunge) config.DivideByZeroBehaviour {
 				return f.Config.DivideByZeroBehaviour
 			}}
@@ -309,6 +381,12 @@ func ParseInstruction(char rune) InstructionPerformer {
 				}
 				return b % a, nil
 			},
+			exact: func(a *big.Int, b *big.Int) *big.Int {
+				if a.Sign() == 0 {
+					return nil
+				}
+				return new(big.Int).Rem(b, a)
+			},
 			div0ConfigVal: func(f *Befunge) config.DivideByZeroBehaviour {
 				return f.Config.ModulusByZeroBehaviour
 			}}
@@ -317,38 +395,27 @@ func ParseInstruction(char rune) InstructionPerformer {
 	case char == '`':
 		return op2{operator: func(a int, b int) (int, error) {
 			return boolToInt(b > a), nil
+		}, exact: func(a *big.Int, b *big.Int) *big.Int {
+			return big.NewInt(int64(boolToInt(b.Cmp(a) > 0)))
 		}}
 	case char == '>':
-		return dir{delta: func() *Vector2 {
+		return dir{delta: func() *Vector {
 			return XPos()
 		}}
 	case char == '<':
-		return dir{delta: func() *Vector2 {
+		return dir{delta: func() *Vector {
 			return XNeg()
 		}}
 	case char == 'v':
-		return dir{delta: func() *Vector2 {
+		return dir{delta: func() *Vector {
 			return YPos()
 		}}
 	case char == '^':
-		return dir{delta: func() *Vector2 {
+		return dir{delta: func() *Vector {
 			return YNeg()
 		}}
 	case char == '?':
-		return dir{delta: func() *Vector2 {
-			switch rand.IntN(4) {
-			case 0:
-				return XPos()
-			case 1:
-				return XNeg()
-			case 2:
-				return YPos()
-			case 3:
-				fallthrough
-			default:
-				return YNeg()
-			}
-		}}
+		return random{directions: []func() *Vector{XPos, XNeg, YPos, YNeg}}
 	case char == '_':
 		return conditionalDir{
 			zeroDir: XPos,
@@ -0,0 +1,547 @@
+package pkg
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// flags reported in the first cell pushed by the y instruction
+const (
+	sysInfoConcurrent = 1 << iota
+	sysInfoFileInput
+	sysInfoFileOutput
+	sysInfoExecute
+	sysInfoUnbufferedIO
+)
+
+type reflect struct {
+}
+
+func (r reflect) PerformInstruction(f *Befunge) error {
+	f.delta = f.delta.Multiply(-1)
+	return nil
+}
+
+type turn struct {
+	left bool
+}
+
+func (t turn) PerformInstruction(f *Befunge) error {
+	if t.left {
+		f.delta = f.delta.TurnLeft()
+	} else {
+		f.delta = f.delta.TurnRight()
+	}
+	return nil
+}
+
+type compare struct {
+}
+
+func (c compare) PerformInstruction(f *Befunge) error {
+	b, a := f.stackPop(), f.stackPop()
+	switch f.CellValue(a).Cmp(f.CellValue(b)) {
+	case -1:
+		f.delta = f.delta.TurnLeft()
+	case 1:
+		f.delta = f.delta.TurnRight()
+	}
+	return nil
+}
+
+type absoluteDelta struct {
+}
+
+func (a absoluteDelta) PerformInstruction(f *Befunge) error {
+	delta, ok := f.popVector()
+	if !ok {
+		return reflect{}.PerformInstruction(f)
+	}
+	f.delta = delta
+	return nil
+}
+
+type jump struct {
+}
+
+func (j jump) PerformInstruction(f *Befunge) error {
+	n, ok := f.popInt()
+	if !ok {
+		return reflect{}.PerformInstruction(f)
+	}
+	f.InstructionPointer = f.positionAtOffset(f.delta.Multiply(n))
+	return nil
+}
+
+type iterate struct {
+}
+
+func (k iterate) PerformInstruction(f *Befunge) error {
+	n, ok := f.popInt()
+	if !ok || n < 0 {
+		return reflect{}.PerformInstruction(f)
+	}
+	next := f.nextInstructionPosition()
+	if n == 0 {
+		// skip over the next instruction entirely
+		f.InstructionPointer = next
+		return nil
+	}
+	current := f.InstructionPointer
+	instruction := f.Space.Instruction(next, f.parseInstruction)
+	for range n {
+		err := instruction.PerformInstruction(f)
+		if err != nil || f.halted {
+			return err
+		}
+	}
+	if *f.InstructionPointer == *current {
+		// the iterated instruction has been executed, so the instruction pointer skips over it
+		f.InstructionPointer = next
+	}
+	return nil
+}
+
+type fetchChar struct {
+}
+
+func (c fetchChar) PerformInstruction(f *Befunge) error {
+	f.move()
+	return num{val: int(f.CurrentChar())}.PerformInstruction(f)
+}
+
+type storeChar struct {
+}
+
+func (s storeChar) PerformInstruction(f *Befunge) error {
+	v, err := f.spaceCell(f.stackPop())
+	if err != nil {
+		f.halted = true
+		return err
+	}
+	f.move()
+	f.Space.Put(f.InstructionPointer, v)
+	return nil
+}
+
+type clearStack struct {
+}
+
+func (c clearStack) PerformInstruction(f *Befunge) error {
+	f.Stack.Clear()
+	return nil
+}
+
+type quit struct {
+}
+
+func (q quit) PerformInstruction(f *Befunge) error {
+	f.exitCode = f.stackPop()
+	f.halted = true
+	return nil
+}
+
+type beginBlock struct {
+}
+
+// maxPadding the most zeros an instruction pads a stack with when it transfers more values than there are, or is given
+// a negative count by {. Counts needing more than this reflect rather than allocating without limit
+const maxPadding = 1 << 20
+
+func (b beginBlock) PerformInstruction(f *Befunge) error {
+	n, ok := f.popInt()
+	if !ok || n > len(f.Stack.Values)+maxPadding || n < -maxPadding {
+		return reflect{}.PerformInstruction(f)
+	}
+	soss := f.Stack
+	toss := f.Stacks.PushStack()
+	if n > 0 {
+		toss.PushAll(soss.PopN(n)...)
+	} else {
+		soss.PushAll(make([]int, -n)...)
+	}
+	pushVector(soss, f.StorageOffset, f.dimensions)
+	f.StorageOffset = f.InstructionPointer.Add(f.delta)
+	f.Stack = toss
+	return nil
+}
+
+type endBlock struct {
+}
+
+func (e endBlock) PerformInstruction(f *Befunge) error {
+	soss, ok := f.Stacks.SOSS()
+	if !ok {
+		return reflect{}.PerformInstruction(f)
+	}
+	n, ok := f.popInt()
+	if !ok || n > len(f.Stack.Values)+maxPadding {
+		return reflect{}.PerformInstruction(f)
+	}
+	offset, fits := f.popVectorFrom(soss)
+	if !fits {
+		return reflect{}.PerformInstruction(f)
+	}
+	f.StorageOffset = offset
+	if n > 0 {
+		soss.PushAll(f.Stack.PopN(n)...)
+	} else {
+		soss.Drop(-max(n, -len(soss.Values)))
+	}
+	f.Stacks.PopStack()
+	f.Stack = soss
+	return nil
+}
+
+type stackUnderStack struct {
+}
+
+func (u stackUnderStack) PerformInstruction(f *Befunge) error {
+	soss, ok := f.Stacks.SOSS()
+	if !ok {
+		return reflect{}.PerformInstruction(f)
+	}
+	count, ok := f.popInt()
+	if !ok || count > len(soss.Values)+maxPadding || count < -(len(f.Stack.Values)+maxPadding) {
+		return reflect{}.PerformInstruction(f)
+	}
+	// values are transferred one at a time, reversing their order
+	for range count {
+		v, _ := soss.Pop()
+		f.Stack.Push(v)
+	}
+	for range -count {
+		v, _ := f.Stack.Pop()
+		soss.Push(v)
+	}
+	return nil
+}
+
+type split struct {
+}
+
+func (s split) PerformInstruction(f *Befunge) error {
+	child := f.IP.split(f.nextIPID)
+	f.nextIPID++
+	// the child moves away from the t so that it doesn't split again, and executes before its parent from the next tick
+	child.InstructionPointer = f.Space.Next(child.InstructionPointer, child.delta)
+	f.IPs = slices.Insert(f.IPs, slices.Index(f.IPs, f.IP), child)
+	return nil
+}
+
+type inputFile struct {
+}
+
+func (i inputFile) PerformInstruction(f *Befunge) error {
+	name := popString(f.Stack)
+	flags, _ := f.popInt()
+	origin, fits := f.popVector()
+	path, ok := f.sandboxPath(name)
+	if !ok || !fits {
+		return reflect{}.PerformInstruction(f)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return reflect{}.PerformInstruction(f)
+	}
+	least := origin.Add(f.StorageOffset)
+	var size *Vector
+	if flags&1 != 0 {
+		// binary files are loaded byte by byte onto a single line, including any line breaks
+		for x, b := range contents {
+			f.Space.Put(least.Add(NewVector3(x, 0, 0)), rune(b))
+		}
+		size = NewVector3(len(contents), 1, 1)
+	} else {
+		size = loadText(f.Space, string(contents), least, f.dimensions)
+	}
+	pushVector(f.Stack, size, f.dimensions)
+	pushVector(f.Stack, origin, f.dimensions)
+	return nil
+}
+
+type outputFile struct {
+}
+
+func (o outputFile) PerformInstruction(f *Befunge) error {
+	name := popString(f.Stack)
+	flags, _ := f.popInt()
+	origin, originFits := f.popVector()
+	size, sizeFits := f.popVector()
+	path, ok := f.sandboxPath(name)
+	if !ok || !originFits || !sizeFits || size.X < 0 || size.Y < 0 || size.Z < 0 {
+		return reflect{}.PerformInstruction(f)
+	}
+	// the size only has a component for each dimension, but there is always at least one line and layer
+	size = NewVector3(size.X, max(size.Y, 1), max(size.Z, 1))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return reflect{}.PerformInstruction(f)
+	}
+	w := bufio.NewWriter(file)
+	if flags&1 != 0 {
+		writeText(w, f.Space, origin.Add(f.StorageOffset), size)
+	} else {
+		writeBinary(w, f.Space, origin.Add(f.StorageOffset), size)
+	}
+	if errors.Join(w.Flush(), file.Close()) != nil {
+		return reflect{}.PerformInstruction(f)
+	}
+	return nil
+}
+
+type execute struct {
+}
+
+func (e execute) PerformInstruction(f *Befunge) error {
+	command := popString(f.Stack)
+	if !f.Config.Sandbox.AllowExec {
+		return reflect{}.PerformInstruction(f)
+	}
+	cmd := shellCommand(command)
+	cmd.Stdout = f.writer
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		f.Stack.Push(exitErr.ExitCode())
+	case err != nil: // the shell couldn't be run at all
+		return reflect{}.PerformInstruction(f)
+	default:
+		f.Stack.Push(0)
+	}
+	return nil
+}
+
+type sysInfo struct {
+}
+
+func (s sysInfo) PerformInstruction(f *Befunge) error {
+	n, ok := f.popInt()
+	if !ok {
+		return reflect{}.PerformInstruction(f)
+	}
+	info := NewStack[int]()
+	f.pushSysInfo(info)
+	if n <= 0 {
+		f.Stack.Values = append(f.Stack.Values, info.Values...)
+		return nil
+	}
+	if n <= len(info.Values) {
+		f.Stack.Push(info.Values[len(info.Values)-n])
+		return nil
+	}
+	// past the end of the system info, y acts as a pick instruction on the existing stack
+	i := len(f.Stack.Values) - (n - len(info.Values))
+	if i >= 0 {
+		f.Stack.Push(f.Stack.Values[i])
+	} else {
+		f.Stack.Push(0)
+	}
+	return nil
+}
+
+// pushSysInfo pushes the system information cells in reverse order, so that the first cell ends up on top of the stack
+func (f *Befunge) pushSysInfo(s *Stack[int]) {
+	// 20. environment variables
+	s.Push(0)
+	for _, env := range os.Environ() {
+		pushString(s, env)
+	}
+	// 19. command line arguments
+	s.Push(0)
+	s.Push(0)
+	// 18. size of each stack, from the TOSS down, 17. number of stacks
+	for _, stack := range f.Stacks.Stacks {
+		s.Push(len(stack.Values))
+	}
+	s.Push(f.Stacks.Len())
+	// 16. time, 15. date
+	now := time.Now()
+	s.Push(now.Hour()*256*256 + now.Minute()*256 + now.Second())
+	s.Push((now.Year()-1900)*256*256 + int(now.Month())*256 + now.Day())
+	// 14. greatest point, relative to the least point, 13. least point
+	least, greatest := f.Space.Bounds()
+	pushVector(s, greatest.Add(least.Multiply(-1)), f.dimensions)
+	pushVector(s, least, f.dimensions)
+	// 12. storage offset, 11. delta, 10. position
+	pushVector(s, f.StorageOffset, f.dimensions)
+	pushVector(s, f.delta, f.dimensions)
+	pushVector(s, f.InstructionPointer, f.dimensions)
+	// 9. team number, 8. IP ID
+	s.Push(0)
+	s.Push(f.ID)
+	// 7. number of dimensions
+	s.Push(f.dimensions)
+	// 6. path separator
+	s.Push(int(os.PathSeparator))
+	// 5. operating paradigm of = (unavailable, or equivalent to C's system())
+	if f.Config.Sandbox.AllowExec {
+		s.Push(1)
+	} else {
+		s.Push(0)
+	}
+	// 4. version number
+	s.Push(versionNumber())
+	// 3. handprint
+	s.Push(Handprint)
+	// 2. bytes per cell (0 for bignums, which have no limit)
+	s.Push(f.cellBits / 8)
+	// 1. flags
+	flags := sysInfoConcurrent | sysInfoUnbufferedIO
+	if f.fileIOAllowed() {
+		flags |= sysInfoFileInput | sysInfoFileOutput
+	}
+	if f.Config.Sandbox.AllowExec {
+		flags |= sysInfoExecute
+	}
+	s.Push(flags)
+}
+
+// pushString pushes s as a null terminated string, with the first character on top of the stack
+func pushString(s *Stack[int], str string) {
+	s.Push(0)
+	runes := []rune(str)
+	for i := len(runes) - 1; i >= 0; i-- {
+		s.Push(int(runes[i]))
+	}
+}
+
+// popString pops a null terminated string, with its first character on top of the stack
+func popString(s *Stack[int]) string {
+	var str strings.Builder
+	for {
+		c, _ := s.Pop()
+		if c == 0 {
+			return str.String()
+		}
+		str.WriteRune(rune(c))
+	}
+}
+
+// pushVector pushes a component of v for each dimension, eg x and then y for Befunge
+func pushVector(s *Stack[int], v *Vector, dimensions int) {
+	s.Push(v.X)
+	if dimensions >= 2 {
+		s.Push(v.Y)
+	}
+	if dimensions >= 3 {
+		s.Push(v.Z)
+	}
+}
+
+// popVectorFrom pops a component for each dimension, in the reverse order to pushVector, which is false when a
+// component is a bignum too big for an int
+func (f *Befunge) popVectorFrom(s *Stack[int]) (*Vector, bool) {
+	var v Vector
+	fits := true
+	pop := func() int {
+		c, _ := s.Pop()
+		value, ok := f.intValue(c)
+		fits = fits && ok
+		return value
+	}
+	if f.dimensions >= 3 {
+		v.Z = pop()
+	}
+	if f.dimensions >= 2 {
+		v.Y = pop()
+	}
+	v.X = pop()
+	return &v, fits
+}
+
+// versionNumber converts eg 0.1.0 to 10
+func versionNumber() int {
+	v, _ := strconv.Atoi(strings.ReplaceAll(Version, ".", ""))
+	return v
+}
+
+// ParseInstruction98 parses an instruction in the Funge-98 dialect. Instructions shared with Befunge-93 are delegated
+// to ParseInstruction, and any unknown instruction reflects the instruction pointer.
+func ParseInstruction98(char rune) InstructionPerformer {
+	return ParseFungeInstruction(char, 2)
+}
+
+// ParseFungeInstruction parses an instruction in the Funge-98 dialect for the given number of dimensions: 1 for
+// Unefunge, 2 for Befunge, or 3 for Trefunge. Instructions which need more dimensions than are available reflect the
+// instruction pointer.
+func ParseFungeInstruction(char rune, dimensions int) InstructionPerformer {
+	switch {
+	case dimensions < 2 && strings.ContainsRune("^v|[]w", char):
+		return reflect{}
+	case dimensions < 3 && strings.ContainsRune("hlm", char):
+		return reflect{}
+	case char == '?':
+		return random{directions: []func() *Vector{XPos, XNeg, YPos, YNeg, ZPos, ZNeg}[:2*dimensions]}
+	case char == 'h':
+		return dir{delta: ZNeg}
+	case char == 'l':
+		return dir{delta: ZPos}
+	case char == 'm':
+		return conditionalDir{
+			zeroDir: ZPos,
+			elseDir: ZNeg,
+		}
+	case 'a' <= char && char <= 'f':
+		return num{val: int(char-'a') + 10}
+	case char == '[':
+		return turn{left: true}
+	case char == ']':
+		return turn{left: false}
+	case char == 'w':
+		return compare{}
+	case char == 'x':
+		return absoluteDelta{}
+	case char == 'j':
+		return jump{}
+	case char == 'k':
+		return iterate{}
+	case char == 'r':
+		return reflect{}
+	case char == '\'':
+		return fetchChar{}
+	case char == 's':
+		return storeChar{}
+	case char == 'n':
+		return clearStack{}
+	case char == 'q':
+		return quit{}
+	case char == 'y':
+		return sysInfo{}
+	case char == '{':
+		return beginBlock{}
+	case char == '}':
+		return endBlock{}
+	case char == 'u':
+		return stackUnderStack{}
+	case char == 't':
+		return split{}
+	case char == 'i':
+		return inputFile{}
+	case char == 'o':
+		return outputFile{}
+	case char == '=':
+		return execute{}
+	case char == '(':
+		return loadFingerprint{}
+	case char == ')':
+		return unloadFingerprint{}
+	case 'A' <= char && char <= 'Z':
+		return semantic{char: char}
+	case char == 'z', char == ' ', char == ';':
+		return noop{}
+	}
+	instruction := ParseInstruction(char)
+	if _, unknown := instruction.(noop); unknown {
+		return reflect{}
+	}
+	return instruction
+}
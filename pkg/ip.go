@@ -0,0 +1,59 @@
+package pkg
+
+// IP the state owned by a single instruction pointer. Befunge-93 programs only ever have one, but Funge-98 programs can
+// spawn more using t, which all execute concurrently
+type IP struct {
+	ID                 int
+	InstructionPointer *Vector
+	StringMode         bool
+	Stack              *Stack[int] // the top of Stacks
+	Stacks             *StackStack[int]
+	StorageOffset      *Vector
+	delta              *Vector
+	terminated         bool
+	semantics          [26]Stack[InstructionPerformer] // the loaded fingerprint instructions for each of A-Z
+}
+
+func NewIP(id int) *IP {
+	stacks := NewStackStack[int]()
+	return &IP{
+		ID:                 id,
+		InstructionPointer: NewVector2(0, 0),
+		StringMode:         false,
+		Stack:              stacks.TOSS(),
+		Stacks:             stacks,
+		StorageOffset:      NewVector2(0, 0),
+		delta:              XPos(),
+		terminated:         false,
+	}
+}
+
+// Delta the direction the instruction pointer moves in
+func (ip *IP) Delta() *Vector {
+	return ip.delta
+}
+
+// SetDelta changes the direction the instruction pointer moves in
+func (ip *IP) SetDelta(delta *Vector) {
+	ip.delta = delta
+}
+
+// split creates a copy of the instruction pointer with the given ID, travelling in the opposite direction
+func (ip *IP) split(id int) *IP {
+	stacks := ip.Stacks.Clone()
+	var semantics [26]Stack[InstructionPerformer]
+	for i, s := range ip.semantics {
+		semantics[i] = *s.Clone()
+	}
+	return &IP{
+		ID:                 id,
+		InstructionPointer: ip.InstructionPointer,
+		StringMode:         ip.StringMode,
+		Stack:              stacks.TOSS(),
+		Stacks:             stacks,
+		StorageOffset:      ip.StorageOffset,
+		delta:              ip.delta.Multiply(-1),
+		terminated:         false,
+		semantics:          semantics,
+	}
+}
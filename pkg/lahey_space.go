@@ -0,0 +1,221 @@
+package pkg
+
+import (
+	"bufio"
+	"strings"
+)
+
+const chunkSize = 64
+
+type chunk struct {
+	cells   [chunkSize * chunkSize]rune
+	decoded [chunkSize * chunkSize]InstructionPerformer // nil for cells which haven't been decoded yet
+}
+
+func newChunk() *chunk {
+	c := new(chunk)
+	for i := range c.cells {
+		c.cells[i] = ' '
+	}
+	return c
+}
+
+// LaheySpace an unbounded, sparse funge-space as used by Funge-98. Cells are stored in fixed size chunks which are only
+// allocated once written to, and every other cell is a space. Instruction pointers leaving the bounding box of the
+// program wrap around to its opposite side, as defined by Lahey-space.
+type LaheySpace struct {
+	chunks   map[Vector]*chunk
+	least    Vector
+	greatest Vector
+	empty    bool
+}
+
+// NewLaheySpace loads the program into a new funge-space with the given number of dimensions. Unefunge programs are
+// loaded onto a single line, ignoring line breaks, while Trefunge programs use form feeds to separate each layer
+func NewLaheySpace(s string, dimensions int) *LaheySpace {
+	space := &LaheySpace{chunks: make(map[Vector]*chunk), empty: true}
+	loadText(space, s, &Vector{}, dimensions)
+	return space
+}
+
+// writeBinary writes the region of funge-space from least with the given size, with a line break between its lines and
+// a form feed between its layers. Cells are written as they're read, so that a huge region doesn't need a huge amount of
+// memory
+func writeBinary(w *bufio.Writer, space FungeSpace, least *Vector, size *Vector) {
+	for z := range size.Z {
+		if z > 0 {
+			_ = w.WriteByte('\f')
+		}
+		for y := range size.Y {
+			if y > 0 {
+				_ = w.WriteByte('\n')
+			}
+			for x := range size.X {
+				_, _ = w.WriteRune(space.Get(least.Add(NewVector3(x, y, z))))
+			}
+		}
+	}
+}
+
+// writeText writes the region in the same way as writeBinary, but as a text file, leaving out trailing spaces, lines
+// and layers. Everything outside the bounds of funge-space is spaces, so only the part of the region within its bounds
+// is read
+func writeText(w *bufio.Writer, space FungeSpace, least *Vector, size *Vector) {
+	spaceLeast, spaceGreatest := space.Bounds()
+	from := spaceLeast.Add(least.Multiply(-1))
+	to := spaceGreatest.Add(least.Multiply(-1))
+	// clamp the bounds to the region, where to is exclusive
+	from = NewVector3(min(max(from.X, 0), size.X), min(max(from.Y, 0), size.Y), min(max(from.Z, 0), size.Z))
+	to = NewVector3(min(max(to.X+1, from.X), size.X), min(max(to.Y+1, from.Y), size.Y),
+		min(max(to.Z+1, from.Z), size.Z))
+	lastZ := 0
+	line := make([]rune, 0, to.X-from.X)
+	for z := from.Z; z < to.Z; z++ {
+		lastY := -1 // until a line of the layer is written
+		for y := from.Y; y < to.Y; y++ {
+			line = line[:0]
+			for x := from.X; x < to.X; x++ {
+				line = append(line, space.Get(least.Add(NewVector3(x, y, z))))
+			}
+			trimmed := strings.TrimRight(string(line), " ")
+			if trimmed == "" {
+				continue
+			}
+			// empty lines and layers are only written once there is a line after them
+			if lastY < 0 {
+				writeRepeated(w, '\f', z-lastZ)
+				lastY, lastZ = 0, z
+			}
+			writeRepeated(w, '\n', y-lastY)
+			writeRepeated(w, ' ', from.X)
+			_, _ = w.WriteString(trimmed)
+			lastY = y
+		}
+	}
+}
+
+func writeRepeated(w *bufio.Writer, b byte, n int) {
+	for range n {
+		_ = w.WriteByte(b)
+	}
+}
+
+// loadText loads text into the funge-space with its top left corner at origin, in the same way as a program. Spaces are
+// transparent, leaving the existing cells in place. Returns the size of the area that was loaded
+func loadText(space FungeSpace, s string, origin *Vector, dimensions int) *Vector {
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+	if dimensions < 3 {
+		s = strings.ReplaceAll(s, "\f", "")
+	}
+	if dimensions < 2 {
+		s = strings.ReplaceAll(s, "\n", "")
+	}
+	var size Vector
+	for z, layer := range strings.Split(s, "\f") {
+		for y, line := range strings.Split(layer, "\n") {
+			for x, char := range []rune(line) {
+				if char != ' ' {
+					space.Put(origin.Add(NewVector3(x, y, z)), char)
+				}
+				size.X = max(size.X, x+1)
+				size.Y = max(size.Y, y+1)
+				size.Z = max(size.Z, z+1)
+			}
+		}
+	}
+	return &size
+}
+
+// chunkIndex finds the chunk containing the position, and the index of the position within it. Chunks are flat, so each
+// z layer has its own chunks
+func chunkIndex(position *Vector) (Vector, int) {
+	cx, cy := floorDiv(position.X, chunkSize), floorDiv(position.Y, chunkSize)
+	return Vector{cx, cy, position.Z}, (position.Y-cy*chunkSize)*chunkSize + (position.X - cx*chunkSize)
+}
+
+func floorDiv(a int, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
+
+func (l *LaheySpace) Get(position *Vector) rune {
+	key, i := chunkIndex(position)
+	c, ok := l.chunks[key]
+	if !ok {
+		return ' '
+	}
+	return c.cells[i]
+}
+
+func (l *LaheySpace) Put(position *Vector, v rune) {
+	key, i := chunkIndex(position)
+	c, ok := l.chunks[key]
+	if !ok {
+		if v == ' ' {
+			return
+		}
+		c = newChunk()
+		l.chunks[key] = c
+	}
+	c.cells[i] = v
+	c.decoded[i] = nil
+	// the bounds only ever grow; finding the new bounds when a cell is cleared would mean scanning the entire space
+	if v != ' ' {
+		l.grow(position)
+	}
+}
+
+func (l *LaheySpace) Instruction(position *Vector, decode func(rune) InstructionPerformer) InstructionPerformer {
+	key, i := chunkIndex(position)
+	c, ok := l.chunks[key]
+	if !ok {
+		// there's nothing but spaces here, so not worth keeping
+		return decode(' ')
+	}
+	if c.decoded[i] == nil {
+		c.decoded[i] = decode(c.cells[i])
+	}
+	return c.decoded[i]
+}
+
+func (l *LaheySpace) grow(position *Vector) {
+	if l.empty {
+		l.least, l.greatest = *position, *position
+		l.empty = false
+		return
+	}
+	l.least = Vector{min(l.least.X, position.X), min(l.least.Y, position.Y), min(l.least.Z, position.Z)}
+	l.greatest = Vector{max(l.greatest.X, position.X), max(l.greatest.Y, position.Y), max(l.greatest.Z, position.Z)}
+}
+
+// Contains is always true, as Lahey-space is unbounded
+func (l *LaheySpace) Contains(*Vector) bool {
+	return true
+}
+
+func (l *LaheySpace) inBounds(position *Vector) bool {
+	return position.X >= l.least.X && position.X <= l.greatest.X &&
+		position.Y >= l.least.Y && position.Y <= l.greatest.Y &&
+		position.Z >= l.least.Z && position.Z <= l.greatest.Z
+}
+
+func (l *LaheySpace) Next(position *Vector, delta *Vector) *Vector {
+	next := position.Add(delta)
+	if l.inBounds(next) {
+		return next
+	}
+	// Lahey-space wraparound: travel backwards until leaving the bounds, then step back inside them. If the position
+	// was already outside the bounds then this simply continues on to the next position.
+	back := next.Add(delta.Multiply(-1))
+	for l.inBounds(back) {
+		back = back.Add(delta.Multiply(-1))
+	}
+	return back.Add(delta)
+}
+
+func (l *LaheySpace) Bounds() (*Vector, *Vector) {
+	least, greatest := l.least, l.greatest
+	return &least, &greatest
+}
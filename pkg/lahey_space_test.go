@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLaheySpace_cells(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	space := NewLaheySpace("ab\n\n  c", 2)
+	asserts.Equal('a', space.Get(NewVector2(0, 0)), "Get(0, 0) mismatch")
+	asserts.Equal('c', space.Get(NewVector2(2, 2)), "Get(2, 2) mismatch")
+	asserts.Equal(' ', space.Get(NewVector2(-1000, 5000)), "unset cells should be spaces")
+
+	space.Put(NewVector2(-100, -200), 'x')
+	space.Put(NewVector2(chunkSize*3+1, 7), 'y')
+	asserts.Equal('x', space.Get(NewVector2(-100, -200)), "Get(-100, -200) mismatch")
+	asserts.Equal('y', space.Get(NewVector2(chunkSize*3+1, 7)), "Get far east mismatch")
+	least, greatest := space.Bounds()
+	asserts.Equal(*NewVector2(-100, -200), *least, "least bound mismatch")
+	asserts.Equal(*NewVector2(chunkSize*3+1, 7), *greatest, "greatest bound mismatch")
+}
+
+func TestLaheySpace_dimensions(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	var cases = []struct {
+		name       string
+		dimensions int
+		position   *Vector
+		expected   rune
+	}{
+		{"unefunge_ignores_line_breaks", 1, NewVector2(3, 0), 'd'},
+		{"befunge_ignores_form_feeds", 2, NewVector2(1, 1), 'd'},
+		{"trefunge_layers", 3, NewVector3(0, 1, 1), 'e'},
+		{"trefunge_first_layer", 3, NewVector3(1, 0, 0), 'b'},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			space := NewLaheySpace("ab\nc\fd\ne", test.dimensions)
+			asserts.Equal(test.expected, space.Get(test.position), "Get%s mismatch", test.position)
+		})
+	}
+}
+
+func TestLaheySpace_Next(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	space := NewLaheySpace(`abcd
+e  f
+ghij`, 2)
+	var cases = []struct {
+		name                 string
+		position, delta      *Vector
+		expectedX, expectedY int
+	}{
+		{"inside", NewVector2(0, 0), XPos(), 1, 0},
+		{"wrap_east", NewVector2(3, 1), XPos(), 0, 1},
+		{"wrap_west", NewVector2(0, 1), XNeg(), 3, 1},
+		{"wrap_south", NewVector2(2, 2), YPos(), 2, 0},
+		{"wrap_diagonal", NewVector2(3, 2), NewVector2(1, 1), 1, 0},
+		{"wrap_knight", NewVector2(3, 1), NewVector2(2, 1), 1, 0},
+		{"approaching_from_outside", NewVector2(-5, 0), XPos(), -4, 0},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			next := space.Next(test.position, test.delta)
+			asserts.Equal(test.expectedX, next.X, "X value mismatch")
+			asserts.Equal(test.expectedY, next.Y, "Y value mismatch")
+		})
+	}
+}
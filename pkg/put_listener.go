@@ -0,0 +1,52 @@
+package pkg
+
+// PutEvent a cell of funge-space being put, by p or any other instruction which writes to funge-space
+type PutEvent struct {
+	IP       *IP    // the instruction pointer which put the cell
+	Position Vector // wrapped into funge-space, if it wraps
+	Old      rune
+	New      rune
+}
+
+// OnPut calls the listener after each cell is put into funge-space, other than by reverting a step
+func (f *Befunge) OnPut(listener func(PutEvent)) {
+	f.listenToPuts()
+	f.putListeners = append(f.putListeners, listener)
+}
+
+// listenToPuts wraps funge-space so that each cell that is put is recorded and notified, if it isn't already wrapped
+func (f *Befunge) listenToPuts() {
+	if _, ok := f.Space.(*listenedSpace); !ok {
+		f.Space = &listenedSpace{FungeSpace: f.Space, befunge: f}
+	}
+}
+
+// listenedSpace records each cell that is put in the current step's Undo, and notifies the put listeners of it.
+// Reverting a step puts cells back without either
+type listenedSpace struct {
+	FungeSpace
+	befunge *Befunge
+}
+
+func (s *listenedSpace) Put(position *Vector, v rune) {
+	old := s.Get(position)
+	if lahey, ok := s.FungeSpace.(*LaheySpace); ok && s.befunge.undo != nil && s.befunge.undo.bounds == nil {
+		s.befunge.undo.bounds = &laheyBounds{least: lahey.least, greatest: lahey.greatest, empty: lahey.empty}
+	}
+	s.FungeSpace.Put(position, v)
+	cell := *position
+	if torus, ok := s.FungeSpace.(*Torus); ok {
+		// puts wrap around the torus
+		cell = *NewVector2(torus.ModWidth(position.X), torus.ModHeight(position.Y))
+	}
+	if s.befunge.reverting {
+		return
+	}
+	event := PutEvent{IP: s.befunge.IP, Position: cell, Old: old, New: v}
+	if s.befunge.undo != nil {
+		s.befunge.undo.puts = append(s.befunge.undo.puts, event)
+	}
+	for _, listener := range s.befunge.putListeners {
+		listener(event)
+	}
+}
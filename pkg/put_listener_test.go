@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"github.com/kagof/kagofunge/config"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestBefunge_OnPut(t *testing.T) {
+	t.Parallel()
+
+	// the cell which was put, its old and new values, and the position of the instruction pointer which put it
+	type put struct {
+		position Vector
+		old, new rune
+		by       Vector
+	}
+	tests := []struct {
+		name      string
+		funge     string
+		behaviour config.OutOfBoundsBehaviour
+		expected  []put
+	}{
+		{"put", `"@"60p `, config.OobNoOp, []put{{*NewVector2(6, 0), ' ', '@', *NewVector2(5, 0)}}},
+		{"put_wraps", `"@"98+0p `, config.OobWrap, []put{{*NewVector2(8, 0), ' ', '@', *NewVector2(7, 0)}}},
+		{"put_out_of_bounds", `"@"98+0p @`, config.OobNoOp, nil},
+		{"put_twice", `"1"50p"@"60p`, config.OobNoOp, []put{
+			{*NewVector2(5, 0), 'p', '1', *NewVector2(5, 0)},
+			{*NewVector2(6, 0), '"', '@', *NewVector2(11, 0)},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+			cfg := config.DefaultConfig()
+			cfg.Interpreter.PutOutOfBoundsBehaviour = test.behaviour
+			befunge := NewBefunge(&cfg, test.funge, &strings.Builder{}, strings.NewReader(""))
+			var actual []put
+			befunge.OnPut(func(event PutEvent) {
+				actual = append(actual, put{event.Position, event.Old, event.New, *event.IP.InstructionPointer})
+			})
+			hasNext := true
+			for i := 0; hasNext && i < maxSteps; i++ {
+				var err error
+				hasNext, err = befunge.Step()
+				asserts.NoError(err)
+			}
+			asserts.False(hasNext, "the program should halt")
+			asserts.Equal(test.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// sandboxPath resolves a path used by i or o, reporting whether it lies within one of the directories the sandbox allows
+// access to. Symbolic links are resolved first, so they can't be used to escape the allowed directories
+func (f *Befunge) sandboxPath(name string) (string, bool) {
+	path, err := resolvePath(name)
+	if err != nil {
+		return "", false
+	}
+	for _, dir := range f.Config.Sandbox.AllowedDirectories {
+		dir, err := resolvePath(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// resolvePath makes the path absolute and resolves any symbolic links. Files that don't exist yet (eg, ones about to be
+// written by o) are resolved relative to their parent directory
+func resolvePath(name string) (string, error) {
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved, nil
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+func (f *Befunge) fileIOAllowed() bool {
+	return len(f.Config.Sandbox.AllowedDirectories) > 0
+}
+
+// shellCommand runs the command the same way as C's system()
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("/bin/sh", "-c", command)
+}
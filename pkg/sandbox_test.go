@@ -0,0 +1,181 @@
+package pkg
+
+import (
+	"github.com/kagof/kagofunge/config"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFunge98_sandbox(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	allowed, other := t.TempDir(), t.TempDir()
+	asserts.NoError(os.WriteFile(filepath.Join(allowed, "in.txt"), []byte("AB"), 0644))
+	asserts.NoError(os.WriteFile(filepath.Join(other, "in.txt"), []byte("AB"), 0644))
+	asserts.NoError(os.Symlink(other, filepath.Join(allowed, "link")))
+
+	// programs ending in #@ followed by the instruction only print if the instruction doesn't reflect
+	var cases = []struct {
+		name        string
+		sandbox     config.SandboxConfig
+		funge       string
+		expected    string
+		writtenFile string
+		written     string
+	}{
+		{
+			"input_denied_by_default",
+			config.SandboxConfig{},
+			"aa0" + fungeString(filepath.Join(allowed, "in.txt")) + "#@i1.@",
+			"",
+			"", "",
+		},
+		{
+			"input",
+			config.SandboxConfig{AllowedDirectories: []string{allowed}},
+			"aa0" + fungeString(filepath.Join(allowed, "in.txt")) + "#@i....@",
+			"101012",
+			"", "",
+		},
+		{
+			"input_loads_cells",
+			config.SandboxConfig{AllowedDirectories: []string{allowed}},
+			"aa0" + fungeString(filepath.Join(allowed, "in.txt")) + "#@i$$$$bag,@",
+			"B",
+			"", "",
+		},
+		{
+			"input_outside_allowed_directory",
+			config.SandboxConfig{AllowedDirectories: []string{allowed}},
+			"aa0" + fungeString(filepath.Join(other, "in.txt")) + "#@i1.@",
+			"",
+			"", "",
+		},
+		{
+			"input_escaping_with_dot_dot",
+			config.SandboxConfig{AllowedDirectories: []string{allowed}},
+			"aa0" + fungeString(filepath.Join(allowed, "..", filepath.Base(other), "in.txt")) + "#@i1.@",
+			"",
+			"", "",
+		},
+		{
+			"input_escaping_with_symlink",
+			config.SandboxConfig{AllowedDirectories: []string{allowed}},
+			"aa0" + fungeString(filepath.Join(allowed, "link", "in.txt")) + "#@i1.@",
+			"",
+			"", "",
+		},
+		{
+			"input_missing_file",
+			config.SandboxConfig{AllowedDirectories: []string{allowed}},
+			"aa0" + fungeString(filepath.Join(allowed, "missing.txt")) + "#@i1.@",
+			"",
+			"", "",
+		},
+		{
+			"output",
+			config.SandboxConfig{AllowedDirectories: []string{allowed}},
+			"51001" + fungeString(filepath.Join(allowed, "out.txt")) + "#@o1.@",
+			"1",
+			filepath.Join(allowed, "out.txt"), "51001",
+		},
+		{
+			"output_text_trims_empty_lines",
+			config.SandboxConfig{AllowedDirectories: []string{allowed}},
+			"f3001" + fungeString(filepath.Join(allowed, "out_text.txt")) + "#@o1.@\n\n",
+			"1",
+			filepath.Join(allowed, "out_text.txt"), "f3001" + fungeString(filepath.Join(allowed, "out_text.txt"))[:10],
+		},
+		{
+			"output_text_huge_region",
+			config.SandboxConfig{AllowedDirectories: []string{allowed}},
+			"88*:*:*:*:001" + fungeString(filepath.Join(allowed, "out_huge.txt")) + "#@o1.@",
+			"1",
+			filepath.Join(allowed, "out_huge.txt"), "88*:*:*:*:001" + fungeString(filepath.Join(allowed,
+				"out_huge.txt")) + "#@o1.@",
+		},
+		{
+			"output_text_before_program",
+			config.SandboxConfig{AllowedDirectories: []string{allowed}},
+			"4102-01" + fungeString(filepath.Join(allowed, "out_before.txt")) + "#@o1.@",
+			"1",
+			filepath.Join(allowed, "out_before.txt"), "  41",
+		},
+		{
+			"output_binary",
+			config.SandboxConfig{AllowedDirectories: []string{allowed}},
+			"72000" + fungeString(filepath.Join(allowed, "out.bin")) + "#@o1.@",
+			"1",
+			filepath.Join(allowed, "out.bin"), "720000\"\n       ",
+		},
+		{
+			"output_denied_by_default",
+			config.SandboxConfig{},
+			"51001" + fungeString(filepath.Join(other, "out.txt")) + "#@o1.@",
+			"",
+			"", "",
+		},
+		{
+			"execute_denied_by_default",
+			config.SandboxConfig{},
+			`0"3 tixe"#@=1.@`,
+			"",
+			"", "",
+		},
+		{
+			"execute",
+			config.SandboxConfig{AllowExec: true},
+			`0"3 tixe"=.@`,
+			"3",
+			"", "",
+		},
+		{
+			"execute_output",
+			config.SandboxConfig{AllowExec: true},
+			`0"ih ohce"=.@`,
+			"hi\n0",
+			"", "",
+		},
+		{
+			"sysinfo_flags_sandboxed",
+			config.SandboxConfig{},
+			"1y.5y.@",
+			"170",
+			"", "",
+		},
+		{
+			"sysinfo_flags_allowed",
+			config.SandboxConfig{AllowedDirectories: []string{allowed}, AllowExec: true},
+			"1y.5y.@",
+			"311",
+			"", "",
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := config.DefaultConfig()
+			cfg.Interpreter.Dialect = config.Dialect98
+			cfg.Interpreter.Sandbox = test.sandbox
+			output, _ := runProgram(t, &cfg, test.funge, "")
+			asserts.Equal(test.expected, output, "%s output not as expected", test.name)
+			if test.writtenFile != "" {
+				written, err := os.ReadFile(test.writtenFile)
+				asserts.NoError(err)
+				asserts.Equal(test.written, string(written), "%s file not as expected", test.name)
+			}
+		})
+	}
+}
+
+// fungeString the code to push s as a null terminated string
+func fungeString(s string) string {
+	runes := []rune(s)
+	slices.Reverse(runes)
+	return `0"` + string(runes) + `"`
+}
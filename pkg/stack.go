@@ -1,11 +1,23 @@
 package pkg
 
+import "slices"
+
 type Stack[T any] struct {
 	Values []T
+	watch  stackWatch[T]
+}
+
+// stackWatch records the values popped from a stack while a step which can be undone is running. Values are only ever
+// removed from the top, so the stack can be reverted by truncating it to lowest and pushing back the values it lost
+type stackWatch[T any] struct {
+	active bool
+	length int // the length of the stack when it started being watched
+	lowest int // the fewest values the stack has had since then
+	lost   []T // the values which were between lowest and length, from the top down
 }
 
 func NewStack[T any]() *Stack[T] {
-	return &Stack[T]{nil}
+	return &Stack[T]{}
 }
 
 func (s *Stack[T]) Push(value T) {
@@ -15,7 +27,7 @@ func (s *Stack[T]) Push(value T) {
 func (s *Stack[T]) Pop() (T, bool) {
 	var t, b = s.Peek()
 	if b {
-		s.Values = s.Values[:len(s.Values)-1]
+		s.truncate(len(s.Values) - 1)
 	}
 	return t, b
 }
@@ -27,3 +39,60 @@ func (s *Stack[T]) Peek() (T, bool) {
 	}
 	return s.Values[len(s.Values)-1], true
 }
+
+// PopN pops the top n values off of the stack, returning them in the order they were pushed. If the stack has fewer
+// than n values, the missing values are treated as zero values underneath the bottom of the stack
+func (s *Stack[T]) PopN(n int) []T {
+	out := make([]T, n)
+	available := min(n, len(s.Values))
+	copy(out[n-available:], s.Values[len(s.Values)-available:])
+	s.truncate(len(s.Values) - available)
+	return out
+}
+
+// Drop pops the top n values off of the stack, or every value if it has fewer than n
+func (s *Stack[T]) Drop(n int) {
+	s.truncate(max(0, len(s.Values)-n))
+}
+
+// Clear pops every value off of the stack
+func (s *Stack[T]) Clear() {
+	s.truncate(0)
+}
+
+// truncate removes the values above length, keeping them if the stack is being watched
+func (s *Stack[T]) truncate(length int) {
+	if w := &s.watch; w.active && length < w.lowest {
+		for i := w.lowest - 1; i >= length; i-- {
+			w.lost = append(w.lost, s.Values[i])
+		}
+		w.lowest = length
+	}
+	s.Values = s.Values[:length]
+}
+
+// startWatching starts recording the values lost by the stack, so that it can be reverted to how it is now
+func (s *Stack[T]) startWatching() {
+	s.watch = stackWatch[T]{active: true, length: len(s.Values), lowest: len(s.Values)}
+}
+
+// stopWatching stops recording the values lost by the stack, returning the length to truncate it to and the values to
+// push back to revert it, or false if it is unchanged
+func (s *Stack[T]) stopWatching() (int, []T, bool) {
+	w := s.watch
+	s.watch = stackWatch[T]{}
+	if w.lowest == w.length && len(s.Values) == w.length {
+		return 0, nil, false
+	}
+	slices.Reverse(w.lost)
+	return w.lowest, w.lost, true
+}
+
+// PushAll pushes each value onto the stack in order, so that the last value is on top
+func (s *Stack[T]) PushAll(values ...T) {
+	s.Values = append(s.Values, values...)
+}
+
+func (s *Stack[T]) Clone() *Stack[T] {
+	return &Stack[T]{Values: slices.Clone(s.Values)}
+}
@@ -0,0 +1,53 @@
+package pkg
+
+import "github.com/kagof/kagofunge/internal"
+
+// StackStack a stack of stacks, as used by Funge-98. There is always at least one stack; the last stack is the top of
+// the stack stack (TOSS) and the one beneath it the second on the stack stack (SOSS)
+type StackStack[T any] struct {
+	Stacks []*Stack[T]
+}
+
+func NewStackStack[T any]() *StackStack[T] {
+	return &StackStack[T]{[]*Stack[T]{NewStack[T]()}}
+}
+
+// TOSS the top of the stack stack
+func (s *StackStack[T]) TOSS() *Stack[T] {
+	return s.Stacks[len(s.Stacks)-1]
+}
+
+// SOSS the second on the stack stack, if there is one
+func (s *StackStack[T]) SOSS() (*Stack[T], bool) {
+	if len(s.Stacks) < 2 {
+		return nil, false
+	}
+	return s.Stacks[len(s.Stacks)-2], true
+}
+
+// PushStack pushes a new empty stack, which becomes the TOSS
+func (s *StackStack[T]) PushStack() *Stack[T] {
+	stack := NewStack[T]()
+	s.Stacks = append(s.Stacks, stack)
+	return stack
+}
+
+// PopStack removes the TOSS, returning false if it is the only stack
+func (s *StackStack[T]) PopStack() (*Stack[T], bool) {
+	if len(s.Stacks) < 2 {
+		return nil, false
+	}
+	stack := s.TOSS()
+	s.Stacks = s.Stacks[:len(s.Stacks)-1]
+	return stack, true
+}
+
+// Len the number of stacks on the stack stack
+func (s *StackStack[T]) Len() int {
+	return len(s.Stacks)
+}
+
+// Clone copies the stack stack and each of its stacks
+func (s *StackStack[T]) Clone() *StackStack[T] {
+	return &StackStack[T]{internal.MapSlice(s.Stacks, (*Stack[T]).Clone)}
+}
@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"slices"
+)
+
+// StepEvent an instruction pointer executing the instruction in a cell, or pushing its character in string mode. The
+// state of the instruction pointer after the instruction, such as its delta, can be read from IP while the event is
+// being handled, before the instruction pointer moves on
+type StepEvent struct {
+	IP         *IP
+	Position   Vector // where the instruction was
+	Char       rune
+	StringMode bool   // whether the instruction pointer was in string mode, so pushed the character
+	Input      []byte // the input consumed by the instruction
+	Output     []byte // the output written by the instruction
+}
+
+// pendingStepEvent a step event which has started but not yet finished
+type pendingStepEvent struct {
+	event  StepEvent
+	input  int // how much input had been consumed before the instruction
+	output int // how much output had been written during the step before the instruction
+}
+
+// OnStep calls the listener after each instruction pointer executes an instruction. Instructions executed by another
+// instruction, such as k, are part of the step of the instruction which executed them
+func (f *Befunge) OnStep(listener func(StepEvent)) {
+	f.logIO()
+	f.stepListeners = append(f.stepListeners, listener)
+}
+
+func (f *Befunge) startStepEvent(char rune) *pendingStepEvent {
+	return &pendingStepEvent{
+		event: StepEvent{
+			IP:         f.IP,
+			Position:   *f.InstructionPointer,
+			Char:       char,
+			StringMode: f.StringMode && char != '"',
+		},
+		input:  f.consumedInput(),
+		output: len(f.output.written),
+	}
+}
+
+func (f *Befunge) finishStepEvent(pending *pendingStepEvent) {
+	event := pending.event
+	if input := f.input.read[pending.input:f.consumedInput()]; len(input) > 0 {
+		event.Input = slices.Clone(input)
+	}
+	if output := f.output.written[pending.output:]; len(output) > 0 {
+		event.Output = slices.Clone(output)
+	}
+	for _, listener := range f.stepListeners {
+		listener(event)
+	}
+}
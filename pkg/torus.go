@@ -7,9 +7,10 @@ import (
 )
 
 type Torus struct {
-	Chars  [][]rune
-	Width  int
-	Height int
+	Chars   [][]rune
+	Width   int
+	Height  int
+	decoded [][]InstructionPerformer // parallel to Chars, with nil for cells which haven't been decoded yet
 }
 
 func (t *Torus) ModWidth(x int) int {
@@ -25,7 +26,53 @@ func (t *Torus) CharAt(x int, y int) rune {
 }
 
 func (t *Torus) SetCharAt(x int, y int, v rune) {
-	t.Chars[t.ModHeight(y)][t.ModWidth(x)] = v
+	x, y = t.ModWidth(x), t.ModHeight(y)
+	t.Chars[y][x] = v
+	if t.decoded != nil {
+		t.decoded[y][x] = nil
+	}
+}
+
+func (t *Torus) Get(position *Vector) rune {
+	return t.CharAt(position.X, position.Y)
+}
+
+func (t *Torus) Put(position *Vector, v rune) {
+	t.SetCharAt(position.X, position.Y, v)
+}
+
+func (t *Torus) Contains(position *Vector) bool {
+	return position.Y < t.Height && position.Y >= 0 && position.X < t.Width && position.X >= 0
+}
+
+func (t *Torus) Next(position *Vector, delta *Vector) *Vector {
+	x, y := position.X, position.Y
+	if delta.X != 0 { //saving some modulus operations
+		x = t.ModWidth(x + delta.X)
+	}
+	if delta.Y != 0 { //saving some modulus operations
+		y = t.ModHeight(y + delta.Y)
+	}
+	return NewVector2(x, y)
+}
+
+func (t *Torus) Bounds() (*Vector, *Vector) {
+	return NewVector2(0, 0), NewVector2(t.Width-1, t.Height-1)
+}
+
+func (t *Torus) Instruction(position *Vector, decode func(rune) InstructionPerformer) InstructionPerformer {
+	if t.decoded == nil {
+		t.decoded = internal.MapSlice(t.Chars, func(line []rune) []InstructionPerformer {
+			return make([]InstructionPerformer, len(line))
+		})
+	}
+	x, y := t.ModWidth(position.X), t.ModHeight(position.Y)
+	instruction := t.decoded[y][x]
+	if instruction == nil {
+		instruction = decode(t.Chars[y][x])
+		t.decoded[y][x] = instruction
+	}
+	return instruction
 }
 
 func NewTorus(s string, numLines int, numColumns int) *Torus {
@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"github.com/kagof/kagofunge/config"
+	"strings"
+)
+
+// maxTraceLength the most instructions compiled into a single trace
+const maxTraceLength = 4096
+
+// TraceEngine runs a program with the same results as Befunge.Step, but faster. Each straight-line path through
+// funge-space (one without branches, puts, or anything else that depends on more than the stack) is compiled into a
+// trace the first time it is reached, which can then be run again without decoding or moving between each of its
+// instructions. Traces are invalidated when any of their cells are overwritten
+type TraceEngine struct {
+	*Befunge
+	traces map[traceKey]*trace
+	// the traces passing through each cell
+	cellTraces map[Vector][]*trace
+}
+
+// traceKey the state of the instruction pointer when entering a trace
+type traceKey struct {
+	position Vector
+	delta    Vector
+}
+
+type trace struct {
+	key   traceKey
+	ops   []traceOp
+	exit  traceKey // the instruction which ended the trace, which is executed normally
+	cells []Vector
+}
+
+type traceOp struct {
+	instruction InstructionPerformer
+	traceKey    // where the instruction is, in case the program halts on it
+}
+
+func NewTraceEngine(f *Befunge) *TraceEngine {
+	engine := &TraceEngine{
+		Befunge:    f,
+		traces:     make(map[traceKey]*trace),
+		cellTraces: make(map[Vector][]*trace),
+	}
+	f.Space = &tracedSpace{FungeSpace: f.Space, engine: engine}
+	return engine
+}
+
+func (e *TraceEngine) Step() (bool, error) {
+	// concurrent instruction pointers take turns, so only a lone instruction pointer can run a trace
+	if len(e.IPs) == 1 && !e.StringMode {
+		err := e.run(e.traceFrom(traceKey{position: *e.InstructionPointer, delta: *e.delta}))
+		if e.halted {
+			return false, mapErr(e.Befunge, err)
+		}
+	}
+	return e.Befunge.Step()
+}
+
+func (e *TraceEngine) run(t *trace) error {
+	for _, op := range t.ops {
+		err := op.instruction.PerformInstruction(e.Befunge)
+		if e.halted {
+			e.InstructionPointer, e.delta = &op.position, &op.delta
+			return err
+		}
+	}
+	exit := t.exit
+	e.InstructionPointer, e.delta = &exit.position, &exit.delta
+	return nil
+}
+
+// traceFrom the trace for the instruction pointer entering the state, compiling it if needed
+func (e *TraceEngine) traceFrom(key traceKey) *trace {
+	if t, ok := e.traces[key]; ok {
+		return t
+	}
+	t := e.compile(key)
+	e.traces[key] = t
+	for _, cell := range t.cells {
+		e.cellTraces[cell] = append(e.cellTraces[cell], t)
+	}
+	return t
+}
+
+// compile follows the instruction pointer from the state until it reaches an instruction which can't be traced
+func (e *TraceEngine) compile(key traceKey) *trace {
+	t := &trace{key: key}
+	visited := make(map[traceKey]bool)
+	position, delta := key.position, key.delta
+	for len(t.ops) < maxTraceLength && !visited[traceKey{position, delta}] {
+		visited[traceKey{position, delta}] = true
+		char := e.Space.Get(&position)
+		instruction := e.Space.Instruction(&position, e.parseInstruction)
+		if !e.traceable(char, instruction) {
+			break
+		}
+		t.cells = append(t.cells, position)
+		switch instruction := instruction.(type) {
+		case noop:
+		case dir:
+			delta = *instruction.delta()
+		case skip:
+			position = *e.Space.Next(&position, &delta)
+		default:
+			t.ops = append(t.ops, traceOp{instruction: instruction, traceKey: traceKey{position, delta}})
+		}
+		position = *e.Space.Next(&position, &delta)
+	}
+	t.exit = traceKey{position, delta}
+	return t
+}
+
+// traceable whether the instruction can be part of a trace, ie it always leaves the instruction pointer with the same
+// delta, and never changes funge-space
+func (e *TraceEngine) traceable(char rune, instruction InstructionPerformer) bool {
+	switch instruction := instruction.(type) {
+	case num, not, dup, swap, discard, write, read, skip:
+		return true
+	case get:
+		// a coordinate too big for an int reflects the instruction pointer in Funge-98
+		return !e.is98()
+	case op2:
+		// / and % can reflect the instruction pointer when dividing by zero
+		return instruction.div0ConfigVal == nil || instruction.div0ConfigVal(e.Befunge) != config.Div0Reflect
+	case dir:
+		return strings.ContainsRune("<>^vhl", char) // rather than ?
+	case noop:
+		return char != ';' // comments are skipped by the instruction pointer, rather than executed
+	default:
+		return false
+	}
+}
+
+// invalidate removes the traces passing through the cell
+func (e *TraceEngine) invalidate(cell Vector) {
+	for _, t := range e.cellTraces[cell] {
+		if e.traces[t.key] == t {
+			delete(e.traces, t.key)
+		}
+	}
+	delete(e.cellTraces, cell)
+}
+
+// invalidateAll removes every trace, eg when the bounds of funge-space grow and so change how it wraps around
+func (e *TraceEngine) invalidateAll() {
+	clear(e.traces)
+	clear(e.cellTraces)
+}
+
+// tracedSpace invalidates the traces passing through each cell that is put
+type tracedSpace struct {
+	FungeSpace
+	engine *TraceEngine
+}
+
+func (s *tracedSpace) Put(position *Vector, v rune) {
+	least, greatest := s.Bounds()
+	s.FungeSpace.Put(position, v)
+	newLeast, newGreatest := s.Bounds()
+	if *least != *newLeast || *greatest != *newGreatest {
+		s.engine.invalidateAll()
+		return
+	}
+	cell := *position
+	if torus, ok := s.FungeSpace.(*Torus); ok {
+		// puts wrap around the torus
+		cell = *NewVector2(torus.ModWidth(position.X), torus.ModHeight(position.Y))
+	}
+	s.engine.invalidate(cell)
+}
@@ -0,0 +1,437 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	bin "encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// TraceFormat the format a trace of the instructions executed by a program is written in
+type TraceFormat string
+
+const (
+	TraceFormatText   TraceFormat = "text"   // a line describing each instruction
+	TraceFormatJSONL  TraceFormat = "jsonl"  // a JSON object on each line for each instruction
+	TraceFormatBinary TraceFormat = "binary" // a compact binary encoding, starting with traceMagic
+)
+
+// traceMagic the start of a binary trace, followed by the version of its encoding
+const traceMagic = "KGFT"
+
+const traceBinaryVersion = 1
+
+// TraceRecord an instruction executed by an instruction pointer, as written to a trace
+type TraceRecord struct {
+	Tick       int // the tick the instruction was executed in, starting from 1
+	IP         int // the ID of the instruction pointer
+	X          int
+	Y          int
+	Z          int
+	Char       rune
+	DX         int // the delta of the instruction pointer after the instruction
+	DY         int
+	DZ         int
+	StringMode bool       // whether the character was pushed in string mode
+	Stack      []*big.Int // the values on top of the stack after the instruction, top first
+	Input      []byte
+	Output     []byte
+}
+
+// traceRecordJSON a TraceRecord as written to a JSON lines trace, with its character and I/O as strings
+type traceRecordJSON struct {
+	Tick       int        `json:"tick"`
+	IP         int        `json:"ip"`
+	X          int        `json:"x"`
+	Y          int        `json:"y"`
+	Z          int        `json:"z,omitempty"`
+	Char       string     `json:"char"`
+	DX         int        `json:"dx"`
+	DY         int        `json:"dy"`
+	DZ         int        `json:"dz,omitempty"`
+	StringMode bool       `json:"stringMode"`
+	Stack      []*big.Int `json:"stack"`
+	Input      string     `json:"input,omitempty"`
+	Output     string     `json:"output,omitempty"`
+}
+
+// TraceWriter writes trace records in one of the trace formats
+type TraceWriter struct {
+	w       *bufio.Writer
+	json    *json.Encoder
+	format  TraceFormat
+	started bool
+}
+
+func NewTraceWriter(w io.Writer, format TraceFormat) (*TraceWriter, error) {
+	switch format {
+	case TraceFormatText, TraceFormatJSONL, TraceFormatBinary:
+		buffered := bufio.NewWriter(w)
+		encoder := json.NewEncoder(buffered)
+		encoder.SetEscapeHTML(false) // & is an instruction, not HTML
+		return &TraceWriter{w: buffered, json: encoder, format: format}, nil
+	default:
+		return nil, errors.New("Unknown trace format " + string(format))
+	}
+}
+
+func (t *TraceWriter) Write(record *TraceRecord) error {
+	var err error
+	switch t.format {
+	case TraceFormatText:
+		_, err = t.w.WriteString(traceText(record) + "\n")
+	case TraceFormatJSONL:
+		err = t.json.Encode(traceRecordJSON{
+			Tick:       record.Tick,
+			IP:         record.IP,
+			X:          record.X,
+			Y:          record.Y,
+			Z:          record.Z,
+			Char:       string(record.Char),
+			DX:         record.DX,
+			DY:         record.DY,
+			DZ:         record.DZ,
+			StringMode: record.StringMode,
+			Stack:      record.Stack,
+			Input:      string(record.Input),
+			Output:     string(record.Output),
+		})
+	case TraceFormatBinary:
+		var b []byte
+		if !t.started {
+			b = append([]byte(traceMagic), traceBinaryVersion)
+		}
+		_, err = t.w.Write(appendTraceBinary(b, record))
+	}
+	t.started = true
+	return err
+}
+
+// Flush writes any records which have been buffered
+func (t *TraceWriter) Flush() error {
+	return t.w.Flush()
+}
+
+// traceText a line describing the record, eg 12 ip 0 (3,4) '?' -> (0,1) [7 1] in "5\n" out "2 "
+func traceText(record *TraceRecord) string {
+	var sb strings.Builder
+	stack := make([]string, len(record.Stack))
+	for i, value := range record.Stack {
+		stack[i] = value.String()
+	}
+	_, _ = fmt.Fprintf(&sb, "%d ip %d %s %q -> %s [%s]", record.Tick, record.IP,
+		NewVector3(record.X, record.Y, record.Z), record.Char, NewVector3(record.DX, record.DY, record.DZ),
+		strings.Join(stack, " "))
+	if record.StringMode {
+		sb.WriteString(" string")
+	}
+	if len(record.Input) > 0 {
+		_, _ = fmt.Fprintf(&sb, " in %q", record.Input)
+	}
+	if len(record.Output) > 0 {
+		_, _ = fmt.Fprintf(&sb, " out %q", record.Output)
+	}
+	return sb.String()
+}
+
+// appendTraceBinary appends the binary encoding of the record, which is each of its fields in order as varints, with
+// the string mode as a byte, and the stack, input and output each preceded by their length
+func appendTraceBinary(b []byte, record *TraceRecord) []byte {
+	b = bin.AppendUvarint(b, uint64(record.Tick))
+	b = bin.AppendUvarint(b, uint64(record.IP))
+	for _, v := range []int{record.X, record.Y, record.Z, int(record.Char), record.DX, record.DY, record.DZ} {
+		b = bin.AppendVarint(b, int64(v))
+	}
+	if record.StringMode {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	b = bin.AppendUvarint(b, uint64(len(record.Stack)))
+	for _, value := range record.Stack {
+		// values which fit in an int64 are a varint, and bignums are their sign and magnitude
+		if value.IsInt64() {
+			b = append(b, 0)
+			b = bin.AppendVarint(b, value.Int64())
+			continue
+		}
+		b = append(b, byte(1+max(-value.Sign(), 0)))
+		b = bin.AppendUvarint(b, uint64(len(value.Bytes())))
+		b = append(b, value.Bytes()...)
+	}
+	b = bin.AppendUvarint(b, uint64(len(record.Input)))
+	b = append(b, record.Input...)
+	b = bin.AppendUvarint(b, uint64(len(record.Output)))
+	return append(b, record.Output...)
+}
+
+// TraceRecorder runs a program like Befunge.Step, writing a record of each instruction executed to a trace. The trace
+// is flushed when the program terminates or fails
+type TraceRecorder struct {
+	*Befunge
+	writer *TraceWriter
+	depth  int // the most values on top of the stack recorded
+	tick   int
+	err    error // the first error writing the trace
+}
+
+func NewTraceRecorder(f *Befunge, writer *TraceWriter, depth int) *TraceRecorder {
+	r := &TraceRecorder{Befunge: f, writer: writer, depth: depth}
+	f.OnStep(r.record)
+	return r
+}
+
+func (r *TraceRecorder) Step() (bool, error) {
+	r.tick++
+	proceed, err := r.Befunge.Step()
+	if err == nil && r.err != nil {
+		proceed, err = false, r.err
+	}
+	if !proceed || err != nil {
+		err = errors.Join(err, r.writer.Flush())
+	}
+	return proceed, err
+}
+
+func (r *TraceRecorder) record(event StepEvent) {
+	if r.err != nil {
+		return
+	}
+	ip := event.IP
+	values := ip.Stack.Values
+	stack := make([]*big.Int, 0, min(r.depth, len(values)))
+	for i := len(values) - 1; i >= 0 && len(stack) < r.depth; i-- {
+		stack = append(stack, r.CellValue(values[i]))
+	}
+	r.err = r.writer.Write(&TraceRecord{
+		Tick:       r.tick,
+		IP:         ip.ID,
+		X:          event.Position.X,
+		Y:          event.Position.Y,
+		Z:          event.Position.Z,
+		Char:       event.Char,
+		DX:         ip.delta.X,
+		DY:         ip.delta.Y,
+		DZ:         ip.delta.Z,
+		StringMode: event.StringMode,
+		Stack:      stack,
+		Input:      event.Input,
+		Output:     event.Output,
+	})
+}
+
+// traceTextPattern matches a line of a text trace, as written by traceText
+var traceTextPattern = regexp.MustCompile(`^(\d+) ip (\d+) \((-?\d+),(-?\d+)(?:,(-?\d+))?\) ('(?:[^'\\]|\\.)+') -> ` +
+	`\((-?\d+),(-?\d+)(?:,(-?\d+))?\) \[([-\d ]*)\]( string)?(?: in ("(?:[^"\\]|\\.)*"))?(?: out ("(?:[^"\\]|\\.)*"))?$`)
+
+// ReadTrace reads the records of a trace in any of the trace formats, which is detected from its content
+func ReadTrace(r io.Reader) ([]*TraceRecord, error) {
+	reader := bufio.NewReader(r)
+	start, _ := reader.Peek(len(traceMagic))
+	if string(start) == traceMagic {
+		return readTraceBinary(reader)
+	}
+	var records []*TraceRecord
+	for line := 1; ; line++ {
+		text, err := reader.ReadString('\n')
+		if text = strings.TrimSpace(text); text != "" {
+			var record *TraceRecord
+			var parseErr error
+			if text[0] == '{' {
+				record, parseErr = parseTraceJSON(text)
+			} else {
+				record, parseErr = parseTraceText(text)
+			}
+			if parseErr != nil {
+				return nil, fmt.Errorf("invalid trace record on line %d: %w", line, parseErr)
+			}
+			records = append(records, record)
+		}
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func parseTraceJSON(text string) (*TraceRecord, error) {
+	var record traceRecordJSON
+	if err := json.Unmarshal([]byte(text), &record); err != nil {
+		return nil, err
+	}
+	char, size := utf8.DecodeRuneInString(record.Char)
+	if size == 0 || size != len(record.Char) {
+		return nil, fmt.Errorf("expected a single character, not %q", record.Char)
+	}
+	return &TraceRecord{
+		Tick:       record.Tick,
+		IP:         record.IP,
+		X:          record.X,
+		Y:          record.Y,
+		Z:          record.Z,
+		Char:       char,
+		DX:         record.DX,
+		DY:         record.DY,
+		DZ:         record.DZ,
+		StringMode: record.StringMode,
+		Stack:      record.Stack,
+		Input:      bytesOrNil(record.Input),
+		Output:     bytesOrNil(record.Output),
+	}, nil
+}
+
+func parseTraceText(text string) (*TraceRecord, error) {
+	match := traceTextPattern.FindStringSubmatch(text)
+	if match == nil {
+		return nil, errors.New("expected a record like 12 ip 0 (3,4) '?' -> (0,1) [7 1]")
+	}
+	ints := make([]int, 10)
+	for i, group := range match[1:10] {
+		if group != "" && i != 5 {
+			ints[i], _ = strconv.Atoi(group)
+		}
+	}
+	char, err := strconv.Unquote(match[6])
+	if err != nil {
+		return nil, err
+	}
+	record := &TraceRecord{
+		Tick:       ints[0],
+		IP:         ints[1],
+		X:          ints[2],
+		Y:          ints[3],
+		Z:          ints[4],
+		Char:       []rune(char)[0],
+		DX:         ints[6],
+		DY:         ints[7],
+		DZ:         ints[8],
+		StringMode: match[11] != "",
+		Stack:      []*big.Int{},
+	}
+	for _, value := range strings.Fields(match[10]) {
+		v, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid stack value %s", value)
+		}
+		record.Stack = append(record.Stack, v)
+	}
+	for i, field := range []*[]byte{&record.Input, &record.Output} {
+		if quoted := match[12+i]; quoted != "" {
+			s, err := strconv.Unquote(quoted)
+			if err != nil {
+				return nil, err
+			}
+			*field = bytesOrNil(s)
+		}
+	}
+	return record, nil
+}
+
+func readTraceBinary(reader *bufio.Reader) ([]*TraceRecord, error) {
+	header := make([]byte, len(traceMagic)+1)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	if header[len(traceMagic)] != traceBinaryVersion {
+		return nil, fmt.Errorf("unknown binary trace version %d", header[len(traceMagic)])
+	}
+	// the records are read from memory, so that the lengths in them can be checked against what remains
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	remaining := bytes.NewReader(data)
+	var records []*TraceRecord
+	for remaining.Len() > 0 {
+		record, err := readTraceRecordBinary(remaining)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trace record %d: %w", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// readTraceRecordBinary reads a record encoded by appendTraceBinary
+func readTraceRecordBinary(reader *bytes.Reader) (*TraceRecord, error) {
+	var errs []error
+	uvarint := func() int {
+		v, err := bin.ReadUvarint(reader)
+		if err == nil && v > math.MaxInt {
+			err = fmt.Errorf("value %d too big", v)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			return 0
+		}
+		return int(v)
+	}
+	varint := func() int {
+		v, err := bin.ReadVarint(reader)
+		errs = append(errs, err)
+		return int(v)
+	}
+	// length reads a count of the bytes or stack values which follow it, each of which takes at least a byte
+	length := func() int {
+		n := uvarint()
+		if n > reader.Len() {
+			errs = append(errs, fmt.Errorf("length %d longer than the remaining %d bytes", n, reader.Len()))
+			return 0
+		}
+		return n
+	}
+	readBytes := func(n int) []byte {
+		if n == 0 {
+			return nil
+		}
+		b := make([]byte, n)
+		_, err := io.ReadFull(reader, b)
+		errs = append(errs, err)
+		return b
+	}
+	readByte := func() byte {
+		b, err := reader.ReadByte()
+		errs = append(errs, err)
+		return b
+	}
+
+	record := &TraceRecord{Tick: uvarint(), IP: uvarint(), X: varint(), Y: varint(), Z: varint(), Char: rune(varint()),
+		DX: varint(), DY: varint(), DZ: varint(), StringMode: readByte() == 1, Stack: []*big.Int{}}
+	for range length() {
+		switch readByte() {
+		case 0:
+			record.Stack = append(record.Stack, big.NewInt(int64(varint())))
+		case 1:
+			record.Stack = append(record.Stack, new(big.Int).SetBytes(readBytes(length())))
+		default:
+			record.Stack = append(record.Stack, new(big.Int).Neg(new(big.Int).SetBytes(readBytes(length()))))
+		}
+	}
+	record.Input = readBytes(length())
+	record.Output = readBytes(length())
+	if err := errors.Join(errs...); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+func bytesOrNil(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	return []byte(s)
+}
@@ -0,0 +1,234 @@
+package pkg
+
+import (
+	"bytes"
+	"github.com/kagof/kagofunge/config"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestBefunge_OnStep(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	cfg := config.DefaultConfig()
+	var output strings.Builder
+	befunge := NewBefunge(&cfg, `"a",&.@`, &output, strings.NewReader("12\n"))
+	var events []StepEvent
+	befunge.OnStep(func(event StepEvent) {
+		event.IP = nil
+		events = append(events, event)
+	})
+	hasNext := true
+	for i := 0; hasNext && i < maxSteps; i++ {
+		var err error
+		// stepping with an undo records the same I/O
+		hasNext, _, err = befunge.StepWithUndo()
+		asserts.NoError(err)
+	}
+	asserts.Equal("a12", output.String())
+	asserts.Equal([]StepEvent{
+		{Position: *NewVector2(0, 0), Char: '"'},
+		{Position: *NewVector2(1, 0), Char: 'a', StringMode: true},
+		{Position: *NewVector2(2, 0), Char: '"'},
+		{Position: *NewVector2(3, 0), Char: ',', Output: []byte("a")},
+		{Position: *NewVector2(4, 0), Char: '&', Input: []byte("12\n")},
+		{Position: *NewVector2(5, 0), Char: '.', Output: []byte("12")},
+		{Position: *NewVector2(6, 0), Char: '@'},
+	}, events)
+}
+
+func TestBefunge_OnStep_discardsInput(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	cfg := config.DefaultConfig()
+	input := strings.Repeat("testing", 1000)
+	var output strings.Builder
+	befunge := NewBefunge(&cfg, "~:!#@_,", &output, strings.NewReader(input))
+	var read strings.Builder
+	befunge.OnStep(func(event StepEvent) {
+		read.Write(event.Input)
+	})
+	hasNext := true
+	for hasNext {
+		var err error
+		hasNext, err = befunge.Step()
+		asserts.NoError(err)
+		asserts.LessOrEqual(len(befunge.input.read), 4096, "consumed input should be discarded after each step")
+	}
+	asserts.Equal(input, output.String())
+	asserts.Equal(input, read.String())
+	asserts.Empty(befunge.input.read)
+}
+
+func TestTraceRecorder(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		dialect  config.Dialect
+		funge    string
+		depth    int
+		format   TraceFormat
+		expected string
+	}{
+		{"text", config.Dialect93, `123v` + "\n" + `@.&<`, 2, TraceFormatText, strings.Join([]string{
+			"1 ip 0 (0,0) '1' -> (1,0) [1]",
+			"2 ip 0 (1,0) '2' -> (1,0) [2 1]",
+			"3 ip 0 (2,0) '3' -> (1,0) [3 2]",
+			"4 ip 0 (3,0) 'v' -> (0,1) [3 2]",
+			"5 ip 0 (3,1) '<' -> (-1,0) [3 2]",
+			`6 ip 0 (2,1) '&' -> (-1,0) [7 3] in "7\n"`,
+			`7 ip 0 (1,1) '.' -> (-1,0) [3 2] out "7"`,
+			"8 ip 0 (0,1) '@' -> (-1,0) [3 2]",
+			"",
+		}, "\n")},
+		{"jsonl", config.Dialect93, `"&",@`, 4, TraceFormatJSONL, strings.Join([]string{
+			`{"tick":1,"ip":0,"x":0,"y":0,"char":"\"","dx":1,"dy":0,"stringMode":false,"stack":[]}`,
+			`{"tick":2,"ip":0,"x":1,"y":0,"char":"&","dx":1,"dy":0,"stringMode":true,"stack":[38]}`,
+			`{"tick":3,"ip":0,"x":2,"y":0,"char":"\"","dx":1,"dy":0,"stringMode":false,"stack":[38]}`,
+			`{"tick":4,"ip":0,"x":3,"y":0,"char":",","dx":1,"dy":0,"stringMode":false,"stack":[],"output":"&"}`,
+			`{"tick":5,"ip":0,"x":4,"y":0,"char":"@","dx":1,"dy":0,"stringMode":false,"stack":[]}`,
+			"",
+		}, "\n")},
+		{"concurrent", config.Dialect98, `t1.@`, 1, TraceFormatText, strings.Join([]string{
+			"1 ip 0 (0,0) 't' -> (1,0) []",
+			// the new instruction pointer goes first, west from the t and around to the @
+			"2 ip 1 (3,0) '@' -> (-1,0) []",
+			"2 ip 0 (1,0) '1' -> (1,0) [1]",
+			`3 ip 0 (2,0) '.' -> (1,0) [] out "1"`,
+			"4 ip 0 (3,0) '@' -> (1,0) []",
+			"",
+		}, "\n")},
+		{"binary", config.Dialect93, `@`, 4, TraceFormatBinary,
+			"KGFT\x01" + "\x01\x00" + "\x00\x00\x00\x80\x01\x02\x00\x00" + "\x00" + "\x00" + "\x00" + "\x00"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+
+			cfg := config.DefaultConfig()
+			cfg.Interpreter.Dialect = test.dialect
+			var trace bytes.Buffer
+			writer, err := NewTraceWriter(&trace, test.format)
+			if !asserts.NoError(err) {
+				return
+			}
+			recorder := NewTraceRecorder(NewBefunge(&cfg, test.funge, &strings.Builder{}, strings.NewReader("7\n")),
+				writer, test.depth)
+			hasNext := true
+			for i := 0; hasNext && i < maxSteps; i++ {
+				hasNext, err = recorder.Step()
+				asserts.NoError(err)
+			}
+			asserts.Equal(test.expected, trace.String())
+		})
+	}
+
+	_, err := NewTraceWriter(&bytes.Buffer{}, "xml")
+	assert.EqualError(t, err, "Unknown trace format xml")
+}
+
+func TestReadTrace(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.Interpreter.Dialect = config.Dialect98
+	cfg.Interpreter.CellWidth = config.CellWidthBignum
+	// reads a character and a number, and then prints a bignum
+	funge := `~&$` + strings.Repeat(" ", 17) + "v\n" + `@.*:*:*:*:*:*:"ffff"<`
+	var traces []string
+	var formats []TraceFormat
+	for _, format := range []TraceFormat{TraceFormatText, TraceFormatJSONL, TraceFormatBinary} {
+		var trace bytes.Buffer
+		writer, err := NewTraceWriter(&trace, format)
+		if !asserts.NoError(err) {
+			return
+		}
+		recorder := NewTraceRecorder(NewBefunge(&cfg, funge, &strings.Builder{}, strings.NewReader("ü-12\n")),
+			writer, 3)
+		hasNext := true
+		for i := 0; hasNext && i < maxSteps; i++ {
+			hasNext, err = recorder.Step()
+			asserts.NoError(err)
+		}
+		traces, formats = append(traces, trace.String()), append(formats, format)
+	}
+
+	var expected []*TraceRecord
+	for i, trace := range traces {
+		read, err := ReadTrace(strings.NewReader(trace))
+		if !asserts.NoError(err, formats[i]) {
+			continue
+		}
+		if expected == nil {
+			expected = read
+			continue
+		}
+		asserts.Equal(expected, read, "the %s trace should read the same records as the text trace", formats[i])
+	}
+	if asserts.NotEmpty(expected) {
+		asserts.Equal(&TraceRecord{Tick: 1, Char: '~', DX: 1, Stack: []*big.Int{big.NewInt('ü')}, Input: []byte("ü")},
+			expected[0])
+		asserts.Equal([]byte("-12\n"), expected[1].Input)
+		print := expected[len(expected)-2]
+		asserts.Equal('.', print.Char)
+		asserts.Equal(print.Output, []byte(new(big.Int).Exp(big.NewInt('f'), big.NewInt(64), nil).String()),
+			"the bignum is printed")
+	}
+}
+
+func TestReadTrace_invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		trace    string
+		expected string
+	}{
+		{"text", "1 ip 0 (0,0) '1'\n", "invalid trace record on line 1: expected a record like 12 ip 0 (3,4) '?' -> (0,1) [7 1]"},
+		{"jsonl", "\n{\"tick\":1,\"char\":\"ab\"}\n", "invalid trace record on line 2: expected a single character, not \"ab\""},
+		{"binary version", "KGFT\x02", "unknown binary trace version 2"},
+		{"binary truncated", "KGFT\x01\x01\x00\x00", "invalid trace record 1: unexpected EOF"},
+		{"binary tick too big", "KGFT\x01\xff\xff\xff\xff\xff\xff\xff\xff\xff\x01" + strings.Repeat("\x00", 13),
+			"invalid trace record 1: value 18446744073709551615 too big"},
+		{"binary stack too long", "KGFT\x01" + strings.Repeat("\x00", 10) + "\xff\xff\xff\xff\xff\xff\xff\xff\x7f\x00\x00",
+			"invalid trace record 1: length 9223372036854775807 longer than the remaining 2 bytes"},
+		{"binary input too long", "KGFT\x01" + strings.Repeat("\x00", 11) + "\x80\x80\x80\x80\x08\x00",
+			"invalid trace record 1: length 2147483648 longer than the remaining 1 bytes"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := ReadTrace(strings.NewReader(test.trace))
+			assert.EqualError(t, err, test.expected)
+		})
+	}
+}
+
+// FuzzReadTrace checks that reading a corrupt trace gives an error, rather than panicking
+func FuzzReadTrace(f *testing.F) {
+	cfg := config.DefaultConfig()
+	cfg.Interpreter.Dialect = config.Dialect98
+	cfg.Interpreter.CellWidth = config.CellWidthBignum
+	var trace bytes.Buffer
+	writer, _ := NewTraceWriter(&trace, TraceFormatBinary)
+	recorder := NewTraceRecorder(NewBefunge(&cfg, `~.88*:*:*:*:*01-.@`, &strings.Builder{}, strings.NewReader("a")),
+		writer, 3)
+	for hasNext, i := true, 0; hasNext && i < maxSteps; i++ {
+		hasNext, _ = recorder.Step()
+	}
+	f.Add(trace.Bytes())
+	f.Add([]byte("KGFT\x01"))
+
+	f.Fuzz(func(t *testing.T, trace []byte) {
+		_, _ = ReadTrace(bytes.NewReader(trace))
+	})
+}
@@ -0,0 +1,108 @@
+package pkg
+
+import (
+	"github.com/kagof/kagofunge/config"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// engineCases programs from TestBefunge and TestFunge98, which other ways of running programs are checked against
+// the step engine with
+var engineCases = []struct {
+	name    string
+	dialect config.Dialect
+	funge   string
+	input   string
+}{
+	{"hello_world", config.Dialect93, " >               v\n v\"Hello, World!\"<\n >:v\n ^,_@", ""},
+	{"cat", config.Dialect93, "~:!#@_,", "testing"},
+	{"factorial", config.Dialect93, "&>:1-:v v *_$.@ \n ^    _$>\\:^", "5"},
+	{"quine", config.Dialect93, "01->1# +# :# 0# g# ,# :# 5# 8# *# 4# +# -# _@", ""},
+	{"divide_by_zero", config.Dialect93, "10/.@", "3"},
+	{"g_oob", config.Dialect93, "1-g.@", ""},
+	{"p_oob", config.Dialect93, "\" \"02-0p#@ #.<", ""},
+	{"self_modifying", config.Dialect93, `2."@"10p`, ""},
+	{"hex_digits", config.Dialect98, "af*.@", ""},
+	{"store_char", config.Dialect98, "'Qs@30g,@", ""},
+	{"iterate", config.Dialect98, "3k1++.@", ""},
+	{"absolute_delta", config.Dialect98, "20x.7.. @", ""},
+	{"jump", config.Dialect98, "2j..5.@", ""},
+	{"turn_left", config.Dialect98, "v @\n  .\n>5[", ""},
+	{"compare", config.Dialect98, "521w\n   .\n   @", ""},
+	{"comment", config.Dialect98, "5;.@;.@", ""},
+	{"end_block", config.Dialect98, "1232{1}...@", ""},
+	{"storage_offset", config.Dialect98, "1{$00g,@", ""},
+	{"stack_under_stack", config.Dialect98, "1230{4u....@", ""},
+	{"put_negative", config.Dialect98, "'A01-0p01-0g,@", ""},
+	{"split", config.Dialect98, "1t3.@.", ""},
+	{"split_terminating_parent", config.Dialect98, "t@  .7<", ""},
+	{"clear_stack", config.Dialect98, "123n45...@", ""},
+	{"iterate_pop", config.Dialect98, "1234564k$..@", ""},
+	{"fingerprint", config.Dialect98, "\"AMOR\"4(MX+.\"AMOR\"4)@", ""},
+}
+
+// TestTraceEngine checks that the trace engine gives the same output as the step engine
+func TestTraceEngine(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range engineCases {
+		t.Run(string(test.dialect)+"/"+test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := assert.New(t)
+			cfg := config.DefaultConfig()
+			cfg.Interpreter.Dialect = test.dialect
+			expected, _ := runProgram(t, &cfg, test.funge, test.input)
+
+			var writer strings.Builder
+			engine := NewTraceEngine(NewBefunge(&cfg, test.funge, &writer, strings.NewReader(test.input)))
+			var hasNext = true
+			var err error
+			var i = 0
+			for hasNext && i < maxSteps {
+				hasNext, err = engine.Step()
+				asserts.NoError(err, "no error expected while executing %s", test.funge)
+				i += 1
+			}
+			asserts.Less(i, maxSteps, "exceeded %d steps executing %s", maxSteps, test.funge)
+			asserts.Equal(expected, writer.String(), "%s output not as expected", test.name)
+		})
+	}
+}
+
+func TestTraceEngine_invalidation(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+	cfg := config.DefaultConfig()
+	engine := NewTraceEngine(NewBefunge(&cfg, "1.@", &strings.Builder{}, strings.NewReader("")))
+	trace := engine.traceFrom(traceKey{position: *NewVector2(0, 0), delta: *XPos()})
+	asserts.Len(trace.ops, 2, "1 and . should be traced")
+	asserts.Equal(*NewVector2(2, 0), trace.exit.position, "the trace should end at @")
+
+	engine.Space.Put(NewVector2(5, 0), '@') // puts wrap around the torus, to the @ ending the trace
+	asserts.Contains(engine.traces, trace.key, "putting to a cell outside of the trace should not invalidate it")
+	engine.Space.Put(NewVector2(4, 0), ',')
+	asserts.NotContains(engine.traces, trace.key, "putting to a cell in the trace should invalidate it")
+}
+
+// TestTraceEngine_getReflects checks that g, which reflects on a coordinate too big for an int in Funge-98, isn't traced
+func TestTraceEngine_getReflects(t *testing.T) {
+	t.Parallel()
+	asserts := assert.New(t)
+	funge := "#@.088*:*:*:*:*g1.@"
+	cfg := config.DefaultConfig()
+	cfg.Interpreter.Dialect = config.Dialect98
+	cfg.Interpreter.CellWidth = config.CellWidthBignum
+	expected, _ := runProgram(t, &cfg, funge, "")
+	asserts.Equal("00", expected, "g should reflect on a coordinate too big for an int")
+
+	var writer strings.Builder
+	engine := NewTraceEngine(NewBefunge(&cfg, funge, &writer, strings.NewReader("")))
+	var hasNext = true
+	var err error
+	for i := 0; hasNext && i < maxSteps; i++ {
+		hasNext, err = engine.Step()
+		asserts.NoError(err, "no error expected while executing %s", funge)
+	}
+	asserts.Equal(expected, writer.String(), "trace engine output not as expected")
+}
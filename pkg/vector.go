@@ -0,0 +1,180 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	regexParenComma3, _   = regexp.Compile(`\(\d+,\d+,\d+\)`)
+	regexParenCommaSp3, _ = regexp.Compile(`\(\d+, \d+, \d+\)`)
+	regexParenSp3, _      = regexp.Compile(`\(\d+ \d+ \d+\)`)
+	regexBracComma3, _    = regexp.Compile(`\[\d+,\d+,\d+]`)
+	regexBracCommaSp3, _  = regexp.Compile(`\[\d+, \d+, \d+]`)
+	regexBracSp3, _       = regexp.Compile(`\[\d+ \d+ \d+]`)
+	regexComma3, _        = regexp.Compile(`\d+,\d+,\d+`)
+
+	regexParenComma, _   = regexp.Compile(`\(\d+,\d+\)`)
+	regexParenCommaSp, _ = regexp.Compile(`\(\d+, \d+\)`)
+	regexParenSp, _      = regexp.Compile(`\(\d+ \d+\)`)
+	regexBracComma, _    = regexp.Compile(`\[\d+,\d+]`)
+	regexBracCommaSp, _  = regexp.Compile(`\[\d+, \d+]`)
+	regexBracSp, _       = regexp.Compile(`\[\d+ \d+]`)
+	regexComma, _        = regexp.Compile(`\d+,\d+`)
+)
+
+// Vector a position or direction in funge-space. Befunge only uses X and Y, Unefunge only X, and Trefunge all three
+type Vector struct {
+	X, Y, Z int
+}
+
+// Vector2 a position or direction in Befunge's two dimensions.
+//
+// Deprecated: use Vector, which can also have a z component for Trefunge
+type Vector2 = Vector
+
+func NewVector2(x int, y int) *Vector {
+	return &Vector{X: x, Y: y}
+}
+
+func NewVector3(x int, y int, z int) *Vector {
+	return &Vector{X: x, Y: y, Z: z}
+}
+
+// String formats the vector as (x,y), or (x,y,z) if it has a z component
+func (v *Vector) String() string {
+	if v.Z != 0 {
+		return fmt.Sprintf("(%d,%d,%d)", v.X, v.Y, v.Z)
+	}
+	return fmt.Sprintf("(%d,%d)", v.X, v.Y)
+}
+
+func (v *Vector) Add(other *Vector) *Vector {
+	return NewVector3(v.X+other.X, v.Y+other.Y, v.Z+other.Z)
+}
+
+func (v *Vector) Multiply(factor int) *Vector {
+	return NewVector3(v.X*factor, v.Y*factor, v.Z*factor)
+}
+
+// TurnLeft rotates the vector 90 degrees anticlockwise, as seen with the y-axis pointing down the torus. eg (1, 0)
+// (east) becomes (0, -1) (north)
+func (v *Vector) TurnLeft() *Vector {
+	return NewVector3(v.Y, -v.X, v.Z)
+}
+
+// TurnRight rotates the vector 90 degrees clockwise, as seen with the y-axis pointing down the torus. eg (1, 0)
+// (east) becomes (0, 1) (south)
+func (v *Vector) TurnRight() *Vector {
+	return NewVector3(-v.Y, v.X, v.Z)
+}
+
+// ScaleToOne converts eg (-2, 4) to (-1, 1), and (3, 0) to (1, 0). This does not necessarily
+// convert to a unit vector of magnitude 1, rather converts each dimension to 1 if it is positive, -1 if it is negative,
+// or 0 if it is 0
+func (v *Vector) ScaleToOne() *Vector {
+	absX := abs(v.X)
+	absY := abs(v.Y)
+	absZ := abs(v.Z)
+	if (absX == 1 || absX == 0) && (absY == 1 || absY == 0) && (absZ == 1 || absZ == 0) {
+		return v
+	}
+	return NewVector3(v.X/ifZero(absX, 1), v.Y/ifZero(absY, 1), v.Z/ifZero(absZ, 1))
+}
+
+func ifZero(first int, second int) int {
+	if first == 0 {
+		return second
+	}
+	return first
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func XPos() *Vector {
+	return NewVector2(1, 0)
+}
+
+func XNeg() *Vector {
+	return NewVector2(-1, 0)
+}
+
+func YPos() *Vector {
+	return NewVector2(0, 1)
+}
+
+func YNeg() *Vector {
+	return NewVector2(0, -1)
+}
+
+func ZPos() *Vector {
+	return NewVector3(0, 0, 1)
+}
+
+func ZNeg() *Vector {
+	return NewVector3(0, 0, -1)
+}
+
+// ParseVector2 parses a 2 dimensional vector, eg (x,y).
+//
+// Deprecated: use ParseVector, which also parses 3 dimensional vectors
+func ParseVector2(str string) (*Vector2, error) {
+	return ParseVector(str)
+}
+
+// ParseVector parses a 2 or 3 dimensional vector, eg (x,y) or (x,y,z)
+func ParseVector(str string) (*Vector, error) {
+	if regexParenComma3.MatchString(str) {
+		return getVals3("(%d,%d,%d)", str)
+	} else if regexParenCommaSp3.MatchString(str) {
+		return getVals3("(%d, %d, %d)", str)
+	} else if regexParenSp3.MatchString(str) {
+		return getVals3("(%d %d %d)", str)
+	} else if regexBracComma3.MatchString(str) {
+		return getVals3("[%d,%d,%d]", str)
+	} else if regexBracCommaSp3.MatchString(str) {
+		return getVals3("[%d, %d, %d]", str)
+	} else if regexBracSp3.MatchString(str) {
+		return getVals3("[%d %d %d]", str)
+	} else if regexComma3.MatchString(str) {
+		return getVals3("%d,%d,%d", str)
+	} else if regexParenComma.MatchString(str) {
+		return getVals("(%d,%d)", str)
+	} else if regexParenCommaSp.MatchString(str) {
+		return getVals("(%d, %d)", str)
+	} else if regexParenSp.MatchString(str) {
+		return getVals("(%d %d)", str)
+	} else if regexBracComma.MatchString(str) {
+		return getVals("[%d,%d]", str)
+	} else if regexBracCommaSp.MatchString(str) {
+		return getVals("[%d, %d]", str)
+	} else if regexBracSp.MatchString(str) {
+		return getVals("[%d %d]", str)
+	} else if regexComma.MatchString(str) {
+		return getVals("%d,%d", str)
+	}
+	return nil, fmt.Errorf("invalid pointer value: %s", str)
+}
+
+func getVals(fmtStr string, str string) (*Vector, error) {
+	var x, y int
+	_, err := fmt.Sscanf(str, fmtStr, &x, &y)
+	if err != nil {
+		return nil, err
+	}
+	return NewVector2(x, y), err
+}
+
+func getVals3(fmtStr string, str string) (*Vector, error) {
+	var x, y, z int
+	_, err := fmt.Sscanf(str, fmtStr, &x, &y, &z)
+	if err != nil {
+		return nil, err
+	}
+	return NewVector3(x, y, z), err
+}
@@ -5,7 +5,7 @@ import (
 	"testing"
 )
 
-func TestVector2_ScaleToOne(t *testing.T) {
+func TestVector_ScaleToOne(t *testing.T) {
 	t.Parallel()
 	asserts := assert.New(t)
 
@@ -25,7 +25,7 @@ func TestVector2_ScaleToOne(t *testing.T) {
 	}
 
 	for _, test := range cases {
-		v := Vector2{test.inX, test.inY}
+		v := Vector{X: test.inX, Y: test.inY}
 		t.Run(v.String(), func(t *testing.T) {
 			t.Parallel()
 			result := v.ScaleToOne()
@@ -0,0 +1,7 @@
+package pkg
+
+// Version the version of kagofunge
+const Version = "0.1.0"
+
+// Handprint identifies this interpreter to Funge-98 programs via the y instruction. It is "KGFN" in ASCII.
+const Handprint = 'K'<<24 | 'G'<<16 | 'F'<<8 | 'N'